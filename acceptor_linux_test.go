@@ -0,0 +1,81 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package gnet
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestTCPKeepAliveEx(t *testing.T) {
+	events := &testTCPKeepAliveServer{done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithTCPKeepAliveEx(time.Second*30, time.Second*5, 3), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testTCPKeepAliveServer struct {
+	*EventServer
+	action bool
+	done   chan error
+}
+
+func (t *testTCPKeepAliveServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	var opts []int
+	for _, opt := range []int{unix.TCP_KEEPIDLE, unix.TCP_KEEPINTVL, unix.TCP_KEEPCNT} {
+		v, err := unix.GetsockoptInt(c.FD(), unix.IPPROTO_TCP, opt)
+		if err != nil {
+			out = []byte(err.Error())
+			return
+		}
+		opts = append(opts, v)
+	}
+	out = []byte(fmt.Sprint(opts))
+	action = Close
+	return
+}
+
+func (t *testTCPKeepAliveServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				if _, err = conn.Write([]byte("ping")); err != nil {
+					return err
+				}
+				data, err := ioutil.ReadAll(conn)
+				if err != nil {
+					return err
+				}
+				if string(data) != "[30 5 3]" {
+					return fmt.Errorf("expected TCP_KEEPIDLE, TCP_KEEPINTVL and TCP_KEEPCNT of [30 5 3], got %q", data)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
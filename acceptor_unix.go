@@ -6,7 +6,61 @@
 
 package gnet
 
-import "golang.org/x/sys/unix"
+import (
+	"time"
+
+	"github.com/panjf2000/gnet/internal/netpoll"
+	"golang.org/x/sys/unix"
+)
+
+// nextLoop returns the event-loop for the newly accepted connection.
+func (svr *server) nextLoop(fd int, sa unix.Sockaddr) (el *eventloop) {
+	if svr.opts.IncomingCPUAffinity {
+		if cpu, err := incomingCPU(fd); err == nil && cpu >= 0 {
+			idx := cpu % svr.subLoopGroup.len()
+			svr.subLoopGroup.iterate(func(i int, e *eventloop) bool {
+				if i == idx {
+					el = e
+					return false
+				}
+				return true
+			})
+			return
+		}
+	}
+	return svr.subLoopGroup.next(netpoll.SockaddrToTCPOrUnixAddr(sa))
+}
+
+// rejectConn closes the newly accepted connection as the server has reached the limit of MaxConnections.
+func (svr *server) rejectConn(fd int, sa unix.Sockaddr) {
+	sniffErrorAndLog(svr.logger, unix.Close(fd))
+	if svr.rejectionHandler != nil {
+		svr.rejectionHandler.OnConnectionRejected(netpoll.SockaddrToTCPOrUnixAddr(sa))
+	}
+}
+
+// setUpConnSocket applies Options.ConnSocketOpt to the accepted socket, which is closed if it fails.
+func (svr *server) setUpConnSocket(fd int) bool {
+	if svr.opts.ConnSocketOpt == nil {
+		return true
+	}
+	if err := svr.opts.ConnSocketOpt(fd); err != nil {
+		svr.logger.Errorf("failed to set up socket options of fd:%d, error:%v\n", fd, err)
+		sniffErrorAndLog(svr.logger, unix.Close(fd))
+		svr.releaseConnSlot()
+		return false
+	}
+	return true
+}
+
+// setKeepAlive sets up the keepalive of the accepted TCP socket with the options.
+func (svr *server) setKeepAlive(fd int) error {
+	idle, interval := svr.opts.TCPKeepAlive, svr.opts.TCPKeepAliveInterval
+	if interval <= 0 {
+		interval = idle
+	}
+	return netpoll.SetKeepAliveEx(fd, int(idle/time.Second), int(interval/time.Second), svr.opts.TCPKeepAliveCount)
+}
 
 func (svr *server) acceptNewConnection(fd int) error {
 	nfd, sa, err := unix.Accept(fd)
@@ -16,13 +70,26 @@ func (svr *server) acceptNewConnection(fd int) error {
 		}
 		return err
 	}
+	if !svr.acquireConnSlot() {
+		svr.rejectConn(nfd, sa)
+		return nil
+	}
 	if err := unix.SetNonblock(nfd, true); err != nil {
+		sniffErrorAndLog(svr.logger, unix.Close(nfd))
+		svr.releaseConnSlot()
 		return err
 	}
-	el := svr.subLoopGroup.next(nfd)
-	c := newTCPConn(nfd, el, sa)
+	if !svr.setUpConnSocket(nfd) {
+		return nil
+	}
+	svr.loopsLock.RLock()
+	defer svr.loopsLock.RUnlock()
+	el := svr.nextLoop(nfd, sa)
+	c := newTCPConn(nfd, el, sa, svr.listener(fd).lnaddr)
 	_ = el.poller.Trigger(func() (err error) {
 		if err = el.poller.AddRead(nfd); err != nil {
+			sniffErrorAndLog(svr.logger, unix.Close(nfd))
+			svr.releaseConnSlot()
 			return
 		}
 		el.connections[nfd] = c
@@ -8,29 +8,28 @@
 package gnet
 
 import (
-	"hash/crc32"
+	"crypto/tls"
+	"io"
+	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/panjf2000/gnet/pool/bytebuffer"
 )
 
-// hashCode hashes a string to a unique hashcode.
-func hashCode(s string) int {
-	v := int(crc32.ChecksumIEEE([]byte(s)))
-	if v >= 0 {
-		return v
-	}
-	return -v
-}
-
-func (svr *server) listenerRun() {
+func (svr *server) listenerRun(ln *listener) {
 	var err error
-	defer func() { svr.signalShutdown(err) }()
-	var packet [0x10000]byte
+	defer func() {
+		// The listener is closed on purpose during graceful shutdown, which will signal shutdown by itself.
+		if atomic.LoadInt32(&svr.inShutdown) == 0 {
+			svr.signalShutdown(err)
+		}
+	}()
+	var packet [defaultReadBufferCap]byte
 	for {
-		if svr.ln.pconn != nil {
+		if ln.pconn != nil {
 			// Read data from UDP socket.
-			n, addr, e := svr.ln.pconn.ReadFrom(packet[:])
+			n, addr, e := ln.pconn.ReadFrom(packet[:])
 			if e != nil {
 				err = e
 				return
@@ -38,32 +37,143 @@ func (svr *server) listenerRun() {
 			buf := bytebuffer.Get()
 			_, _ = buf.Write(packet[:n])
 
-			el := svr.subLoopGroup.next(hashCode(addr.String()))
-			el.ch <- &udpIn{newUDPConn(el, svr.ln.lnaddr, addr, buf)}
+			if svr.opts.UDPConnected {
+				c := svr.connectedUDPConn(ln, addr)
+				c.loop.ch <- &connectedUDPIn{c, buf}
+				continue
+			}
+			el := svr.subLoopGroup.next(addr)
+			el.ch <- &udpIn{newUDPConn(el, ln.pconn, ln.lnaddr, addr, buf)}
 		} else {
 			// Accept TCP socket.
-			conn, e := svr.ln.ln.Accept()
+			conn, e := ln.ln.Accept()
 			if e != nil {
 				err = e
 				return
 			}
-			el := svr.subLoopGroup.next(hashCode(conn.RemoteAddr().String()))
-			c := newTCPConn(conn, el)
-			el.ch <- c
+			if !svr.acquireConnSlot() {
+				sniffErrorAndLog(svr.logger, conn.Close())
+				if svr.rejectionHandler != nil {
+					svr.rejectionHandler.OnConnectionRejected(conn.RemoteAddr())
+				}
+				continue
+			}
+			el := svr.subLoopGroup.next(conn.RemoteAddr())
+			c := newTCPConn(conn, el, ln.lnaddr)
 			go func() {
-				var packet [0x10000]byte
-				for {
-					n, err := c.conn.Read(packet[:])
+				// Connections in handshake are not swept yet, so bound the handshake by IdleTimeout.
+				handshake := svr.opts.ProxyProtocol || svr.opts.TLSConfig != nil
+				if handshake && svr.opts.IdleTimeout > 0 {
+					_ = conn.SetDeadline(time.Now().Add(svr.opts.IdleTimeout))
+				}
+				var rw net.Conn = conn
+				if svr.opts.ProxyProtocol {
+					addr, rest, err := readProxyHeader(conn)
 					if err != nil {
-						_ = c.conn.SetReadDeadline(time.Time{})
-						el.ch <- &stderr{c, err}
+						el.ch <- func() error {
+							return el.loopHandshakeError(c, err)
+						}
 						return
 					}
-					buf := bytebuffer.Get()
-					_, _ = buf.Write(packet[:n])
-					el.ch <- &tcpIn{c, buf}
+					c.remoteAddr = addr
+					rw = &prefixedConn{conn, rest}
 				}
+				var r io.Reader = rw
+				if svr.opts.TLSConfig != nil {
+					c.tlsConn = tls.Server(rw, svr.opts.TLSConfig)
+					r = c.tlsConn
+					if err := c.tlsConn.Handshake(); err != nil {
+						el.ch <- func() error {
+							return el.loopHandshakeError(c, err)
+						}
+						return
+					}
+				}
+				if handshake {
+					_ = conn.SetDeadline(time.Time{})
+				}
+				el.ch <- c
+				svr.readConn(el, c, r)
 			}()
 		}
 	}
 }
+
+// readConn reads data from the connection by r and sends it to the event-loop until reading fails.
+func (svr *server) readConn(el *eventloop, c *stdConn, r io.Reader) {
+	packet := make([]byte, svr.readBufferCap())
+	for {
+		n, err := r.Read(packet)
+		if err != nil {
+			_ = c.conn.SetReadDeadline(time.Time{})
+			if atomic.LoadInt32(&c.done) == 3 {
+				// Detached, the data read so far has been queued before.
+				el.ch <- func() error {
+					return el.loopDetached(c)
+				}
+				return
+			}
+			el.ch <- &stderr{c, err}
+			return
+		}
+		buf := bytebuffer.Get()
+		_, _ = buf.Write(packet[:n])
+		el.ch <- &tcpIn{c, buf}
+		// Stop reading until the connection gets back under its rate limit, see Options.ConnRateLimit.
+		if c.limiter != nil {
+			if d := c.limiter.take(n, time.Now()); d > 0 {
+				time.Sleep(d)
+			}
+		}
+	}
+}
+
+// readProxyHeader reads the PROXY protocol header from the beginning of conn, it returns the client address
+// carried by the header and the data read after it.
+func readProxyHeader(conn net.Conn) (addr net.Addr, rest []byte, err error) {
+	buf := make([]byte, 0, 256)
+	for {
+		if len(buf) == cap(buf) {
+			buf = append(buf, 0)[:len(buf)]
+		}
+		n, e := conn.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		addr, n, err = parseProxyHeader(buf)
+		if err != ErrIncompletePacket {
+			return addr, buf[n:], err
+		}
+		if e != nil {
+			return nil, nil, e
+		}
+	}
+}
+
+// prefixedConn is a net.Conn whose reads return the prefix before the data read from the connection.
+type prefixedConn struct {
+	net.Conn
+	prefix []byte
+}
+
+func (c *prefixedConn) Read(p []byte) (int, error) {
+	if len(c.prefix) > 0 {
+		n := copy(p, c.prefix)
+		c.prefix = c.prefix[n:]
+		return n, nil
+	}
+	return c.Conn.Read(p)
+}
+
+// connectedUDPConn returns the connection of the remote peer of UDP listener, creating one if there is none.
+func (svr *server) connectedUDPConn(ln *listener, addr net.Addr) *stdConn {
+	key := udpConnKey{ln.pconn, addr.String()}
+	if v, ok := svr.udpConns.Load(key); ok {
+		return v.(*stdConn)
+	}
+	el := svr.subLoopGroup.next(addr)
+	c := newUDPConn(el, ln.pconn, ln.lnaddr, addr, nil)
+	c.connected = true
+	c.codec = el.codec
+	c.remoteAddrStr = key.addr
+	svr.udpConns.Store(key, c)
+	return c
+}
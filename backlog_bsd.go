@@ -0,0 +1,37 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build darwin netbsd freebsd openbsd dragonfly
+
+package gnet
+
+import (
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxListenerBacklog returns the maximum backlog of listen(2), which is kern.ipc.somaxconn or the like.
+func maxListenerBacklog() int {
+	var (
+		n   uint32
+		err error
+	)
+	switch runtime.GOOS {
+	case "darwin", "dragonfly":
+		n, err = unix.SysctlUint32("kern.ipc.somaxconn")
+	case "freebsd":
+		n, err = unix.SysctlUint32("kern.ipc.soacceptqueue")
+	case "openbsd":
+		n, err = unix.SysctlUint32("kern.somaxconn")
+	}
+	if n == 0 || err != nil {
+		return unix.SOMAXCONN
+	}
+	// The backlog is stored in a uint16 by the kernel.
+	if n > 1<<16-1 {
+		n = 1<<16 - 1
+	}
+	return int(n)
+}
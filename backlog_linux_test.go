@@ -0,0 +1,36 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package gnet
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestAcceptBacklog(t *testing.T) {
+	for _, tc := range []struct {
+		backlog, expected int
+	}{
+		{16, 16},
+		{1 << 30, maxListenerBacklog()},
+	} {
+		ln, err := initListener("tcp://127.0.0.1:0", &Options{AcceptBacklog: tc.backlog})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The backlog of a listening socket is reported as the sacked segments of TCP_INFO.
+		info, err := unix.GetsockoptTCPInfo(ln.fd, unix.IPPROTO_TCP, unix.TCP_INFO)
+		ln.close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int(info.Sacked) != tc.expected {
+			t.Fatalf("expected backlog %d for %d, got %d", tc.expected, tc.backlog, info.Sacked)
+		}
+	}
+}
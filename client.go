@@ -0,0 +1,57 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+// Client dials connections to remote servers and serves them by its own event-loops with the same
+// OnOpened/React/OnClosed lifecycle and codec as the connections accepted by Serve, data is sent
+// to the servers by Conn.AsyncWrite.
+//
+// Server-side options, e.g. TLSConfig and ProxyProtocol, don't apply to the connections of Client,
+// and OnInitComplete isn't fired.
+type Client struct {
+	svr     *server
+	stopped chan struct{}
+}
+
+// NewClient creates a client with the event-loops started, which handle the events of the dialed
+// connections by eventHandler.
+func NewClient(eventHandler EventHandler, opts ...Option) (*Client, error) {
+	options := loadOptions(opts...)
+	options.TLSConfig = nil
+	options.ProxyProtocol = false
+	svr, err := newServer(eventHandler, nil, options)
+	if err != nil {
+		return nil, err
+	}
+	if err = svr.startClient(numEventLoops(options)); err != nil {
+		return nil, err
+	}
+	cli := &Client{svr: svr, stopped: make(chan struct{})}
+	go func() {
+		svr.stop()
+		close(cli.stopped)
+	}()
+	return cli, nil
+}
+
+// Dial connects to the address, which is formatted as the one of Serve with the "tcp" network
+// scheme assumed when one is not specified, and hands the connection over to an event-loop chosen
+// by the load-balancer. It returns once OnOpened has fired for the connection.
+func (cli *Client) Dial(addr string) (Conn, error) {
+	network, address := parseAddr(addr)
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+	default:
+		return nil, ErrProtocolNotSupported
+	}
+	return cli.svr.dial(network, address)
+}
+
+// Stop closes all the connections of client and stops its event-loops, OnClosed fires for each
+// of the connections.
+func (cli *Client) Stop() {
+	cli.svr.signalStop()
+	<-cli.stopped
+}
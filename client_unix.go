@@ -0,0 +1,110 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux darwin netbsd freebsd openbsd dragonfly
+
+package gnet
+
+import (
+	"net"
+	"sync/atomic"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// startClient starts the event-loops of the server of Client, which polls no listeners.
+func (svr *server) startClient(numEventLoop int) error {
+	if err := svr.activateLoops(numEventLoop); err != nil {
+		svr.closeLoops()
+		return err
+	}
+	if svr.sweepsIdleConns() {
+		go svr.sweepIdleConns()
+	}
+	if svr.opts.ReadTimeout > 0 && svr.timeoutHandler != nil {
+		go svr.checkReadTimeouts()
+	}
+	return nil
+}
+
+// signalStop signals the server of Client to stop.
+func (svr *server) signalStop() {
+	svr.signalShutdown()
+}
+
+// dial connects to the address and registers the connection with an event-loop.
+func (svr *server) dial(network, address string) (Conn, error) {
+	if atomic.LoadInt32(&svr.down) == 1 {
+		return nil, ErrServerShutdown
+	}
+	nc, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	// The fd of nc is duplicated to be polled by the event-loop, nc itself isn't needed any more.
+	var fd int
+	rc, err := nc.(syscall.Conn).SyscallConn()
+	if err == nil {
+		var dupErr error
+		if err = rc.Control(func(s uintptr) {
+			fd, dupErr = unix.Dup(int(s))
+		}); err == nil {
+			err = dupErr
+		}
+	}
+	localAddr := nc.LocalAddr()
+	_ = nc.Close()
+	if err != nil {
+		return nil, err
+	}
+	sa, err := unix.Getpeername(fd)
+	if err == nil {
+		err = unix.SetNonblock(fd, true)
+	}
+	if err == nil && svr.opts.ConnSocketOpt != nil {
+		err = svr.opts.ConnSocketOpt(fd)
+	}
+	if err != nil {
+		sniffErrorAndLog(svr.logger, unix.Close(fd))
+		return nil, err
+	}
+	if !svr.acquireConnSlot() {
+		sniffErrorAndLog(svr.logger, unix.Close(fd))
+		return nil, ErrTooManyConnections
+	}
+
+	svr.loopsLock.RLock()
+	el := svr.nextLoop(fd, sa)
+	c := newTCPConn(fd, el, sa, localAddr)
+	opened := make(chan error, 1)
+	err = el.poller.Trigger(func() error {
+		if err := el.poller.AddRead(fd); err != nil {
+			sniffErrorAndLog(svr.logger, unix.Close(fd))
+			svr.releaseConnSlot()
+			opened <- err
+			return nil
+		}
+		el.connections[fd] = c
+		el.plusConnCount()
+		err := el.loopOpen(c)
+		opened <- nil
+		return err
+	})
+	svr.loopsLock.RUnlock()
+	if err != nil {
+		sniffErrorAndLog(svr.logger, unix.Close(fd))
+		svr.releaseConnSlot()
+		return nil, err
+	}
+	select {
+	case err = <-opened:
+	case <-svr.sweeperDone:
+		return nil, ErrServerShutdown
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
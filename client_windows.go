@@ -0,0 +1,59 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build windows
+
+package gnet
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// startClient starts the event-loops of the server of Client, which runs no listeners.
+func (svr *server) startClient(numEventLoop int) error {
+	svr.startLoops(numEventLoop)
+	if svr.sweepsIdleConns() {
+		go svr.sweepIdleConns()
+	}
+	if svr.opts.ReadTimeout > 0 && svr.timeoutHandler != nil {
+		go svr.checkReadTimeouts()
+	}
+	return nil
+}
+
+// signalStop signals the server of Client to stop.
+func (svr *server) signalStop() {
+	svr.signalShutdown(nil)
+}
+
+// dial connects to the address and hands the connection over to an event-loop.
+func (svr *server) dial(network, address string) (Conn, error) {
+	if atomic.LoadInt32(&svr.down) == 1 {
+		return nil, ErrServerShutdown
+	}
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if !svr.acquireConnSlot() {
+		_ = conn.Close()
+		return nil, ErrTooManyConnections
+	}
+	el := svr.subLoopGroup.next(conn.RemoteAddr())
+	c := newTCPConn(conn, el, conn.LocalAddr())
+	opened := make(chan struct{})
+	el.ch <- func() error {
+		err := el.loopAccept(c)
+		close(opened)
+		return err
+	}
+	select {
+	case <-opened:
+	case <-svr.sweeperDone:
+		return nil, ErrServerShutdown
+	}
+	go svr.readConn(el, c, conn)
+	return c, nil
+}
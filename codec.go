@@ -23,6 +23,37 @@ type (
 		Decode(c Conn) ([]byte, error)
 	}
 
+	// ZeroCopyCodec is implemented by codecs that can decode frames aliasing the inbound buffer of connection
+	// rather than copying them out of it, the event-loop prefers DecodeZeroCopy to Decode for such codecs.
+	// The built-in codecs copy frames by default, use ZeroCopyLengthFieldBasedFrameCodec or
+	// ZeroCopyStreamingLengthFieldBasedFrameCodec to opt in.
+	// The inbound bytes of a frame are held until EventHandler.React returns, after which they are shifted and
+	// the frame is overwritten by the subsequent data, so the frame must not be retained or used past the return
+	// of React, copy it if needed, see Options.ZeroCopyDebug for catching such misuses.
+	ZeroCopyCodec interface {
+		ICodec
+		// DecodeZeroCopy decodes a frame without consuming its inbound bytes, which are held by the token.
+		DecodeZeroCopy(c Conn) ([]byte, FrameToken, error)
+	}
+
+	// FrameToken holds the inbound bytes of a frame decoded by ZeroCopyCodec, which are shifted by the event-loop
+	// with Conn.ShiftN once the frame has been handled.
+	FrameToken struct {
+		n int
+	}
+
+	// connStateCodec is implemented by codecs that keep per-connection state, which will be released
+	// by the event-loop once the connection is closed.
+	connStateCodec interface {
+		releaseConn(c Conn)
+	}
+
+	// partialFrameCodec is implemented by codecs that keep a frame of connection partially decoded across
+	// calls of Decode, the bytes of which can't be taken over by another codec until the frame is complete.
+	partialFrameCodec interface {
+		hasPartialFrame(c Conn) bool
+	}
+
 	// BuiltInFrameCodec is the built-in codec which will be assigned to gnet server when customized codec is not set up.
 	BuiltInFrameCodec struct {
 	}
@@ -36,6 +67,12 @@ type (
 		delimiter byte
 	}
 
+	// MultiDelimiterBasedFrameCodec encodes/decodes frames separated by a specific multi-byte delimiter
+	// into/from TCP stream.
+	MultiDelimiterBasedFrameCodec struct {
+		delimiter []byte
+	}
+
 	// FixedLengthFrameCodec encodes/decodes fixed-length-separated frames into/from TCP stream.
 	FixedLengthFrameCodec struct {
 		frameLength int
@@ -50,6 +87,21 @@ type (
 	}
 )
 
+// releaseCodecState releases the per-connection state kept by the given codec if there is any.
+func releaseCodecState(codec ICodec, c Conn) {
+	if cc, ok := codec.(connStateCodec); ok {
+		cc.releaseConn(c)
+	}
+}
+
+// hasPartialFrame reports whether the given codec is in the middle of decoding a frame of the connection.
+func hasPartialFrame(codec ICodec, c Conn) bool {
+	if cc, ok := codec.(partialFrameCodec); ok {
+		return cc.hasPartialFrame(c)
+	}
+	return false
+}
+
 // Encode ...
 func (cc *BuiltInFrameCodec) Encode(c Conn, buf []byte) ([]byte, error) {
 	return buf, nil
@@ -72,7 +124,7 @@ func (cc *LineBasedFrameCodec) Decode(c Conn) ([]byte, error) {
 	buf := c.Read()
 	idx := bytes.IndexByte(buf, CRLFByte)
 	if idx == -1 {
-		return nil, ErrCRLFNotFound
+		return nil, ErrIncompletePacket
 	}
 	c.ShiftN(idx + 1)
 	return buf[:idx], nil
@@ -93,12 +145,33 @@ func (cc *DelimiterBasedFrameCodec) Decode(c Conn) ([]byte, error) {
 	buf := c.Read()
 	idx := bytes.IndexByte(buf, cc.delimiter)
 	if idx == -1 {
-		return nil, ErrDelimiterNotFound
+		return nil, ErrIncompletePacket
 	}
 	c.ShiftN(idx + 1)
 	return buf[:idx], nil
 }
 
+// NewMultiDelimiterBasedFrameCodec instantiates and returns a codec with a specific multi-byte delimiter.
+func NewMultiDelimiterBasedFrameCodec(delimiter []byte) *MultiDelimiterBasedFrameCodec {
+	return &MultiDelimiterBasedFrameCodec{delimiter}
+}
+
+// Encode ...
+func (cc *MultiDelimiterBasedFrameCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	return append(buf, cc.delimiter...), nil
+}
+
+// Decode ...
+func (cc *MultiDelimiterBasedFrameCodec) Decode(c Conn) ([]byte, error) {
+	buf := c.Read()
+	idx := bytes.Index(buf, cc.delimiter)
+	if idx == -1 {
+		return nil, ErrIncompletePacket
+	}
+	c.ShiftN(idx + len(cc.delimiter))
+	return buf[:idx], nil
+}
+
 // NewFixedLengthFrameCodec instantiates and returns a codec with fixed length.
 func NewFixedLengthFrameCodec(frameLength int) *FixedLengthFrameCodec {
 	return &FixedLengthFrameCodec{frameLength}
@@ -114,9 +187,15 @@ func (cc *FixedLengthFrameCodec) Encode(c Conn, buf []byte) ([]byte, error) {
 
 // Decode ...
 func (cc *FixedLengthFrameCodec) Decode(c Conn) ([]byte, error) {
-	size, buf := c.ReadN(cc.frameLength)
-	if size == 0 {
-		return nil, ErrUnexpectedEOF
+	return readFixedLength(c, cc.frameLength)
+}
+
+// readFixedLength reads a frame of n bytes, a partial frame is left in buffers with ErrIncompletePacket returned
+// until the rest of it arrives.
+func readFixedLength(c Conn, n int) ([]byte, error) {
+	size, buf := c.ReadN(n)
+	if size == 0 || size < n {
+		return nil, ErrIncompletePacket
 	}
 	c.ShiftN(size)
 	return buf, nil
@@ -129,11 +208,23 @@ func NewLengthFieldBasedFrameCodec(ec EncoderConfig, dc DecoderConfig) *LengthFi
 	return &LengthFieldBasedFrameCodec{encoderConfig: ec, decoderConfig: dc}
 }
 
+// ZeroCopyLengthFieldBasedFrameCodec is a LengthFieldBasedFrameCodec implementing ZeroCopyCodec, the frames passed
+// to EventHandler.React alias the inbound buffer and are only valid until React returns.
+type ZeroCopyLengthFieldBasedFrameCodec struct {
+	LengthFieldBasedFrameCodec
+}
+
+// NewZeroCopyLengthFieldBasedFrameCodec instantiates and returns a codec based on the length field,
+// which decodes frames without copying them, see ZeroCopyCodec.
+func NewZeroCopyLengthFieldBasedFrameCodec(ec EncoderConfig, dc DecoderConfig) *ZeroCopyLengthFieldBasedFrameCodec {
+	return &ZeroCopyLengthFieldBasedFrameCodec{LengthFieldBasedFrameCodec{encoderConfig: ec, decoderConfig: dc}}
+}
+
 // EncoderConfig config for encoder.
 type EncoderConfig struct {
 	// ByteOrder is the ByteOrder of the length field.
 	ByteOrder binary.ByteOrder
-	// LengthFieldLength is the length of the length field.
+	// LengthFieldLength is the length of the length field, from 1 to 8 bytes.
 	LengthFieldLength int
 	// LengthAdjustment is the compensation value to add to the value of the length field
 	LengthAdjustment int
@@ -148,16 +239,29 @@ type DecoderConfig struct {
 	ByteOrder binary.ByteOrder
 	// LengthFieldOffset is the offset of the length field
 	LengthFieldOffset int
-	// LengthFieldLength is the length of the length field
+	// LengthFieldLength is the length of the length field, from 1 to 8 bytes
 	LengthFieldLength int
 	// LengthAdjustment is the compensation value to add to the value of the length field
 	LengthAdjustment int
 	// InitialBytesToStrip is the number of first bytes to strip out from the decoded frame
 	InitialBytesToStrip int
+	// MaxFrameLength is the maximum length of the message, ErrFrameTooLarge will be returned
+	// if the length of message exceeds it, zero value means no limit
+	MaxFrameLength int
 }
 
 // Encode ...
 func (cc *LengthFieldBasedFrameCodec) Encode(c Conn, buf []byte) (out []byte, err error) {
+	if out, err = cc.EncodeHeader(buf); err != nil {
+		return nil, err
+	}
+	out = append(out, buf...)
+	return
+}
+
+// EncodeHeader encodes the length field of the frame of buf without the payload, which can be written along with
+// the payload by Conn.Writev rather than copying the payload behind the header like Encode.
+func (cc *LengthFieldBasedFrameCodec) EncodeHeader(buf []byte) (out []byte, err error) {
 	length := len(buf) + cc.encoderConfig.LengthAdjustment
 	if cc.encoderConfig.LengthIncludesLengthFieldLength {
 		length += cc.encoderConfig.LengthFieldLength
@@ -190,11 +294,15 @@ func (cc *LengthFieldBasedFrameCodec) Encode(c Conn, buf []byte) (out []byte, er
 	case 8:
 		out = make([]byte, 8)
 		cc.encoderConfig.ByteOrder.PutUint64(out, uint64(length))
+	case 5, 6, 7:
+		n := cc.encoderConfig.LengthFieldLength
+		if uint64(length) >= 1<<(8*uint(n)) {
+			return nil, fmt.Errorf("length does not fit into %d bytes: %d", n, length)
+		}
+		out = writeUintN(cc.encoderConfig.ByteOrder, uint64(length), n)
 	default:
 		return nil, ErrUnsupportedLength
 	}
-
-	out = append(out, buf...)
 	return
 }
 
@@ -213,16 +321,30 @@ func (in *innerBuffer) readN(n int) (buf []byte, err error) {
 
 // Decode ...
 func (cc *LengthFieldBasedFrameCodec) Decode(c Conn) ([]byte, error) {
+	frame, err := cc.peekFrame(c)
+	if err != nil {
+		return nil, err
+	}
+	fullMessage := make([]byte, len(frame))
+	copy(fullMessage, frame)
+	c.ShiftN(len(fullMessage))
+	return fullMessage[cc.decoderConfig.InitialBytesToStrip:], nil
+}
+
+// peekFrame returns the whole frame at the head of inbound data, including the header and the length field,
+// without consuming it.
+func (cc *LengthFieldBasedFrameCodec) peekFrame(c Conn) ([]byte, error) {
 	var (
 		in     innerBuffer
 		header []byte
 		err    error
 	)
-	in = c.Read()
+	buf := c.Read()
+	in = buf
 	if cc.decoderConfig.LengthFieldOffset > 0 { //discard header(offset)
 		header, err = in.readN(cc.decoderConfig.LengthFieldOffset)
 		if err != nil {
-			return nil, ErrUnexpectedEOF
+			return nil, ErrIncompletePacket
 		}
 	}
 
@@ -232,18 +354,45 @@ func (cc *LengthFieldBasedFrameCodec) Decode(c Conn) ([]byte, error) {
 	}
 
 	// real message length
-	msgLength := int(frameLength) + cc.decoderConfig.LengthAdjustment
-	msg, err := in.readN(msgLength)
+	msgLength, err := cc.adjustFrameLength(frameLength)
 	if err != nil {
-		return nil, ErrUnexpectedEOF
+		return nil, err
+	}
+	if _, err = in.readN(msgLength); err != nil {
+		return nil, ErrIncompletePacket
 	}
+	frame := buf[:len(header)+len(lenBuf)+msgLength]
+	if strip := cc.decoderConfig.InitialBytesToStrip; strip < 0 || strip > len(frame) {
+		return nil, fmt.Errorf("%w: %d bytes to strip from %d bytes", ErrInvalidStripLength, strip, len(frame))
+	}
+	return frame, nil
+}
 
-	fullMessage := make([]byte, len(header)+len(lenBuf)+msgLength)
-	copy(fullMessage, header)
-	copy(fullMessage[len(header):], lenBuf)
-	copy(fullMessage[len(header)+len(lenBuf):], msg)
-	c.ShiftN(len(fullMessage))
-	return fullMessage[cc.decoderConfig.InitialBytesToStrip:], nil
+// DecodeZeroCopy decodes a frame aliasing the inbound buffer, see ZeroCopyCodec.
+func (cc *ZeroCopyLengthFieldBasedFrameCodec) DecodeZeroCopy(c Conn) ([]byte, FrameToken, error) {
+	frame, err := cc.peekFrame(c)
+	if err != nil {
+		return nil, FrameToken{}, err
+	}
+	return frame[cc.decoderConfig.InitialBytesToStrip:], NewFrameToken(len(frame)), nil
+}
+
+// adjustFrameLength returns the length of the message following the length field, which is checked against
+// DecoderConfig.MaxFrameLength before being converted to int, so that a huge length field never wraps around.
+func (cc *LengthFieldBasedFrameCodec) adjustFrameLength(frameLength uint64) (int, error) {
+	const maxInt = int(^uint(0) >> 1)
+	adjustment := cc.decoderConfig.LengthAdjustment
+	if frameLength > uint64(maxInt) || adjustment > 0 && int(frameLength) > maxInt-adjustment {
+		return 0, fmt.Errorf("%w: %d", ErrFrameTooLarge, frameLength)
+	}
+	msgLength := int(frameLength) + adjustment
+	if maxLength := cc.decoderConfig.MaxFrameLength; maxLength > 0 && msgLength > maxLength {
+		return 0, fmt.Errorf("%w: %d", ErrFrameTooLarge, msgLength)
+	}
+	if msgLength < 0 {
+		return 0, ErrTooLessLength
+	}
+	return msgLength, nil
 }
 
 func (cc *LengthFieldBasedFrameCodec) getUnadjustedFrameLength(in *innerBuffer) ([]byte, uint64, error) {
@@ -251,33 +400,39 @@ func (cc *LengthFieldBasedFrameCodec) getUnadjustedFrameLength(in *innerBuffer)
 	case 1:
 		b, err := in.readN(1)
 		if err != nil {
-			return nil, 0, ErrUnexpectedEOF
+			return nil, 0, ErrIncompletePacket
 		}
 		return b, uint64(b[0]), nil
 	case 2:
 		lenBuf, err := in.readN(2)
 		if err != nil {
-			return nil, 0, ErrUnexpectedEOF
+			return nil, 0, ErrIncompletePacket
 		}
 		return lenBuf, uint64(cc.decoderConfig.ByteOrder.Uint16(lenBuf)), nil
 	case 3:
 		lenBuf, err := in.readN(3)
 		if err != nil {
-			return nil, 0, ErrUnexpectedEOF
+			return nil, 0, ErrIncompletePacket
 		}
 		return lenBuf, readUint24(cc.decoderConfig.ByteOrder, lenBuf), nil
 	case 4:
 		lenBuf, err := in.readN(4)
 		if err != nil {
-			return nil, 0, ErrUnexpectedEOF
+			return nil, 0, ErrIncompletePacket
 		}
 		return lenBuf, uint64(cc.decoderConfig.ByteOrder.Uint32(lenBuf)), nil
 	case 8:
 		lenBuf, err := in.readN(8)
 		if err != nil {
-			return nil, 0, ErrUnexpectedEOF
+			return nil, 0, ErrIncompletePacket
 		}
 		return lenBuf, cc.decoderConfig.ByteOrder.Uint64(lenBuf), nil
+	case 5, 6, 7:
+		lenBuf, err := in.readN(cc.decoderConfig.LengthFieldLength)
+		if err != nil {
+			return nil, 0, ErrIncompletePacket
+		}
+		return lenBuf, readUintN(cc.decoderConfig.ByteOrder, lenBuf), nil
 	default:
 		return nil, 0, ErrUnsupportedLength
 	}
@@ -291,6 +446,33 @@ func readUint24(byteOrder binary.ByteOrder, b []byte) uint64 {
 	return uint64(b[2]) | uint64(b[1])<<8 | uint64(b[0])<<16
 }
 
+// readUintN assembles the integer of the length field in any width up to 8 bytes byte by byte.
+func readUintN(byteOrder binary.ByteOrder, b []byte) (v uint64) {
+	if byteOrder == binary.LittleEndian {
+		for i := len(b) - 1; i >= 0; i-- {
+			v = v<<8 | uint64(b[i])
+		}
+		return
+	}
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return
+}
+
+// writeUintN puts the integer of the length field in n bytes, n is up to 8.
+func writeUintN(byteOrder binary.ByteOrder, v uint64, n int) []byte {
+	b := make([]byte, n)
+	for i := 0; i < n; i++ {
+		if byteOrder == binary.LittleEndian {
+			b[i] = byte(v >> (8 * uint(i)))
+		} else {
+			b[n-1-i] = byte(v >> (8 * uint(i)))
+		}
+	}
+	return b
+}
+
 func writeUint24(byteOrder binary.ByteOrder, v int) []byte {
 	b := make([]byte, 3)
 	if byteOrder == binary.LittleEndian {
@@ -304,3 +486,19 @@ func writeUint24(byteOrder binary.ByteOrder, v int) []byte {
 	}
 	return b
 }
+
+// NewFrameToken returns the token holding the first n inbound bytes of connection, which is returned by the custom
+// ZeroCopyCodec along with the frame decoded from these bytes.
+func NewFrameToken(n int) FrameToken {
+	return FrameToken{n}
+}
+
+// poisonFrame overwrites the frame that has been released, so that the use of it afterwards is noticeable.
+func poisonFrame(frame []byte) {
+	for i := range frame {
+		frame[i] = framePoison
+	}
+}
+
+// framePoison is the byte overwriting the released frames of ZeroCopyCodec, see Options.ZeroCopyDebug.
+const framePoison = 0xdb
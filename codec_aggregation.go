@@ -0,0 +1,145 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// aggregatedFrameHeaderLength is the length of the length prefix of each frame in a batch.
+const aggregatedFrameHeaderLength = 4
+
+// AggregatingCodec wraps a codec and aggregates small outbound frames into batches, each frame is prefixed
+// with its 4-byte big-endian length and appended to the batch of the connection, and the batch is encoded
+// by the inner codec as a single frame once it reaches maxBytes or maxDelay has elapsed since its first frame.
+// The decoder splits each batch decoded by the inner codec back into the original frames.
+//
+// Encode returns nil until the batch is flushed, a batch flushed on time is written by Conn.AsyncWrite(nil),
+// which makes Encode with a nil buf flush the pending batch of the connection.
+type AggregatingCodec struct {
+	codec    ICodec
+	maxBytes int
+	maxDelay time.Duration
+	conns    sync.Map // Conn -> *aggregation
+}
+
+// aggregation is the state of a connection, the outbound batch and the inbound frames split from the last batch.
+type aggregation struct {
+	mu     sync.Mutex
+	batch  []byte
+	timer  *time.Timer
+	frames [][]byte
+}
+
+// NewAggregatingCodec instantiates and returns a codec aggregating frames into batches encoded by the inner codec,
+// a batch is flushed once its size reaches maxBytes or maxDelay has elapsed since its first frame.
+func NewAggregatingCodec(codec ICodec, maxBytes int, maxDelay time.Duration) *AggregatingCodec {
+	return &AggregatingCodec{codec: codec, maxBytes: maxBytes, maxDelay: maxDelay}
+}
+
+func (cc *AggregatingCodec) state(c Conn) *aggregation {
+	v, _ := cc.conns.LoadOrStore(c, new(aggregation))
+	return v.(*aggregation)
+}
+
+// takeBatch takes away the pending batch and stops its timer, it must be called with the lock held.
+func (ag *aggregation) takeBatch() (batch []byte) {
+	batch, ag.batch = ag.batch, nil
+	if ag.timer != nil {
+		ag.timer.Stop()
+		ag.timer = nil
+	}
+	return
+}
+
+// Encode ...
+func (cc *AggregatingCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	var batch []byte
+	if buf == nil {
+		v, ok := cc.conns.Load(c)
+		if !ok {
+			return nil, nil
+		}
+		ag := v.(*aggregation)
+		ag.mu.Lock()
+		batch = ag.takeBatch()
+		ag.mu.Unlock()
+	} else {
+		ag := cc.state(c)
+		ag.mu.Lock()
+		var header [aggregatedFrameHeaderLength]byte
+		binary.BigEndian.PutUint32(header[:], uint32(len(buf)))
+		ag.batch = append(append(ag.batch, header[:]...), buf...)
+		if len(ag.batch) >= cc.maxBytes {
+			batch = ag.takeBatch()
+		} else if ag.timer == nil {
+			ag.timer = time.AfterFunc(cc.maxDelay, func() {
+				_ = c.AsyncWrite(nil)
+			})
+		}
+		ag.mu.Unlock()
+	}
+	if len(batch) == 0 {
+		return nil, nil
+	}
+	return cc.codec.Encode(c, batch)
+}
+
+// Decode ...
+func (cc *AggregatingCodec) Decode(c Conn) ([]byte, error) {
+	ag := cc.state(c)
+	for len(ag.frames) == 0 {
+		batch, err := cc.codec.Decode(c)
+		if err != nil || batch == nil {
+			return nil, err
+		}
+		// The frames outlive the buffer of the inner codec, which may be reused by the next read.
+		batch = append([]byte(nil), batch...)
+		for len(batch) > 0 {
+			if len(batch) < aggregatedFrameHeaderLength {
+				return nil, ErrInvalidAggregatedFrame
+			}
+			n := int(binary.BigEndian.Uint32(batch))
+			batch = batch[aggregatedFrameHeaderLength:]
+			if n > len(batch) {
+				return nil, ErrInvalidAggregatedFrame
+			}
+			ag.frames = append(ag.frames, batch[:n:n])
+			batch = batch[n:]
+		}
+	}
+	frame := ag.frames[0]
+	ag.frames[0] = nil
+	ag.frames = ag.frames[1:]
+	return frame, nil
+}
+
+// hasPartialFrame also takes the frames of the batch that hasn't been flushed yet into account,
+// which would be lost by switching to another codec.
+func (cc *AggregatingCodec) hasPartialFrame(c Conn) bool {
+	if v, ok := cc.conns.Load(c); ok {
+		ag := v.(*aggregation)
+		ag.mu.Lock()
+		pending := len(ag.frames) > 0 || len(ag.batch) > 0
+		ag.mu.Unlock()
+		if pending {
+			return true
+		}
+	}
+	return hasPartialFrame(cc.codec, c)
+}
+
+func (cc *AggregatingCodec) releaseConn(c Conn) {
+	if v, ok := cc.conns.Load(c); ok {
+		ag := v.(*aggregation)
+		ag.mu.Lock()
+		ag.takeBatch()
+		ag.mu.Unlock()
+		cc.conns.Delete(c)
+	}
+	releaseCodecState(cc.codec, c)
+}
@@ -0,0 +1,138 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import "encoding/binary"
+
+// bitmaskLength is the length of the field-presence bitmask in bytes.
+const bitmaskLength = 2
+
+// BitmaskField defines a fixed-size optional field of frames encoded/decoded by BitmaskCodec,
+// Bit is the bit of the field in the bitmask, which is in [0, 16).
+type BitmaskField struct {
+	Bit  uint
+	Size int
+}
+
+// BitmaskCodec encodes/decodes frames consisting of a 2-byte big-endian field-presence bitmask followed by
+// the present fields, which are fixed-size and appear in the order of their definitions.
+// Decode returns the whole frame including the bitmask, which can be parsed into fields by Fields,
+// and Encode accepts a frame built by EncodeFields.
+type BitmaskCodec struct {
+	fields []BitmaskField
+	sizes  [16]int // size of field by bit, 0 means undefined
+}
+
+// NewBitmaskCodec instantiates and returns a codec with the ordered definitions of fields.
+func NewBitmaskCodec(fields []BitmaskField) *BitmaskCodec {
+	cc := &BitmaskCodec{fields: fields}
+	for _, f := range fields {
+		cc.sizes[f.Bit] = f.Size
+	}
+	return cc
+}
+
+// frameLength returns the length of the frame with the given bitmask.
+func (cc *BitmaskCodec) frameLength(mask uint16) (int, error) {
+	length := bitmaskLength
+	for bit := uint(0); bit < 16; bit++ {
+		if mask&(1<<bit) == 0 {
+			continue
+		}
+		if cc.sizes[bit] == 0 {
+			return 0, ErrInvalidBitmaskField
+		}
+		length += cc.sizes[bit]
+	}
+	return length, nil
+}
+
+// EncodeFields builds a frame from the given fields keyed by their bits, each field must be of the defined size.
+func (cc *BitmaskCodec) EncodeFields(fields map[uint][]byte) ([]byte, error) {
+	var mask uint16
+	for bit, value := range fields {
+		if bit >= 16 || cc.sizes[bit] == 0 || len(value) != cc.sizes[bit] {
+			return nil, ErrInvalidBitmaskField
+		}
+		mask |= 1 << bit
+	}
+	length, _ := cc.frameLength(mask)
+	frame := make([]byte, bitmaskLength, length)
+	binary.BigEndian.PutUint16(frame, mask)
+	for _, f := range cc.fields {
+		if value, ok := fields[f.Bit]; ok {
+			frame = append(frame, value...)
+		}
+	}
+	return frame, nil
+}
+
+// Fields parses the frame returned by Decode into the present fields keyed by their bits.
+func (cc *BitmaskCodec) Fields(frame []byte) (map[uint][]byte, error) {
+	if len(frame) < bitmaskLength {
+		return nil, ErrIncompletePacket
+	}
+	mask := binary.BigEndian.Uint16(frame)
+	length, err := cc.frameLength(mask)
+	if err != nil {
+		return nil, err
+	}
+	if len(frame) != length {
+		return nil, ErrInvalidBitmaskField
+	}
+	fields := make(map[uint][]byte)
+	offset := bitmaskLength
+	for _, f := range cc.fields {
+		if mask&(1<<f.Bit) != 0 {
+			fields[f.Bit] = frame[offset : offset+f.Size]
+			offset += f.Size
+		}
+	}
+	return fields, nil
+}
+
+// DecodeFields decodes a frame from the connection and parses it into the present fields keyed by their bits.
+func (cc *BitmaskCodec) DecodeFields(c Conn) (map[uint][]byte, error) {
+	frame, err := cc.Decode(c)
+	if err != nil {
+		return nil, err
+	}
+	return cc.Fields(frame)
+}
+
+// Encode ...
+func (cc *BitmaskCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	if len(buf) < bitmaskLength {
+		return nil, ErrInvalidBitmaskField
+	}
+	length, err := cc.frameLength(binary.BigEndian.Uint16(buf))
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) != length {
+		return nil, ErrInvalidBitmaskField
+	}
+	return buf, nil
+}
+
+// Decode ...
+func (cc *BitmaskCodec) Decode(c Conn) ([]byte, error) {
+	size, header := c.ReadN(bitmaskLength)
+	if size < bitmaskLength {
+		return nil, ErrIncompletePacket
+	}
+	length, err := cc.frameLength(binary.BigEndian.Uint16(header))
+	if err != nil {
+		return nil, err
+	}
+	size, buf := c.ReadN(length)
+	if size < length {
+		return nil, ErrIncompletePacket
+	}
+	frame := make([]byte, length)
+	copy(frame, buf)
+	c.ShiftN(length)
+	return frame, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+// BoundedDelimiterFrameCodec encodes/decodes frames separated by a specific delimiter into/from TCP stream like
+// DelimiterBasedFrameCodec and MultiDelimiterBasedFrameCodec, but bounds the length of frames so that the peers
+// sending unterminated frames can't make the inbound buffer grow without limit: a frame is too large once more
+// than maxFrameLength bytes are buffered without the delimiter or the delimiter is found beyond them.
+// Decode returns ErrFrameTooLarge for a frame too large by default, with which the connection is closed.
+// With discardTooLong, the frame too large is discarded silently up to the next delimiter instead, and
+// the connection goes on with the frames after it.
+type BoundedDelimiterFrameCodec struct {
+	delimiter      []byte
+	maxFrameLength int
+	discardTooLong bool
+	discarding     sync.Map // connections discarding the rest of a frame too large
+}
+
+// NewBoundedDelimiterFrameCodec instantiates and returns a codec with a specific delimiter, frames longer than
+// maxFrameLength are rejected or discarded, see BoundedDelimiterFrameCodec, 0 means no limit.
+func NewBoundedDelimiterFrameCodec(delimiter []byte, maxFrameLength int,
+	discardTooLong bool) *BoundedDelimiterFrameCodec {
+	return &BoundedDelimiterFrameCodec{
+		delimiter:      delimiter,
+		maxFrameLength: maxFrameLength,
+		discardTooLong: discardTooLong,
+	}
+}
+
+// Encode ...
+func (cc *BoundedDelimiterFrameCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	return append(buf, cc.delimiter...), nil
+}
+
+// Decode ...
+func (cc *BoundedDelimiterFrameCodec) Decode(c Conn) ([]byte, error) {
+	for {
+		if _, ok := cc.discarding.Load(c); ok {
+			if !cc.discard(c) {
+				return nil, ErrIncompletePacket
+			}
+			cc.discarding.Delete(c)
+		}
+		buf := c.Read()
+		idx := bytes.Index(buf, cc.delimiter)
+		// The last bytes may be the beginning of the delimiter if it's not found.
+		length := idx
+		if idx == -1 {
+			length = len(buf) - len(cc.delimiter) + 1
+		}
+		if cc.maxFrameLength <= 0 || length <= cc.maxFrameLength {
+			if idx == -1 {
+				return nil, ErrIncompletePacket
+			}
+			c.ShiftN(idx + len(cc.delimiter))
+			return buf[:idx], nil
+		}
+		if !cc.discardTooLong {
+			return nil, fmt.Errorf("%w: %d", ErrFrameTooLarge, length)
+		}
+		cc.discarding.Store(c, struct{}{})
+	}
+}
+
+// discard drops the inbound data of a frame too large, it reports whether the end of frame has been dropped.
+func (cc *BoundedDelimiterFrameCodec) discard(c Conn) bool {
+	buf := c.Read()
+	if idx := bytes.Index(buf, cc.delimiter); idx != -1 {
+		c.ShiftN(idx + len(cc.delimiter))
+		return true
+	}
+	// Keep the bytes which may be the beginning of the delimiter.
+	if n := len(buf) - len(cc.delimiter) + 1; n > 0 {
+		c.ShiftN(n)
+	}
+	return false
+}
+
+func (cc *BoundedDelimiterFrameCodec) hasPartialFrame(c Conn) bool {
+	_, ok := cc.discarding.Load(c)
+	return ok
+}
+
+func (cc *BoundedDelimiterFrameCodec) releaseConn(c Conn) {
+	cc.discarding.Delete(c)
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// checksumLength is the length of the CRC32 appended to each frame by ChecksumCodec.
+const checksumLength = 4
+
+// ChecksumCodec wraps a codec and appends a big-endian CRC32 of the payload to each frame, the payload
+// followed by the CRC32 is what the wrapped codec encodes, e.g. prefixes with a length field.
+// The CRC32 is verified and stripped as soon as the wrapped codec decodes a frame, so that a corrupt frame
+// never reaches React, ErrChecksumMismatch is returned for it and the connection is closed.
+type ChecksumCodec struct {
+	codec ICodec
+	table *crc32.Table
+}
+
+// NewChecksumCodec instantiates and returns a codec appending the CRC32 with the IEEE polynomial.
+func NewChecksumCodec(codec ICodec) *ChecksumCodec {
+	return &ChecksumCodec{codec: codec, table: crc32.IEEETable}
+}
+
+// NewChecksumCodecWithPolynomial instantiates and returns a codec appending the CRC32 with the given polynomial,
+// e.g. crc32.Castagnoli.
+func NewChecksumCodecWithPolynomial(codec ICodec, poly uint32) *ChecksumCodec {
+	return &ChecksumCodec{codec: codec, table: crc32.MakeTable(poly)}
+}
+
+// Encode ...
+func (cc *ChecksumCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	frame := make([]byte, len(buf), len(buf)+checksumLength)
+	copy(frame, buf)
+	frame = frame[:len(buf)+checksumLength]
+	binary.BigEndian.PutUint32(frame[len(buf):], crc32.Checksum(buf, cc.table))
+	return cc.codec.Encode(c, frame)
+}
+
+// Decode ...
+func (cc *ChecksumCodec) Decode(c Conn) ([]byte, error) {
+	frame, err := cc.codec.Decode(c)
+	if err != nil || frame == nil {
+		return nil, err
+	}
+	if len(frame) < checksumLength {
+		return nil, ErrChecksumMismatch
+	}
+	payload, sum := frame[:len(frame)-checksumLength], frame[len(frame)-checksumLength:]
+	if binary.BigEndian.Uint32(sum) != crc32.Checksum(payload, cc.table) {
+		return nil, ErrChecksumMismatch
+	}
+	return payload, nil
+}
+
+func (cc *ChecksumCodec) hasPartialFrame(c Conn) bool {
+	return hasPartialFrame(cc.codec, c)
+}
+
+func (cc *ChecksumCodec) releaseConn(c Conn) {
+	releaseCodecState(cc.codec, c)
+}
@@ -0,0 +1,142 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// CompressionCodec wraps a codec and compresses the payload of each frame with DEFLATE transparently,
+// the payload is compressed before being encoded by the inner codec and inflated after being decoded
+// by the inner codec. Empty payloads are passed through untouched.
+//
+// A preset dictionary can be used to improve the compression ratio of small frames sharing common content,
+// it can be set for the whole server by NewCompressionCodecWithDictionary or for a specific connection by
+// SetDictionary, both peers must use the same dictionary.
+type CompressionCodec struct {
+	codec   ICodec
+	level   int
+	dict    []byte
+	writers sync.Pool // *flate.Writer with dict
+	readers sync.Pool // io.ReadCloser implementing flate.Resetter
+	conns   sync.Map  // Conn -> *connDictionary
+}
+
+// connDictionary is the preset dictionary of a connection with the writer bound to it.
+type connDictionary struct {
+	mu   sync.Mutex
+	dict []byte
+	w    *flate.Writer
+}
+
+// NewCompressionCodec instantiates and returns a codec compressing frames of the inner codec at the given level,
+// which is one of the compression levels of compress/flate.
+func NewCompressionCodec(codec ICodec, level int) *CompressionCodec {
+	return &CompressionCodec{codec: codec, level: level}
+}
+
+// NewCompressionCodecWithDictionary instantiates and returns a codec compressing frames of the inner codec at
+// the given level with a preset dictionary shared by all connections.
+func NewCompressionCodecWithDictionary(codec ICodec, level int, dict []byte) *CompressionCodec {
+	return &CompressionCodec{codec: codec, level: level, dict: dict}
+}
+
+// SetDictionary sets the preset dictionary for the given connection, which takes precedence over the one
+// shared by all connections, a nil dict resets the connection to use the shared one.
+// It should be called before any frame is encoded/decoded, typically in EventHandler.OnOpened.
+func (cc *CompressionCodec) SetDictionary(c Conn, dict []byte) {
+	if dict == nil {
+		cc.conns.Delete(c)
+		return
+	}
+	cc.conns.Store(c, &connDictionary{dict: dict})
+}
+
+func (cc *CompressionCodec) dictionary(c Conn) (*connDictionary, []byte) {
+	if v, ok := cc.conns.Load(c); ok {
+		cd := v.(*connDictionary)
+		return cd, cd.dict
+	}
+	return nil, cc.dict
+}
+
+// Encode ...
+func (cc *CompressionCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	if len(buf) == 0 {
+		return cc.codec.Encode(c, buf)
+	}
+	var (
+		out bytes.Buffer
+		err error
+	)
+	if cd, _ := cc.dictionary(c); cd != nil {
+		cd.mu.Lock()
+		if cd.w == nil {
+			cd.w, err = flate.NewWriterDict(&out, cc.level, cd.dict)
+		} else {
+			cd.w.Reset(&out)
+		}
+		if err == nil {
+			err = compress(cd.w, buf)
+		}
+		cd.mu.Unlock()
+	} else {
+		w, _ := cc.writers.Get().(*flate.Writer)
+		if w == nil {
+			w, err = flate.NewWriterDict(&out, cc.level, cc.dict)
+		} else {
+			w.Reset(&out)
+		}
+		if err == nil {
+			err = compress(w, buf)
+			cc.writers.Put(w)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cc.codec.Encode(c, out.Bytes())
+}
+
+func compress(w *flate.Writer, buf []byte) error {
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// Decode ...
+func (cc *CompressionCodec) Decode(c Conn) ([]byte, error) {
+	frame, err := cc.codec.Decode(c)
+	if err != nil || len(frame) == 0 {
+		return frame, err
+	}
+	_, dict := cc.dictionary(c)
+	r, _ := cc.readers.Get().(io.ReadCloser)
+	if r == nil {
+		r = flate.NewReaderDict(bytes.NewReader(frame), dict)
+	} else if err = r.(flate.Resetter).Reset(bytes.NewReader(frame), dict); err != nil {
+		return nil, err
+	}
+	payload, err := ioutil.ReadAll(r)
+	cc.readers.Put(r)
+	if err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func (cc *CompressionCodec) hasPartialFrame(c Conn) bool {
+	return hasPartialFrame(cc.codec, c)
+}
+
+func (cc *CompressionCodec) releaseConn(c Conn) {
+	cc.conns.Delete(c)
+	releaseCodecState(cc.codec, c)
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import "encoding/binary"
+
+const (
+	frameTypeLength   = 2
+	frameLengthLength = 4
+)
+
+type (
+	// FrameHandler handles the payload of a frame with a specific type.
+	FrameHandler func(c Conn, payload []byte)
+
+	// DefaultFrameHandler handles the payload of a frame whose type has no FrameHandler registered.
+	DefaultFrameHandler func(c Conn, frameType uint16, payload []byte)
+
+	// FrameDispatchCodec encodes/decodes type-length-value frames into/from TCP stream and routes each decoded frame
+	// to the FrameHandler registered for its type, the event-loop invokes the handler instead of
+	// EventHandler.React, in which the data can be written to the connection by c.AsyncWrite(buf).
+	// A frame consists of a 2-byte type, a 4-byte length of the payload and the payload, all in big-endian.
+	// Frames of unknown types are passed to the DefaultFrameHandler if there is one, otherwise to
+	// EventHandler.React with the type and payload, just like the buffer given to Encode.
+	FrameDispatchCodec struct {
+		handlers       map[uint16]FrameHandler
+		defaultHandler DefaultFrameHandler
+	}
+
+	// frameDispatcher is implemented by codecs that route decoded frames to their own handlers.
+	frameDispatcher interface {
+		dispatch(c Conn, frame []byte) (handled bool)
+	}
+)
+
+// NewFrameDispatchCodec instantiates and returns a codec dispatching frames by types.
+func NewFrameDispatchCodec() *FrameDispatchCodec {
+	return &FrameDispatchCodec{handlers: make(map[uint16]FrameHandler)}
+}
+
+// NewTypedFrame returns the buffer to be encoded by FrameDispatchCodec for a frame with the given type and payload.
+func NewTypedFrame(frameType uint16, payload []byte) []byte {
+	buf := make([]byte, frameTypeLength+len(payload))
+	binary.BigEndian.PutUint16(buf, frameType)
+	copy(buf[frameTypeLength:], payload)
+	return buf
+}
+
+// RegisterFrameHandler registers the handler for frames with the given type,
+// handlers must be registered before the server starts.
+func (cc *FrameDispatchCodec) RegisterFrameHandler(frameType uint16, fn FrameHandler) {
+	cc.handlers[frameType] = fn
+}
+
+// SetDefaultFrameHandler sets the handler for frames with unknown types,
+// it must be set before the server starts.
+func (cc *FrameDispatchCodec) SetDefaultFrameHandler(fn DefaultFrameHandler) {
+	cc.defaultHandler = fn
+}
+
+// Encode encodes the buffer built by NewTypedFrame, which starts with the 2-byte type of frame.
+func (cc *FrameDispatchCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	if len(buf) < frameTypeLength {
+		return nil, ErrFrameTypeMissing
+	}
+	payload := buf[frameTypeLength:]
+	out := make([]byte, frameTypeLength+frameLengthLength+len(payload))
+	copy(out, buf[:frameTypeLength])
+	binary.BigEndian.PutUint32(out[frameTypeLength:], uint32(len(payload)))
+	copy(out[frameTypeLength+frameLengthLength:], payload)
+	return out, nil
+}
+
+// Decode decodes a frame and returns its type and payload, without the length field.
+func (cc *FrameDispatchCodec) Decode(c Conn) ([]byte, error) {
+	headerLength := frameTypeLength + frameLengthLength
+	size, header := c.ReadN(headerLength)
+	if size < headerLength {
+		return nil, ErrIncompletePacket
+	}
+	frameType := binary.BigEndian.Uint16(header)
+	frameLength := headerLength + int(binary.BigEndian.Uint32(header[frameTypeLength:]))
+	size, buf := c.ReadN(frameLength)
+	if size < frameLength {
+		return nil, ErrIncompletePacket
+	}
+	frame := NewTypedFrame(frameType, buf[headerLength:])
+	c.ShiftN(frameLength)
+	return frame, nil
+}
+
+func (cc *FrameDispatchCodec) dispatch(c Conn, frame []byte) bool {
+	frameType, payload := binary.BigEndian.Uint16(frame), frame[frameTypeLength:]
+	if fn, ok := cc.handlers[frameType]; ok {
+		fn(c, payload)
+		return true
+	}
+	if cc.defaultHandler != nil {
+		cc.defaultHandler(c, frameType, payload)
+		return true
+	}
+	return false
+}
+
+// dispatchFrame routes the decoded frame to the handler registered in codec if there is one,
+// it reports whether the frame has been handled.
+func dispatchFrame(codec ICodec, c Conn, frame []byte) bool {
+	if d, ok := codec.(frameDispatcher); ok {
+		return d.dispatch(c, frame)
+	}
+	return false
+}
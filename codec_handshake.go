@@ -0,0 +1,59 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import "sync"
+
+// HandshakeFunc performs the handshake of a connection, it may read the inbound data via c.Read()/c.ReadN(n)
+// and reply via c.AsyncWrite(buf), consumed data must be discarded by c.ShiftN(n).
+// It will be invoked whenever new data arrives until it returns done as true, return a non-nil error if
+// the handshake failed.
+type HandshakeFunc func(c Conn) (done bool, err error)
+
+// HandshakeCodec wraps a codec and runs a handshake exchange before the framing of the inner codec begins.
+// Data written during the handshake is not encoded by the inner codec.
+type HandshakeCodec struct {
+	codec     ICodec
+	handshake HandshakeFunc
+	done      sync.Map // connections that have finished the handshake
+}
+
+// NewHandshakeCodec instantiates and returns a codec that runs the given handshake on each connection
+// before delegating to the inner codec.
+func NewHandshakeCodec(codec ICodec, handshake HandshakeFunc) *HandshakeCodec {
+	return &HandshakeCodec{codec: codec, handshake: handshake}
+}
+
+// Encode ...
+func (cc *HandshakeCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	if _, ok := cc.done.Load(c); !ok {
+		return buf, nil
+	}
+	return cc.codec.Encode(c, buf)
+}
+
+// Decode ...
+func (cc *HandshakeCodec) Decode(c Conn) ([]byte, error) {
+	if _, ok := cc.done.Load(c); !ok {
+		done, err := cc.handshake(c)
+		if err != nil {
+			return nil, err
+		}
+		if !done {
+			return nil, ErrIncompletePacket
+		}
+		cc.done.Store(c, struct{}{})
+	}
+	return cc.codec.Decode(c)
+}
+
+func (cc *HandshakeCodec) hasPartialFrame(c Conn) bool {
+	return hasPartialFrame(cc.codec, c)
+}
+
+func (cc *HandshakeCodec) releaseConn(c Conn) {
+	cc.done.Delete(c)
+	releaseCodecState(cc.codec, c)
+}
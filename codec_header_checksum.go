@@ -0,0 +1,100 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	headerLengthFieldLength   = 4
+	headerChecksumFieldLength = 2
+)
+
+// HeaderChecksumFrameCodec encodes/decodes frames whose header carries a checksum of the header itself,
+// the layout of a frame is:
+//
+//	| length (4 bytes) | header fields (fixed size) | checksum (2 bytes) | payload (length bytes) |
+//
+// where the length and the checksum are big-endian, and the checksum covers the length and the header fields.
+// The checksum is verified as soon as the header arrives, before the length is trusted, so that a corrupt length
+// never makes the codec wait for or buffer a bogus payload.
+// Both the buffer to Encode and the frame returned by Decode are the header fields followed by the payload.
+type HeaderChecksumFrameCodec struct {
+	fieldsLength   int
+	maxFrameLength int
+	checksum       func([]byte) uint16
+}
+
+// NewHeaderChecksumFrameCodec instantiates and returns a codec with fieldsLength bytes of header fields,
+// frames with payload longer than maxFrameLength will be rejected, 0 means no limit.
+// The checksum is CRC-16/CCITT-FALSE if checksum is nil.
+func NewHeaderChecksumFrameCodec(fieldsLength, maxFrameLength int, checksum func([]byte) uint16) *HeaderChecksumFrameCodec {
+	if checksum == nil {
+		checksum = crc16CCITT
+	}
+	return &HeaderChecksumFrameCodec{fieldsLength, maxFrameLength, checksum}
+}
+
+func (cc *HeaderChecksumFrameCodec) headerLength() int {
+	return headerLengthFieldLength + cc.fieldsLength + headerChecksumFieldLength
+}
+
+// Encode ...
+func (cc *HeaderChecksumFrameCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	if len(buf) < cc.fieldsLength {
+		return nil, ErrHeaderFieldsMissing
+	}
+	fields, payload := buf[:cc.fieldsLength], buf[cc.fieldsLength:]
+	out := make([]byte, cc.headerLength(), cc.headerLength()+len(payload))
+	binary.BigEndian.PutUint32(out, uint32(len(payload)))
+	copy(out[headerLengthFieldLength:], fields)
+	checksumOffset := headerLengthFieldLength + cc.fieldsLength
+	binary.BigEndian.PutUint16(out[checksumOffset:], cc.checksum(out[:checksumOffset]))
+	return append(out, payload...), nil
+}
+
+// Decode ...
+func (cc *HeaderChecksumFrameCodec) Decode(c Conn) ([]byte, error) {
+	buf := c.Read()
+	headerLength := cc.headerLength()
+	if len(buf) < headerLength {
+		return nil, ErrIncompletePacket
+	}
+	checksumOffset := headerLengthFieldLength + cc.fieldsLength
+	if cc.checksum(buf[:checksumOffset]) != binary.BigEndian.Uint16(buf[checksumOffset:]) {
+		return nil, ErrHeaderChecksumMismatch
+	}
+	length := uint64(binary.BigEndian.Uint32(buf))
+	if cc.maxFrameLength > 0 && length > uint64(cc.maxFrameLength) {
+		return nil, fmt.Errorf("%w: %d", ErrFrameTooLarge, length)
+	}
+	if length > uint64(len(buf)-headerLength) {
+		return nil, ErrIncompletePacket
+	}
+	frameLength := headerLength + int(length)
+	frame := make([]byte, 0, cc.fieldsLength+int(length))
+	frame = append(frame, buf[headerLengthFieldLength:checksumOffset]...)
+	frame = append(frame, buf[headerLength:frameLength]...)
+	c.ShiftN(frameLength)
+	return frame, nil
+}
+
+// crc16CCITT computes the CRC-16/CCITT-FALSE checksum of data.
+func crc16CCITT(data []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
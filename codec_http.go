@@ -0,0 +1,190 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+var (
+	httpCRLF         = []byte("\r\n")
+	httpHeaderEnd    = []byte("\r\n\r\n")
+	httpContinue     = []byte("HTTP/1.1 100 Continue\r\n\r\n")
+	httpVersionMajor = []byte("HTTP/1.")
+)
+
+// HTTPCodec decodes HTTP/1.1 requests, Decode returns the raw bytes of a complete request: the request line,
+// the headers and the body, which is delimited by either Content-Length or the chunked transfer coding, and
+// ErrIncompletePacket if the request is incomplete, so that pipelined requests are decoded one by one.
+// Requests with "Expect: 100-continue" get the interim response "100 Continue" once their headers arrive,
+// unless the body arrives along with them. Encode returns the given bytes as they are, which are expected to be
+// a complete HTTP response already.
+type HTTPCodec struct {
+	maxRequestLength int
+	continued        sync.Map // Conn -> struct{}, the connections that have been sent 100 Continue for the request
+}
+
+// NewHTTPCodec instantiates and returns a codec of HTTP/1.1 requests, requests longer than maxRequestLength
+// will be rejected, 0 means no limit.
+func NewHTTPCodec(maxRequestLength int) *HTTPCodec {
+	return &HTTPCodec{maxRequestLength: maxRequestLength}
+}
+
+// Encode ...
+func (cc *HTTPCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	return buf, nil
+}
+
+// Decode ...
+func (cc *HTTPCodec) Decode(c Conn) ([]byte, error) {
+	buf := c.Read()
+	// Empty lines before the request line are ignored, see RFC 7230 section 3.5.
+	start := 0
+	for bytes.HasPrefix(buf[start:], httpCRLF) {
+		start += len(httpCRLF)
+	}
+	idx := bytes.Index(buf[start:], httpHeaderEnd)
+	if idx == -1 {
+		if cc.maxRequestLength > 0 && len(buf)-start > cc.maxRequestLength {
+			return nil, fmt.Errorf("%w: %d", ErrFrameTooLarge, len(buf)-start)
+		}
+		return nil, ErrIncompletePacket
+	}
+	headerEnd := start + idx + len(httpHeaderEnd)
+	header, err := parseHTTPHeader(buf[start:headerEnd])
+	if err != nil {
+		return nil, err
+	}
+	var end, length int
+	if header.chunked {
+		if end, err = parseHTTPChunkedBody(buf, headerEnd); err == nil {
+			length = end - start
+		} else {
+			length = len(buf) - start
+		}
+	} else {
+		end = headerEnd + header.contentLength
+		if len(buf) < end {
+			err = ErrIncompletePacket
+		}
+		length = end - start
+	}
+	if err != nil && err != ErrIncompletePacket {
+		return nil, err
+	}
+	if cc.maxRequestLength > 0 && length > cc.maxRequestLength {
+		return nil, fmt.Errorf("%w: %d", ErrFrameTooLarge, length)
+	}
+	if err == ErrIncompletePacket {
+		if header.expectContinue && len(buf) == headerEnd {
+			if _, sent := cc.continued.LoadOrStore(c, struct{}{}); !sent {
+				if err := c.AsyncWrite(httpContinue); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return nil, ErrIncompletePacket
+	}
+	if header.expectContinue {
+		cc.continued.Delete(c)
+	}
+	c.ShiftN(end)
+	return buf[start:end], nil
+}
+
+func (cc *HTTPCodec) releaseConn(c Conn) {
+	cc.continued.Delete(c)
+}
+
+// httpHeader is what HTTPCodec needs from the headers of a request.
+type httpHeader struct {
+	contentLength  int
+	chunked        bool
+	expectContinue bool
+}
+
+// parseHTTPHeader parses the request line and the headers ending with an empty line.
+func parseHTTPHeader(buf []byte) (header httpHeader, err error) {
+	lines := bytes.Split(buf[:len(buf)-len(httpHeaderEnd)], httpCRLF)
+	// The request line: method SP request-target SP HTTP-version.
+	parts := bytes.Split(lines[0], []byte(" "))
+	if len(parts) != 3 || len(parts[0]) == 0 || len(parts[1]) == 0 || !bytes.HasPrefix(parts[2], httpVersionMajor) {
+		return header, ErrInvalidHTTPRequest
+	}
+	hasContentLength := false
+	for _, line := range lines[1:] {
+		colon := bytes.IndexByte(line, ':')
+		if colon <= 0 {
+			return header, ErrInvalidHTTPRequest
+		}
+		name, value := line[:colon], bytes.TrimSpace(line[colon+1:])
+		switch {
+		case bytes.EqualFold(name, []byte("Content-Length")):
+			n, e := strconv.Atoi(string(value))
+			if e != nil || n < 0 || (hasContentLength && n != header.contentLength) {
+				return header, ErrInvalidHTTPRequest
+			}
+			header.contentLength, hasContentLength = n, true
+		case bytes.EqualFold(name, []byte("Transfer-Encoding")):
+			// The chunked transfer coding must be the final one of a request, see RFC 7230 section 3.3.3.
+			codings := bytes.Split(value, []byte(","))
+			if !bytes.EqualFold(bytes.TrimSpace(codings[len(codings)-1]), []byte("chunked")) {
+				return header, ErrInvalidHTTPRequest
+			}
+			header.chunked = true
+		case bytes.EqualFold(name, []byte("Expect")):
+			header.expectContinue = bytes.EqualFold(value, []byte("100-continue"))
+		}
+	}
+	if header.chunked {
+		// Transfer-Encoding overrides Content-Length.
+		header.contentLength = 0
+	}
+	return
+}
+
+// parseHTTPChunkedBody parses the body in the chunked transfer coding starting at pos of buf, including
+// the trailers, and returns the end of it.
+func parseHTTPChunkedBody(buf []byte, pos int) (end int, err error) {
+	for {
+		idx := bytes.Index(buf[pos:], httpCRLF)
+		if idx == -1 {
+			return 0, ErrIncompletePacket
+		}
+		sizeField := buf[pos : pos+idx]
+		if ext := bytes.IndexByte(sizeField, ';'); ext >= 0 {
+			sizeField = sizeField[:ext]
+		}
+		size, e := strconv.ParseUint(string(bytes.TrimSpace(sizeField)), 16, 31)
+		if e != nil {
+			return 0, ErrInvalidHTTPRequest
+		}
+		pos += idx + len(httpCRLF)
+		if size == 0 {
+			break
+		}
+		if len(buf) < pos+int(size)+len(httpCRLF) {
+			return 0, ErrIncompletePacket
+		}
+		if !bytes.Equal(buf[pos+int(size):pos+int(size)+len(httpCRLF)], httpCRLF) {
+			return 0, ErrInvalidHTTPRequest
+		}
+		pos += int(size) + len(httpCRLF)
+	}
+	// The trailers end with an empty line.
+	for {
+		idx := bytes.Index(buf[pos:], httpCRLF)
+		if idx == -1 {
+			return 0, ErrIncompletePacket
+		}
+		pos += idx + len(httpCRLF)
+		if idx == 0 {
+			return pos, nil
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// InlineCommand is a line of InlineCommandCodec split into arguments.
+type InlineCommand struct {
+	Args [][]byte
+}
+
+// InlineCommandCodec encodes/decodes the inline commands of Redis, which are lines of space-separated arguments
+// terminated by CRLF or LF, like the ones typed into redis-cli. An argument may be quoted to contain spaces:
+// double-quoted arguments support the escapes \", \\, \n, \r, \t, \b, \a and \xHH, and single-quoted arguments
+// support \'. Decode returns the line without the terminator once its quotes are checked, which can be split
+// into arguments by Parse, or DecodeCommand can be used to decode a line into InlineCommand directly.
+// Encode appends CRLF to the given line, which can be built from arguments by EncodeCommand.
+type InlineCommandCodec struct {
+	maxLineLength int
+}
+
+// NewInlineCommandCodec instantiates and returns a codec of inline commands, lines longer than maxLineLength
+// will be rejected, 0 means no limit.
+func NewInlineCommandCodec(maxLineLength int) *InlineCommandCodec {
+	return &InlineCommandCodec{maxLineLength}
+}
+
+// EncodeCommand joins the arguments into a line with spaces, the arguments that are empty or contain spaces,
+// quotes or control characters are double-quoted.
+func (cc *InlineCommandCodec) EncodeCommand(args ...[]byte) []byte {
+	var line []byte
+	for i, arg := range args {
+		if i > 0 {
+			line = append(line, ' ')
+		}
+		if len(arg) > 0 && bytes.IndexFunc(arg, needsQuote) == -1 {
+			line = append(line, arg...)
+			continue
+		}
+		line = append(line, '"')
+		for _, b := range arg {
+			switch b {
+			case '"', '\\':
+				line = append(line, '\\', b)
+			case '\n':
+				line = append(line, '\\', 'n')
+			case '\r':
+				line = append(line, '\\', 'r')
+			case '\t':
+				line = append(line, '\\', 't')
+			default:
+				if b < ' ' || b == 0x7f {
+					line = append(line, fmt.Sprintf("\\x%02x", b)...)
+				} else {
+					line = append(line, b)
+				}
+			}
+		}
+		line = append(line, '"')
+	}
+	return line
+}
+
+func needsQuote(r rune) bool {
+	return r <= ' ' || r == '"' || r == '\'' || r == 0x7f
+}
+
+// Parse splits the line returned by Decode into arguments, the arguments are copied from the line.
+func (cc *InlineCommandCodec) Parse(line []byte) (InlineCommand, error) {
+	args, err := splitInlineArgs(line)
+	return InlineCommand{Args: args}, err
+}
+
+// DecodeCommand decodes a line from the connection and splits it into arguments.
+func (cc *InlineCommandCodec) DecodeCommand(c Conn) (InlineCommand, error) {
+	line, err := cc.Decode(c)
+	if err != nil {
+		return InlineCommand{}, err
+	}
+	return cc.Parse(line)
+}
+
+// Encode ...
+func (cc *InlineCommandCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	return append(buf, respCRLF...), nil
+}
+
+// Decode ...
+func (cc *InlineCommandCodec) Decode(c Conn) ([]byte, error) {
+	buf := c.Read()
+	idx := bytes.IndexByte(buf, '\n')
+	if idx == -1 {
+		if cc.maxLineLength > 0 && len(buf) > cc.maxLineLength {
+			return nil, fmt.Errorf("%w: %d", ErrFrameTooLarge, len(buf))
+		}
+		return nil, ErrIncompletePacket
+	}
+	line := bytes.TrimSuffix(buf[:idx], []byte{'\r'})
+	if cc.maxLineLength > 0 && len(line) > cc.maxLineLength {
+		return nil, fmt.Errorf("%w: %d", ErrFrameTooLarge, len(line))
+	}
+	if _, err := splitInlineArgs(line); err != nil {
+		return nil, err
+	}
+	c.ShiftN(idx + 1)
+	return line, nil
+}
+
+// splitInlineArgs splits the line into arguments by the quoting rules of redis-cli.
+func splitInlineArgs(line []byte) (args [][]byte, err error) {
+	for i := 0; ; {
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+			i++
+		}
+		if i == len(line) {
+			return
+		}
+		var arg []byte
+		switch line[i] {
+		case '"':
+			if arg, i, err = splitDoubleQuoted(line, i+1); err != nil {
+				return nil, err
+			}
+		case '\'':
+			if arg, i, err = splitSingleQuoted(line, i+1); err != nil {
+				return nil, err
+			}
+		default:
+			start := i
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				i++
+			}
+			arg = append([]byte{}, line[start:i]...)
+		}
+		args = append(args, arg)
+	}
+}
+
+// splitDoubleQuoted returns the double-quoted argument starting at pos and the position after the closing quote.
+func splitDoubleQuoted(line []byte, pos int) (arg []byte, end int, err error) {
+	arg = []byte{}
+	for i := pos; i < len(line); i++ {
+		switch b := line[i]; {
+		case b == '"':
+			return arg, i + 1, checkQuoteClosed(line, i+1)
+		case b == '\\' && i+1 < len(line):
+			i++
+			switch line[i] {
+			case 'n':
+				arg = append(arg, '\n')
+			case 'r':
+				arg = append(arg, '\r')
+			case 't':
+				arg = append(arg, '\t')
+			case 'b':
+				arg = append(arg, '\b')
+			case 'a':
+				arg = append(arg, '\a')
+			case 'x':
+				if i+2 < len(line) {
+					if v, e := strconv.ParseUint(string(line[i+1:i+3]), 16, 8); e == nil {
+						arg = append(arg, byte(v))
+						i += 2
+						break
+					}
+				}
+				arg = append(arg, 'x')
+			default:
+				arg = append(arg, line[i])
+			}
+		default:
+			arg = append(arg, b)
+		}
+	}
+	return nil, 0, ErrUnbalancedQuotes
+}
+
+// splitSingleQuoted returns the single-quoted argument starting at pos and the position after the closing quote.
+func splitSingleQuoted(line []byte, pos int) (arg []byte, end int, err error) {
+	arg = []byte{}
+	for i := pos; i < len(line); i++ {
+		switch b := line[i]; {
+		case b == '\'':
+			return arg, i + 1, checkQuoteClosed(line, i+1)
+		case b == '\\' && i+1 < len(line) && line[i+1] == '\'':
+			arg = append(arg, '\'')
+			i++
+		default:
+			arg = append(arg, b)
+		}
+	}
+	return nil, 0, ErrUnbalancedQuotes
+}
+
+// checkQuoteClosed checks that the closing quote ending at pos is followed by a space or the end of line.
+func checkQuoteClosed(line []byte, pos int) error {
+	if pos < len(line) && line[pos] != ' ' && line[pos] != '\t' {
+		return ErrUnbalancedQuotes
+	}
+	return nil
+}
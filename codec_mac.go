@@ -0,0 +1,98 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"hash"
+	"sync"
+)
+
+// ChainedMACCodec wraps a codec and appends a MAC to each frame, the MAC is computed as
+// HMAC(key, previous MAC || payload), chaining all frames in the same direction of a connection, which makes it
+// possible to detect reordered or dropped frames besides corrupted ones.
+// Frames must be encoded in the same order as they are written to the connection, so calls to c.AsyncWrite(buf)
+// on the same connection ought to be serialized.
+type ChainedMACCodec struct {
+	codec  ICodec
+	key    []byte
+	hash   func() hash.Hash
+	states sync.Map // Conn -> *macState
+}
+
+// macState is the running state of chained MACs of a connection.
+type macState struct {
+	mu       sync.Mutex
+	sent     []byte // MAC of the last encoded frame
+	received []byte // MAC of the last decoded frame
+}
+
+// NewChainedMACCodec instantiates and returns a codec computing chained MACs with the given key and hash,
+// HMAC-SHA256 is used if h is nil.
+func NewChainedMACCodec(codec ICodec, key []byte, h func() hash.Hash) *ChainedMACCodec {
+	if h == nil {
+		h = sha256.New
+	}
+	return &ChainedMACCodec{codec: codec, key: key, hash: h}
+}
+
+func (cc *ChainedMACCodec) state(c Conn) *macState {
+	if st, ok := cc.states.Load(c); ok {
+		return st.(*macState)
+	}
+	st, _ := cc.states.LoadOrStore(c, new(macState))
+	return st.(*macState)
+}
+
+func (cc *ChainedMACCodec) sum(prev, payload []byte) []byte {
+	mac := hmac.New(cc.hash, cc.key)
+	_, _ = mac.Write(prev)
+	_, _ = mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// Encode ...
+func (cc *ChainedMACCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	st := cc.state(c)
+	st.mu.Lock()
+	mac := cc.sum(st.sent, buf)
+	st.sent = mac
+	st.mu.Unlock()
+	frame := make([]byte, 0, len(buf)+len(mac))
+	frame = append(frame, buf...)
+	return cc.codec.Encode(c, append(frame, mac...))
+}
+
+// Decode ...
+func (cc *ChainedMACCodec) Decode(c Conn) ([]byte, error) {
+	frame, err := cc.codec.Decode(c)
+	if err != nil {
+		return nil, err
+	}
+	st := cc.state(c)
+	size := cc.hash().Size()
+	if len(frame) < size {
+		return nil, ErrMACMismatch
+	}
+	payload, mac := frame[:len(frame)-size], frame[len(frame)-size:]
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	expected := cc.sum(st.received, payload)
+	if !hmac.Equal(mac, expected) {
+		return nil, ErrMACMismatch
+	}
+	st.received = expected
+	return payload, nil
+}
+
+func (cc *ChainedMACCodec) hasPartialFrame(c Conn) bool {
+	return hasPartialFrame(cc.codec, c)
+}
+
+func (cc *ChainedMACCodec) releaseConn(c Conn) {
+	cc.states.Delete(c)
+	releaseCodecState(cc.codec, c)
+}
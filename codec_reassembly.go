@@ -0,0 +1,121 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+const (
+	// streamIDLength is the length of the stream id leading the fragments and the messages of StreamReassemblyCodec.
+	streamIDLength = 4
+	// streamFragmentHeaderLength is the length of the stream id and the flags of fragment.
+	streamFragmentHeaderLength = streamIDLength + 1
+	// streamFragmentFinal is the flag of the final fragment of message.
+	streamFragmentFinal = 0x01
+)
+
+// StreamMessage is a message of StreamReassemblyCodec parsed into the stream id and the payload.
+type StreamMessage struct {
+	StreamID uint32
+	Payload  []byte
+}
+
+// StreamReassemblyCodec reassembles the messages chunked into fragments interleaved across streams of
+// a multiplexed protocol, like the DATA frames of HTTP/2. Each fragment is a frame of the inner codec made of
+// a 4-byte big-endian stream id, a flags byte whose lowest bit marks the final fragment of a message, and
+// a chunk of the message, which can be built by Fragment. The chunks are buffered per stream until the final
+// fragment of the stream arrives, then Decode returns the whole message prefixed with its stream id,
+// which can be parsed by Parse. Encode takes a fragment built by Fragment and encodes it by the inner codec.
+type StreamReassemblyCodec struct {
+	codec            ICodec
+	maxMessageLength int
+	conns            sync.Map // Conn -> map[uint32][]byte, the pending messages of streams
+}
+
+// NewStreamReassemblyCodec instantiates and returns a codec reassembling the fragments delimited by the inner codec,
+// messages longer than maxMessageLength will be rejected, 0 means no limit.
+func NewStreamReassemblyCodec(codec ICodec, maxMessageLength int) *StreamReassemblyCodec {
+	return &StreamReassemblyCodec{codec: codec, maxMessageLength: maxMessageLength}
+}
+
+// Fragment builds a fragment of the stream with the given chunk of message, final marks the last chunk.
+func (cc *StreamReassemblyCodec) Fragment(streamID uint32, chunk []byte, final bool) []byte {
+	fragment := make([]byte, streamFragmentHeaderLength+len(chunk))
+	binary.BigEndian.PutUint32(fragment, streamID)
+	if final {
+		fragment[streamIDLength] = streamFragmentFinal
+	}
+	copy(fragment[streamFragmentHeaderLength:], chunk)
+	return fragment
+}
+
+// Parse parses the message returned by Decode, the payload shares the memory of message.
+func (cc *StreamReassemblyCodec) Parse(message []byte) (StreamMessage, error) {
+	if len(message) < streamIDLength {
+		return StreamMessage{}, ErrInvalidStreamFragment
+	}
+	return StreamMessage{StreamID: binary.BigEndian.Uint32(message), Payload: message[streamIDLength:]}, nil
+}
+
+// Encode ...
+func (cc *StreamReassemblyCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	if len(buf) < streamFragmentHeaderLength {
+		return nil, ErrInvalidStreamFragment
+	}
+	return cc.codec.Encode(c, buf)
+}
+
+// Decode ...
+func (cc *StreamReassemblyCodec) Decode(c Conn) ([]byte, error) {
+	var streams map[uint32][]byte
+	if v, ok := cc.conns.Load(c); ok {
+		streams = v.(map[uint32][]byte)
+	}
+	for {
+		fragment, err := cc.codec.Decode(c)
+		if err != nil || fragment == nil {
+			return nil, err
+		}
+		if len(fragment) < streamFragmentHeaderLength {
+			return nil, ErrInvalidStreamFragment
+		}
+		streamID := binary.BigEndian.Uint32(fragment)
+		message, ok := streams[streamID]
+		if !ok {
+			// The message outlives the buffer of the inner codec, which may be reused by the next read.
+			message = append(message, fragment[:streamIDLength]...)
+		}
+		message = append(message, fragment[streamFragmentHeaderLength:]...)
+		if cc.maxMessageLength > 0 && len(message)-streamIDLength > cc.maxMessageLength {
+			return nil, fmt.Errorf("%w: %d", ErrFrameTooLarge, len(message)-streamIDLength)
+		}
+		if fragment[streamIDLength]&streamFragmentFinal != 0 {
+			if ok {
+				delete(streams, streamID)
+			}
+			return message, nil
+		}
+		if streams == nil {
+			streams = make(map[uint32][]byte)
+			cc.conns.Store(c, streams)
+		}
+		streams[streamID] = message
+	}
+}
+
+func (cc *StreamReassemblyCodec) hasPartialFrame(c Conn) bool {
+	if v, ok := cc.conns.Load(c); ok && len(v.(map[uint32][]byte)) > 0 {
+		return true
+	}
+	return hasPartialFrame(cc.codec, c)
+}
+
+func (cc *StreamReassemblyCodec) releaseConn(c Conn) {
+	cc.conns.Delete(c)
+	releaseCodecState(cc.codec, c)
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// respCRLF is the terminator of lines in RESP.
+var respCRLF = []byte("\r\n")
+
+// RESPCodec decodes values of the Redis serialization protocol: simple strings, errors, integers,
+// bulk strings and arrays, which may be nested, as well as inline commands terminated by a newline.
+// Decode returns the raw bytes of a complete value and ErrIncompletePacket if the value is incomplete,
+// Encode returns the given bytes as they are, which are expected to be encoded in RESP already.
+type RESPCodec struct{}
+
+// Encode ...
+func (cc *RESPCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	return buf, nil
+}
+
+// Decode ...
+func (cc *RESPCodec) Decode(c Conn) ([]byte, error) {
+	buf := c.Read()
+	if len(buf) == 0 {
+		return nil, ErrIncompletePacket
+	}
+	end, err := parseRESP(buf, 0)
+	if err != nil {
+		return nil, err
+	}
+	c.ShiftN(end)
+	return buf[:end], nil
+}
+
+// parseRESP parses the value starting at pos of buf and returns the end of it.
+func parseRESP(buf []byte, pos int) (end int, err error) {
+	if pos >= len(buf) {
+		return 0, ErrIncompletePacket
+	}
+	switch buf[pos] {
+	case '+', '-', ':':
+		_, end, err = parseRESPLine(buf, pos+1)
+		return
+	case '$':
+		var n int
+		if n, end, err = parseRESPLength(buf, pos+1); err != nil || n < 0 {
+			return
+		}
+		if end+n+len(respCRLF) > len(buf) {
+			return 0, ErrIncompletePacket
+		}
+		if !bytes.Equal(buf[end+n:end+n+len(respCRLF)], respCRLF) {
+			return 0, ErrInvalidRESP
+		}
+		return end + n + len(respCRLF), nil
+	case '*':
+		var n int
+		if n, end, err = parseRESPLength(buf, pos+1); err != nil {
+			return
+		}
+		for i := 0; i < n; i++ {
+			if end, err = parseRESP(buf, end); err != nil {
+				return
+			}
+		}
+		return
+	default:
+		// Inline command, which is terminated by either CRLF or LF.
+		idx := bytes.IndexByte(buf[pos:], '\n')
+		if idx == -1 {
+			return 0, ErrIncompletePacket
+		}
+		return pos + idx + 1, nil
+	}
+}
+
+// parseRESPLine returns the line starting at pos of buf without the trailing CRLF and the end of it.
+func parseRESPLine(buf []byte, pos int) (line []byte, end int, err error) {
+	idx := bytes.Index(buf[pos:], respCRLF)
+	if idx == -1 {
+		return nil, 0, ErrIncompletePacket
+	}
+	return buf[pos : pos+idx], pos + idx + len(respCRLF), nil
+}
+
+// parseRESPLength parses the length of a bulk string or an array, -1 stands for a null value.
+func parseRESPLength(buf []byte, pos int) (n, end int, err error) {
+	var line []byte
+	if line, end, err = parseRESPLine(buf, pos); err != nil {
+		return
+	}
+	if n, err = strconv.Atoi(string(line)); err != nil || n < -1 {
+		return 0, 0, ErrInvalidRESP
+	}
+	return
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+// SniffFunc chooses the codec of a connection by the leading bytes of its inbound data, which are peeked as head
+// without being consumed. It will be invoked whenever new data arrives until it returns a non-nil codec, return
+// a nil codec to wait for more data, or a non-nil error to close the connection, e.g. ErrUnknownProtocol.
+type SniffFunc func(head []byte) (ICodec, error)
+
+// SniffingCodec serves multiple protocols on one address by sniffing the leading bytes of each connection to choose
+// its codec, e.g. HTTP requests and the frames of a custom protocol. The chosen codec replaces SniffingCodec as
+// the codec of the connection by Conn.SetCodec and decodes all data from the beginning, as the sniffed data is left
+// in the inbound buffer. Data written before the codec is chosen, e.g. in OnOpened, is not encoded.
+type SniffingCodec struct {
+	sniff          SniffFunc
+	maxSniffLength int
+}
+
+// NewSniffingCodec instantiates and returns a codec choosing the codec of each connection by sniff, which is given
+// at most maxSniffLength bytes, a connection is closed with ErrUnknownProtocol if no codec is chosen once
+// maxSniffLength bytes have arrived, 0 means no limit.
+func NewSniffingCodec(sniff SniffFunc, maxSniffLength int) *SniffingCodec {
+	return &SniffingCodec{sniff: sniff, maxSniffLength: maxSniffLength}
+}
+
+// Encode ...
+func (cc *SniffingCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	return buf, nil
+}
+
+// Decode ...
+func (cc *SniffingCodec) Decode(c Conn) ([]byte, error) {
+	head, _ := c.Peek(cc.maxSniffLength)
+	codec, err := cc.sniff(head)
+	if err != nil {
+		return nil, err
+	}
+	if codec == nil {
+		if cc.maxSniffLength > 0 && len(head) >= cc.maxSniffLength {
+			return nil, ErrUnknownProtocol
+		}
+		return nil, ErrIncompletePacket
+	}
+	if err = c.SetCodec(codec); err != nil {
+		return nil, err
+	}
+	return codec.Decode(c)
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import "sync"
+
+// StateMachineStep advances the state machine of StateMachineCodec by a byte, it returns the next state
+// and whether the byte completes a frame.
+type StateMachineStep func(state int, b byte) (nextState int, frameComplete bool)
+
+// StateMachineCodec decodes frames by feeding the inbound bytes through a user-provided state machine,
+// e.g. a DFA generated by ragel, the bytes fed until a frame completes make up the frame.
+// The state of an incomplete frame is kept across calls of Decode, so that the bytes are fed only once.
+// Encode returns the given bytes as they are.
+type StateMachineCodec struct {
+	initial int
+	step    StateMachineStep
+	conns   sync.Map // Conn -> *machineState
+}
+
+// machineState is the state machine of a connection and the number of bytes it has been fed with.
+type machineState struct {
+	state int
+	fed   int
+}
+
+// NewStateMachineCodec instantiates and returns a codec driven by the step function, which starts every frame
+// from the initial state.
+func NewStateMachineCodec(initial int, step StateMachineStep) *StateMachineCodec {
+	return &StateMachineCodec{initial: initial, step: step}
+}
+
+// Encode ...
+func (cc *StateMachineCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	return buf, nil
+}
+
+// Decode ...
+func (cc *StateMachineCodec) Decode(c Conn) ([]byte, error) {
+	ms := &machineState{state: cc.initial}
+	if v, ok := cc.conns.Load(c); ok {
+		ms = v.(*machineState)
+	}
+	buf := c.Read()
+	for i := ms.fed; i < len(buf); i++ {
+		var complete bool
+		if ms.state, complete = cc.step(ms.state, buf[i]); complete {
+			cc.conns.Delete(c)
+			c.ShiftN(i + 1)
+			return buf[:i+1], nil
+		}
+	}
+	if len(buf) > ms.fed {
+		ms.fed = len(buf)
+		cc.conns.Store(c, ms)
+	}
+	return nil, ErrIncompletePacket
+}
+
+func (cc *StateMachineCodec) hasPartialFrame(c Conn) bool {
+	_, ok := cc.conns.Load(c)
+	return ok
+}
+
+func (cc *StateMachineCodec) releaseConn(c Conn) {
+	cc.conns.Delete(c)
+}
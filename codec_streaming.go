@@ -0,0 +1,99 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import "sync"
+
+// StreamingLengthFieldBasedFrameCodec is a stateful LengthFieldBasedFrameCodec for large frames spanning
+// many reads, it parses the header of a frame only once and caches the expected length of the whole frame per
+// connection until the frame is complete, meanwhile Decode returns (nil, nil) to signal that more data is needed
+// without walking through or copying the buffered data.
+type StreamingLengthFieldBasedFrameCodec struct {
+	LengthFieldBasedFrameCodec
+	frameLengths sync.Map // Conn -> length of the pending frame, including header
+}
+
+// NewStreamingLengthFieldBasedFrameCodec instantiates and returns a stateful codec based on the length field.
+func NewStreamingLengthFieldBasedFrameCodec(ec EncoderConfig, dc DecoderConfig) *StreamingLengthFieldBasedFrameCodec {
+	return &StreamingLengthFieldBasedFrameCodec{
+		LengthFieldBasedFrameCodec: LengthFieldBasedFrameCodec{encoderConfig: ec, decoderConfig: dc},
+	}
+}
+
+// Decode ...
+func (cc *StreamingLengthFieldBasedFrameCodec) Decode(c Conn) ([]byte, error) {
+	frame, token, err := cc.decodeFrame(c)
+	if frame == nil {
+		return nil, err
+	}
+	fullMessage := make([]byte, len(frame))
+	copy(fullMessage, frame)
+	c.ShiftN(token.n)
+	return fullMessage, nil
+}
+
+// decodeFrame returns the frame aliasing the inbound buffer once all of it has arrived, along with the token holding
+// its inbound bytes, without consuming them.
+func (cc *StreamingLengthFieldBasedFrameCodec) decodeFrame(c Conn) ([]byte, FrameToken, error) {
+	var frameLength int
+	if v, ok := cc.frameLengths.Load(c); ok {
+		frameLength = v.(int)
+	} else {
+		headerLength := cc.decoderConfig.LengthFieldOffset + cc.decoderConfig.LengthFieldLength
+		size, header := c.ReadN(headerLength)
+		if size < headerLength {
+			return nil, FrameToken{}, nil
+		}
+		in := innerBuffer(header[cc.decoderConfig.LengthFieldOffset:])
+		_, length, err := cc.getUnadjustedFrameLength(&in)
+		if err != nil {
+			return nil, FrameToken{}, err
+		}
+		msgLength, err := cc.adjustFrameLength(length)
+		if err != nil {
+			return nil, FrameToken{}, err
+		}
+		frameLength = headerLength + msgLength
+		cc.frameLengths.Store(c, frameLength)
+	}
+
+	if c.BufferLength() < frameLength {
+		return nil, FrameToken{}, nil
+	}
+	cc.frameLengths.Delete(c)
+	_, buf := c.ReadN(frameLength)
+	return buf[cc.decoderConfig.InitialBytesToStrip:], NewFrameToken(frameLength), nil
+}
+
+func (cc *StreamingLengthFieldBasedFrameCodec) hasPartialFrame(c Conn) bool {
+	_, ok := cc.frameLengths.Load(c)
+	return ok
+}
+
+func (cc *StreamingLengthFieldBasedFrameCodec) releaseConn(c Conn) {
+	cc.frameLengths.Delete(c)
+}
+
+// ZeroCopyStreamingLengthFieldBasedFrameCodec is a StreamingLengthFieldBasedFrameCodec implementing ZeroCopyCodec,
+// the frames passed to EventHandler.React alias the inbound buffer and are only valid until React returns.
+type ZeroCopyStreamingLengthFieldBasedFrameCodec struct {
+	StreamingLengthFieldBasedFrameCodec
+}
+
+// NewZeroCopyStreamingLengthFieldBasedFrameCodec instantiates and returns a stateful codec based on the length field,
+// which decodes frames without copying them, see ZeroCopyCodec.
+func NewZeroCopyStreamingLengthFieldBasedFrameCodec(ec EncoderConfig,
+	dc DecoderConfig) *ZeroCopyStreamingLengthFieldBasedFrameCodec {
+	return &ZeroCopyStreamingLengthFieldBasedFrameCodec{
+		StreamingLengthFieldBasedFrameCodec: StreamingLengthFieldBasedFrameCodec{
+			LengthFieldBasedFrameCodec: LengthFieldBasedFrameCodec{encoderConfig: ec, decoderConfig: dc},
+		},
+	}
+}
+
+// DecodeZeroCopy decodes a frame aliasing the inbound buffer once all of it has arrived, see ZeroCopyCodec.
+func (cc *ZeroCopyStreamingLengthFieldBasedFrameCodec) DecodeZeroCopy(c Conn) ([]byte, FrameToken, error) {
+	return cc.decodeFrame(c)
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// maxOctetCountDigits is the maximum number of digits allowed in the MSG-LEN field of octet-counting framing.
+const maxOctetCountDigits = 10
+
+// SyslogTCPCodec encodes/decodes syslog messages transported over TCP, as described in RFC 6587.
+// It detects the framing of each message individually: messages starting with a digit are decoded with
+// octet-counting framing ("MSG-LEN SP SYSLOG-MSG"), otherwise they are decoded with non-transparent framing,
+// which means the message is terminated by a LF.
+// Messages are always encoded with octet-counting framing.
+type SyslogTCPCodec struct {
+}
+
+// Encode ...
+func (cc *SyslogTCPCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	out := strconv.AppendInt(make([]byte, 0, len(buf)+maxOctetCountDigits+1), int64(len(buf)), 10)
+	out = append(out, ' ')
+	return append(out, buf...), nil
+}
+
+// Decode ...
+func (cc *SyslogTCPCodec) Decode(c Conn) ([]byte, error) {
+	buf := c.Read()
+	if len(buf) == 0 {
+		return nil, ErrIncompletePacket
+	}
+	if buf[0] < '0' || buf[0] > '9' {
+		idx := bytes.IndexByte(buf, CRLFByte)
+		if idx == -1 {
+			return nil, ErrIncompletePacket
+		}
+		c.ShiftN(idx + 1)
+		return buf[:idx], nil
+	}
+
+	var msgLen int
+	for i, b := range buf {
+		switch {
+		case b >= '0' && b <= '9':
+			if i == maxOctetCountDigits {
+				return nil, ErrInvalidOctetCount
+			}
+			msgLen = msgLen*10 + int(b-'0')
+		case b == ' ':
+			start := i + 1
+			if len(buf)-start < msgLen {
+				return nil, ErrIncompletePacket
+			}
+			c.ShiftN(start + msgLen)
+			return buf[start : start+msgLen], nil
+		default:
+			return nil, ErrInvalidOctetCount
+		}
+	}
+	return nil, ErrIncompletePacket
+}
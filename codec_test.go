@@ -1,11 +1,74 @@
 package gnet
 
 import (
+	"bytes"
+	"compress/flate"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
 	"math/rand"
+	"strings"
 	"testing"
+	"time"
 )
 
+// mockConn is a Conn backed by an in-memory inbound buffer, it is used for testing codecs without a server.
+type mockConn struct {
+	Conn
+	in []byte
+}
+
+func (c *mockConn) Read() []byte {
+	return c.in
+}
+
+func (c *mockConn) ResetBuffer() {
+	c.in = nil
+}
+
+func (c *mockConn) ReadN(n int) (size int, buf []byte) {
+	if n <= 0 || n > len(c.in) {
+		n = len(c.in)
+	}
+	return n, c.in[:n]
+}
+
+func (c *mockConn) ShiftN(n int) (size int) {
+	if n <= 0 || n > len(c.in) {
+		size = len(c.in)
+		c.ResetBuffer()
+		return
+	}
+	c.in = c.in[n:]
+	return n
+}
+
+func (c *mockConn) BufferLength() int {
+	return len(c.in)
+}
+
+// decodeAll feeds the given stream into the codec in fragments of random sizes and returns all decoded frames.
+func decodeAll(codec ICodec, stream []byte) (frames [][]byte) {
+	c := new(mockConn)
+	for len(stream) > 0 {
+		n := rand.Intn(8) + 1
+		if n > len(stream) {
+			n = len(stream)
+		}
+		c.in = append(c.in, stream[:n]...)
+		stream = stream[n:]
+		for {
+			frame, err := codec.Decode(c)
+			if err != nil || frame == nil {
+				break
+			}
+			frames = append(frames, append([]byte{}, frame...))
+		}
+	}
+	return
+}
+
 func TestLengthFieldBasedFrameCodecWith1(t *testing.T) {
 	encoderConfig := EncoderConfig{
 		ByteOrder:                       binary.BigEndian,
@@ -205,6 +268,51 @@ func TestLengthFieldBasedFrameCodecWith8(t *testing.T) {
 	}
 }
 
+func TestLengthFieldBasedFrameCodecWith6(t *testing.T) {
+	for _, byteOrder := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		encoderConfig := EncoderConfig{
+			ByteOrder:         byteOrder,
+			LengthFieldLength: 6,
+		}
+		decoderConfig := DecoderConfig{
+			ByteOrder:           byteOrder,
+			LengthFieldLength:   6,
+			InitialBytesToStrip: 6,
+		}
+		codec := NewLengthFieldBasedFrameCodec(encoderConfig, decoderConfig)
+		data := make([]byte, 300)
+		if _, err := rand.Read(data); err != nil {
+			panic(err)
+		}
+		out, err := codec.Encode(nil, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := []byte{0, 0, 0, 0, 1, 44}
+		if byteOrder == binary.LittleEndian {
+			header = []byte{44, 1, 0, 0, 0, 0}
+		}
+		if string(out[:6]) != string(header) || string(out[6:]) != string(data) {
+			t.Fatalf("unexpected frame encoded with %v: %v", byteOrder, out[:6])
+		}
+		frames := decodeAll(codec, append(out, out...))
+		if len(frames) != 2 || string(frames[0]) != string(data) || string(frames[1]) != string(data) {
+			t.Fatalf("data don't match with %v, decoded %d frames", byteOrder, len(frames))
+		}
+	}
+
+	buf := make([]byte, 7)
+	rand.Read(buf)
+	for _, byteOrder := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		if p := writeUintN(byteOrder, readUintN(byteOrder, buf), 7); string(buf) != string(p) {
+			t.Fatalf("data don't match with %v, raw data: %v, recovered data: %v\n", byteOrder, buf, p)
+		}
+	}
+	if readUintN(binary.BigEndian, buf[:4]) != uint64(binary.BigEndian.Uint32(buf)) {
+		t.Fatal("unexpected integer read in 4 bytes")
+	}
+}
+
 func TestFixedLengthFrameCodec_Encode(t *testing.T) {
 	codec := NewFixedLengthFrameCodec(8)
 	if data, err := codec.Encode(nil, make([]byte, 15)); data != nil || err != ErrInvalidFixedLength {
@@ -212,6 +320,25 @@ func TestFixedLengthFrameCodec_Encode(t *testing.T) {
 	}
 }
 
+func TestLengthFieldBasedFrameCodecInvalidStrip(t *testing.T) {
+	codec := NewLengthFieldBasedFrameCodec(
+		EncoderConfig{ByteOrder: binary.BigEndian, LengthFieldLength: 2},
+		DecoderConfig{ByteOrder: binary.BigEndian, LengthFieldLength: 2, InitialBytesToStrip: 8},
+	)
+	out, _ := codec.Encode(nil, []byte("abc"))
+	c := &mockConn{in: out}
+	if _, err := codec.Decode(c); !errors.Is(err, ErrInvalidStripLength) {
+		t.Fatalf("expected ErrInvalidStripLength, got %v", err)
+	}
+	zc := &ZeroCopyLengthFieldBasedFrameCodec{*codec}
+	if _, _, err := zc.DecodeZeroCopy(c); !errors.Is(err, ErrInvalidStripLength) {
+		t.Fatalf("expected ErrInvalidStripLength decoding with zero copy, got %v", err)
+	}
+	if len(c.in) != len(out) {
+		t.Fatal("expected the frame not to be consumed")
+	}
+}
+
 func TestInnerBufferReadN(t *testing.T) {
 	var in innerBuffer
 	data := make([]byte, 10)
@@ -232,3 +359,1284 @@ func TestInnerBufferReadN(t *testing.T) {
 		t.Fatal("wrong length of leftover bytes")
 	}
 }
+
+func TestSyslogTCPCodec(t *testing.T) {
+	codec := new(SyslogTCPCodec)
+	messages := []string{
+		"<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - 'su root' failed",
+		"<165>1 2003-08-24T05:14:15.000003-07:00 192.0.2.1 myproc 8710 - - %% It's time to make the do-nuts.",
+		"",
+		"<13>Feb  5 17:32:18 10.0.0.99 Use the BFG!",
+	}
+	var stream []byte
+	for i, msg := range messages {
+		if i%2 == 0 {
+			out, err := codec.Encode(nil, []byte(msg))
+			if err != nil {
+				t.Fatalf("failed to encode syslog message: %v", err)
+			}
+			stream = append(stream, out...)
+		} else {
+			stream = append(stream, msg+"\n"...)
+		}
+	}
+	frames := decodeAll(codec, stream)
+	if len(frames) != len(messages) {
+		t.Fatalf("expected %d frames, got %d", len(messages), len(frames))
+	}
+	for i, frame := range frames {
+		if string(frame) != messages[i] {
+			t.Fatalf("frame %d mismatched, expected: %q, got: %q", i, messages[i], frame)
+		}
+	}
+
+	if _, err := codec.Decode(&mockConn{in: []byte("12")}); err != ErrUnexpectedEOF {
+		t.Fatalf("expected ErrUnexpectedEOF, got %v", err)
+	}
+	if _, err := codec.Decode(&mockConn{in: []byte("12a <1>")}); err != ErrInvalidOctetCount {
+		t.Fatalf("expected ErrInvalidOctetCount, got %v", err)
+	}
+}
+
+func TestHandshakeCodec(t *testing.T) {
+	version := []byte("GNET/1\n")
+	handshake := func(c Conn) (bool, error) {
+		size, buf := c.ReadN(len(version))
+		if size < len(version) {
+			return false, nil
+		}
+		if string(buf) != string(version) {
+			return false, errors.New("unsupported version")
+		}
+		c.ShiftN(size)
+		return true, nil
+	}
+	encoderConfig := EncoderConfig{
+		ByteOrder:         binary.BigEndian,
+		LengthFieldLength: 2,
+	}
+	decoderConfig := DecoderConfig{
+		ByteOrder:           binary.BigEndian,
+		LengthFieldLength:   2,
+		InitialBytesToStrip: 2,
+	}
+	inner := NewLengthFieldBasedFrameCodec(encoderConfig, decoderConfig)
+	codec := NewHandshakeCodec(inner, handshake)
+
+	c := new(mockConn)
+	if out, _ := codec.Encode(c, version); string(out) != string(version) {
+		t.Fatalf("data written during handshake should not be encoded, got: %q", out)
+	}
+	stream := append([]byte{}, version...)
+	var messages []string
+	for i := 0; i < 10; i++ {
+		msg := fmt.Sprintf("message-%d", i)
+		messages = append(messages, msg)
+		out, _ := inner.Encode(nil, []byte(msg))
+		stream = append(stream, out...)
+	}
+	frames := decodeAll(codec, stream)
+	if len(frames) != len(messages) {
+		t.Fatalf("expected %d frames, got %d", len(messages), len(frames))
+	}
+	for i, frame := range frames {
+		if string(frame) != messages[i] {
+			t.Fatalf("frame %d mismatched, expected: %q, got: %q", i, messages[i], frame)
+		}
+	}
+
+	c.in = []byte("GNET/2\n")
+	if _, err := codec.Decode(c); err == nil {
+		t.Fatal("expected error of unsupported version")
+	}
+	c.in = append([]byte{}, stream...)
+	if frame, err := codec.Decode(c); err != nil || string(frame) != messages[0] {
+		t.Fatalf("failed to decode the first frame after handshake, frame: %q, error: %v", frame, err)
+	}
+	if out, _ := codec.Encode(c, []byte("hi")); len(out) != 4 {
+		t.Fatalf("data written after handshake should be encoded by the inner codec, got: %q", out)
+	}
+	codec.releaseConn(c)
+	if _, ok := codec.done.Load(c); ok {
+		t.Fatal("handshake state should have been released")
+	}
+}
+
+func TestLengthFieldBasedFrameCodecMaxFrameLength(t *testing.T) {
+	encoderConfig := EncoderConfig{
+		ByteOrder:         binary.BigEndian,
+		LengthFieldLength: 4,
+	}
+	decoderConfig := DecoderConfig{
+		ByteOrder:           binary.BigEndian,
+		LengthFieldLength:   4,
+		InitialBytesToStrip: 4,
+		MaxFrameLength:      1024,
+	}
+	codec := NewLengthFieldBasedFrameCodec(encoderConfig, decoderConfig)
+
+	out, _ := codec.Encode(nil, make([]byte, 1024))
+	if frame, err := codec.Decode(&mockConn{in: out}); err != nil || len(frame) != 1024 {
+		t.Fatalf("failed to decode frame with the maximum length, error: %v", err)
+	}
+	// only the header of an oversized frame is needed to reject it.
+	header := []byte{0x7f, 0xff, 0xff, 0xff}
+	_, err := codec.Decode(&mockConn{in: header})
+	if !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "2147483647") {
+		t.Fatalf("expected the offending length in error, got %v", err)
+	}
+
+	// a length field of 8 bytes beyond the range of int must not wrap around to a negative length.
+	decoderConfig.LengthFieldLength = 8
+	decoderConfig.InitialBytesToStrip = 8
+	for _, codec := range []ICodec{
+		NewLengthFieldBasedFrameCodec(encoderConfig, decoderConfig),
+		NewStreamingLengthFieldBasedFrameCodec(encoderConfig, decoderConfig),
+	} {
+		header = make([]byte, 8)
+		binary.BigEndian.PutUint64(header, 1<<63+5)
+		if _, err = codec.Decode(&mockConn{in: header}); !errors.Is(err, ErrFrameTooLarge) {
+			t.Fatalf("expected ErrFrameTooLarge decoding a length of 2^63+5 by %T, got %v", codec, err)
+		}
+	}
+}
+
+func TestLengthFieldBasedFrameCodecTooLessLength(t *testing.T) {
+	decoderConfig := DecoderConfig{
+		ByteOrder:         binary.BigEndian,
+		LengthFieldLength: 2,
+		LengthAdjustment:  -4,
+	}
+	for _, codec := range []ICodec{
+		NewLengthFieldBasedFrameCodec(EncoderConfig{}, decoderConfig),
+		NewStreamingLengthFieldBasedFrameCodec(EncoderConfig{}, decoderConfig),
+	} {
+		if _, err := codec.Decode(&mockConn{in: []byte{0, 2, 'a', 'b'}}); !errors.Is(err, ErrTooLessLength) {
+			t.Fatalf("expected ErrTooLessLength decoding by %T, got %v", codec, err)
+		}
+	}
+}
+
+func TestMultiDelimiterBasedFrameCodec(t *testing.T) {
+	codec := NewMultiDelimiterBasedFrameCodec([]byte("\r\n\r\n"))
+	messages := []string{"GET / HTTP/1.1\r\nHost: gnet", "", "a\r\nb\r\n\rc"}
+	var stream []byte
+	for _, msg := range messages {
+		out, _ := codec.Encode(nil, []byte(msg))
+		stream = append(stream, out...)
+	}
+	frames := decodeAll(codec, stream)
+	if len(frames) != len(messages) {
+		t.Fatalf("expected %d frames, got %d", len(messages), len(frames))
+	}
+	for i, frame := range frames {
+		if string(frame) != messages[i] {
+			t.Fatalf("frame %d mismatched, expected: %q, got: %q", i, messages[i], frame)
+		}
+	}
+	if _, err := codec.Decode(&mockConn{in: []byte("partial\r\n\r")}); err != ErrDelimiterNotFound {
+		t.Fatalf("expected ErrDelimiterNotFound, got %v", err)
+	}
+}
+
+func TestChainedMACCodec(t *testing.T) {
+	encoderConfig := EncoderConfig{
+		ByteOrder:         binary.BigEndian,
+		LengthFieldLength: 2,
+	}
+	decoderConfig := DecoderConfig{
+		ByteOrder:           binary.BigEndian,
+		LengthFieldLength:   2,
+		InitialBytesToStrip: 2,
+	}
+	inner := NewLengthFieldBasedFrameCodec(encoderConfig, decoderConfig)
+	key := []byte("secret")
+	sender := new(mockConn)
+	var (
+		messages []string
+		frames   [][]byte
+	)
+	encoder := NewChainedMACCodec(inner, key, nil)
+	for i := 0; i < 5; i++ {
+		msg := fmt.Sprintf("message-%d", i)
+		messages = append(messages, msg)
+		out, err := encoder.Encode(sender, []byte(msg))
+		if err != nil {
+			t.Fatalf("failed to encode frame: %v", err)
+		}
+		frames = append(frames, out)
+	}
+
+	decoded := decodeAll(NewChainedMACCodec(inner, key, nil), bytes.Join(frames, nil))
+	if len(decoded) != len(messages) {
+		t.Fatalf("expected %d frames, got %d", len(messages), len(decoded))
+	}
+	for i, frame := range decoded {
+		if string(frame) != messages[i] {
+			t.Fatalf("frame %d mismatched, expected: %q, got: %q", i, messages[i], frame)
+		}
+	}
+
+	decodeStream := func(frames ...[]byte) (n int, err error) {
+		codec := NewChainedMACCodec(inner, key, nil)
+		c := &mockConn{in: bytes.Join(frames, nil)}
+		for c.BufferLength() > 0 {
+			if _, err = codec.Decode(c); err != nil {
+				return
+			}
+			n++
+		}
+		return
+	}
+	// reordered frames.
+	if n, err := decodeStream(frames[0], frames[2], frames[1]); n != 1 || err != ErrMACMismatch {
+		t.Fatalf("expected ErrMACMismatch after 1 frame, got %v after %d frames", err, n)
+	}
+	// a frame is dropped from the stream.
+	if n, err := decodeStream(frames[0], frames[1], frames[3], frames[4]); n != 2 || err != ErrMACMismatch {
+		t.Fatalf("expected ErrMACMismatch after 2 frames, got %v after %d frames", err, n)
+	}
+	// a frame is truncated.
+	truncated := append([]byte{}, frames[1][:len(frames[1])-1]...)
+	binary.BigEndian.PutUint16(truncated, uint16(len(truncated)-2))
+	if n, err := decodeStream(frames[0], truncated); n != 1 || err != ErrMACMismatch {
+		t.Fatalf("expected ErrMACMismatch after 1 frame, got %v after %d frames", err, n)
+	}
+	// a different key.
+	if _, err := NewChainedMACCodec(inner, []byte("guess"), nil).Decode(&mockConn{in: frames[0]}); err != ErrMACMismatch {
+		t.Fatalf("expected ErrMACMismatch, got %v", err)
+	}
+}
+
+func TestChecksumCodec(t *testing.T) {
+	encoderConfig := EncoderConfig{
+		ByteOrder:         binary.BigEndian,
+		LengthFieldLength: 2,
+	}
+	decoderConfig := DecoderConfig{
+		ByteOrder:           binary.BigEndian,
+		LengthFieldLength:   2,
+		InitialBytesToStrip: 2,
+	}
+	inner := NewLengthFieldBasedFrameCodec(encoderConfig, decoderConfig)
+	for _, codec := range []*ChecksumCodec{NewChecksumCodec(inner), NewChecksumCodecWithPolynomial(inner, crc32.Castagnoli)} {
+		var (
+			messages []string
+			frames   [][]byte
+		)
+		for i := 0; i < 5; i++ {
+			msg := fmt.Sprintf("message-%d", i)
+			messages = append(messages, msg)
+			out, err := codec.Encode(nil, []byte(msg))
+			if err != nil {
+				t.Fatalf("failed to encode frame: %v", err)
+			}
+			frames = append(frames, out)
+		}
+		decoded := decodeAll(codec, bytes.Join(frames, nil))
+		if len(decoded) != len(messages) {
+			t.Fatalf("expected %d frames, got %d", len(messages), len(decoded))
+		}
+		for i, frame := range decoded {
+			if string(frame) != messages[i] {
+				t.Fatalf("frame %d mismatched, expected: %q, got: %q", i, messages[i], frame)
+			}
+		}
+
+		// a corrupted payload.
+		corrupted := append([]byte{}, frames[0]...)
+		corrupted[3] ^= 0xff
+		if _, err := codec.Decode(&mockConn{in: corrupted}); err != ErrChecksumMismatch {
+			t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+		}
+		// a frame shorter than the checksum.
+		short, _ := inner.Encode(nil, []byte("ab"))
+		if _, err := codec.Decode(&mockConn{in: short}); err != ErrChecksumMismatch {
+			t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+		}
+	}
+	if _, err := NewChecksumCodecWithPolynomial(inner, crc32.Koopman).Decode(&mockConn{in: mustEncode(NewChecksumCodec(inner), "message")}); err != ErrChecksumMismatch {
+		t.Fatalf("expected ErrChecksumMismatch with a different polynomial, got %v", err)
+	}
+}
+
+func mustEncode(codec ICodec, msg string) []byte {
+	out, err := codec.Encode(nil, []byte(msg))
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+type readNCountingConn struct {
+	mockConn
+	readN int
+}
+
+func (c *readNCountingConn) ReadN(n int) (size int, buf []byte) {
+	c.readN++
+	return c.mockConn.ReadN(n)
+}
+
+func TestStreamingLengthFieldBasedFrameCodec(t *testing.T) {
+	encoderConfig := EncoderConfig{
+		ByteOrder:         binary.BigEndian,
+		LengthFieldLength: 4,
+	}
+	decoderConfig := DecoderConfig{
+		ByteOrder:           binary.BigEndian,
+		LengthFieldLength:   4,
+		InitialBytesToStrip: 4,
+	}
+	codec := NewStreamingLengthFieldBasedFrameCodec(encoderConfig, decoderConfig)
+	data := make([]byte, 2*1024*1024)
+	_, _ = rand.Read(data)
+	large, _ := codec.Encode(nil, data)
+	small, _ := codec.Encode(nil, []byte("small"))
+	empty, _ := codec.Encode(nil, nil)
+	stream := append(append(append([]byte{}, large...), empty...), small...)
+
+	c := new(readNCountingConn)
+	var frames [][]byte
+	for chunk := 64 * 1024; len(stream) > 0; stream = stream[chunk:] {
+		if chunk > len(stream) {
+			chunk = len(stream)
+		}
+		c.in = append(c.in, stream[:chunk]...)
+		for {
+			frame, err := codec.Decode(c)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if frame == nil {
+				break
+			}
+			frames = append(frames, frame)
+		}
+	}
+	if len(frames) != 3 || !bytes.Equal(frames[0], data) || len(frames[1]) != 0 || string(frames[2]) != "small" {
+		t.Fatalf("frames mismatched, got %d frames", len(frames))
+	}
+	// one ReadN for parsing the header and one for reading the whole frame,
+	// plus the last attempt of parsing a header from the empty buffer.
+	if c.readN != 7 {
+		t.Fatalf("expected the header of each frame to be parsed only once, got %d calls of ReadN", c.readN)
+	}
+	if _, ok := codec.frameLengths.Load(c); ok {
+		t.Fatal("state of frame should have been cleared")
+	}
+}
+
+func TestVarintLengthFrameCodec(t *testing.T) {
+	codec := NewVarintLengthFrameCodec(1 << 16)
+	// lengths chosen to cover 1, 2 and 3 bytes long varint prefixes.
+	messages := [][]byte{[]byte("hello"), {}, make([]byte, 300), make([]byte, 1<<15)}
+	for _, msg := range messages[2:] {
+		_, _ = rand.Read(msg)
+	}
+	var stream []byte
+	for _, msg := range messages {
+		out, _ := codec.Encode(nil, msg)
+		stream = append(stream, out...)
+	}
+	frames := decodeAll(codec, stream)
+	if len(frames) != len(messages) {
+		t.Fatalf("expected %d frames, got %d", len(messages), len(frames))
+	}
+	for i, frame := range frames {
+		if !bytes.Equal(frame, messages[i]) {
+			t.Fatalf("frame %d mismatched", i)
+		}
+	}
+
+	// varint of 300 split across reads.
+	if _, err := codec.Decode(&mockConn{in: []byte{0xac}}); err != ErrUnexpectedEOF {
+		t.Fatalf("expected ErrUnexpectedEOF, got %v", err)
+	}
+	overflow := bytes.Repeat([]byte{0xff}, binary.MaxVarintLen64+1)
+	if _, err := codec.Decode(&mockConn{in: overflow}); err != ErrInvalidVarint {
+		t.Fatalf("expected ErrInvalidVarint, got %v", err)
+	}
+	tooLarge, _ := NewVarintLengthFrameCodec(0).Encode(nil, make([]byte, 1<<16+1))
+	if _, err := codec.Decode(&mockConn{in: tooLarge[:4]}); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+	}
+}
+
+func TestCompressionCodec(t *testing.T) {
+	codec := NewCompressionCodec(NewVarintLengthFrameCodec(0), flate.BestSpeed)
+	messages := [][]byte{
+		[]byte(strings.Repeat("gnet is a high-performance networking framework. ", 100)),
+		{},
+		make([]byte, 1024),
+	}
+	_, _ = rand.Read(messages[2])
+	var stream []byte
+	for _, msg := range messages {
+		out, err := codec.Encode(nil, msg)
+		if err != nil {
+			t.Fatalf("failed to encode: %v", err)
+		}
+		stream = append(stream, out...)
+	}
+	if len(stream) >= len(messages[0]) {
+		t.Fatalf("repetitive payload should have been compressed, got %d bytes", len(stream))
+	}
+	// decode twice to reuse the pooled readers.
+	for round := 0; round < 2; round++ {
+		frames := decodeAll(codec, stream)
+		if len(frames) != len(messages) {
+			t.Fatalf("expected %d frames, got %d", len(messages), len(frames))
+		}
+		for i, frame := range frames {
+			if !bytes.Equal(frame, messages[i]) {
+				t.Fatalf("frame %d mismatched", i)
+			}
+		}
+	}
+
+	if _, err := NewCompressionCodec(&BuiltInFrameCodec{}, 42).Encode(nil, []byte("a")); err == nil {
+		t.Fatal("expected error of invalid compression level")
+	}
+	corrupted, _ := NewVarintLengthFrameCodec(0).Encode(nil, []byte{0xff, 0xff, 0xff})
+	if _, err := codec.Decode(&mockConn{in: corrupted}); err == nil {
+		t.Fatal("expected error of corrupted data")
+	}
+}
+
+func TestCompressionCodecDictionary(t *testing.T) {
+	dict := []byte(`{"id":,"name":"","email":"@example.com","active":true,"roles":["admin","user"]}`)
+	var messages [][]byte
+	for i := 0; i < 10; i++ {
+		messages = append(messages, []byte(fmt.Sprintf(
+			`{"id":%d,"name":"user%d","email":"user%d@example.com","active":true,"roles":["user"]}`, i, i, i)))
+	}
+	encodeAll := func(codec *CompressionCodec, c Conn) (stream []byte) {
+		for _, msg := range messages {
+			out, err := codec.Encode(c, msg)
+			if err != nil {
+				t.Fatalf("failed to encode: %v", err)
+			}
+			stream = append(stream, out...)
+		}
+		return
+	}
+	verify := func(frames [][]byte) {
+		if len(frames) != len(messages) {
+			t.Fatalf("expected %d frames, got %d", len(messages), len(frames))
+		}
+		for i, frame := range frames {
+			if !bytes.Equal(frame, messages[i]) {
+				t.Fatalf("frame %d mismatched, expected: %q, got: %q", i, messages[i], frame)
+			}
+		}
+	}
+
+	plain := encodeAll(NewCompressionCodec(NewVarintLengthFrameCodec(0), flate.BestCompression), nil)
+	shared := NewCompressionCodecWithDictionary(NewVarintLengthFrameCodec(0), flate.BestCompression, dict)
+	withDict := encodeAll(shared, nil)
+	if len(withDict)*2 > len(plain) {
+		t.Fatalf("dictionary should improve compression ratio, %d bytes with dictionary, %d bytes without",
+			len(withDict), len(plain))
+	}
+	verify(decodeAll(shared, withDict))
+
+	// per-connection dictionary takes precedence over the shared one.
+	codec := NewCompressionCodec(NewVarintLengthFrameCodec(0), flate.BestCompression)
+	c := new(mockConn)
+	codec.SetDictionary(c, dict)
+	stream := encodeAll(codec, c)
+	if !bytes.Equal(stream, withDict) {
+		t.Fatal("per-connection dictionary should produce the same output as the shared one")
+	}
+	c.in = stream
+	var frames [][]byte
+	for {
+		frame, err := codec.Decode(c)
+		if err != nil || frame == nil {
+			break
+		}
+		frames = append(frames, frame)
+	}
+	verify(frames)
+	if _, err := codec.Decode(&mockConn{in: stream}); err == nil {
+		t.Fatal("expected error when decoding without the dictionary")
+	}
+	codec.releaseConn(c)
+	if _, ok := codec.conns.Load(c); ok {
+		t.Fatal("dictionary of connection should have been released")
+	}
+}
+
+func TestVersionedCodec(t *testing.T) {
+	newInner := func() ICodec {
+		return NewLengthFieldBasedFrameCodec(
+			EncoderConfig{ByteOrder: binary.BigEndian, LengthFieldLength: 2},
+			DecoderConfig{ByteOrder: binary.BigEndian, LengthFieldLength: 2, InitialBytesToStrip: 2})
+	}
+	messages := []string{"v2 frame", "x", "another v2 frame"}
+	for _, perConnection := range []bool{false, true} {
+		codec := NewVersionedCodec(newInner(), 2, []byte{1, 2}, perConnection)
+		var stream []byte
+		for _, msg := range messages {
+			out, _ := codec.Encode(new(mockConn), []byte(msg))
+			if out[0] != 2 {
+				t.Fatalf("frame should start with the version, got %d", out[0])
+			}
+			stream = append(stream, out...)
+		}
+		if perConnection {
+			c := new(mockConn)
+			stream = stream[:0]
+			for _, msg := range messages {
+				out, _ := codec.Encode(c, []byte(msg))
+				stream = append(stream, out...)
+			}
+			if bytes.Count(stream, []byte{2}) != 1 {
+				t.Fatalf("version should be sent only once per connection, got stream: %v", stream)
+			}
+		}
+		frames := decodeAll(codec, stream)
+		if len(frames) != len(messages) {
+			t.Fatalf("expected %d frames, got %d", len(messages), len(frames))
+		}
+		for i, frame := range frames {
+			if string(frame) != messages[i] {
+				t.Fatalf("frame %d mismatched, expected: %q, got: %q", i, messages[i], frame)
+			}
+		}
+	}
+
+	// version 1 is accepted as well, while version 3 is rejected.
+	codec := NewVersionedCodec(newInner(), 2, []byte{1, 2}, false)
+	c := &mockConn{in: []byte{1}}
+	if frame, _ := codec.Decode(c); frame != nil {
+		t.Fatal("frame should not be decoded with the version byte only")
+	}
+	c.in = append(c.in, 0, 2, 'h')
+	if frame, _ := codec.Decode(c); frame != nil {
+		t.Fatal("frame should not be decoded until it is complete")
+	}
+	c.in = append(c.in, 'i', 3, 0, 0)
+	if frame, err := codec.Decode(c); err != nil || string(frame) != "hi" {
+		t.Fatalf("failed to decode frame fragmented at the version byte, frame: %q, error: %v", frame, err)
+	}
+	_, err := codec.Decode(c)
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("expected ErrUnsupportedVersion, got %v", err)
+	}
+	codec.releaseConn(c)
+	if _, ok := codec.validated.Load(c); ok {
+		t.Fatal("version state should have been released")
+	}
+}
+
+func TestBitmaskCodec(t *testing.T) {
+	codec := NewBitmaskCodec([]BitmaskField{{Bit: 0, Size: 4}, {Bit: 3, Size: 8}, {Bit: 1, Size: 2}, {Bit: 15, Size: 1}})
+	combinations := []map[uint][]byte{
+		{},
+		{0: []byte("temp")},
+		{3: []byte("latitude"), 1: []byte("hp")},
+		{0: []byte("temp"), 3: []byte("latitude"), 1: []byte("hp"), 15: []byte("!")},
+		{15: []byte("?")},
+	}
+	var stream []byte
+	for _, fields := range combinations {
+		frame, err := codec.EncodeFields(fields)
+		if err != nil {
+			t.Fatalf("failed to encode fields: %v", err)
+		}
+		out, err := codec.Encode(nil, frame)
+		if err != nil {
+			t.Fatalf("failed to encode frame: %v", err)
+		}
+		stream = append(stream, out...)
+	}
+	// fields are laid out in the order of definitions.
+	if frame, _ := codec.EncodeFields(combinations[2]); string(frame[2:]) != "latitudehp" {
+		t.Fatalf("fields should be in the order of definitions, got: %q", frame[2:])
+	}
+
+	frames := decodeAll(codec, stream)
+	if len(frames) != len(combinations) {
+		t.Fatalf("expected %d frames, got %d", len(combinations), len(frames))
+	}
+	for i, frame := range frames {
+		fields, err := codec.Fields(frame)
+		if err != nil {
+			t.Fatalf("failed to parse fields of frame %d: %v", i, err)
+		}
+		if len(fields) != len(combinations[i]) {
+			t.Fatalf("frame %d: expected %d fields, got %d", i, len(combinations[i]), len(fields))
+		}
+		for bit, value := range combinations[i] {
+			if string(fields[bit]) != string(value) {
+				t.Fatalf("frame %d: field %d mismatched, expected: %q, got: %q", i, bit, value, fields[bit])
+			}
+		}
+	}
+
+	// the frame is split within the bitmask and within the fields.
+	c := &mockConn{in: []byte{0x00}}
+	if _, err := codec.DecodeFields(c); err != ErrUnexpectedEOF {
+		t.Fatalf("expected ErrUnexpectedEOF, got %v", err)
+	}
+	c.in = append(c.in, 0x09, 't', 'e')
+	if _, err := codec.DecodeFields(c); err != ErrUnexpectedEOF {
+		t.Fatalf("expected ErrUnexpectedEOF, got %v", err)
+	}
+	c.in = append(c.in, "mplatitude"...)
+	if fields, err := codec.DecodeFields(c); err != nil || string(fields[0]) != "temp" || string(fields[3]) != "latitude" {
+		t.Fatalf("failed to decode fragmented frame, fields: %q, error: %v", fields, err)
+	}
+
+	if _, err := codec.Decode(&mockConn{in: []byte{0x00, 0x04}}); err != ErrInvalidBitmaskField {
+		t.Fatalf("expected ErrInvalidBitmaskField for undefined bit, got %v", err)
+	}
+	if _, err := codec.EncodeFields(map[uint][]byte{0: []byte("hot")}); err != ErrInvalidBitmaskField {
+		t.Fatalf("expected ErrInvalidBitmaskField for field of wrong size, got %v", err)
+	}
+}
+
+// asyncEncodingConn is a mockConn encoding the data written by AsyncWrite with the codec.
+type asyncEncodingConn struct {
+	mockConn
+	codec   ICodec
+	written chan []byte
+}
+
+func (c *asyncEncodingConn) AsyncWrite(buf []byte) error {
+	out, err := c.codec.Encode(c, buf)
+	if err == nil && out != nil {
+		c.written <- out
+	}
+	return err
+}
+
+func TestAggregatingCodec(t *testing.T) {
+	codec := NewAggregatingCodec(NewVarintLengthFrameCodec(0), 32, time.Millisecond*50)
+	c := &asyncEncodingConn{codec: codec, written: make(chan []byte, 4)}
+	messages := [][]byte{[]byte("a"), []byte("bb"), []byte("ccc"), []byte(strings.Repeat("d", 20)), {}, []byte("eeee")}
+
+	// The first 4 messages fill up the batch: 4*4 + 1 + 2 + 3 + 20 >= 32.
+	var stream []byte
+	for i, msg := range messages[:4] {
+		out, err := codec.Encode(c, msg)
+		if err != nil {
+			t.Fatalf("failed to encode: %v", err)
+		}
+		if i < 3 && out != nil {
+			t.Fatalf("message %d should have been aggregated, got %q", i, out)
+		}
+		if i == 3 && out == nil {
+			t.Fatal("batch should have been flushed on size")
+		}
+		stream = append(stream, out...)
+	}
+	select {
+	case out := <-c.written:
+		t.Fatalf("batch flushed on size shouldn't be flushed again on time, got %q", out)
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	// The rest messages are flushed on time.
+	for _, msg := range messages[4:] {
+		if out, err := codec.Encode(c, msg); err != nil || out != nil {
+			t.Fatalf("message should have been aggregated, got %q, error: %v", out, err)
+		}
+	}
+	select {
+	case out := <-c.written:
+		stream = append(stream, out...)
+	case <-time.After(time.Second):
+		t.Fatal("batch should have been flushed on time")
+	}
+
+	frames := decodeAll(codec, stream)
+	if len(frames) != len(messages) {
+		t.Fatalf("expected %d frames, got %d", len(messages), len(frames))
+	}
+	for i, frame := range frames {
+		if !bytes.Equal(frame, messages[i]) {
+			t.Fatalf("frame %d mismatched, expected: %q, got: %q", i, messages[i], frame)
+		}
+	}
+
+	truncated, _ := NewVarintLengthFrameCodec(0).Encode(nil, []byte{0, 0, 0, 9, 'x'})
+	if _, err := codec.Decode(&mockConn{in: truncated}); err != ErrInvalidAggregatedFrame {
+		t.Fatalf("expected ErrInvalidAggregatedFrame, got %v", err)
+	}
+}
+
+func TestStateMachineCodec(t *testing.T) {
+	// A two-state machine recognizing frames terminated by CRLF, state 1 means a CR has just been seen.
+	var fed int
+	step := func(state int, b byte) (int, bool) {
+		fed++
+		switch {
+		case state == 1 && b == '\n':
+			return 0, true
+		case b == '\r':
+			return 1, false
+		default:
+			return 0, false
+		}
+	}
+	codec := NewStateMachineCodec(0, step)
+	messages := []string{"PING", "", "SET key a\rb", "\n"}
+	var stream []byte
+	for _, msg := range messages {
+		out, _ := codec.Encode(nil, []byte(msg+"\r\n"))
+		stream = append(stream, out...)
+	}
+	frames := decodeAll(codec, stream)
+	if len(frames) != len(messages) {
+		t.Fatalf("expected %d frames, got %d", len(messages), len(frames))
+	}
+	for i, frame := range frames {
+		if string(frame) != messages[i]+"\r\n" {
+			t.Fatalf("frame %d mismatched, expected: %q, got: %q", i, messages[i]+"\r\n", frame)
+		}
+	}
+	if fed != len(stream) {
+		t.Fatalf("expected every byte to be fed once, fed %d bytes of %d", fed, len(stream))
+	}
+
+	c := &mockConn{in: []byte("partial\r")}
+	if _, err := codec.Decode(c); err != ErrUnexpectedEOF {
+		t.Fatalf("expected ErrUnexpectedEOF, got %v", err)
+	}
+	releaseCodecState(codec, c)
+	c.in = []byte("\nnext\r\n")
+	if frame, err := codec.Decode(c); err != nil || string(frame) != "\nnext\r\n" {
+		t.Fatalf("expected the state to be reset on release, got frame: %q, error: %v", frame, err)
+	}
+}
+
+func TestTypedFixedLengthCodec(t *testing.T) {
+	codec := NewTypedFixedLengthCodec(6)
+	records := []TypedFrame{
+		{Type: 1, Payload: []byte("temp1")},
+		{Type: 2, Payload: []byte("humid")},
+		{Type: 0xff, Payload: []byte{0, 0, 0, 0, 0}},
+		{Type: 1, Payload: []byte("temp2")},
+	}
+	var stream []byte
+	for _, r := range records {
+		frame, err := codec.EncodeTyped(r.Type, r.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame, err = codec.Encode(nil, frame); err != nil {
+			t.Fatal(err)
+		}
+		stream = append(stream, frame...)
+	}
+	frames := decodeAll(codec, stream)
+	if len(frames) != len(records) {
+		t.Fatalf("expected %d frames, got %d", len(records), len(frames))
+	}
+	for i, frame := range frames {
+		r, err := codec.Parse(frame)
+		if err != nil || r.Type != records[i].Type || !bytes.Equal(r.Payload, records[i].Payload) {
+			t.Fatalf("frame %d mismatched, expected: %v, got: %v, error: %v", i, records[i], r, err)
+		}
+	}
+
+	if _, err := codec.EncodeTyped(1, []byte("too long")); err != ErrInvalidFixedLength {
+		t.Fatalf("expected ErrInvalidFixedLength, got %v", err)
+	}
+	if _, err := codec.Encode(nil, make([]byte, 7)); err != ErrInvalidFixedLength {
+		t.Fatalf("expected ErrInvalidFixedLength, got %v", err)
+	}
+
+	// A partial frame waits for the rest of it.
+	c := &mockConn{in: stream[:4]}
+	if _, err := codec.DecodeTyped(c); err != ErrUnexpectedEOF || c.BufferLength() != 4 {
+		t.Fatalf("expected the partial frame to be kept with ErrUnexpectedEOF, got %v, %d bytes left", err, c.BufferLength())
+	}
+	c.in = append(c.in, stream[4:6]...)
+	if r, err := codec.DecodeTyped(c); err != nil || r.Type != 1 || string(r.Payload) != "temp1" {
+		t.Fatalf("expected the completed frame, got %v, error: %v", r, err)
+	}
+	if _, err := NewFixedLengthFrameCodec(6).Decode(&mockConn{in: stream[:4]}); err != ErrUnexpectedEOF {
+		t.Fatalf("expected ErrUnexpectedEOF for partial fixed-length frame, got %v", err)
+	}
+}
+
+func TestRESPCodec(t *testing.T) {
+	codec := new(RESPCodec)
+	values := []string{
+		"+OK\r\n",
+		"-ERR unknown command 'foo'\r\n",
+		":1000\r\n",
+		"$5\r\nhello\r\n",
+		"$0\r\n\r\n",
+		"$-1\r\n",
+		"$4\r\na\r\nb\r\n",
+		"*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n",
+		"*3\r\n:1\r\n*2\r\n+a\r\n$-1\r\n*0\r\n",
+		"*-1\r\n",
+		"PING\r\n",
+		"SET key value\n",
+	}
+	var stream []byte
+	for _, v := range values {
+		out, _ := codec.Encode(nil, []byte(v))
+		stream = append(stream, out...)
+	}
+	frames := decodeAll(codec, stream)
+	if len(frames) != len(values) {
+		t.Fatalf("expected %d frames, got %d", len(values), len(frames))
+	}
+	for i, frame := range frames {
+		if string(frame) != values[i] {
+			t.Fatalf("frame %d mismatched, expected: %q, got: %q", i, values[i], frame)
+		}
+	}
+
+	for _, partial := range []string{"", "+OK", "$5\r\nhel", "$5\r\nhello\r", "*2\r\n$3\r\nGET\r\n", "*3\r\n:1\r\n*2\r\n+a\r\n", "PING"} {
+		c := &mockConn{in: []byte(partial)}
+		if _, err := codec.Decode(c); err != ErrIncompletePacket || c.BufferLength() != len(partial) {
+			t.Fatalf("expected ErrIncompletePacket without consuming %q, got %v", partial, err)
+		}
+	}
+	for _, invalid := range []string{"$x\r\n", "*-2\r\n", "$2\r\nabcd\r\n"} {
+		if _, err := codec.Decode(&mockConn{in: []byte(invalid)}); err != ErrInvalidRESP {
+			t.Fatalf("expected ErrInvalidRESP for %q, got %v", invalid, err)
+		}
+	}
+}
+
+func TestIncompletePacketOfBuiltInCodecs(t *testing.T) {
+	encoderConfig := EncoderConfig{ByteOrder: binary.BigEndian, LengthFieldLength: 2}
+	decoderConfig := DecoderConfig{ByteOrder: binary.BigEndian, LengthFieldLength: 2, InitialBytesToStrip: 2}
+	codecs := map[string]ICodec{
+		"line":         new(LineBasedFrameCodec),
+		"delimiter":    NewDelimiterBasedFrameCodec('|'),
+		"fixed-length": NewFixedLengthFrameCodec(8),
+		"length-field": NewLengthFieldBasedFrameCodec(encoderConfig, decoderConfig),
+		"varint":       NewVarintLengthFrameCodec(0),
+	}
+	partials := map[string][]byte{
+		"line":         []byte("no newline"),
+		"delimiter":    []byte("no delimiter"),
+		"fixed-length": []byte("short"),
+		"length-field": {0, 10, 'a'},
+		"varint":       {0x80},
+	}
+	for name, codec := range codecs {
+		c := &mockConn{in: partials[name]}
+		if frame, err := codec.Decode(c); frame != nil || err != ErrIncompletePacket {
+			t.Fatalf("%s: expected ErrIncompletePacket, got frame: %q, error: %v", name, frame, err)
+		}
+		if c.BufferLength() != len(partials[name]) {
+			t.Fatalf("%s: expected the partial frame to be kept, %d bytes left", name, c.BufferLength())
+		}
+	}
+}
+
+func TestStreamReassemblyCodec(t *testing.T) {
+	codec := NewStreamReassemblyCodec(NewVarintLengthFrameCodec(0), 16)
+	// Fragments of two streams interleaved, stream 3 completes first though it starts later.
+	fragments := [][]byte{
+		codec.Fragment(1, []byte("hello, "), false),
+		codec.Fragment(3, []byte("foo"), false),
+		codec.Fragment(1, []byte("gnet"), false),
+		codec.Fragment(3, []byte("bar"), true),
+		codec.Fragment(1, []byte("!"), true),
+		codec.Fragment(3, []byte("baz"), true),
+	}
+	var stream []byte
+	for _, fragment := range fragments {
+		out, err := codec.Encode(nil, fragment)
+		if err != nil {
+			t.Fatalf("failed to encode: %v", err)
+		}
+		stream = append(stream, out...)
+	}
+	expected := []StreamMessage{{3, []byte("foobar")}, {1, []byte("hello, gnet!")}, {3, []byte("baz")}}
+	frames := decodeAll(codec, stream)
+	if len(frames) != len(expected) {
+		t.Fatalf("expected %d messages, got %d", len(expected), len(frames))
+	}
+	for i, frame := range frames {
+		msg, err := codec.Parse(frame)
+		if err != nil || msg.StreamID != expected[i].StreamID || !bytes.Equal(msg.Payload, expected[i].Payload) {
+			t.Fatalf("message %d mismatched, expected: %v, got: %v, error: %v", i, expected[i], msg, err)
+		}
+	}
+
+	c := &mockConn{}
+	c.in, _ = codec.Encode(c, codec.Fragment(5, []byte("partial"), false))
+	if frame, err := codec.Decode(c); err != ErrIncompletePacket || frame != nil {
+		t.Fatalf("expected no message before the final fragment, got %q, error: %v", frame, err)
+	}
+	if !hasPartialFrame(codec, c) {
+		t.Fatal("expected the pending message to be a partial frame")
+	}
+	c.in, _ = codec.Encode(c, codec.Fragment(5, []byte(" and too long"), true))
+	if _, err := codec.Decode(c); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+	}
+	releaseCodecState(codec, c)
+	if hasPartialFrame(codec, c) {
+		t.Fatal("expected the pending messages to be released")
+	}
+
+	if _, err := codec.Encode(nil, []byte{0, 0, 1}); err != ErrInvalidStreamFragment {
+		t.Fatalf("expected ErrInvalidStreamFragment, got %v", err)
+	}
+	c.in, _ = NewVarintLengthFrameCodec(0).Encode(nil, []byte{0, 0, 1})
+	if _, err := codec.Decode(c); err != ErrInvalidStreamFragment {
+		t.Fatalf("expected ErrInvalidStreamFragment, got %v", err)
+	}
+}
+
+func TestInlineCommandCodec(t *testing.T) {
+	codec := NewInlineCommandCodec(64)
+	commands := []struct {
+		line string
+		args []string
+	}{
+		{"PING", []string{"PING"}},
+		{"  SET\tkey   value  ", []string{"SET", "key", "value"}},
+		{`SET "hello world" 'it\'s'`, []string{"SET", "hello world", "it's"}},
+		{`ECHO "a\"b\\c\n\x41" ''`, []string{"ECHO", "a\"b\\c\nA", ""}},
+		{"", nil},
+	}
+	var stream []byte
+	for i, cmd := range commands {
+		// Both CRLF and LF terminate a line.
+		out, _ := codec.Encode(nil, []byte(cmd.line))
+		if i%2 == 1 {
+			out = append([]byte(cmd.line), '\n')
+		}
+		stream = append(stream, out...)
+	}
+	frames := decodeAll(codec, stream)
+	if len(frames) != len(commands) {
+		t.Fatalf("expected %d lines, got %d", len(commands), len(frames))
+	}
+	for i, frame := range frames {
+		cmd, err := codec.Parse(frame)
+		if err != nil || len(cmd.Args) != len(commands[i].args) {
+			t.Fatalf("line %d mismatched, expected: %q, got: %q, error: %v", i, commands[i].args, cmd.Args, err)
+		}
+		for j, arg := range cmd.Args {
+			if string(arg) != commands[i].args[j] {
+				t.Fatalf("argument %d of line %d mismatched, expected: %q, got: %q", j, i, commands[i].args[j], arg)
+			}
+		}
+	}
+
+	args := [][]byte{[]byte("SET"), []byte("hello world"), []byte(`"quoted" 'x'`), {}, {'\r', '\n', 0}}
+	cmd, err := codec.Parse(codec.EncodeCommand(args...))
+	if err != nil || len(cmd.Args) != len(args) {
+		t.Fatalf("expected %q to be encoded and parsed back, got %q, error: %v", args, cmd.Args, err)
+	}
+	for i, arg := range cmd.Args {
+		if !bytes.Equal(arg, args[i]) {
+			t.Fatalf("argument %d mismatched, expected: %q, got: %q", i, args[i], arg)
+		}
+	}
+
+	c := &mockConn{in: []byte("GET key")}
+	if _, err := codec.Decode(c); err != ErrIncompletePacket {
+		t.Fatalf("expected ErrIncompletePacket, got %v", err)
+	}
+	c.in = append(c.in, "\r\nGET "...)
+	if cmd, err = codec.DecodeCommand(c); err != nil || len(cmd.Args) != 2 || string(c.in) != "GET " {
+		t.Fatalf("expected the complete line to be decoded, got %q, error: %v", cmd.Args, err)
+	}
+	for _, line := range []string{`SET "key value`, `SET 'key`, `SET "key"value`, `SET 'key'"`} {
+		if _, err := codec.Decode(&mockConn{in: []byte(line + "\r\n")}); err != ErrUnbalancedQuotes {
+			t.Fatalf("expected ErrUnbalancedQuotes for %q, got %v", line, err)
+		}
+	}
+	if _, err := codec.Decode(&mockConn{in: bytes.Repeat([]byte("a"), 65)}); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+	}
+}
+
+func TestHeaderChecksumFrameCodec(t *testing.T) {
+	if sum := crc16CCITT([]byte("123456789")); sum != 0x29b1 {
+		t.Fatalf("expected CRC-16/CCITT-FALSE check value 0x29b1, got %#x", sum)
+	}
+	codec := NewHeaderChecksumFrameCodec(2, 1<<16, nil)
+	messages := [][]byte{[]byte("\x01\x02hello"), []byte("\x03\x04"), append([]byte("\x05\x06"), make([]byte, 1024)...)}
+	_, _ = rand.Read(messages[2][2:])
+	var stream []byte
+	for _, msg := range messages {
+		out, err := codec.Encode(nil, msg)
+		if err != nil {
+			t.Fatalf("failed to encode: %v", err)
+		}
+		stream = append(stream, out...)
+	}
+	// decodeAll splits the headers into fragments as well.
+	frames := decodeAll(codec, stream)
+	if len(frames) != len(messages) {
+		t.Fatalf("expected %d frames, got %d", len(messages), len(frames))
+	}
+	for i, frame := range frames {
+		if !bytes.Equal(frame, messages[i]) {
+			t.Fatalf("frame %d mismatched", i)
+		}
+	}
+
+	frame, _ := codec.Encode(nil, messages[0])
+	for i := 1; i < codec.headerLength(); i++ {
+		if _, err := codec.Decode(&mockConn{in: frame[:i]}); err != ErrIncompletePacket {
+			t.Fatalf("expected ErrIncompletePacket with %d bytes of header, got %v", i, err)
+		}
+	}
+	// A corrupt length is caught once the header arrives rather than waiting for the bogus payload.
+	corrupt := append([]byte{}, frame[:codec.headerLength()]...)
+	corrupt[1] ^= 0x10
+	if _, err := codec.Decode(&mockConn{in: corrupt}); err != ErrHeaderChecksumMismatch {
+		t.Fatalf("expected ErrHeaderChecksumMismatch, got %v", err)
+	}
+	if _, err := codec.Encode(nil, []byte{1}); err != ErrHeaderFieldsMissing {
+		t.Fatalf("expected ErrHeaderFieldsMissing, got %v", err)
+	}
+	tooLarge, _ := NewHeaderChecksumFrameCodec(2, 0, nil).Encode(nil, make([]byte, 2+1<<16+1))
+	if _, err := codec.Decode(&mockConn{in: tooLarge[:codec.headerLength()]}); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+	}
+}
+
+func TestLengthFieldBasedFrameCodecZeroCopy(t *testing.T) {
+	encoderConfig := EncoderConfig{
+		ByteOrder:         binary.BigEndian,
+		LengthFieldLength: 4,
+	}
+	decoderConfig := DecoderConfig{
+		ByteOrder:           binary.BigEndian,
+		LengthFieldLength:   4,
+		InitialBytesToStrip: 4,
+	}
+	var (
+		_ ZeroCopyCodec = NewZeroCopyLengthFieldBasedFrameCodec(encoderConfig, decoderConfig)
+		_ ZeroCopyCodec = NewZeroCopyStreamingLengthFieldBasedFrameCodec(encoderConfig, decoderConfig)
+	)
+	// The frames decoded by the default codecs must not alias the inbound buffer.
+	for _, codec := range []ICodec{
+		NewLengthFieldBasedFrameCodec(encoderConfig, decoderConfig),
+		NewStreamingLengthFieldBasedFrameCodec(encoderConfig, decoderConfig),
+	} {
+		if _, ok := codec.(ZeroCopyCodec); ok {
+			t.Fatalf("expected %T not to decode frames with zero copy unless opted in", codec)
+		}
+	}
+	codec := NewZeroCopyLengthFieldBasedFrameCodec(encoderConfig, decoderConfig)
+	out, _ := codec.Encode(nil, []byte("hello"))
+	c := &mockConn{in: out}
+	frame, token, err := codec.DecodeZeroCopy(c)
+	if err != nil || string(frame) != "hello" {
+		t.Fatalf("expected frame %q, got %q and error %v", "hello", frame, err)
+	}
+	if &frame[0] != &out[4] {
+		t.Fatal("expected the frame to alias the inbound buffer")
+	}
+	if c.BufferLength() != len(out) || token.n != len(out) {
+		t.Fatalf("expected %d bytes to be held rather than shifted, got %d in buffer and %d held",
+			len(out), c.BufferLength(), token.n)
+	}
+	if _, _, err = codec.DecodeZeroCopy(&mockConn{in: out[:6]}); err != ErrIncompletePacket {
+		t.Fatalf("expected ErrIncompletePacket, got %v", err)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		c.in = out
+		_, token, _ := codec.DecodeZeroCopy(c)
+		c.ShiftN(token.n)
+	})
+	if allocs != 0 {
+		t.Fatalf("expected no allocations, got %v", allocs)
+	}
+
+	streaming := NewZeroCopyStreamingLengthFieldBasedFrameCodec(encoderConfig, decoderConfig)
+	c = &mockConn{in: out}
+	if frame, token, err = streaming.DecodeZeroCopy(c); err != nil || string(frame) != "hello" || &frame[0] != &out[4] {
+		t.Fatalf("expected frame %q aliasing the inbound buffer, got %q and error %v", "hello", frame, err)
+	}
+	if c.BufferLength() != len(out) || token.n != len(out) {
+		t.Fatalf("expected %d bytes to be held rather than shifted, got %d in buffer and %d held",
+			len(out), c.BufferLength(), token.n)
+	}
+}
+
+func BenchmarkLengthFieldBasedFrameCodecDecode(b *testing.B) {
+	encoderConfig := EncoderConfig{
+		ByteOrder:         binary.BigEndian,
+		LengthFieldLength: 4,
+	}
+	decoderConfig := DecoderConfig{
+		ByteOrder:           binary.BigEndian,
+		LengthFieldLength:   4,
+		InitialBytesToStrip: 4,
+	}
+	codec := NewLengthFieldBasedFrameCodec(encoderConfig, decoderConfig)
+	out, _ := codec.Encode(nil, make([]byte, 1024))
+	c := new(mockConn)
+	b.Run("copy", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(out)))
+		for i := 0; i < b.N; i++ {
+			c.in = out
+			_, _ = codec.Decode(c)
+		}
+	})
+	zc := &ZeroCopyLengthFieldBasedFrameCodec{*codec}
+	b.Run("zero-copy", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(out)))
+		for i := 0; i < b.N; i++ {
+			c.in = out
+			_, token, _ := zc.DecodeZeroCopy(c)
+			c.ShiftN(token.n)
+		}
+	})
+}
+
+// asyncWriteRecordingConn is a mockConn recording the data written by AsyncWrite.
+type asyncWriteRecordingConn struct {
+	mockConn
+	written [][]byte
+}
+
+func (c *asyncWriteRecordingConn) AsyncWrite(buf []byte) error {
+	c.written = append(c.written, buf)
+	return nil
+}
+
+func TestHTTPCodec(t *testing.T) {
+	requests := []string{
+		"GET /index.html HTTP/1.1\r\nHost: example.com\r\n\r\n",
+		"POST /form HTTP/1.1\r\nHost: example.com\r\ncontent-length: 11\r\n\r\nhello=world",
+		"POST /upload HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: gzip, chunked\r\n\r\n" +
+			"5;name=value\r\nhello\r\nB\r\n, world\r\n\r\n\r\n0\r\nX-Trailer: yes\r\n\r\n",
+		"PUT /empty HTTP/1.0\r\nContent-Length: 0\r\n\r\n",
+	}
+	codec := NewHTTPCodec(0)
+	// Empty lines between the requests are ignored.
+	frames := decodeAll(codec, []byte(strings.Join(requests, "\r\n")))
+	if len(frames) != len(requests) {
+		t.Fatalf("expected %d requests, got %d", len(requests), len(frames))
+	}
+	for i, frame := range frames {
+		if string(frame) != requests[i] {
+			t.Fatalf("request %d mismatched, expected: %q, got: %q", i, requests[i], frame)
+		}
+	}
+
+	for _, req := range []string{
+		"GET /\r\n\r\n",
+		"GET / SPDY/3\r\n\r\n",
+		"GET / HTTP/1.1\r\nHost\r\n\r\n",
+		"POST / HTTP/1.1\r\nContent-Length: -1\r\n\r\n",
+		"POST / HTTP/1.1\r\nContent-Length: 1\r\nContent-Length: 2\r\n\r\n",
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked, gzip\r\n\r\n",
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n",
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nabc\r\n",
+	} {
+		if _, err := codec.Decode(&mockConn{in: []byte(req)}); err != ErrInvalidHTTPRequest {
+			t.Fatalf("expected ErrInvalidHTTPRequest for %q, got %v", req, err)
+		}
+	}
+
+	limited := NewHTTPCodec(64)
+	if _, err := limited.Decode(&mockConn{in: []byte(requests[0])}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := limited.Decode(&mockConn{in: []byte("POST / HTTP/1.1\r\nContent-Length: 100\r\n\r\n")}); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+	}
+	if _, err := limited.Decode(&mockConn{in: []byte("GET / HTTP/1.1\r\n" + strings.Repeat("X-Header: value\r\n", 5))}); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("expected ErrFrameTooLarge for the incomplete headers, got %v", err)
+	}
+}
+
+func TestHTTPCodecExpectContinue(t *testing.T) {
+	codec := NewHTTPCodec(0)
+	header := "POST /upload HTTP/1.1\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n"
+	c := new(asyncWriteRecordingConn)
+	c.in = []byte(header)
+	for i := 0; i < 2; i++ {
+		if _, err := codec.Decode(c); err != ErrIncompletePacket {
+			t.Fatalf("expected ErrIncompletePacket, got %v", err)
+		}
+	}
+	if len(c.written) != 1 || string(c.written[0]) != "HTTP/1.1 100 Continue\r\n\r\n" {
+		t.Fatalf("expected 100 Continue to be sent once, got %q", c.written)
+	}
+	c.in = append(c.in, "hello"...)
+	frame, err := codec.Decode(c)
+	if err != nil || string(frame) != header+"hello" {
+		t.Fatalf("unexpected request decoded: %q, error: %v", frame, err)
+	}
+
+	// The next request of the connection gets its own 100 Continue.
+	c.in = []byte(header)
+	if _, err = codec.Decode(c); err != ErrIncompletePacket || len(c.written) != 2 {
+		t.Fatalf("expected 100 Continue for the next request, got %q, error: %v", c.written, err)
+	}
+	codec.releaseConn(c)
+
+	// No 100 Continue is needed once the body has begun to arrive.
+	c = new(asyncWriteRecordingConn)
+	c.in = []byte(header + "he")
+	if _, err = codec.Decode(c); err != ErrIncompletePacket || len(c.written) != 0 {
+		t.Fatalf("expected no 100 Continue with the body arriving, got %q, error: %v", c.written, err)
+	}
+}
+
+func TestBoundedDelimiterFrameCodec(t *testing.T) {
+	codec := NewBoundedDelimiterFrameCodec([]byte("\r\n"), 8, false)
+	messages := []string{"PING", "", "12345678"}
+	var stream []byte
+	for _, msg := range messages {
+		out, _ := codec.Encode(nil, []byte(msg))
+		stream = append(stream, out...)
+	}
+	frames := decodeAll(codec, stream)
+	if len(frames) != len(messages) {
+		t.Fatalf("expected %d frames, got %d", len(messages), len(frames))
+	}
+	for i, frame := range frames {
+		if string(frame) != messages[i] {
+			t.Fatalf("frame %d mismatched, expected: %q, got: %q", i, messages[i], frame)
+		}
+	}
+	// The last byte may be the beginning of the delimiter, so 9 bytes without it aren't too large yet.
+	if _, err := codec.Decode(&mockConn{in: []byte("12345678\r")}); err != ErrIncompletePacket {
+		t.Fatalf("expected ErrIncompletePacket, got %v", err)
+	}
+	for _, in := range []string{"1234567890", "123456789\r\n"} {
+		if _, err := codec.Decode(&mockConn{in: []byte(in)}); !errors.Is(err, ErrFrameTooLarge) {
+			t.Fatalf("expected ErrFrameTooLarge for %q, got %v", in, err)
+		}
+	}
+
+	// The frames too large are discarded up to the next delimiter, even if it arrives in pieces.
+	codec = NewBoundedDelimiterFrameCodec([]byte("\r\n"), 8, true)
+	stream = []byte("PING\r\n" + strings.Repeat("x", 100) + "\r\nPONG\r\n123456789\r\n\r\n")
+	frames = decodeAll(codec, stream)
+	if len(frames) != 3 || string(frames[0]) != "PING" || string(frames[1]) != "PONG" || len(frames[2]) != 0 {
+		t.Fatalf("expected the frames too large to be discarded, got %q", frames)
+	}
+	c := &mockConn{in: []byte(strings.Repeat("x", 20))}
+	if _, err := codec.Decode(c); err != ErrIncompletePacket || !codec.hasPartialFrame(c) {
+		t.Fatalf("expected the connection to be discarding, got %v", err)
+	}
+	if len(c.in) != 1 {
+		t.Fatalf("expected the data discarded except the possible beginning of delimiter, %d bytes left", len(c.in))
+	}
+	codec.releaseConn(c)
+	if codec.hasPartialFrame(c) {
+		t.Fatal("expected the state of connection to be released")
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+// TypedFrame is a fixed-length frame of TypedFixedLengthCodec parsed into the leading type byte and the payload.
+type TypedFrame struct {
+	Type    byte
+	Payload []byte
+}
+
+// TypedFixedLengthCodec encodes/decodes fixed-length frames whose first byte identifies the type of frame,
+// e.g. the records of devices. Decode returns the whole frame including the type byte, which can be parsed
+// by Parse, or DecodeTyped can be used to decode a frame into TypedFrame directly.
+type TypedFixedLengthCodec struct {
+	frameLength int
+}
+
+// NewTypedFixedLengthCodec instantiates and returns a codec with fixed length of frames including the type byte.
+func NewTypedFixedLengthCodec(frameLength int) *TypedFixedLengthCodec {
+	return &TypedFixedLengthCodec{frameLength}
+}
+
+// EncodeTyped builds a frame with the given type and payload, which must fill the rest of frame.
+func (cc *TypedFixedLengthCodec) EncodeTyped(frameType byte, payload []byte) ([]byte, error) {
+	if len(payload) != cc.frameLength-1 {
+		return nil, ErrInvalidFixedLength
+	}
+	frame := make([]byte, cc.frameLength)
+	frame[0] = frameType
+	copy(frame[1:], payload)
+	return frame, nil
+}
+
+// Parse parses the frame returned by Decode, the payload shares the memory of frame.
+func (cc *TypedFixedLengthCodec) Parse(frame []byte) (TypedFrame, error) {
+	if len(frame) != cc.frameLength || len(frame) == 0 {
+		return TypedFrame{}, ErrInvalidFixedLength
+	}
+	return TypedFrame{Type: frame[0], Payload: frame[1:]}, nil
+}
+
+// DecodeTyped decodes a frame from the connection and parses it.
+func (cc *TypedFixedLengthCodec) DecodeTyped(c Conn) (TypedFrame, error) {
+	frame, err := cc.Decode(c)
+	if err != nil {
+		return TypedFrame{}, err
+	}
+	return cc.Parse(frame)
+}
+
+// Encode ...
+func (cc *TypedFixedLengthCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	if len(buf)%cc.frameLength != 0 {
+		return nil, ErrInvalidFixedLength
+	}
+	return buf, nil
+}
+
+// Decode ...
+func (cc *TypedFixedLengthCodec) Decode(c Conn) ([]byte, error) {
+	return readFixedLength(c, cc.frameLength)
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// VarintLengthFrameCodec encodes/decodes frames prefixed with the length of payload as a base-128 varint
+// into/from TCP stream, which is the framing used by many protobuf-over-TCP protocols.
+type VarintLengthFrameCodec struct {
+	maxFrameLength int
+}
+
+// NewVarintLengthFrameCodec instantiates and returns a codec based on the varint length prefix,
+// frames with payload longer than maxFrameLength will be rejected, 0 means no limit.
+func NewVarintLengthFrameCodec(maxFrameLength int) *VarintLengthFrameCodec {
+	return &VarintLengthFrameCodec{maxFrameLength}
+}
+
+// Encode ...
+func (cc *VarintLengthFrameCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	out := make([]byte, binary.MaxVarintLen64+len(buf))
+	n := binary.PutUvarint(out, uint64(len(buf)))
+	return append(out[:n], buf...), nil
+}
+
+// Decode ...
+func (cc *VarintLengthFrameCodec) Decode(c Conn) ([]byte, error) {
+	buf := c.Read()
+	length, n := binary.Uvarint(buf)
+	if n == 0 {
+		// The varint is incomplete, wait for more data.
+		return nil, ErrIncompletePacket
+	}
+	if n < 0 {
+		return nil, ErrInvalidVarint
+	}
+	if cc.maxFrameLength > 0 && length > uint64(cc.maxFrameLength) {
+		return nil, fmt.Errorf("%w: %d", ErrFrameTooLarge, length)
+	}
+	if length > uint64(len(buf)-n) {
+		return nil, ErrIncompletePacket
+	}
+	frameLength := n + int(length)
+	c.ShiftN(frameLength)
+	return buf[n:frameLength], nil
+}
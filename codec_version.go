@@ -0,0 +1,84 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"fmt"
+	"sync"
+)
+
+// VersionedCodec wraps a codec and prepends a 1-byte protocol version to the frames of the inner codec,
+// the version is validated against a set of accepted versions and stripped before the inner codec decodes the rest.
+// The version appears either before each frame or only once at the beginning of each connection,
+// in the latter case frames ought to be encoded in the same order as they are written to the connection.
+type VersionedCodec struct {
+	codec         ICodec
+	version       byte
+	accepted      [256]bool
+	perConnection bool
+	validated     sync.Map // Conn -> the version byte has been consumed and validated
+	sent          sync.Map // Conn -> the version byte has been prepended, only used when perConnection is true
+}
+
+// NewVersionedCodec instantiates and returns a codec that encodes frames with the given version and decodes frames
+// with any of the accepted versions, only the given version is accepted if accepted is empty.
+// If perConnection is true, the version is only sent and validated once per connection instead of per frame.
+func NewVersionedCodec(codec ICodec, version byte, accepted []byte, perConnection bool) *VersionedCodec {
+	cc := &VersionedCodec{codec: codec, version: version, perConnection: perConnection}
+	if len(accepted) == 0 {
+		accepted = []byte{version}
+	}
+	for _, v := range accepted {
+		cc.accepted[v] = true
+	}
+	return cc
+}
+
+// Encode ...
+func (cc *VersionedCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	out, err := cc.codec.Encode(c, buf)
+	if err != nil {
+		return nil, err
+	}
+	if cc.perConnection {
+		if _, loaded := cc.sent.LoadOrStore(c, struct{}{}); loaded {
+			return out, nil
+		}
+	}
+	frame := make([]byte, 0, 1+len(out))
+	frame = append(frame, cc.version)
+	return append(frame, out...), nil
+}
+
+// Decode ...
+func (cc *VersionedCodec) Decode(c Conn) ([]byte, error) {
+	if _, ok := cc.validated.Load(c); !ok {
+		size, buf := c.ReadN(1)
+		if size == 0 {
+			return nil, ErrIncompletePacket
+		}
+		if v := buf[0]; !cc.accepted[v] {
+			return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, v)
+		}
+		c.ShiftN(1)
+		cc.validated.Store(c, struct{}{})
+	}
+	frame, err := cc.codec.Decode(c)
+	if frame != nil && !cc.perConnection {
+		// The next frame starts with its own version.
+		cc.validated.Delete(c)
+	}
+	return frame, err
+}
+
+func (cc *VersionedCodec) hasPartialFrame(c Conn) bool {
+	return hasPartialFrame(cc.codec, c)
+}
+
+func (cc *VersionedCodec) releaseConn(c Conn) {
+	cc.validated.Delete(c)
+	cc.sent.Delete(c)
+	releaseCodecState(cc.codec, c)
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// testConnBuffers runs the same operations and codecs against the connection of the platform, so that the data
+// buffered by connections is accessed the same way across platforms. newConn returns a connection with inbound
+// in its inbound ring-buffer, which wraps around the end of ring-buffer, and temp in its event-loop-buffer,
+// which is unset if temp is empty like the one out of React.
+func testConnBuffers(t *testing.T, newConn func(inbound, temp string) Conn) {
+	for _, tc := range []struct{ inbound, temp string }{
+		{"", ""},
+		{"", "hello, gnet"},
+		{"hello, gnet", ""},
+		{"hello, ", "gnet"},
+	} {
+		data := tc.inbound + tc.temp
+		name := fmt.Sprintf("%q+%q", tc.inbound, tc.temp)
+
+		c := newConn(tc.inbound, tc.temp)
+		if buf := c.Read(); string(buf) != data {
+			t.Fatalf("%s: expected to read %q, got %q", name, data, buf)
+		}
+		if c.BufferLength() != len(data) {
+			t.Fatalf("%s: expected buffer length %d, got %d", name, len(data), c.BufferLength())
+		}
+		for n := 0; n <= len(data)+1; n++ {
+			want := data
+			if n > 0 && n < len(data) {
+				want = data[:n]
+			}
+			if size, buf := c.ReadN(n); size != len(want) || string(buf) != want {
+				t.Fatalf("%s: expected ReadN(%d) to read %q, got %d bytes: %q", name, n, want, size, buf)
+			}
+			buf, err := c.Peek(n)
+			if string(buf) != want || (err == ErrIncompletePacket) != (n > len(data)) {
+				t.Fatalf("%s: expected Peek(%d) to peek %q, got %q, error: %v", name, n, want, buf, err)
+			}
+		}
+		if err := c.ShiftNErr(len(data) + 1); !errors.Is(err, ErrShiftOutOfRange) || string(c.Read()) != data {
+			t.Fatalf("%s: expected over-shift to be rejected with data left, got %q, error: %v", name, c.Read(), err)
+		}
+		for shifted := 0; shifted < len(data); {
+			if size := c.ShiftN(3); size != 3 && size != len(data)-shifted {
+				t.Fatalf("%s: expected to shift 3 bytes, got %d", name, size)
+			}
+			if shifted += 3; shifted > len(data) {
+				shifted = len(data)
+			}
+			if rest := string(c.Read()); rest != data[shifted:] {
+				t.Fatalf("%s: expected %q left after shifting %d bytes, got %q", name, data[shifted:], shifted, rest)
+			}
+		}
+		c = newConn(tc.inbound, tc.temp)
+		c.ResetBuffer()
+		if c.BufferLength() != 0 || len(c.Read()) != 0 {
+			t.Fatalf("%s: expected buffers to be reset, %d bytes left", name, c.BufferLength())
+		}
+	}
+
+	// The frames span the inbound ring-buffer and event-loop-buffer.
+	codecs := []struct {
+		codec  ICodec
+		stream func(frames ...[]byte) []byte
+	}{
+		{new(LineBasedFrameCodec), func(frames ...[]byte) []byte {
+			return append(bytes.Join(frames, []byte{CRLFByte}), CRLFByte)
+		}},
+		{NewLengthFieldBasedFrameCodec(EncoderConfig{ByteOrder: binary.BigEndian, LengthFieldLength: 2}, DecoderConfig{
+			ByteOrder: binary.BigEndian, LengthFieldLength: 2, InitialBytesToStrip: 2,
+		}), func(frames ...[]byte) (stream []byte) {
+			for _, frame := range frames {
+				stream = append(stream, byte(len(frame)>>8), byte(len(frame)))
+				stream = append(stream, frame...)
+			}
+			return
+		}},
+	}
+	frames := [][]byte{[]byte("hello"), []byte("gnet"), []byte("!")}
+	for _, cc := range codecs {
+		stream := cc.stream(frames...)
+		for split := 0; split <= len(stream); split++ {
+			c := newConn(string(stream[:split]), string(stream[split:]))
+			for i, want := range frames {
+				frame, err := cc.codec.Decode(c)
+				if err != nil || !bytes.Equal(frame, want) {
+					t.Fatalf("%T split at %d: expected frame %d to be %q, got %q, error: %v",
+						cc.codec, split, i, want, frame, err)
+				}
+			}
+			if frame, err := cc.codec.Decode(c); err != ErrIncompletePacket {
+				t.Fatalf("%T split at %d: expected ErrIncompletePacket, got %q, error: %v", cc.codec, split, frame, err)
+			}
+		}
+	}
+}
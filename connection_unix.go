@@ -8,7 +8,16 @@
 package gnet
 
 import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
 	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
 
 	"github.com/panjf2000/gnet/internal/netpoll"
 	"github.com/panjf2000/gnet/pool/bytebuffer"
@@ -18,104 +27,473 @@ import (
 )
 
 type conn struct {
+	bytesRead      int64                  // number of bytes read from the connection, first to be 64-bit aligned
+	bytesWritten   int64                  // number of bytes written to the connection
+	asyncPending   int64                  // number of bytes queued by AsyncWrite, yet to be written
+	outboundLength int64                  // length of outbound buffer, mirrored for reading from other goroutines
+	writeFull      int32                  // pending outbound bytes have exceeded WriteBufferCap, see WritableHandler
+	id             uint64                 // unique connection id
 	fd             int                    // file descriptor
 	sa             unix.Sockaddr          // remote socket address
-	ctx            interface{}            // user-defined context
+	ctx            unsafe.Pointer         // user-defined context, points to an interface{}
 	loop           *eventloop             // connected event-loop
 	buffer         []byte                 // reuse memory of inbound data as a temporary buffer
+	heldFrame      []byte                 // frame decoded by ZeroCopyCodec, aliasing the inbound data
+	heldBytes      int                    // number of inbound bytes held by heldFrame, shifted once it's handled
 	codec          ICodec                 // codec for TCP
 	opened         bool                   // connection opened event fired
+	hijacked       bool                   // fd has been taken over by Hijack, the event-loop doesn't read from/write to it
+	detached       bool                   // handed over to a net.Conn by Detach, which the event-loop leaves alone
+	writeClosed    bool                   // write side is shut down once outbound buffer is drained, see CloseWrite
+	rejected       bool                   // rejected by OnOpened, inbound data is discarded until the peer closes, see loopReject
+	connected      bool                   // persistent UDP connection of a remote peer, see Options.UDPConnected
+	corkMu         sync.Mutex             // protects corked and corkedPackets, for SendTo may be called by any goroutine
+	corked         bool                   // datagrams are queued rather than sent, see Options.UDPBatching
+	corkedPackets  [][]byte               // datagrams queued during a callback, sent when the callback returns
+	proxyPending   bool                   // waiting for the PROXY protocol header, see Options.ProxyProtocol
+	proxyHeader    []byte                 // part of the PROXY protocol header read so far
+	tlsConn        *tls.Conn              // TLS layer of the connection, see Options.TLSConfig
+	tlsTransport   *tlsTransport          // in-memory transport under the TLS layer
+	lastActive     time.Time              // last time when data was read from or written to the connection
+	lastFrame      time.Time              // last time when a frame was decoded or the read timeout fired
+	frameQuota     int64                  // number of frames allowed to be decoded, 0 means unlimited
+	framesDecoded  int64                  // number of frames decoded since the frame quota was set
+	readThreshold  int                    // minimum number of bytes buffered before decoding, see SetReadThreshold
+	limiter        *RateLimiter           // limiter of the bytes read, see Options.ConnRateLimit
+	readPaused     bool                   // fd isn't polled for readable events until the limiter gets out of debt
 	localAddr      net.Addr               // local addr
 	remoteAddr     net.Addr               // remote addr
+	remoteAddrStr  string                 // cached string of remote addr
 	byteBuffer     *bytebuffer.ByteBuffer // bytes buffer for buffering current packet and data in ring-buffer
 	inboundBuffer  *ringbuffer.RingBuffer // buffer for data from client
 	outboundBuffer *ringbuffer.RingBuffer // buffer for data that is ready to write to client
+	pendingFile    *pendingFile           // rest of the file region sent by SendFile, written before outbound buffer
+	reactQueue     []pooledFrame          // frames waiting to be reacted to on the react pool, see Options.ReactPool
+	reacting       bool                   // React of the connection is running on the react pool
+	logLabels      []logLabel             // user-defined labels attached to the log lines of connection
+	bufferedLock   sync.Mutex             // protects buffered
+	buffered       *bytebuffer.ByteBuffer // encoded frames buffered by WriteBuffered, waiting to be flushed
 }
 
-func newTCPConn(fd int, el *eventloop, sa unix.Sockaddr) *conn {
-	return &conn{
+func newTCPConn(fd int, el *eventloop, sa unix.Sockaddr, localAddr net.Addr) *conn {
+	c := &conn{
+		id:             nextConnID(),
 		fd:             fd,
 		sa:             sa,
 		loop:           el,
+		localAddr:      localAddr,
 		codec:          el.codec,
+		proxyPending:   el.svr.opts.ProxyProtocol,
 		inboundBuffer:  prb.Get(),
 		outboundBuffer: prb.Get(),
 	}
+	c.inboundBuffer.SetGrowthPolicy(el.svr.inboundGrowthPolicy())
+	c.outboundBuffer.SetGrowthPolicy(el.svr.opts.BufferGrowthPolicy)
+	if el.svr.opts.ConnRateLimit > 0 {
+		c.limiter = newRateLimiter(el.svr.opts.ConnRateLimit, el.svr.opts.ConnRateBurst)
+	}
+	return c
 }
 
 func (c *conn) releaseTCP() {
 	c.opened = false
+	c.hijacked = false
+	c.readPaused = false
+	c.tlsConn = nil
+	c.tlsTransport = nil
+	c.closePendingFile()
+	c.reactQueue = nil
+	c.proxyPending = false
+	c.proxyHeader = nil
 	c.sa = nil
-	c.ctx = nil
+	atomic.StorePointer(&c.ctx, nil)
 	c.buffer = nil
 	c.localAddr = nil
 	c.remoteAddr = nil
+	c.remoteAddrStr = ""
 	prb.Put(c.inboundBuffer)
 	prb.Put(c.outboundBuffer)
 	c.inboundBuffer = nil
 	c.outboundBuffer = nil
 	bytebuffer.Put(c.byteBuffer)
 	c.byteBuffer = nil
+	bytebuffer.Put(c.takeBuffered())
 }
 
-func newUDPConn(fd int, el *eventloop, sa unix.Sockaddr) *conn {
+func newUDPConn(fd int, el *eventloop, sa unix.Sockaddr, localAddr net.Addr) *conn {
 	return &conn{
 		fd:         fd,
 		sa:         sa,
-		localAddr:  el.svr.ln.lnaddr,
+		loop:       el,
+		localAddr:  localAddr,
 		remoteAddr: netpoll.SockaddrToUDPAddr(sa),
 	}
 }
 
 func (c *conn) releaseUDP() {
-	c.ctx = nil
+	c.connected = false
+	atomic.StorePointer(&c.ctx, nil)
 	c.localAddr = nil
 	c.remoteAddr = nil
+	c.remoteAddrStr = ""
 }
 
 func (c *conn) open(buf []byte) {
-	n, err := unix.Write(c.fd, buf)
+	if c.tlsConn != nil {
+		c.write(buf)
+		return
+	}
+	n, err := ignoringEINTRIO(unix.Write, c.fd, buf)
 	if err != nil {
-		_, _ = c.outboundBuffer.Write(buf)
+		c.bufferOutbound(buf)
 		return
 	}
-
 	if n < len(buf) {
-		_, _ = c.outboundBuffer.Write(buf[n:])
+		c.bufferOutbound(buf[n:])
+	}
+	c.addBytesWritten(n)
+}
+
+// ignoringEINTRIO calls the I/O function until it isn't interrupted by a signal, which would otherwise be taken
+// as a failure of the connection, e.g. a write interrupted before any data is written fails with EINTR.
+func ignoringEINTRIO(fn func(fd int, p []byte) (int, error), fd int, p []byte) (int, error) {
+	for {
+		n, err := fn(fd, p)
+		if err != unix.EINTR {
+			return n, err
+		}
 	}
 }
 
+// bufferOutbound appends the data that can't be written right now to outbound buffer.
+func (c *conn) bufferOutbound(buf []byte) {
+	_, _ = c.outboundBuffer.Write(buf)
+	c.syncOutboundLength()
+	_ = c.writeBufferFull()
+}
+
+// outboundEmpty reports whether there is nothing pending to be written to the connection.
+func (c *conn) outboundEmpty() bool {
+	return c.pendingFile == nil && c.outboundBuffer.IsEmpty()
+}
+
+// syncOutboundLength mirrors the length of outbound buffer for OutboundBuffered.
+func (c *conn) syncOutboundLength() {
+	atomic.StoreInt64(&c.outboundLength, int64(c.outboundBuffer.Length()))
+}
+
 func (c *conn) read() ([]byte, error) {
+	if zc, ok := c.codec.(ZeroCopyCodec); ok {
+		frame, token, err := zc.DecodeZeroCopy(c)
+		c.heldFrame, c.heldBytes = frame, token.n
+		return frame, err
+	}
 	return c.codec.Decode(c)
 }
 
+// releaseFrame shifts the inbound bytes held by the frame decoded by ZeroCopyCodec once it has been handled.
+func (c *conn) releaseFrame() {
+	if c.heldBytes == 0 {
+		return
+	}
+	if c.loop.svr.opts.ZeroCopyDebug {
+		poisonFrame(c.heldFrame)
+	}
+	c.ShiftN(c.heldBytes)
+	c.heldFrame, c.heldBytes = nil, 0
+}
+
 func (c *conn) write(buf []byte) {
-	if !c.outboundBuffer.IsEmpty() {
-		_, _ = c.outboundBuffer.Write(buf)
+	if c.tlsConn != nil {
+		// The TLS layer writes the encrypted data by writeRaw through its transport.
+		_, _ = c.tlsConn.Write(buf)
+		return
+	}
+	c.writeRaw(buf)
+}
+
+// writeRaw writes the data to the socket, the data that can't be written right now is kept in outbound buffer.
+func (c *conn) writeRaw(buf []byte) {
+	c.lastActive = time.Now()
+	if c.connected {
+		_ = c.sendTo(buf)
+		return
+	}
+	if c.writeClosed {
 		return
 	}
-	n, err := unix.Write(c.fd, buf)
+	if c.hijacked || !c.outboundEmpty() {
+		c.bufferOutbound(buf)
+		return
+	}
+	n, err := ignoringEINTRIO(unix.Write, c.fd, buf)
 	if err != nil {
 		if err == unix.EAGAIN {
-			_, _ = c.outboundBuffer.Write(buf)
-			_ = c.loop.poller.ModReadWrite(c.fd)
+			c.bufferOutbound(buf)
+			_ = c.loop.modReadWrite(c)
 			return
 		}
-		_ = c.loop.loopCloseConn(c, err)
+		_ = c.loop.loopCloseConn(c, sockError(c.fd, err))
 		return
 	}
 	if n < len(buf) {
-		_, _ = c.outboundBuffer.Write(buf[n:])
-		_ = c.loop.poller.ModReadWrite(c.fd)
+		c.bufferOutbound(buf[n:])
+		_ = c.loop.modReadWrite(c)
+	}
+	c.addBytesWritten(n)
+}
+
+// writevRaw writes the buffers to the socket by one vectored write, the data that can't be written right now
+// is kept in outbound buffer.
+func (c *conn) writevRaw(bufs [][]byte) error {
+	c.lastActive = time.Now()
+	if c.writeClosed {
+		return nil
+	}
+	if c.hijacked || !c.outboundEmpty() {
+		for _, buf := range bufs {
+			c.bufferOutbound(buf)
+		}
+		return nil
+	}
+	n, err := writev(c.fd, bufs)
+	if err != nil {
+		if err != unix.EAGAIN {
+			err = sockError(c.fd, err)
+			_ = c.loop.loopCloseConn(c, err)
+			return err
+		}
+		n = 0
+	}
+	written := n
+	for _, buf := range bufs {
+		if n >= len(buf) {
+			n -= len(buf)
+			continue
+		}
+		c.bufferOutbound(buf[n:])
+		n = 0
+	}
+	if !c.outboundEmpty() {
+		_ = c.loop.modReadWrite(c)
+	}
+	c.addBytesWritten(written)
+	return nil
+}
+
+// pendingFile is the rest of a file region sent by SendFile, which is sent once the socket becomes writable.
+type pendingFile struct {
+	fd     int   // duplicate of the file descriptor, closed once the region is sent
+	offset int64 // offset of the rest in file
+	count  int   // number of bytes to be sent
+}
+
+// send sends the file region to the connection until it's all sent or the socket isn't writable for now,
+// it returns the number of bytes sent.
+func (pf *pendingFile) send(c *conn) (sent int, err error) {
+	for pf.count > 0 {
+		n, err := sendFile(c.fd, pf.fd, &pf.offset, pf.count, c.loop.packet)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			if err == unix.EAGAIN {
+				return sent, nil
+			}
+			return sent, sockError(c.fd, err)
+		}
+		if n == 0 {
+			// The file is shorter than the region.
+			return sent, io.ErrUnexpectedEOF
+		}
+		pf.count -= n
+		sent += n
+	}
+	return
+}
+
+// closePendingFile drops the rest of the file region sent by SendFile.
+func (c *conn) closePendingFile() {
+	if c.pendingFile != nil {
+		_ = unix.Close(c.pendingFile.fd)
+		c.pendingFile = nil
+	}
+}
+
+// bufferFile copies the file region to the connection, for it can't be sent by sendfile(2) right now.
+func (c *conn) bufferFile(f *os.File, offset int64, count int) error {
+	buf := c.loop.packet
+	for count > 0 {
+		if count < len(buf) {
+			buf = buf[:count]
+		}
+		n, err := f.ReadAt(buf, offset)
+		if n > 0 {
+			c.write(buf[:n])
+			offset += int64(n)
+			count -= n
+		}
+		if err != nil && count > 0 {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// takeBuffered takes away the frames buffered by WriteBuffered.
+func (c *conn) takeBuffered() (bb *bytebuffer.ByteBuffer) {
+	c.bufferedLock.Lock()
+	bb, c.buffered = c.buffered, nil
+	c.bufferedLock.Unlock()
+	return
+}
+
+// flushBuffered writes the frames buffered by WriteBuffered, it must be invoked within the event-loop.
+func (c *conn) flushBuffered() {
+	if bb := c.takeBuffered(); bb != nil {
+		c.write(bb.B)
+		bytebuffer.Put(bb)
+	}
+}
+
+// sockError returns the pending error of the socket reported by SO_ERROR, which is more precise than
+// the error of a failed write, or err if there is no pending error.
+func sockError(fd int, err error) error {
+	if errno, e := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_ERROR); e == nil && errno != 0 {
+		return unix.Errno(errno)
+	}
+	return err
+}
+
+// udpConnKey identifies a connected UDP connection by the fd of listener and the remote address.
+type udpConnKey struct {
+	fd   int
+	addr string
+}
+
+// isUDP reports whether it is a UDP connection, which shares the fd with the UDP listener.
+func (c *conn) isUDP() bool {
+	return c.loop.svr.listener(c.fd) != nil
+}
+
+func (c *conn) sendTo(buf []byte) (err error) {
+	c.corkMu.Lock()
+	if c.corked {
+		c.corkedPackets = append(c.corkedPackets, append([]byte{}, buf...))
+		c.corkMu.Unlock()
+		return nil
+	}
+	c.corkMu.Unlock()
+	if err = unix.Sendto(c.fd, buf, 0, c.sa); err == nil {
+		c.addBytesWritten(len(buf))
+	}
+	return
+}
+
+// cork queues the datagrams sent afterwards until the connection is uncorked, see Options.UDPBatching.
+func (c *conn) cork() {
+	c.corkMu.Lock()
+	c.corked = true
+	c.corkMu.Unlock()
+}
+
+// uncorked stops queueing the datagrams and returns the ones queued since the connection was corked.
+func (c *conn) uncorked() (bufs [][]byte) {
+	c.corkMu.Lock()
+	bufs, c.corked, c.corkedPackets = c.corkedPackets, false, nil
+	c.corkMu.Unlock()
+	return
+}
+
+// uncork sends the datagrams queued since the connection was corked together.
+func (c *conn) uncork() {
+	bufs := c.uncorked()
+	if len(bufs) == 0 {
+		return
+	}
+	n, err := sendDatagrams(c.fd, bufs, c.sa)
+	for _, buf := range bufs[:n] {
+		c.addBytesWritten(len(buf))
+	}
+	if err != nil {
+		c.errorf("failed to send %d datagrams, error:%v\n", len(bufs)-n, err)
+	}
+}
+
+// sendDatagramsOneByOne sends the datagrams to sa by a sendto(2) for each, it returns the number of datagrams sent.
+func sendDatagramsOneByOne(fd int, bufs [][]byte, sa unix.Sockaddr) (n int, err error) {
+	for _, buf := range bufs {
+		if err = unix.Sendto(fd, buf, 0, sa); err != nil {
+			return
+		}
+		n++
+	}
+	return
+}
+
+// addBytesRead counts the bytes read from the connection.
+func (c *conn) addBytesRead(n int) {
+	atomic.AddInt64(&c.bytesRead, int64(n))
+	c.loop.svr.addBytesRead(n)
+}
+
+// addBytesWritten counts the bytes written to the connection and fires WriteCompleter.OnWriteComplete,
+// it must be invoked after the data not written is buffered, since more data may be written in the event.
+func (c *conn) addBytesWritten(n int) {
+	if n <= 0 {
+		return
+	}
+	atomic.AddInt64(&c.bytesWritten, int64(n))
+	c.loop.svr.addBytesWritten(n)
+	if h := c.loop.svr.writeCompleter; h != nil {
+		h.OnWriteComplete(c, n)
 	}
 }
 
-func (c *conn) sendTo(buf []byte) error {
-	return unix.Sendto(c.fd, buf, 0, c.sa)
+// errorf logs the failure with the logging context of the connection.
+func (c *conn) errorf(format string, args ...interface{}) {
+	c.loop.svr.logger.Errorf(connLogPrefix(c.id, c.remoteAddr, c.logLabels)+format, args...)
 }
 
 // ================================= Public APIs of gnet.Conn =================================
 
+func (c *conn) Context() interface{} {
+	if p := atomic.LoadPointer(&c.ctx); p != nil {
+		return *(*interface{})(p)
+	}
+	return nil
+}
+
+func (c *conn) LoadContext() (interface{}, bool) {
+	if p := atomic.LoadPointer(&c.ctx); p != nil {
+		return *(*interface{})(p), true
+	}
+	return nil, false
+}
+
+func (c *conn) SetContext(ctx interface{}) {
+	atomic.StorePointer(&c.ctx, unsafe.Pointer(&ctx))
+}
+
+func (c *conn) SetLogLabel(key, value string) {
+	c.logLabels = setLogLabel(c.logLabels, key, value)
+}
+
+func (c *conn) CompareAndSwapContext(old, new interface{}) bool {
+	p := atomic.LoadPointer(&c.ctx)
+	var cur interface{}
+	if p != nil {
+		cur = *(*interface{})(p)
+	}
+	if !contextEqual(cur, old) {
+		return false
+	}
+	return atomic.CompareAndSwapPointer(&c.ctx, p, unsafe.Pointer(&new))
+}
+
 func (c *conn) Read() []byte {
 	if c.inboundBuffer.IsEmpty() {
 		return c.buffer
@@ -157,6 +535,14 @@ func (c *conn) ReadN(n int) (size int, buf []byte) {
 	return
 }
 
+func (c *conn) Peek(n int) (buf []byte, err error) {
+	var size int
+	if size, buf = c.ReadN(n); size < n {
+		err = ErrIncompletePacket
+	}
+	return
+}
+
 func (c *conn) ShiftN(n int) (size int) {
 	inBufferLen := c.inboundBuffer.Length()
 	tempBufferLen := len(c.buffer)
@@ -185,40 +571,477 @@ func (c *conn) ShiftN(n int) (size int) {
 	return
 }
 
+func (c *conn) ShiftNErr(n int) error {
+	if length := c.BufferLength(); n < 0 || n > length {
+		return fmt.Errorf("%w: shifting %d bytes of %d bytes", ErrShiftOutOfRange, n, length)
+	}
+	if n > 0 {
+		c.ShiftN(n)
+	}
+	return nil
+}
+
+func (c *conn) DrainTo(w io.Writer) (n int, err error) {
+	head, tail := c.inboundBuffer.LazyReadAll()
+	for _, buf := range [][]byte{head, tail, c.buffer} {
+		if len(buf) == 0 {
+			continue
+		}
+		var m int
+		m, err = w.Write(buf)
+		n += m
+		if err != nil {
+			break
+		}
+	}
+	if n > 0 {
+		c.ShiftN(n)
+	}
+	return
+}
+
 func (c *conn) BufferLength() int {
 	return c.inboundBuffer.Length() + len(c.buffer)
 }
 
 func (c *conn) AsyncWrite(buf []byte) (err error) {
+	// AsyncWrite(nil) flushes the codecs like AggregatingCodec, which is never rejected.
+	if buf != nil && c.writeBufferFull() {
+		return ErrWriteBufferFull
+	}
 	var encodedBuf []byte
 	if encodedBuf, err = c.codec.Encode(c, buf); err == nil {
-		return c.loop.poller.Trigger(func() error {
-			if c.opened {
-				c.write(encodedBuf)
-			}
+		err = c.asyncWriteEncoded(encodedBuf)
+	}
+	return
+}
+
+// asyncWriteEncoded writes the data that has been encoded asynchronously.
+func (c *conn) asyncWriteEncoded(encodedBuf []byte) (err error) {
+	n := int64(len(encodedBuf))
+	atomic.AddInt64(&c.asyncPending, n)
+	if err = c.loop.pushJob(func() error {
+		atomic.AddInt64(&c.asyncPending, -n)
+		if !c.opened {
 			return nil
+		}
+		c.write(encodedBuf)
+		return c.loop.loopNotifyWritable(c)
+	}, func() {
+		atomic.AddInt64(&c.asyncPending, -n)
+	}); err != nil {
+		atomic.AddInt64(&c.asyncPending, -n)
+		c.rejectJob(err)
+	}
+	return
+}
+
+func (c *conn) AsyncWriteSeq(bufs ...[]byte) error {
+	if c.writeBufferFull() {
+		return ErrWriteBufferFull
+	}
+	frames := make([][]byte, 0, len(bufs))
+	var n int64
+	for _, buf := range bufs {
+		frame, err := c.codec.Encode(c, buf)
+		if err != nil {
+			return err
+		}
+		if len(frame) > 0 {
+			frames = append(frames, frame)
+			n += int64(len(frame))
+		}
+	}
+	if len(frames) == 0 {
+		return nil
+	}
+	atomic.AddInt64(&c.asyncPending, n)
+	err := c.loop.pushJob(func() error {
+		atomic.AddInt64(&c.asyncPending, -n)
+		if !c.opened {
+			return nil
+		}
+		if c.connected {
+			for _, frame := range frames {
+				c.write(frame)
+			}
+		} else if err := c.Writev(frames...); err != nil {
+			return err
+		}
+		return c.loop.loopNotifyWritable(c)
+	}, func() {
+		atomic.AddInt64(&c.asyncPending, -n)
+	})
+	if err != nil {
+		atomic.AddInt64(&c.asyncPending, -n)
+		c.rejectJob(err)
+	}
+	return err
+}
+
+// rejectJob closes the connection if its job is rejected by the event-loop with the CloseConn policy.
+func (c *conn) rejectJob(err error) {
+	if err != ErrLoopQueueFull {
+		return
+	}
+	sniffErrorAndLog(c.loop.svr.logger, c.loop.poller.Trigger(func() error {
+		if c.connected || c.loop.connections[c.fd] == c {
+			return c.loop.loopCloseConn(c, ErrLoopQueueFull)
+		}
+		return nil
+	}))
+}
+
+// writeBufferFull reports whether the pending outbound bytes exceed Options.WriteBufferCap,
+// the connection is marked full until OnWritable fires if so.
+func (c *conn) writeBufferFull() bool {
+	writeCap := c.loop.svr.opts.WriteBufferCap
+	if writeCap <= 0 || c.OutboundBuffered() <= writeCap {
+		return false
+	}
+	if atomic.CompareAndSwapInt32(&c.writeFull, 0, 1) && c.loop.svr.writableHandler != nil {
+		// The data may have drained before the connection is marked full by another goroutine,
+		// so check it again on the event-loop after the writes queued so far.
+		_ = c.loop.poller.Trigger(func() error {
+			return c.loop.loopNotifyWritable(c)
 		})
 	}
+	return true
+}
+
+func (c *conn) connCodec() ICodec {
+	return c.codec
+}
+
+func (c *conn) OutboundBuffered() int {
+	return int(atomic.LoadInt64(&c.asyncPending) + atomic.LoadInt64(&c.outboundLength))
+}
+
+func (c *conn) TryWrite(buf []byte) (n int, err error) {
+	var encodedBuf []byte
+	if c.tlsConn != nil {
+		return 0, ErrUnsupportedOp
+	}
+	if c.detached {
+		return 0, ErrDetached
+	}
+	if c.hijacked {
+		return 0, ErrHijacked
+	}
+	if encodedBuf, err = c.codec.Encode(c, buf); err != nil {
+		return
+	}
+	if !c.outboundEmpty() {
+		return 0, ErrWouldBlock
+	}
+	if n, err = ignoringEINTRIO(unix.Write, c.fd, encodedBuf); err != nil {
+		if err == unix.EAGAIN {
+			return 0, ErrWouldBlock
+		}
+		return 0, sockError(c.fd, err)
+	}
+	c.addBytesWritten(n)
 	return
 }
 
+func (c *conn) Writev(bufs ...[]byte) error {
+	if !c.opened {
+		return nil
+	}
+	if c.tlsConn != nil || c.connected {
+		// A TLS record or a datagram is made from the whole data.
+		c.write(bytes.Join(bufs, nil))
+		return nil
+	}
+	return c.writevRaw(bufs)
+}
+
+func (c *conn) SendFile(f *os.File, offset int64, count int) error {
+	if c.isUDP() || c.connected {
+		return ErrUnsupportedOp
+	}
+	c.lastActive = time.Now()
+	if !c.opened || c.writeClosed || count <= 0 {
+		return nil
+	}
+	if c.tlsConn != nil || c.hijacked || !c.outboundEmpty() {
+		return c.bufferFile(f, offset, count)
+	}
+	c.loop.eventHandler.PreWrite()
+	pf := &pendingFile{fd: int(f.Fd()), offset: offset, count: count}
+	n, err := pf.send(c)
+	if err == nil && pf.count > 0 {
+		// The file may be closed by the caller once SendFile returns, so send the rest by a duplicate of it.
+		if pf.fd, err = unix.Dup(pf.fd); err != nil {
+			pf.fd = -1
+			err = c.bufferFile(f, pf.offset, pf.count)
+		} else {
+			c.pendingFile = pf
+			_ = c.loop.modReadWrite(c)
+		}
+	}
+	c.addBytesWritten(n)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		_ = c.loop.loopCloseConn(c, err)
+	}
+	return err
+}
+
+func (c *conn) WriteBuffered(buf []byte) error {
+	encodedBuf, err := c.codec.Encode(c, buf)
+	if err != nil {
+		return err
+	}
+	c.bufferedLock.Lock()
+	if c.buffered == nil {
+		c.buffered = bytebuffer.Get()
+	}
+	_, _ = c.buffered.Write(encodedBuf)
+	c.bufferedLock.Unlock()
+	return nil
+}
+
+func (c *conn) Flush() error {
+	err := c.loop.pushJob(func() error {
+		if c.opened {
+			c.flushBuffered()
+		}
+		return nil
+	}, nil)
+	c.rejectJob(err)
+	return err
+}
+
+func (c *conn) BytesRead() int64 {
+	return atomic.LoadInt64(&c.bytesRead)
+}
+
+func (c *conn) BytesWritten() int64 {
+	return atomic.LoadInt64(&c.bytesWritten)
+}
+
 func (c *conn) SendTo(buf []byte) error {
 	return c.sendTo(buf)
 }
 
+func (c *conn) SetDeadline(t time.Time) error {
+	return ErrUnsupportedOp
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	return ErrUnsupportedOp
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	return ErrUnsupportedOp
+}
+
+func (c *conn) TCPInfo() (*TCPInfo, error) {
+	return getTCPInfo(c.fd)
+}
+
+func (c *conn) SetNoDelay(noDelay bool) error {
+	var opt int
+	if noDelay {
+		opt = 1
+	}
+	return unix.SetsockoptInt(c.fd, unix.IPPROTO_TCP, unix.TCP_NODELAY, opt)
+}
+
+func (c *conn) FD() int {
+	return c.fd
+}
+
+func (c *conn) LoopIndex() int {
+	return c.loop.idx
+}
+
+func (c *conn) JoinGroup(addr net.IP) error {
+	return c.setMembership(addr, true)
+}
+
+func (c *conn) LeaveGroup(addr net.IP) error {
+	return c.setMembership(addr, false)
+}
+
+// setMembership joins or leaves the multicast group of addr with the UDP listener of the connection.
+func (c *conn) setMembership(addr net.IP, join bool) error {
+	if !c.isUDP() {
+		return ErrUnsupportedOp
+	}
+	if !addr.IsMulticast() {
+		return ErrNotMulticast
+	}
+	if ip4 := addr.To4(); ip4 != nil {
+		mreq := new(unix.IPMreq)
+		copy(mreq.Multiaddr[:], ip4)
+		opt := unix.IP_ADD_MEMBERSHIP
+		if !join {
+			opt = unix.IP_DROP_MEMBERSHIP
+		}
+		return unix.SetsockoptIPMreq(c.fd, unix.IPPROTO_IP, opt, mreq)
+	}
+	mreq := new(unix.IPv6Mreq)
+	copy(mreq.Multiaddr[:], addr)
+	opt := unix.IPV6_JOIN_GROUP
+	if !join {
+		opt = unix.IPV6_LEAVE_GROUP
+	}
+	return unix.SetsockoptIPv6Mreq(c.fd, unix.IPPROTO_IPV6, opt, mreq)
+}
+
+func (c *conn) Hijack() (fd int, cleanup func(), err error) {
+	if c.isUDP() || c.tlsConn != nil {
+		return -1, nil, ErrUnsupportedOp
+	}
+	if c.hijacked {
+		return -1, nil, ErrHijacked
+	}
+	if err = c.loop.poller.Delete(c.fd); err != nil {
+		return -1, nil, err
+	}
+	c.hijacked = true
+	var once sync.Once
+	cleanup = func() {
+		once.Do(func() {
+			_ = c.loop.poller.Trigger(func() error {
+				return c.loop.loopResume(c)
+			})
+		})
+	}
+	return c.fd, cleanup, nil
+}
+
+func (c *conn) Detach() (net.Conn, error) {
+	if c.isUDP() || c.tlsConn != nil {
+		return nil, ErrUnsupportedOp
+	}
+	if c.detached || !c.opened {
+		return nil, ErrDetached
+	}
+	if c.hijacked {
+		return nil, ErrHijacked
+	}
+	nc, err := dupConn(c.fd)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.loop.poller.Delete(c.fd); err != nil {
+		_ = nc.Close()
+		return nil, err
+	}
+	return c.loop.loopDetach(c, nc), nil
+}
+
+// dupConn returns the net.Conn over a duplicate of fd, which is managed by the Go runtime rather than gnet.
+func dupConn(fd int) (net.Conn, error) {
+	nfd, err := unix.Dup(fd)
+	if err != nil {
+		return nil, err
+	}
+	f := os.NewFile(uintptr(nfd), "")
+	defer f.Close()
+	return net.FileConn(f)
+}
+
+func (c *conn) SetCodec(codec ICodec) error {
+	if hasPartialFrame(c.codec, c) {
+		return ErrPartialFrame
+	}
+	releaseCodecState(c.codec, c)
+	c.codec = codec
+	return nil
+}
+
+func (c *conn) RateLimiter() *RateLimiter {
+	return c.limiter
+}
+
+func (c *conn) SetFrameQuota(n int64) {
+	c.frameQuota, c.framesDecoded = n, 0
+}
+
+func (c *conn) SetReadThreshold(n int) {
+	c.readThreshold = n
+}
+
+// belowReadThreshold reports whether the data buffered is less than the read threshold.
+func (c *conn) belowReadThreshold() bool {
+	return c.readThreshold > 0 && c.BufferLength() < c.readThreshold
+}
+
+// takeFrameQuota counts a decoded frame against the frame quota, it reports false once the quota is exhausted.
+func (c *conn) takeFrameQuota() bool {
+	if c.frameQuota <= 0 {
+		return true
+	}
+	if c.framesDecoded >= c.frameQuota {
+		return false
+	}
+	c.framesDecoded++
+	return true
+}
+
 func (c *conn) Wake() error {
-	return c.loop.poller.Trigger(func() error {
-		return c.loop.loopWake(c)
-	})
+	return c.WakeWith(nil)
+}
+
+func (c *conn) WakeWith(data []byte) error {
+	if c.isUDP() && !c.connected {
+		return ErrUnsupportedOp
+	}
+	err := c.loop.pushJob(func() error {
+		return c.loop.loopWake(c, data)
+	}, nil)
+	c.rejectJob(err)
+	return err
 }
 
 func (c *conn) Close() error {
+	if c.isUDP() && !c.connected {
+		return ErrUnsupportedOp
+	}
 	return c.loop.poller.Trigger(func() error {
+		if c.opened {
+			c.flushBuffered()
+		}
 		return c.loop.loopCloseConn(c, nil)
 	})
 }
 
-func (c *conn) Context() interface{}       { return c.ctx }
-func (c *conn) SetContext(ctx interface{}) { c.ctx = ctx }
-func (c *conn) LocalAddr() net.Addr        { return c.localAddr }
-func (c *conn) RemoteAddr() net.Addr       { return c.remoteAddr }
+func (c *conn) CloseWrite() error {
+	if c.isUDP() {
+		return ErrUnsupportedOp
+	}
+	return c.loop.poller.Trigger(func() error {
+		if c.loop.connections[c.fd] != c || c.hijacked || c.writeClosed {
+			return nil
+		}
+		if c.opened {
+			c.flushBuffered()
+		}
+		if c.tlsConn != nil {
+			// Send the close_notify alert before shutting down the socket.
+			_ = c.tlsConn.CloseWrite()
+		}
+		c.writeClosed = true
+		if c.outboundEmpty() {
+			return c.loop.loopShutdownWrite(c)
+		}
+		return nil
+	})
+}
+
+func (c *conn) LocalAddr() net.Addr  { return c.localAddr }
+func (c *conn) RemoteAddr() net.Addr { return c.remoteAddr }
+
+func (c *conn) RemoteAddrString() string {
+	if c.remoteAddrStr == "" && c.remoteAddr != nil {
+		c.remoteAddrStr = c.remoteAddr.String()
+	}
+	return c.remoteAddrStr
+}
+
+func (c *conn) Network() string {
+	return addrNetwork(c.localAddr)
+}
@@ -0,0 +1,1041 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux darwin netbsd freebsd openbsd dragonfly
+
+package gnet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/panjf2000/gnet/ringbuffer"
+	"golang.org/x/sys/unix"
+)
+
+func TestHijack(t *testing.T) {
+	events := &testHijackServer{network: "tcp", addr: ":9991", result: make(chan error, 1)}
+	must(Serve(events, events.network+"://"+events.addr, WithTicker(true)))
+	if err := <-events.result; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testHijackServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+	done          bool
+	result        chan error
+}
+
+func (t *testHijackServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	switch string(frame) {
+	case "hijack":
+		fd, cleanup, err := c.Hijack()
+		must(err)
+		if _, _, err = c.Hijack(); err != ErrHijacked {
+			panic("expected ErrHijacked when hijacking a hijacked connection")
+		}
+		if _, err = c.TryWrite([]byte("direct")); err != ErrHijacked {
+			panic("expected ErrHijacked when writing directly to a hijacked connection")
+		}
+		// Data written by gnet while the connection is hijacked is delivered after the cleanup.
+		must(c.AsyncWrite([]byte("queued")))
+		go func() {
+			_, err := unix.Write(fd, []byte("raw-out"))
+			must(err)
+			buf := make([]byte, 16)
+			for {
+				n, err := unix.Read(fd, buf)
+				if err == unix.EAGAIN {
+					time.Sleep(time.Millisecond)
+					continue
+				}
+				must(err)
+				if string(buf[:n]) != "raw-in" {
+					panic("unexpected data read from the hijacked fd: " + string(buf[:n]))
+				}
+				break
+			}
+			cleanup()
+		}()
+	default:
+		out = frame
+	}
+	return
+}
+
+func (t *testHijackServer) Tick() (delay time.Duration, action Action) {
+	if t.done {
+		action = Shutdown
+		return
+	}
+	if !t.action {
+		t.action = true
+		go func() {
+			t.result <- func() error {
+				conn, err := net.Dial(t.network, t.addr)
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				expect := func(s string) error {
+					buf := make([]byte, len(s))
+					if _, err := io.ReadFull(conn, buf); err != nil {
+						return err
+					}
+					if !bytes.Equal(buf, []byte(s)) {
+						return fmt.Errorf("expected %q, got %q", s, buf)
+					}
+					return nil
+				}
+				if _, err = conn.Write([]byte("hijack")); err != nil {
+					return err
+				}
+				if err = expect("raw-out"); err != nil {
+					return err
+				}
+				if _, err = conn.Write([]byte("raw-in")); err != nil {
+					return err
+				}
+				if err = expect("queued"); err != nil {
+					return err
+				}
+				if _, err = conn.Write([]byte("resumed")); err != nil {
+					return err
+				}
+				return expect("resumed")
+			}()
+		}()
+	}
+	select {
+	case err := <-t.result:
+		t.result <- err
+		t.done = true
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestWriteErrorReported(t *testing.T) {
+	events := &testWriteErrorServer{
+		network:   "tcp",
+		addr:      ":9991",
+		reset:     make(chan struct{}),
+		resetDone: make(chan struct{}),
+		closed:    make(chan error, 1),
+	}
+	must(Serve(events, events.network+"://"+events.addr, WithTicker(true)))
+	if err := <-events.closed; !errors.Is(err, unix.ECONNRESET) {
+		t.Fatalf("expected ECONNRESET to be reported to OnClosed, got %v", err)
+	}
+}
+
+type testWriteErrorServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+	reset         chan struct{}
+	resetDone     chan struct{}
+	closed        chan error
+}
+
+func (t *testWriteErrorServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	// Let the client reset the connection before writing the response.
+	close(t.reset)
+	<-t.resetDone
+	time.Sleep(time.Millisecond * 100)
+	out = frame
+	return
+}
+
+func (t *testWriteErrorServer) OnClosed(c Conn, err error) (action Action) {
+	t.closed <- err
+	return
+}
+
+func (t *testWriteErrorServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			conn, err := net.Dial(t.network, t.addr)
+			must(err)
+			must(conn.(*net.TCPConn).SetLinger(0))
+			_, err = conn.Write([]byte("Hello World!"))
+			must(err)
+			<-t.reset
+			must(conn.Close())
+			close(t.resetDone)
+		}()
+	}
+	if len(t.closed) > 0 {
+		action = Shutdown
+		return
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func BenchmarkRemoteAddrString(b *testing.B) {
+	c := &conn{remoteAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9991}}
+	b.Run("RemoteAddr().String", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = c.RemoteAddr().String()
+		}
+	})
+	b.Run("RemoteAddrString", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = c.RemoteAddrString()
+		}
+	})
+}
+
+// failingWriter accepts at most n bytes and fails afterwards.
+type failingWriter struct {
+	bytes.Buffer
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		p = p[:w.n]
+	}
+	n, _ := w.Buffer.Write(p)
+	if w.n -= n; w.n == 0 {
+		return n, io.ErrShortWrite
+	}
+	return n, nil
+}
+
+func TestWriteBufferCap(t *testing.T) {
+	events := &testWriteBufferCapServer{filled: make(chan error, 1), done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithWriteBufferCap(writeBufferCap), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+const writeBufferCap = 64 * 1024
+
+type testWriteBufferCapServer struct {
+	*EventServer
+	action  bool
+	conn    Conn
+	written int
+	filled  chan error
+	done    chan error
+}
+
+func (t *testWriteBufferCapServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	t.conn = c
+	go func() {
+		t.filled <- func() error {
+			// Write until the data the client doesn't read overflows the socket buffer and then the cap.
+			chunk := make([]byte, 16*1024)
+			for t.written < 64*1024*1024 {
+				err := c.AsyncWrite(chunk)
+				if err == ErrWriteBufferFull {
+					if n := c.OutboundBuffered(); n <= writeBufferCap {
+						return fmt.Errorf("rejected with %d bytes pending, which doesn't exceed the cap", n)
+					}
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				t.written += len(chunk)
+			}
+			return errors.New("AsyncWrite was never rejected")
+		}()
+	}()
+	return
+}
+
+func (t *testWriteBufferCapServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				if _, err = conn.Write([]byte("go")); err != nil {
+					return err
+				}
+				if err = <-t.filled; err != nil {
+					return err
+				}
+				if _, err = io.CopyN(ioutil.Discard, conn, int64(t.written)); err != nil {
+					return err
+				}
+				for start := time.Now(); t.conn.OutboundBuffered() != 0; time.Sleep(time.Millisecond) {
+					if time.Since(start) > time.Second {
+						return fmt.Errorf("expected no pending bytes after reading all, got %d", t.conn.OutboundBuffered())
+					}
+				}
+				if err = t.conn.AsyncWrite([]byte("more")); err != nil {
+					return fmt.Errorf("expected AsyncWrite to be accepted once drained, got %v", err)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestPeek(t *testing.T) {
+	c := &conn{inboundBuffer: ringbuffer.New(8)}
+	_, _ = c.inboundBuffer.Write([]byte("012345"))
+	c.inboundBuffer.Shift(6)
+	_, _ = c.inboundBuffer.Write([]byte("head"))
+	c.buffer = []byte("body")
+
+	for _, n := range []int{2, 6, 8} {
+		if buf, err := c.Peek(n); err != nil || string(buf) != "headbody"[:n] {
+			t.Fatalf("expected to peek %q, got %q, error: %v", "headbody"[:n], buf, err)
+		}
+	}
+	if buf, err := c.Peek(10); err != ErrIncompletePacket || string(buf) != "headbody" {
+		t.Fatalf("expected to peek all data with ErrIncompletePacket, got %q, error: %v", buf, err)
+	}
+	if buf, err := c.Peek(0); err != nil || string(buf) != "headbody" {
+		t.Fatalf("expected to peek all data, got %q, error: %v", buf, err)
+	}
+	if c.BufferLength() != 8 {
+		t.Fatalf("expected no data evicted by peeking, %d bytes left", c.BufferLength())
+	}
+}
+
+func TestDrainTo(t *testing.T) {
+	newConn := func() *conn {
+		c := &conn{inboundBuffer: ringbuffer.New(16)}
+		// Wrap the data around the end of ring-buffer.
+		_, _ = c.inboundBuffer.Write([]byte("0123456789"))
+		c.inboundBuffer.Shift(10)
+		_, _ = c.inboundBuffer.Write([]byte("hello, gnet "))
+		c.buffer = []byte("world")
+		return c
+	}
+
+	c := newConn()
+	var buf bytes.Buffer
+	if n, err := c.DrainTo(&buf); err != nil || n != 17 || buf.String() != "hello, gnet world" {
+		t.Fatalf("expected to drain 17 bytes, got %d bytes: %q, error: %v", n, buf.String(), err)
+	}
+	if c.BufferLength() != 0 || len(c.Read()) != 0 {
+		t.Fatalf("expected buffers to be emptied, %d bytes left", c.BufferLength())
+	}
+	if n, err := c.DrainTo(&buf); err != nil || n != 0 {
+		t.Fatalf("expected nothing to drain, got %d bytes, error: %v", n, err)
+	}
+
+	c = newConn()
+	w := &failingWriter{n: 14}
+	if n, err := c.DrainTo(w); err != io.ErrShortWrite || n != 14 {
+		t.Fatalf("expected to drain 14 bytes with error, got %d bytes, error: %v", n, err)
+	}
+	if rest := string(c.Read()); rest != "rld" {
+		t.Fatalf("expected the data not written to be left, got %q", rest)
+	}
+}
+
+func TestLoopOverflowPolicy(t *testing.T) {
+	t.Run("block", func(t *testing.T) {
+		testLoopOverflowPolicy(t, Block)
+	})
+	t.Run("drop-oldest", func(t *testing.T) {
+		testLoopOverflowPolicy(t, DropOldest)
+	})
+	t.Run("close-conn", func(t *testing.T) {
+		testLoopOverflowPolicy(t, CloseConn)
+	})
+}
+
+const (
+	loopQueueCap = 8
+	floodJobs    = 100
+)
+
+func testLoopOverflowPolicy(t *testing.T, policy LoopOverflowPolicy) {
+	events := &testLoopOverflowServer{
+		policy:  policy,
+		flooded: make(chan error, 1),
+		closed:  make(chan error, 1),
+		done:    make(chan error, 1),
+	}
+	must(Serve(events, "tcp://:9991", WithLoopQueueCap(loopQueueCap), WithLoopOverflowPolicy(policy),
+		WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testLoopOverflowServer struct {
+	*EventServer
+	policy  LoopOverflowPolicy
+	svr     Server
+	action  bool
+	flooded chan error
+	closed  chan error
+	done    chan error
+}
+
+func (t *testLoopOverflowServer) OnInitComplete(svr Server) (action Action) {
+	t.svr = svr
+	return
+}
+
+func (t *testLoopOverflowServer) OnClosed(c Conn, err error) (action Action) {
+	t.closed <- err
+	return
+}
+
+// React holds the event-loop until its queue is flooded.
+func (t *testLoopOverflowServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	flooded := make(chan error, 1)
+	go func() {
+		flooded <- t.flood(c)
+	}()
+	for start := time.Now(); t.svr.LoopQueueLengths()[0] < loopQueueCap; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.flooded <- fmt.Errorf("expected %d jobs in the queue, got %v", loopQueueCap, t.svr.LoopQueueLengths())
+			return
+		}
+	}
+	if t.policy == Block {
+		// The flooder is blocked until the event-loop takes the queued jobs.
+		go func() { t.flooded <- <-flooded }()
+		return
+	}
+	t.flooded <- <-flooded
+	if n := t.svr.LoopQueueLengths()[0]; n != loopQueueCap {
+		t.flooded <- fmt.Errorf("expected the queue to be bounded at %d jobs, got %d", loopQueueCap, n)
+	}
+	return
+}
+
+func (t *testLoopOverflowServer) flood(c Conn) error {
+	for i := 0; i < floodJobs; i++ {
+		err := c.AsyncWrite([]byte{'x'})
+		if t.policy == CloseConn && i == loopQueueCap {
+			if err != ErrLoopQueueFull {
+				return fmt.Errorf("expected ErrLoopQueueFull once the queue is full, got %v", err)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *testLoopOverflowServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- t.dial()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func (t *testLoopOverflowServer) dial() error {
+	conn, err := net.Dial("tcp", ":9991")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte("go")); err != nil {
+		return err
+	}
+	if err = <-t.flooded; err != nil {
+		return err
+	}
+	expected := floodJobs
+	if t.policy != Block {
+		expected = loopQueueCap
+	}
+	if _, err = io.ReadFull(conn, make([]byte, expected)); err != nil {
+		return err
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	n, err := conn.Read(make([]byte, 1))
+	switch t.policy {
+	case CloseConn:
+		if err != io.EOF {
+			return fmt.Errorf("expected the connection to be closed, got %d bytes and %v", n, err)
+		}
+		if err = <-t.closed; err != ErrLoopQueueFull {
+			return fmt.Errorf("expected the connection to be closed with ErrLoopQueueFull, got %v", err)
+		}
+	default:
+		if e, ok := err.(net.Error); !ok || !e.Timeout() {
+			return fmt.Errorf("expected no more data, got %d bytes and %v", n, err)
+		}
+	}
+	return nil
+}
+
+func TestCloseWrite(t *testing.T) {
+	events := &testCloseWriteServer{received: make(chan []byte, 1), done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// closeWriteReply is larger than the socket buffer, the write side must be shut down after it's flushed.
+var closeWriteReply = bytes.Repeat([]byte("bye"), 4*1024*1024)
+
+type testCloseWriteServer struct {
+	*EventServer
+	action   bool
+	replied  bool
+	received chan []byte
+	done     chan error
+}
+
+func (t *testCloseWriteServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	if t.replied {
+		t.received <- append([]byte{}, frame...)
+		return
+	}
+	t.replied = true
+	if err := c.CloseWrite(); err != nil {
+		t.received <- []byte(err.Error())
+	}
+	out = closeWriteReply
+	return
+}
+
+func (t *testCloseWriteServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				if _, err = conn.Write([]byte("hello")); err != nil {
+					return err
+				}
+				data, err := ioutil.ReadAll(conn)
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(data, closeWriteReply) {
+					return fmt.Errorf("expected %d bytes before EOF, got %d", len(closeWriteReply), len(data))
+				}
+				// The read side of server is still open.
+				if _, err = conn.Write([]byte("more")); err != nil {
+					return err
+				}
+				select {
+				case frame := <-t.received:
+					if string(frame) != "more" {
+						return fmt.Errorf("expected %q after CloseWrite, got %q", "more", frame)
+					}
+				case <-time.After(time.Second):
+					return errors.New("data sent after CloseWrite was not received")
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestOpenedClose(t *testing.T) {
+	events := &testOpenedCloseServer{reacted: make(chan struct{}, 1), done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testOpenedCloseServer struct {
+	*EventServer
+	action  bool
+	reacted chan struct{}
+	done    chan error
+}
+
+func (t *testOpenedCloseServer) OnOpened(c Conn) (out []byte, action Action) {
+	// The banner is larger than the socket buffer, the connection must be closed after it's flushed.
+	return closeWriteReply, Close
+}
+
+func (t *testOpenedCloseServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	select {
+	case t.reacted <- struct{}{}:
+	default:
+	}
+	return
+}
+
+func (t *testOpenedCloseServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				if _, err = conn.Write([]byte("hello")); err != nil {
+					return err
+				}
+				data, err := ioutil.ReadAll(conn)
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(data, closeWriteReply) {
+					return fmt.Errorf("expected %d bytes before EOF, got %d", len(closeWriteReply), len(data))
+				}
+				select {
+				case <-t.reacted:
+					return errors.New("React fired for the connection closed by OnOpened")
+				default:
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestFD(t *testing.T) {
+	t.Run("tcp", func(t *testing.T) {
+		testFD("tcp", ":9991")
+	})
+	t.Run("udp", func(t *testing.T) {
+		testFD("udp", ":9991")
+	})
+}
+
+type testFDServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+}
+
+func (t *testFDServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	fd := c.FD()
+	const sndBuf = 64 * 1024
+	must(unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_SNDBUF, sndBuf))
+	n, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_SNDBUF)
+	must(err)
+	// Linux doubles the value to leave room for the bookkeeping overhead.
+	if n < sndBuf {
+		panic(fmt.Sprintf("expected SO_SNDBUF of at least %d, got %d", sndBuf, n))
+	}
+	// The fd is the socket serving the address of connection.
+	sa, err := unix.Getsockname(fd)
+	must(err)
+	var port int
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		port = sa.Port
+	case *unix.SockaddrInet6:
+		port = sa.Port
+	}
+	if _, expected, _ := net.SplitHostPort(c.LocalAddr().String()); strconv.Itoa(port) != expected {
+		panic(fmt.Sprintf("fd %d is bound to port %d rather than the one of %v", fd, port, c.LocalAddr()))
+	}
+	action = Shutdown
+	return
+}
+
+func (t *testFDServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			conn, err := net.Dial(t.network, t.addr)
+			must(err)
+			defer conn.Close()
+			_, err = conn.Write([]byte("Hello World!"))
+			must(err)
+		}()
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func testFD(network, addr string) {
+	events := &testFDServer{network: network, addr: addr}
+	must(Serve(events, network+"://"+addr, WithTicker(true)))
+}
+
+func TestReuseAddr(t *testing.T) {
+	for _, addr := range []string{"tcp://:9991", "udp://:9991", "unix://gnet-reuseaddr.sock"} {
+		for _, reuseAddr := range []bool{false, true} {
+			ln, err := initListener(addr, &Options{ReuseAddr: reuseAddr})
+			if err != nil {
+				t.Fatal(err)
+			}
+			opt, err := unix.GetsockoptInt(ln.fd, unix.SOL_SOCKET, unix.SO_REUSEADDR)
+			ln.close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Go sets up SO_REUSEADDR for the listeners of stream sockets by default.
+			if expected := reuseAddr || ln.network != "udp"; (opt != 0) != expected {
+				t.Fatalf("expected SO_REUSEADDR of %s to be %t, got %d", addr, expected, opt)
+			}
+		}
+	}
+}
+
+func TestSocketOpt(t *testing.T) {
+	const rcvbuf = 1 << 17
+	ln, err := initListener("tcp://:9991", &Options{SocketOpt: func(fd int) error {
+		return unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, rcvbuf)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt, err := unix.GetsockoptInt(ln.fd, unix.SOL_SOCKET, unix.SO_RCVBUF)
+	ln.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opt < rcvbuf {
+		t.Fatalf("expected SO_RCVBUF of at least %d, got %d", rcvbuf, opt)
+	}
+
+	errSocketOpt := errors.New("socket option failed")
+	if _, err = initListener("tcp://:9991", &Options{SocketOpt: func(fd int) error {
+		return errSocketOpt
+	}}); err != errSocketOpt {
+		t.Fatalf("expected %v, got %v", errSocketOpt, err)
+	}
+}
+
+func TestConnSocketOpt(t *testing.T) {
+	events := &testConnSocketOptServer{done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithConnSocketOpt(events.socketOpt), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+const connSndbuf = 1 << 17
+
+type testConnSocketOptServer struct {
+	*EventServer
+	action bool
+	calls  int
+	done   chan error
+}
+
+// socketOpt sets up SO_SNDBUF of the first connection and fails the rest.
+func (t *testConnSocketOptServer) socketOpt(fd int) error {
+	t.calls++
+	if t.calls > 1 {
+		return errors.New("socket option failed")
+	}
+	return unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_SNDBUF, connSndbuf)
+}
+
+func (t *testConnSocketOptServer) OnOpened(c Conn) (out []byte, action Action) {
+	opt, err := unix.GetsockoptInt(c.FD(), unix.SOL_SOCKET, unix.SO_SNDBUF)
+	if err != nil {
+		out = []byte(err.Error())
+	} else {
+		out = []byte(strconv.Itoa(opt))
+	}
+	action = Close
+	return
+}
+
+func (t *testConnSocketOptServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				data, err := ioutil.ReadAll(conn)
+				if err != nil {
+					return err
+				}
+				if opt, err := strconv.Atoi(string(data)); err != nil || opt < connSndbuf {
+					return fmt.Errorf("expected SO_SNDBUF of at least %d, got %q", connSndbuf, data)
+				}
+
+				conn, err = net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				if data, err = ioutil.ReadAll(conn); err == nil && len(data) > 0 {
+					return fmt.Errorf("expected the connection failed in socket options to be closed, got %q", data)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestReadBufferCap(t *testing.T) {
+	events := &testReadBufferCapServer{done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithReadBufferCap(readBufferCap), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+const readBufferCap = 1 << 20
+
+type testReadBufferCapServer struct {
+	*EventServer
+	action bool
+	done   chan error
+}
+
+func (t *testReadBufferCapServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	t.done <- func() error {
+		cc := c.(*conn)
+		if n := cc.inboundBuffer.Cap(); n < readBufferCap {
+			return fmt.Errorf("expected the inbound ring-buffer to be sized to %d bytes, got %d", readBufferCap, n)
+		}
+		if n := len(cc.loop.packet); n != readBufferCap {
+			return fmt.Errorf("expected the chunk of reads to be %d bytes, got %d", readBufferCap, n)
+		}
+		return nil
+	}()
+	action = Shutdown
+	return
+}
+
+func (t *testReadBufferCapServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			conn, err := net.Dial("tcp", ":9991")
+			must(err)
+			defer conn.Close()
+			_, err = conn.Write([]byte("Hello World!"))
+			must(err)
+		}()
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestShiftNErr(t *testing.T) {
+	c := &conn{inboundBuffer: ringbuffer.New(8)}
+	_, _ = c.inboundBuffer.Write([]byte("head"))
+	c.buffer = []byte("body")
+
+	for _, n := range []int{-1, 9} {
+		if err := c.ShiftNErr(n); !errors.Is(err, ErrShiftOutOfRange) {
+			t.Fatalf("expected ErrShiftOutOfRange for shifting %d bytes, got %v", n, err)
+		}
+		if rest := string(c.Read()); rest != "headbody" {
+			t.Fatalf("expected data to be left untouched by over-shift, got %q", rest)
+		}
+	}
+	if err := c.ShiftNErr(0); err != nil || string(c.Read()) != "headbody" {
+		t.Fatalf("expected shifting 0 bytes to be a no-op, got %q, error: %v", c.Read(), err)
+	}
+	if err := c.ShiftNErr(6); err != nil || string(c.Read()) != "dy" {
+		t.Fatalf("expected %q left, got %q, error: %v", "dy", c.Read(), err)
+	}
+	if err := c.ShiftNErr(2); err != nil || c.BufferLength() != 0 {
+		t.Fatalf("expected buffers to be emptied, %d bytes left, error: %v", c.BufferLength(), err)
+	}
+}
+
+func TestCompareAndSwapContextNotComparable(t *testing.T) {
+	c := new(conn)
+	ctx := map[string]int{"a": 1}
+	c.SetContext(ctx)
+	if c.CompareAndSwapContext(ctx, 1) {
+		t.Fatal("expected a map context not to be swapped")
+	}
+	if cur, _ := c.LoadContext(); cur.(map[string]int)["a"] != 1 {
+		t.Fatalf("expected the map context to be left untouched, got %v", cur)
+	}
+	if c.CompareAndSwapContext(nil, 1) || c.CompareAndSwapContext(struct{ s []int }{}, 1) {
+		t.Fatal("expected a context of another type not to be swapped")
+	}
+	c.SetContext(1)
+	if c.CompareAndSwapContext([]int{1}, 2) {
+		t.Fatal("expected a slice not to equal the context")
+	}
+	if !c.CompareAndSwapContext(1, ctx) {
+		t.Fatal("expected the context to be swapped for a map")
+	}
+}
+
+func TestConnBuffers(t *testing.T) {
+	testConnBuffers(t, func(inbound, temp string) Conn {
+		c := &conn{inboundBuffer: ringbuffer.New(32)}
+		// Wrap the inbound data around the end of ring-buffer.
+		_, _ = c.inboundBuffer.Write(make([]byte, 24))
+		c.inboundBuffer.Shift(24)
+		_, _ = c.inboundBuffer.Write([]byte(inbound))
+		if temp != "" {
+			c.buffer = []byte(temp)
+		}
+		return c
+	})
+}
+
+func TestIgnoringEINTRIO(t *testing.T) {
+	calls := 0
+	write := func(fd int, p []byte) (int, error) {
+		if calls++; calls < 3 {
+			return -1, unix.EINTR
+		}
+		return len(p), nil
+	}
+	if n, err := ignoringEINTRIO(write, 0, []byte("data")); n != 4 || err != nil || calls != 3 {
+		t.Fatalf("expected the write to be retried until it succeeds, got %d bytes in %d calls, error: %v",
+			n, calls, err)
+	}
+	calls = 0
+	write = func(fd int, p []byte) (int, error) {
+		calls++
+		return -1, unix.EAGAIN
+	}
+	if _, err := ignoringEINTRIO(write, 0, nil); err != unix.EAGAIN || calls != 1 {
+		t.Fatalf("expected EAGAIN to be returned at once, got %v in %d calls", err, calls)
+	}
+}
+
+func TestPartialWrites(t *testing.T) {
+	events := &testPartialWritesServer{done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// partialWritesPayload is far larger than the socket buffers, so that the replies are written partially.
+var partialWritesPayload = func() []byte {
+	b := make([]byte, 4<<20)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}()
+
+type testPartialWritesServer struct {
+	*EventServer
+	action bool
+	done   chan error
+}
+
+func (t *testPartialWritesServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	for range frame {
+		// Every byte requests a payload, the later ones are queued behind the rest of the earlier ones.
+		_ = c.Writev(partialWritesPayload[:1<<20], partialWritesPayload[1<<20:])
+	}
+	return
+}
+
+func (t *testPartialWritesServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				for i := 0; i < 3; i++ {
+					if _, err = conn.Write([]byte("x")); err != nil {
+						return err
+					}
+				}
+				// Let the server run into a full socket send buffer before reading.
+				time.Sleep(time.Millisecond * 200)
+				_ = conn.SetReadDeadline(time.Now().Add(time.Second * 10))
+				reply := make([]byte, len(partialWritesPayload))
+				for i := 0; i < 3; i++ {
+					if _, err = io.ReadFull(conn, reply); err != nil {
+						return fmt.Errorf("payload %d: %v", i, err)
+					}
+					if !bytes.Equal(reply, partialWritesPayload) {
+						return fmt.Errorf("payload %d is corrupted", i)
+					}
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
@@ -8,7 +8,17 @@
 package gnet
 
 import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
 	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
 
 	"github.com/panjf2000/gnet/pool/bytebuffer"
 	prb "github.com/panjf2000/gnet/pool/ringbuffer"
@@ -20,10 +30,6 @@ type stderr struct {
 	err error
 }
 
-type wakeReq struct {
-	c *stdConn
-}
-
 type tcpIn struct {
 	c  *stdConn
 	in *bytebuffer.ByteBuffer
@@ -33,41 +39,90 @@ type udpIn struct {
 	c *stdConn
 }
 
+// connectedUDPIn is a datagram read from the remote peer of a connected UDP connection.
+type connectedUDPIn struct {
+	c  *stdConn
+	in *bytebuffer.ByteBuffer
+}
+
+// udpConnKey identifies a connected UDP connection by the UDP socket of listener and the remote address.
+type udpConnKey struct {
+	pconn net.PacketConn
+	addr  string
+}
+
 type stdConn struct {
-	ctx           interface{}            // user-defined context
+	bytesRead     int64                  // number of bytes read from the connection, first to be 64-bit aligned
+	bytesWritten  int64                  // number of bytes written to the connection
+	asyncPending  int64                  // number of bytes queued by AsyncWrite, yet to be written
+	writeFull     int32                  // pending outbound bytes have exceeded WriteBufferCap, see WritableHandler
+	id            uint64                 // unique connection id
+	ctx           unsafe.Pointer         // user-defined context, points to an interface{}
 	conn          net.Conn               // original connection
+	tlsConn       *tls.Conn              // TLS layer over the original connection, see Options.TLSConfig
+	pconn         net.PacketConn         // UDP socket which the packet comes from
 	loop          *eventloop             // owner event-loop
-	done          int32                  // 0: attached, 1: closed
+	done          int32                  // 0: attached, 1: closed, 2: closed for idle timeout, 3: detached
+	detached      *detachedConn          // net.Conn returned by Detach, to which the data read in the meantime goes
+	connected     bool                   // persistent UDP connection of a remote peer, see Options.UDPConnected
+	writeClosed   bool                   // write side has been shut down, see CloseWrite
+	rejected      bool                   // rejected by OnOpened, inbound data is discarded until the peer closes, see loopReject
+	reactQueue    []pooledFrame          // frames waiting to be reacted to on the react pool, see Options.ReactPool
+	reacting      bool                   // React of the connection is running on the react pool
+	lastActive    time.Time              // last time when data was read from or written to the connection
+	lastFrame     time.Time              // last time when a frame was decoded or the read timeout fired
+	frameQuota    int64                  // number of frames allowed to be decoded, 0 means unlimited
+	framesDecoded int64                  // number of frames decoded since the frame quota was set
+	readThreshold int                    // minimum number of bytes buffered before decoding, see SetReadThreshold
+	limiter       *RateLimiter           // limiter of the bytes read, see Options.ConnRateLimit
 	buffer        *bytebuffer.ByteBuffer // reuse memory of inbound data as a temporary buffer
+	heldFrame     []byte                 // frame decoded by ZeroCopyCodec, aliasing the inbound data
+	heldBytes     int                    // number of inbound bytes held by heldFrame, shifted once it's handled
 	codec         ICodec                 // codec for TCP
 	localAddr     net.Addr               // local server addr
 	remoteAddr    net.Addr               // remote peer addr
+	remoteAddrStr string                 // cached string of remote peer addr
 	byteBuffer    *bytebuffer.ByteBuffer // bytes buffer for buffering current packet and data in ring-buffer
 	inboundBuffer *ringbuffer.RingBuffer // buffer for data from client
+	logLabels     []logLabel             // user-defined labels attached to the log lines of connection
+	bufferedLock  sync.Mutex             // protects buffered
+	buffered      *bytebuffer.ByteBuffer // encoded frames buffered by WriteBuffered, waiting to be flushed
 }
 
-func newTCPConn(conn net.Conn, el *eventloop) *stdConn {
-	return &stdConn{
+func newTCPConn(conn net.Conn, el *eventloop, localAddr net.Addr) *stdConn {
+	c := &stdConn{
+		id:            nextConnID(),
 		conn:          conn,
 		loop:          el,
+		localAddr:     localAddr,
 		codec:         el.codec,
 		inboundBuffer: prb.Get(),
 	}
+	c.inboundBuffer.SetGrowthPolicy(el.svr.inboundGrowthPolicy())
+	if el.svr.opts.ConnRateLimit > 0 {
+		c.limiter = newRateLimiter(el.svr.opts.ConnRateLimit, el.svr.opts.ConnRateBurst)
+	}
+	return c
 }
 
 func (c *stdConn) releaseTCP() {
-	c.ctx = nil
+	c.tlsConn = nil
+	atomic.StorePointer(&c.ctx, nil)
+	c.reactQueue = nil
 	c.localAddr = nil
 	c.remoteAddr = nil
+	c.remoteAddrStr = ""
 	prb.Put(c.inboundBuffer)
 	c.inboundBuffer = nil
 	bytebuffer.Put(c.buffer)
 	c.buffer = nil
+	bytebuffer.Put(c.takeBuffered())
 }
 
-func newUDPConn(el *eventloop, localAddr, remoteAddr net.Addr, buf *bytebuffer.ByteBuffer) *stdConn {
+func newUDPConn(el *eventloop, pconn net.PacketConn, localAddr, remoteAddr net.Addr, buf *bytebuffer.ByteBuffer) *stdConn {
 	return &stdConn{
 		loop:       el,
+		pconn:      pconn,
 		localAddr:  localAddr,
 		remoteAddr: remoteAddr,
 		buffer:     buf,
@@ -75,31 +130,153 @@ func newUDPConn(el *eventloop, localAddr, remoteAddr net.Addr, buf *bytebuffer.B
 }
 
 func (c *stdConn) releaseUDP() {
-	c.ctx = nil
+	atomic.StorePointer(&c.ctx, nil)
 	c.localAddr = nil
+	c.remoteAddrStr = ""
 	bytebuffer.Put(c.buffer)
 	c.buffer = nil
 }
 
 func (c *stdConn) read() ([]byte, error) {
+	if zc, ok := c.codec.(ZeroCopyCodec); ok {
+		frame, token, err := zc.DecodeZeroCopy(c)
+		c.heldFrame, c.heldBytes = frame, token.n
+		return frame, err
+	}
 	return c.codec.Decode(c)
 }
 
+// releaseFrame shifts the inbound bytes held by the frame decoded by ZeroCopyCodec once it has been handled.
+func (c *stdConn) releaseFrame() {
+	if c.heldBytes == 0 {
+		return
+	}
+	if c.loop.svr.opts.ZeroCopyDebug {
+		poisonFrame(c.heldFrame)
+	}
+	c.ShiftN(c.heldBytes)
+	c.heldFrame, c.heldBytes = nil, 0
+}
+
+// takeBuffered takes away the frames buffered by WriteBuffered.
+func (c *stdConn) takeBuffered() (bb *bytebuffer.ByteBuffer) {
+	c.bufferedLock.Lock()
+	bb, c.buffered = c.buffered, nil
+	c.bufferedLock.Unlock()
+	return
+}
+
+// flushBuffered writes the frames buffered by WriteBuffered, it must be invoked within the event-loop.
+func (c *stdConn) flushBuffered() (err error) {
+	if bb := c.takeBuffered(); bb != nil {
+		c.lastActive = time.Now()
+		_, err = c.write(bb.B)
+		bytebuffer.Put(bb)
+	}
+	return
+}
+
+// write writes the data to the underlying connection, counting the bytes written.
+func (c *stdConn) write(buf []byte) (n int, err error) {
+	if c.writeClosed || c.detached != nil {
+		return
+	}
+	if c.connected {
+		n, err = c.pconn.WriteTo(buf, c.remoteAddr)
+	} else if c.tlsConn != nil {
+		n, err = c.tlsConn.Write(buf)
+	} else {
+		n, err = c.conn.Write(buf)
+	}
+	c.addBytesWritten(n)
+	return
+}
+
+// addBytesRead counts the bytes read from the connection.
+func (c *stdConn) addBytesRead(n int) {
+	atomic.AddInt64(&c.bytesRead, int64(n))
+	c.loop.svr.addBytesRead(n)
+}
+
+// addBytesWritten counts the bytes written to the connection and fires WriteCompleter.OnWriteComplete.
+func (c *stdConn) addBytesWritten(n int) {
+	if n <= 0 {
+		return
+	}
+	atomic.AddInt64(&c.bytesWritten, int64(n))
+	c.loop.svr.addBytesWritten(n)
+	if h := c.loop.svr.writeCompleter; h != nil {
+		h.OnWriteComplete(c, n)
+	}
+}
+
+// errorf logs the failure with the logging context of the connection.
+func (c *stdConn) errorf(format string, args ...interface{}) {
+	c.loop.svr.logger.Errorf(connLogPrefix(c.id, c.remoteAddr, c.logLabels)+format, args...)
+}
+
+// debugf logs the event of the connection with its logging context.
+func (c *stdConn) debugf(format string, args ...interface{}) {
+	c.loop.svr.logger.Debugf(connLogPrefix(c.id, c.remoteAddr, c.logLabels)+format, args...)
+}
+
 // ================================= Public APIs of gnet.Conn =================================
 
+func (c *stdConn) Context() interface{} {
+	if p := atomic.LoadPointer(&c.ctx); p != nil {
+		return *(*interface{})(p)
+	}
+	return nil
+}
+
+func (c *stdConn) LoadContext() (interface{}, bool) {
+	if p := atomic.LoadPointer(&c.ctx); p != nil {
+		return *(*interface{})(p), true
+	}
+	return nil, false
+}
+
+func (c *stdConn) SetContext(ctx interface{}) {
+	atomic.StorePointer(&c.ctx, unsafe.Pointer(&ctx))
+}
+
+func (c *stdConn) SetLogLabel(key, value string) {
+	c.logLabels = setLogLabel(c.logLabels, key, value)
+}
+
+func (c *stdConn) CompareAndSwapContext(old, new interface{}) bool {
+	p := atomic.LoadPointer(&c.ctx)
+	var cur interface{}
+	if p != nil {
+		cur = *(*interface{})(p)
+	}
+	if !contextEqual(cur, old) {
+		return false
+	}
+	return atomic.CompareAndSwapPointer(&c.ctx, p, unsafe.Pointer(&new))
+}
+
+// tempBuffer returns the data in event-loop-buffer, which is only set during loopRead, so that the data is
+// accessed the same way as the one of unix connection out of React, e.g. in a worker pool.
+func (c *stdConn) tempBuffer() []byte {
+	if c.buffer == nil {
+		return nil
+	}
+	return c.buffer.B
+}
+
 func (c *stdConn) Read() []byte {
 	if c.inboundBuffer.IsEmpty() {
-		if c.buffer.Len() == 0 {
-			return nil
-		}
-		return c.buffer.Bytes()
+		return c.tempBuffer()
 	}
-	c.byteBuffer = c.inboundBuffer.WithByteBuffer(c.buffer.Bytes())
+	c.byteBuffer = c.inboundBuffer.WithByteBuffer(c.tempBuffer())
 	return c.byteBuffer.Bytes()
 }
 
 func (c *stdConn) ResetBuffer() {
-	c.buffer.Reset()
+	if c.buffer != nil {
+		c.buffer.Reset()
+	}
 	c.inboundBuffer.Reset()
 	bytebuffer.Put(c.byteBuffer)
 	c.byteBuffer = nil
@@ -107,13 +284,13 @@ func (c *stdConn) ResetBuffer() {
 
 func (c *stdConn) ReadN(n int) (size int, buf []byte) {
 	inBufferLen := c.inboundBuffer.Length()
-	tempBufferLen := c.buffer.Len()
+	tempBufferLen := len(c.tempBuffer())
 	if totalLen := inBufferLen + tempBufferLen; totalLen < n || n <= 0 {
 		n = totalLen
 	}
 	size = n
 	if c.inboundBuffer.IsEmpty() {
-		buf = c.buffer.B[:n]
+		buf = c.tempBuffer()[:n]
 		return
 	}
 	head, tail := c.inboundBuffer.LazyRead(n)
@@ -131,9 +308,17 @@ func (c *stdConn) ReadN(n int) (size int, buf []byte) {
 	return
 }
 
+func (c *stdConn) Peek(n int) (buf []byte, err error) {
+	var size int
+	if size, buf = c.ReadN(n); size < n {
+		err = ErrIncompletePacket
+	}
+	return
+}
+
 func (c *stdConn) ShiftN(n int) (size int) {
 	inBufferLen := c.inboundBuffer.Length()
-	tempBufferLen := c.buffer.Len()
+	tempBufferLen := len(c.tempBuffer())
 	if inBufferLen+tempBufferLen < n || n <= 0 {
 		c.ResetBuffer()
 		size = inBufferLen + tempBufferLen
@@ -159,39 +344,446 @@ func (c *stdConn) ShiftN(n int) (size int) {
 	return
 }
 
+func (c *stdConn) ShiftNErr(n int) error {
+	if length := c.BufferLength(); n < 0 || n > length {
+		return fmt.Errorf("%w: shifting %d bytes of %d bytes", ErrShiftOutOfRange, n, length)
+	}
+	if n > 0 {
+		c.ShiftN(n)
+	}
+	return nil
+}
+
+func (c *stdConn) DrainTo(w io.Writer) (n int, err error) {
+	head, tail := c.inboundBuffer.LazyReadAll()
+	for _, buf := range [][]byte{head, tail, c.tempBuffer()} {
+		if len(buf) == 0 {
+			continue
+		}
+		var m int
+		m, err = w.Write(buf)
+		n += m
+		if err != nil {
+			break
+		}
+	}
+	if n > 0 {
+		c.ShiftN(n)
+	}
+	return
+}
+
 func (c *stdConn) BufferLength() int {
-	return c.inboundBuffer.Length() + c.buffer.Len()
+	return c.inboundBuffer.Length() + len(c.tempBuffer())
 }
 
 func (c *stdConn) AsyncWrite(buf []byte) (err error) {
+	// AsyncWrite(nil) flushes the codecs like AggregatingCodec, which is never rejected.
+	if buf != nil && c.writeBufferFull() {
+		return ErrWriteBufferFull
+	}
 	var encodedBuf []byte
 	if encodedBuf, err = c.codec.Encode(c, buf); err == nil {
-		c.loop.ch <- func() error {
-			_, _ = c.conn.Write(encodedBuf)
+		err = c.asyncWriteEncoded(encodedBuf)
+	}
+	return
+}
+
+// asyncWriteEncoded writes the data that has been encoded asynchronously.
+func (c *stdConn) asyncWriteEncoded(encodedBuf []byte) (err error) {
+	n := int64(len(encodedBuf))
+	atomic.AddInt64(&c.asyncPending, n)
+	if err = c.loop.pushJob(func() error {
+		atomic.AddInt64(&c.asyncPending, -n)
+		if _, ok := c.loop.connections[c]; !ok {
 			return nil
 		}
+		c.lastActive = time.Now()
+		if _, err := c.write(encodedBuf); err != nil {
+			return c.loop.loopError(c, err)
+		}
+		return c.loop.loopNotifyWritable(c)
+	}, func() {
+		atomic.AddInt64(&c.asyncPending, -n)
+	}); err != nil {
+		atomic.AddInt64(&c.asyncPending, -n)
+		c.rejectJob(err)
 	}
 	return
 }
 
+func (c *stdConn) AsyncWriteSeq(bufs ...[]byte) error {
+	if c.writeBufferFull() {
+		return ErrWriteBufferFull
+	}
+	frames := make([][]byte, 0, len(bufs))
+	var n int64
+	for _, buf := range bufs {
+		frame, err := c.codec.Encode(c, buf)
+		if err != nil {
+			return err
+		}
+		if len(frame) > 0 {
+			frames = append(frames, frame)
+			n += int64(len(frame))
+		}
+	}
+	if len(frames) == 0 {
+		return nil
+	}
+	atomic.AddInt64(&c.asyncPending, n)
+	err := c.loop.pushJob(func() error {
+		atomic.AddInt64(&c.asyncPending, -n)
+		if _, ok := c.loop.connections[c]; !ok {
+			return nil
+		}
+		c.lastActive = time.Now()
+		if c.connected {
+			for _, frame := range frames {
+				if _, err := c.write(frame); err != nil {
+					return c.loop.loopError(c, err)
+				}
+			}
+			return nil
+		}
+		if err := c.Writev(frames...); err != nil {
+			return c.loop.loopError(c, err)
+		}
+		return c.loop.loopNotifyWritable(c)
+	}, func() {
+		atomic.AddInt64(&c.asyncPending, -n)
+	})
+	if err != nil {
+		atomic.AddInt64(&c.asyncPending, -n)
+		c.rejectJob(err)
+	}
+	return err
+}
+
+// rejectJob closes the connection if its job is rejected by the event-loop with the CloseConn policy.
+func (c *stdConn) rejectJob(err error) {
+	if err != ErrLoopQueueFull {
+		return
+	}
+	c.loop.ch <- func() error {
+		if _, ok := c.loop.connections[c]; ok || c.connected {
+			return c.loop.loopError(c, ErrLoopQueueFull)
+		}
+		return nil
+	}
+}
+
+// writeBufferFull reports whether the pending outbound bytes exceed Options.WriteBufferCap,
+// the connection is marked full until OnWritable fires if so.
+func (c *stdConn) writeBufferFull() bool {
+	writeCap := c.loop.svr.opts.WriteBufferCap
+	if writeCap <= 0 || c.OutboundBuffered() <= writeCap {
+		return false
+	}
+	if atomic.CompareAndSwapInt32(&c.writeFull, 0, 1) && c.loop.svr.writableHandler != nil {
+		// The data may have drained before the connection is marked full,
+		// so check it again on the event-loop after the writes queued so far.
+		_ = c.loop.pushJob(func() error {
+			return c.loop.loopNotifyWritable(c)
+		}, nil)
+	}
+	return true
+}
+
+func (c *stdConn) connCodec() ICodec {
+	return c.codec
+}
+
+func (c *stdConn) Writev(bufs ...[]byte) (err error) {
+	c.lastActive = time.Now()
+	if c.detached != nil {
+		return
+	}
+	if c.connected || c.tlsConn != nil {
+		// A TLS record or a datagram is made from the whole data.
+		_, err = c.write(bytes.Join(bufs, nil))
+		return
+	}
+	// net.Buffers is written to the TCP connection by WSASend with all the buffers.
+	vec := net.Buffers(bufs)
+	n, err := vec.WriteTo(c.conn)
+	c.addBytesWritten(int(n))
+	return
+}
+
+// SendFile copies the file through a buffer, for the writes block the event-loop on Windows anyway.
+func (c *stdConn) SendFile(f *os.File, offset int64, count int) error {
+	if c.conn == nil {
+		return ErrUnsupportedOp
+	}
+	c.lastActive = time.Now()
+	if count <= 0 {
+		return nil
+	}
+	buf := make([]byte, 0x10000)
+	for count > 0 {
+		if count < len(buf) {
+			buf = buf[:count]
+		}
+		n, err := f.ReadAt(buf, offset)
+		if n > 0 {
+			if _, e := c.write(buf[:n]); e != nil {
+				return e
+			}
+			offset += int64(n)
+			count -= n
+		}
+		if err != nil && count > 0 {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// OutboundBuffered only counts the data queued by AsyncWrite, for the writes block the event-loop on Windows
+// rather than buffering the data.
+func (c *stdConn) OutboundBuffered() int {
+	return int(atomic.LoadInt64(&c.asyncPending))
+}
+
+func (c *stdConn) TryWrite(buf []byte) (n int, err error) {
+	return 0, ErrUnsupportedOp
+}
+
+func (c *stdConn) WriteBuffered(buf []byte) error {
+	encodedBuf, err := c.codec.Encode(c, buf)
+	if err != nil {
+		return err
+	}
+	c.bufferedLock.Lock()
+	if c.buffered == nil {
+		c.buffered = bytebuffer.Get()
+	}
+	_, _ = c.buffered.Write(encodedBuf)
+	c.bufferedLock.Unlock()
+	return nil
+}
+
+func (c *stdConn) Flush() error {
+	err := c.loop.pushJob(func() error {
+		_ = c.flushBuffered()
+		return nil
+	}, nil)
+	c.rejectJob(err)
+	return err
+}
+
+func (c *stdConn) BytesRead() int64 {
+	return atomic.LoadInt64(&c.bytesRead)
+}
+
+func (c *stdConn) BytesWritten() int64 {
+	return atomic.LoadInt64(&c.bytesWritten)
+}
+
 func (c *stdConn) SendTo(buf []byte) (err error) {
-	_, err = c.loop.svr.ln.pconn.WriteTo(buf, c.remoteAddr)
+	var n int
+	n, err = c.pconn.WriteTo(buf, c.remoteAddr)
+	c.addBytesWritten(n)
 	return
 }
 
-func (c *stdConn) Wake() error {
-	c.loop.ch <- wakeReq{c}
+func (c *stdConn) SetDeadline(t time.Time) error {
+	if c.conn == nil {
+		return ErrUnsupportedOp
+	}
+	return c.conn.SetDeadline(t)
+}
+
+func (c *stdConn) SetReadDeadline(t time.Time) error {
+	if c.conn == nil {
+		return ErrUnsupportedOp
+	}
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *stdConn) SetWriteDeadline(t time.Time) error {
+	if c.conn == nil {
+		return ErrUnsupportedOp
+	}
+	return c.conn.SetWriteDeadline(t)
+}
+
+func (c *stdConn) TCPInfo() (*TCPInfo, error) {
+	return nil, ErrUnsupportedOp
+}
+
+func (c *stdConn) SetNoDelay(noDelay bool) error {
+	if tc, ok := c.conn.(*net.TCPConn); ok {
+		return tc.SetNoDelay(noDelay)
+	}
+	return ErrUnsupportedOp
+}
+
+func (c *stdConn) FD() int {
+	return -1
+}
+
+func (c *stdConn) LoopIndex() int {
+	return c.loop.idx
+}
+
+func (c *stdConn) JoinGroup(addr net.IP) error {
+	return c.setMembership(addr, true)
+}
+
+func (c *stdConn) LeaveGroup(addr net.IP) error {
+	return c.setMembership(addr, false)
+}
+
+// setMembership joins or leaves the multicast group of addr with the UDP listener of the connection.
+func (c *stdConn) setMembership(addr net.IP, join bool) error {
+	uc, ok := c.pconn.(*net.UDPConn)
+	if !ok {
+		return ErrUnsupportedOp
+	}
+	if !addr.IsMulticast() {
+		return ErrNotMulticast
+	}
+	rc, err := uc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var opErr error
+	err = rc.Control(func(fd uintptr) {
+		if ip4 := addr.To4(); ip4 != nil {
+			mreq := new(syscall.IPMreq)
+			copy(mreq.Multiaddr[:], ip4)
+			opt := syscall.IP_ADD_MEMBERSHIP
+			if !join {
+				opt = syscall.IP_DROP_MEMBERSHIP
+			}
+			opErr = syscall.SetsockoptIPMreq(syscall.Handle(fd), syscall.IPPROTO_IP, opt, mreq)
+			return
+		}
+		mreq := new(syscall.IPv6Mreq)
+		copy(mreq.Multiaddr[:], addr)
+		opt := syscall.IPV6_JOIN_GROUP
+		if !join {
+			opt = syscall.IPV6_LEAVE_GROUP
+		}
+		opErr = syscall.SetsockoptIPv6Mreq(syscall.Handle(fd), syscall.IPPROTO_IPV6, opt, mreq)
+	})
+	if err != nil {
+		return err
+	}
+	return opErr
+}
+
+func (c *stdConn) Hijack() (fd int, cleanup func(), err error) {
+	return -1, nil, ErrUnsupportedOp
+}
+
+func (c *stdConn) Detach() (net.Conn, error) {
+	if c.connected || c.pconn != nil || c.tlsConn != nil {
+		return nil, ErrUnsupportedOp
+	}
+	if !atomic.CompareAndSwapInt32(&c.done, 0, 3) {
+		return nil, ErrDetached
+	}
+	return c.loop.loopDetach(c), nil
+}
+
+func (c *stdConn) SetCodec(codec ICodec) error {
+	if hasPartialFrame(c.codec, c) {
+		return ErrPartialFrame
+	}
+	releaseCodecState(c.codec, c)
+	c.codec = codec
 	return nil
 }
 
+func (c *stdConn) RateLimiter() *RateLimiter {
+	return c.limiter
+}
+
+func (c *stdConn) SetFrameQuota(n int64) {
+	c.frameQuota, c.framesDecoded = n, 0
+}
+
+func (c *stdConn) SetReadThreshold(n int) {
+	c.readThreshold = n
+}
+
+// belowReadThreshold reports whether the data buffered is less than the read threshold.
+func (c *stdConn) belowReadThreshold() bool {
+	return c.readThreshold > 0 && c.BufferLength() < c.readThreshold
+}
+
+// takeFrameQuota counts a decoded frame against the frame quota, it reports false once the quota is exhausted.
+func (c *stdConn) takeFrameQuota() bool {
+	if c.frameQuota <= 0 {
+		return true
+	}
+	if c.framesDecoded >= c.frameQuota {
+		return false
+	}
+	c.framesDecoded++
+	return true
+}
+
+func (c *stdConn) Wake() error {
+	return c.WakeWith(nil)
+}
+
+func (c *stdConn) WakeWith(data []byte) error {
+	err := c.loop.pushJob(func() error {
+		return c.loop.loopWake(c, data)
+	}, nil)
+	c.rejectJob(err)
+	return err
+}
+
 func (c *stdConn) Close() error {
 	c.loop.ch <- func() error {
+		_ = c.flushBuffered()
 		return c.loop.loopCloseConn(c)
 	}
 	return nil
 }
 
-func (c *stdConn) Context() interface{}       { return c.ctx }
-func (c *stdConn) SetContext(ctx interface{}) { c.ctx = ctx }
-func (c *stdConn) LocalAddr() net.Addr        { return c.localAddr }
-func (c *stdConn) RemoteAddr() net.Addr       { return c.remoteAddr }
+func (c *stdConn) CloseWrite() error {
+	// Both *net.TCPConn and *net.UnixConn can shut down the write side.
+	wc, ok := c.conn.(interface{ CloseWrite() error })
+	if !ok {
+		return ErrUnsupportedOp
+	}
+	c.loop.ch <- func() error {
+		if _, ok := c.loop.connections[c]; !ok || c.writeClosed {
+			return nil
+		}
+		_ = c.flushBuffered()
+		if c.tlsConn != nil {
+			// Send the close_notify alert before shutting down the socket.
+			_ = c.tlsConn.CloseWrite()
+		}
+		c.writeClosed = true
+		if err := wc.CloseWrite(); err != nil {
+			return c.loop.loopError(c, err)
+		}
+		return nil
+	}
+	return nil
+}
+
+func (c *stdConn) LocalAddr() net.Addr  { return c.localAddr }
+func (c *stdConn) RemoteAddr() net.Addr { return c.remoteAddr }
+
+func (c *stdConn) RemoteAddrString() string {
+	if c.remoteAddrStr == "" && c.remoteAddr != nil {
+		c.remoteAddrStr = c.remoteAddr.String()
+	}
+	return c.remoteAddrStr
+}
+
+func (c *stdConn) Network() string {
+	return addrNetwork(c.localAddr)
+}
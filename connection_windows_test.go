@@ -0,0 +1,29 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build windows
+
+package gnet
+
+import (
+	"testing"
+
+	"github.com/panjf2000/gnet/pool/bytebuffer"
+	"github.com/panjf2000/gnet/ringbuffer"
+)
+
+func TestConnBuffers(t *testing.T) {
+	testConnBuffers(t, func(inbound, temp string) Conn {
+		c := &stdConn{inboundBuffer: ringbuffer.New(32)}
+		// Wrap the inbound data around the end of ring-buffer.
+		_, _ = c.inboundBuffer.Write(make([]byte, 24))
+		c.inboundBuffer.Shift(24)
+		_, _ = c.inboundBuffer.Write([]byte(inbound))
+		if temp != "" {
+			c.buffer = bytebuffer.Get()
+			_, _ = c.buffer.WriteString(temp)
+		}
+		return c
+	})
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"sync"
+	"time"
+)
+
+// CorrelationIDFunc extracts the correlation id from a request or response frame,
+// ok is false if the frame carries no correlation id.
+type CorrelationIDFunc func(frame []byte) (id interface{}, ok bool)
+
+// ResponseCallback is invoked with the response matching a request, or with an error
+// if no response arrives in time or the connection is released.
+type ResponseCallback func(response []byte, err error)
+
+type pendingRequest struct {
+	callback ResponseCallback
+	timer    *time.Timer
+}
+
+// Correlator matches the responses to the in-flight requests sent over connections by their correlation ids.
+// It works above the codec: requests are sent by Send, each decoded frame should be offered to Match in
+// EventHandler.React, and Release should be invoked in EventHandler.OnClosed.
+type Correlator struct {
+	extractID CorrelationIDFunc
+	timeout   time.Duration
+	mu        sync.Mutex
+	pending   map[Conn]map[interface{}]*pendingRequest
+}
+
+// NewCorrelator instantiates and returns a Correlator, the callback of a request is invoked with
+// ErrRequestTimeout if the response doesn't arrive within timeout, 0 means no timeout.
+func NewCorrelator(extractID CorrelationIDFunc, timeout time.Duration) *Correlator {
+	return &Correlator{
+		extractID: extractID,
+		timeout:   timeout,
+		pending:   make(map[Conn]map[interface{}]*pendingRequest),
+	}
+}
+
+// Send tracks the request and writes it to the connection asynchronously, callback is invoked
+// within the event-loop when the matching response is offered to Match, or in another goroutine
+// when the request times out.
+func (cr *Correlator) Send(c Conn, request []byte, callback ResponseCallback) error {
+	id, ok := cr.extractID(request)
+	if !ok {
+		return ErrCorrelationIDMissing
+	}
+	req := &pendingRequest{callback: callback}
+
+	cr.mu.Lock()
+	requests := cr.pending[c]
+	if requests == nil {
+		requests = make(map[interface{}]*pendingRequest)
+		cr.pending[c] = requests
+	}
+	if _, ok = requests[id]; ok {
+		cr.mu.Unlock()
+		return ErrCorrelationIDInUse
+	}
+	requests[id] = req
+	if cr.timeout > 0 {
+		req.timer = time.AfterFunc(cr.timeout, func() {
+			if cr.remove(c, id, req) {
+				callback(nil, ErrRequestTimeout)
+			}
+		})
+	}
+	cr.mu.Unlock()
+
+	if err := c.AsyncWrite(request); err != nil {
+		cr.remove(c, id, req)
+		return err
+	}
+	return nil
+}
+
+// Match invokes the callback of the request matching the frame and reports whether the frame is a response
+// to an in-flight request, otherwise the frame should be handled as usual.
+func (cr *Correlator) Match(c Conn, frame []byte) bool {
+	id, ok := cr.extractID(frame)
+	if !ok {
+		return false
+	}
+	cr.mu.Lock()
+	req, ok := cr.pending[c][id]
+	cr.mu.Unlock()
+	if !ok || !cr.remove(c, id, req) {
+		return false
+	}
+	req.callback(frame, nil)
+	return true
+}
+
+// Pending returns the number of in-flight requests on the connection.
+func (cr *Correlator) Pending(c Conn) int {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	return len(cr.pending[c])
+}
+
+// Release gives up all the in-flight requests on the connection, their callbacks are invoked with err.
+func (cr *Correlator) Release(c Conn, err error) {
+	cr.mu.Lock()
+	requests := cr.pending[c]
+	delete(cr.pending, c)
+	cr.mu.Unlock()
+	for _, req := range requests {
+		if req.timer != nil {
+			req.timer.Stop()
+		}
+		req.callback(nil, err)
+	}
+}
+
+// remove stops tracking the request, it reports false if the request has been removed already.
+func (cr *Correlator) remove(c Conn, id interface{}, req *pendingRequest) bool {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	requests := cr.pending[c]
+	if requests[id] != req {
+		return false
+	}
+	if req.timer != nil {
+		req.timer.Stop()
+	}
+	delete(requests, id)
+	if len(requests) == 0 {
+		delete(cr.pending, c)
+	}
+	return true
+}
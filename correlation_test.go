@@ -0,0 +1,113 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// asyncWriteConn records the data written by AsyncWrite.
+type asyncWriteConn struct {
+	Conn
+	mu      sync.Mutex
+	written [][]byte
+}
+
+func (c *asyncWriteConn) AsyncWrite(buf []byte) error {
+	c.mu.Lock()
+	c.written = append(c.written, buf)
+	c.mu.Unlock()
+	return nil
+}
+
+func TestCorrelator(t *testing.T) {
+	// The first byte of frame is the correlation id.
+	extractID := func(frame []byte) (interface{}, bool) {
+		if len(frame) == 0 {
+			return nil, false
+		}
+		return frame[0], true
+	}
+	cr := NewCorrelator(extractID, time.Millisecond*200)
+	c1, c2 := new(asyncWriteConn), new(asyncWriteConn)
+
+	type result struct {
+		response string
+		err      error
+	}
+	results := make(chan result, 8)
+	callback := func(response []byte, err error) {
+		results <- result{string(response), err}
+	}
+	expect := func(response string, err error) {
+		select {
+		case r := <-results:
+			if r.response != response || r.err != err {
+				t.Fatalf("expected response %q with error %v, got %q with error %v", response, err, r.response, r.err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("callback of response %q with error %v isn't invoked", response, err)
+		}
+	}
+
+	for _, id := range []byte{1, 2, 3} {
+		if err := cr.Send(c1, []byte{id, 'q'}, callback); err != nil {
+			t.Fatalf("failed to send request %d: %v", id, err)
+		}
+	}
+	if err := cr.Send(c2, []byte{1, 'q'}, callback); err != nil {
+		t.Fatalf("failed to send request with the same id on another connection: %v", err)
+	}
+	if len(c1.written) != 3 || len(c2.written) != 1 {
+		t.Fatalf("requests should be written to the connections, got %d and %d", len(c1.written), len(c2.written))
+	}
+	if err := cr.Send(c1, []byte{2, 'q'}, callback); err != ErrCorrelationIDInUse {
+		t.Fatalf("expected ErrCorrelationIDInUse, got %v", err)
+	}
+	if err := cr.Send(c1, nil, callback); err != ErrCorrelationIDMissing {
+		t.Fatalf("expected ErrCorrelationIDMissing, got %v", err)
+	}
+
+	// Responses arrive out of order.
+	if !cr.Match(c1, []byte{3, 'c'}) {
+		t.Fatal("response 3 should match")
+	}
+	expect("\x03c", nil)
+	if !cr.Match(c1, []byte{1, 'a'}) {
+		t.Fatal("response 1 should match")
+	}
+	expect("\x01a", nil)
+	if cr.Match(c1, []byte{1, 'a'}) {
+		t.Fatal("duplicate response 1 shouldn't match")
+	}
+	if cr.Match(c1, []byte{9, 'x'}) || cr.Match(c1, nil) {
+		t.Fatal("frames that aren't responses to in-flight requests shouldn't match")
+	}
+	if n := cr.Pending(c1); n != 1 {
+		t.Fatalf("expected 1 in-flight request, got %d", n)
+	}
+
+	// Request 2 on c1 and request 1 on c2 time out, late responses don't match.
+	expect("", ErrRequestTimeout)
+	expect("", ErrRequestTimeout)
+	if cr.Match(c1, []byte{2, 'b'}) || cr.Match(c2, []byte{1, 'a'}) {
+		t.Fatal("responses to timed out requests shouldn't match")
+	}
+
+	// In-flight requests are given up when releasing the connection.
+	errClosed := errors.New("closed")
+	cr = NewCorrelator(extractID, 0)
+	if err := cr.Send(c2, []byte{7, 'q'}, callback); err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	cr.Release(c2, errClosed)
+	expect("", errClosed)
+	if n := cr.Pending(c2); n != 0 {
+		t.Fatalf("expected no in-flight request, got %d", n)
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package gnet
+
+import (
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+const cpuAffinitySupported = true
+
+// pinCPU locks the event-loop to the OS thread running it and binds the thread to its CPU of Options.CPUAffinity.
+// The thread is left locked when the event-loop exits, so that it is terminated instead of running other
+// goroutines on the CPU.
+func (el *eventloop) pinCPU() {
+	cpus := el.svr.opts.CPUAffinity
+	if len(cpus) == 0 {
+		return
+	}
+	runtime.LockOSThread()
+	var set unix.CPUSet
+	set.Set(cpus[el.idx%len(cpus)])
+	if err := unix.SchedSetaffinity(0, &set); err != nil {
+		el.svr.logger.Errorf("failed to bind event-loop:%d to CPU %d, error:%v\n", el.idx, cpus[el.idx%len(cpus)], err)
+	}
+}
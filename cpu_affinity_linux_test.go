@@ -0,0 +1,91 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package gnet
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCPUAffinity(t *testing.T) {
+	var set unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &set); err != nil {
+		t.Fatal(err)
+	}
+	// Pin the event-loop to the last CPU which the test is allowed to run on.
+	cpu := -1
+	for i := 0; i < len(set)*64; i++ {
+		if set.IsSet(i) {
+			cpu = i
+		}
+	}
+	events := &testCPUAffinityServer{cpu: cpu, done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithCPUAffinity([]int{cpu}), WithNumEventLoop(2), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testCPUAffinityServer struct {
+	*EventServer
+	cpu    int
+	action bool
+	done   chan error
+}
+
+func (t *testCPUAffinityServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	var set unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &set); err != nil {
+		out = []byte(err.Error())
+	} else if set.Count() != 1 || !set.IsSet(t.cpu) {
+		out = []byte(fmt.Sprintf("event-loop isn't bound to CPU %d only", t.cpu))
+	} else {
+		out = []byte("ok")
+	}
+	action = Close
+	return
+}
+
+func (t *testCPUAffinityServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				if _, err = conn.Write([]byte("ping")); err != nil {
+					return err
+				}
+				data, err := ioutil.ReadAll(conn)
+				if err != nil {
+					return err
+				}
+				if string(data) != "ok" {
+					return fmt.Errorf("%s", data)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
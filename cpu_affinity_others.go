@@ -0,0 +1,11 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package gnet
+
+const cpuAffinitySupported = false
+
+func (el *eventloop) pinCPU() {}
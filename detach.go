@@ -0,0 +1,50 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import "net"
+
+// detachedConn is the net.Conn of a connection detached from gnet, see Conn.Detach. The data read by gnet
+// but not decoded is returned by Read first, and the data pending to be written by gnet is written before Write.
+type detachedConn struct {
+	net.Conn
+	ready   chan struct{} // closed once the data buffered by gnet has been handed over
+	inbound []byte        // data read by gnet but not decoded
+	err     error         // error of writing the data pending to be written by gnet
+}
+
+func newDetachedConn(nc net.Conn, inbound []byte) *detachedConn {
+	return &detachedConn{
+		Conn:    nc,
+		ready:   make(chan struct{}),
+		inbound: append([]byte(nil), inbound...),
+	}
+}
+
+// flush writes the data pending to be written by gnet, then hands the connection over to the caller.
+func (dc *detachedConn) flush(outbound []byte) {
+	if len(outbound) > 0 {
+		_, dc.err = dc.Conn.Write(outbound)
+	}
+	close(dc.ready)
+}
+
+func (dc *detachedConn) Read(p []byte) (int, error) {
+	<-dc.ready
+	if len(dc.inbound) > 0 {
+		n := copy(p, dc.inbound)
+		dc.inbound = dc.inbound[n:]
+		return n, nil
+	}
+	return dc.Conn.Read(p)
+}
+
+func (dc *detachedConn) Write(p []byte) (int, error) {
+	<-dc.ready
+	if dc.err != nil {
+		return 0, dc.err
+	}
+	return dc.Conn.Write(p)
+}
@@ -5,18 +5,128 @@ import "errors"
 var (
 	// ErrProtocolNotSupported occurs when trying to use protocol that is not supported.
 	ErrProtocolNotSupported = errors.New("not supported protocol on this platform")
+	// ErrNoAddress occurs when serving without any address.
+	ErrNoAddress = errors.New("no address to serve")
+	// ErrAlreadyListening occurs when adding a listener for the address that is being served.
+	ErrAlreadyListening = errors.New("address is already being served")
 	// ErrServerShutdown occurs when server is closing.
 	ErrServerShutdown = errors.New("server is going to be shutdown")
+	// ErrTooManyConnections occurs when dialing by Client which has reached the limit of MaxConnections.
+	ErrTooManyConnections = errors.New("number of connections has reached the limit")
+	// ErrInvalidNumEventLoop occurs when trying to scale event-loops to zero or a negative number.
+	ErrInvalidNumEventLoop = errors.New("number of event-loops must be positive")
+	// ErrScalingNotSupported occurs when trying to scale event-loops of a server that can't be scaled,
+	// which is a server with SO_REUSEPORT, a UDP server or a server on Windows.
+	ErrScalingNotSupported = errors.New("event-loops of this server can't be scaled")
+	// ErrScaleDownNotSupported occurs when trying to remove event-loops, whose connections can't be migrated
+	// to the other event-loops.
+	ErrScaleDownNotSupported = errors.New("event-loops can't be removed")
+	// ErrUnsupportedOp occurs when calling some methods that are not supported on this platform.
+	ErrUnsupportedOp = errors.New("unsupported operation on this platform")
+	// ErrWouldBlock occurs when a non-blocking operation can't be done without blocking,
+	// e.g. the socket send buffer is full.
+	ErrWouldBlock = errors.New("operation would block")
+	// ErrWriteBufferFull occurs when AsyncWrite is called on a connection whose pending outbound bytes
+	// exceed Options.WriteBufferCap.
+	ErrWriteBufferFull = errors.New("write buffer of connection is full")
+	// ErrLoopQueueFull occurs when a job is rejected by the full queue of event-loop with the CloseConn policy,
+	// see Options.LoopQueueCap.
+	ErrLoopQueueFull = errors.New("queue of event-loop is full")
+	// ErrNotMulticast occurs when joining or leaving a group of non-multicast address.
+	ErrNotMulticast = errors.New("not a multicast address")
+	// ErrShiftOutOfRange occurs when calling Conn.ShiftNErr with a length that is negative or exceeds the length
+	// of the available data.
+	ErrShiftOutOfRange = errors.New("shift length is out of range of the available data")
+	// ErrHijacked occurs when hijacking a connection that has already been hijacked.
+	ErrHijacked = errors.New("connection has been hijacked")
+	// ErrDetached occurs when detaching a connection which has been detached or closed.
+	ErrDetached = errors.New("connection has been detached")
+	// ErrCorrelationIDMissing occurs when a request sent by Correlator carries no correlation id.
+	ErrCorrelationIDMissing = errors.New("correlation id of request is missing")
+	// ErrCorrelationIDInUse occurs when a request is sent by Correlator with the id of an in-flight request.
+	ErrCorrelationIDInUse = errors.New("correlation id is in use by an in-flight request")
+	// ErrRequestTimeout occurs when the response to a request sent by Correlator doesn't arrive in time.
+	ErrRequestTimeout = errors.New("request timed out without a response")
+	// ErrIdleTimeout occurs when a connection is closed because it has been idle for longer than the idle timeout.
+	ErrIdleTimeout = errors.New("connection has been idle for too long")
+	// ErrQuotaExceeded occurs when a connection is closed because it has sent more frames than its frame quota.
+	ErrQuotaExceeded = errors.New("frame quota of connection exceeded")
+	// ErrPartialFrame occurs when switching the codec of a connection while the old codec is in the middle of
+	// decoding a frame.
+	ErrPartialFrame = errors.New("codec is in the middle of decoding a frame")
 	// ErrInvalidFixedLength occurs when the output data have invalid fixed length.
 	ErrInvalidFixedLength = errors.New("invalid fixed length of bytes")
+	// ErrIncompletePacket occurs when the frame is incomplete and more data is needed to decode it,
+	// the event-loop keeps buffering the data rather than closing the connection when it's returned by codec.
+	ErrIncompletePacket = errors.New("incomplete packet")
 	// ErrUnexpectedEOF occurs when no enough data to read by codec.
-	ErrUnexpectedEOF = errors.New("there is no enough data")
+	// Deprecated: it's the same as ErrIncompletePacket.
+	ErrUnexpectedEOF = ErrIncompletePacket
 	// ErrDelimiterNotFound occurs when no such a delimiter is in input data.
-	ErrDelimiterNotFound = errors.New("there is no such a delimiter")
+	// Deprecated: it's the same as ErrIncompletePacket.
+	ErrDelimiterNotFound = ErrIncompletePacket
 	// ErrCRLFNotFound occurs when a CRLF is not found by codec.
-	ErrCRLFNotFound = errors.New("there is no CRLF")
+	// Deprecated: it's the same as ErrIncompletePacket.
+	ErrCRLFNotFound = ErrIncompletePacket
 	// ErrUnsupportedLength occurs when unsupported lengthFieldLength is from input data.
-	ErrUnsupportedLength = errors.New("unsupported lengthFieldLength. (expected: 1, 2, 3, 4, or 8)")
+	ErrUnsupportedLength = errors.New("unsupported lengthFieldLength. (expected: 1 to 8)")
 	// ErrTooLessLength occurs when adjusted frame length is less than zero.
 	ErrTooLessLength = errors.New("adjusted frame length is less than zero")
+	// ErrFrameTooLarge occurs when the length of frame exceeds the maximum frame length.
+	ErrFrameTooLarge = errors.New("frame length exceeds the maximum")
+	// ErrInvalidStripLength occurs when InitialBytesToStrip of decoder is out of the range of frame.
+	ErrInvalidStripLength = errors.New("initial bytes to strip exceed the frame length")
+	// ErrInvalidVarint occurs when the varint length prefix of frame overflows a 64-bit integer.
+	ErrInvalidVarint = errors.New("invalid varint length of frame")
+	// ErrFrameTypeMissing occurs when the buffer to be encoded by FrameDispatchCodec is too short to have a frame type.
+	ErrFrameTypeMissing = errors.New("type of frame is missing")
+	// ErrUnsupportedVersion occurs when the protocol version of frame is not accepted by VersionedCodec.
+	ErrUnsupportedVersion = errors.New("unsupported protocol version")
+	// ErrInvalidBitmaskField occurs when a field of BitmaskCodec is undefined or of a wrong size.
+	ErrInvalidBitmaskField = errors.New("undefined bitmask field or invalid size of field")
+	// ErrInvalidAggregatedFrame occurs when a batch decoded by AggregatingCodec is truncated in the middle of a frame.
+	ErrInvalidAggregatedFrame = errors.New("invalid frame in aggregated batch")
+	// ErrInvalidStreamFragment occurs when a fragment of StreamReassemblyCodec is too short to have a stream header.
+	ErrInvalidStreamFragment = errors.New("invalid fragment of stream")
+	// ErrHeaderChecksumMismatch occurs when the checksum in the header of frame doesn't match the one computed from
+	// the header fields.
+	ErrHeaderChecksumMismatch = errors.New("checksum of frame header mismatched")
+	// ErrHeaderFieldsMissing occurs when the buffer to be encoded by HeaderChecksumFrameCodec is too short to have
+	// the header fields.
+	ErrHeaderFieldsMissing = errors.New("header fields of frame are missing")
+	// ErrMACMismatch occurs when the MAC of frame doesn't match the one computed from the payload.
+	ErrMACMismatch = errors.New("MAC of frame mismatched")
+	// ErrChecksumMismatch occurs when the CRC32 of frame doesn't match the one computed from the payload.
+	ErrChecksumMismatch = errors.New("checksum of frame mismatched")
+	// ErrInvalidRESP occurs when the data is not a valid value of the Redis serialization protocol.
+	ErrInvalidRESP = errors.New("invalid RESP value")
+	// ErrInvalidHTTPRequest occurs when the request line or the headers of HTTP request are malformed.
+	ErrInvalidHTTPRequest = errors.New("invalid HTTP request")
+	// ErrUnknownProtocol occurs when SniffingCodec can't tell the protocol of a connection from its leading bytes.
+	ErrUnknownProtocol = errors.New("unknown protocol")
+	// ErrUnbalancedQuotes occurs when an inline command has an unclosed quote or a closing quote followed by
+	// something other than a space.
+	ErrUnbalancedQuotes = errors.New("unbalanced quotes in inline command")
+	// ErrInvalidOctetCount occurs when the MSG-LEN field of an octet-counting syslog frame is malformed.
+	ErrInvalidOctetCount = errors.New("invalid octet count of syslog frame")
+	// ErrInvalidProxyHeader occurs when a connection doesn't start with a valid PROXY protocol header,
+	// see Options.ProxyProtocol.
+	ErrInvalidProxyHeader = errors.New("invalid PROXY protocol header")
 )
+
+// ListenError is returned by Serve and Server.AddListener when it fails to listen on an address, e.g. the address
+// is already in use, which can be told by errors.Is(err, syscall.EADDRINUSE).
+type ListenError struct {
+	Op   string // operation failed, e.g. "listen"
+	Addr string // address to listen on, as given to Serve or Server.AddListener
+	Err  error  // underlying error, usually a *net.OpError
+}
+
+func (e *ListenError) Error() string {
+	return e.Op + " " + e.Addr + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *ListenError) Unwrap() error {
+	return e.Err
+}
@@ -13,18 +13,23 @@ import (
 	"time"
 
 	"github.com/panjf2000/gnet/internal/netpoll"
+	"github.com/panjf2000/gnet/pool/bytebuffer"
 	"golang.org/x/sys/unix"
 )
 
 type eventloop struct {
-	idx          int             // loop index in the server loops list
-	svr          *server         // server in loop
-	codec        ICodec          // codec for TCP
-	packet       []byte          // read packet buffer
-	poller       *netpoll.Poller // epoll or kqueue
-	connCount    int32           // number of active connections in event-loop
-	connections  map[int]*conn   // loop connections fd -> conn
-	eventHandler EventHandler    // user eventHandler
+	idx          int                  // loop index in the server loops list
+	svr          *server              // server in loop
+	codec        ICodec               // codec for TCP
+	packet       []byte               // read packet buffer
+	plaintext    []byte               // buffer of data decrypted from TLS connections
+	poller       *netpoll.Poller      // epoll or kqueue
+	connCount    int32                // number of active connections in event-loop
+	connections  map[int]*conn        // loop connections fd -> conn
+	udpConns     map[udpConnKey]*conn // connected UDP connections owned by loop
+	eventHandler EventHandler         // user eventHandler
+	jobs         loopQueue            // jobs queued by the users of connections
+	udpBatch     *udpBatch            // buffers of the datagrams read at a time, see Options.UDPBatch
 }
 
 func (el *eventloop) plusConnCount() {
@@ -39,6 +44,14 @@ func (el *eventloop) loadConnCount() int32 {
 	return atomic.LoadInt32(&el.connCount)
 }
 
+// pushJob queues the job from the users of connections, see Options.LoopQueueCap.
+func (el *eventloop) pushJob(run func() error, drop func()) error {
+	opts := el.svr.opts
+	return el.jobs.push(opts.LoopQueueCap, opts.LoopOverflowPolicy, loopJob{run, drop}, func(drain func() error) error {
+		return el.poller.Trigger(drain)
+	})
+}
+
 func (el *eventloop) loopRun() {
 	defer func() {
 		if el.idx == 0 && el.svr.opts.Ticker {
@@ -47,17 +60,24 @@ func (el *eventloop) loopRun() {
 		el.svr.signalShutdown()
 	}()
 
+	el.pinCPU()
 	if el.idx == 0 && el.svr.opts.Ticker {
 		go el.loopTicker()
 	}
+	if el.svr.opts.PerLoopTicker && el.svr.loopTicker != nil {
+		go el.loopPerLoopTicker()
+	}
 
-	el.svr.logger.Printf("event-loop:%d exits with error: %v\n", el.idx, el.poller.Polling(el.handleEvent))
+	el.svr.logger.Infof("event-loop:%d exits with error: %v\n", el.idx, el.poller.Polling(el.handleEvent))
 }
 
 func (el *eventloop) loopAccept(fd int) error {
-	if fd == el.svr.ln.fd {
-		if el.svr.ln.pconn != nil {
-			return el.loopReadUDP(fd)
+	if ln := el.svr.listener(fd); ln != nil {
+		if ln.pconn != nil {
+			if el.svr.opts.UDPBatch > 1 {
+				return el.loopReadUDPBatch(fd, ln.lnaddr)
+			}
+			return el.loopReadUDP(fd, ln.lnaddr)
 		}
 		nfd, sa, err := unix.Accept(fd)
 		if err != nil {
@@ -66,111 +86,417 @@ func (el *eventloop) loopAccept(fd int) error {
 			}
 			return err
 		}
+		if !el.svr.acquireConnSlot() {
+			el.svr.rejectConn(nfd, sa)
+			return nil
+		}
 		if err = unix.SetNonblock(nfd, true); err != nil {
+			sniffErrorAndLog(el.svr.logger, unix.Close(nfd))
+			el.svr.releaseConnSlot()
 			return err
 		}
-		c := newTCPConn(nfd, el, sa)
+		if !el.svr.setUpConnSocket(nfd) {
+			return nil
+		}
+		c := newTCPConn(nfd, el, sa, ln.lnaddr)
 		if err = el.poller.AddRead(c.fd); err == nil {
 			el.connections[c.fd] = c
 			el.plusConnCount()
 			return el.loopOpen(c)
 		}
+		sniffErrorAndLog(el.svr.logger, unix.Close(nfd))
+		el.svr.releaseConnSlot()
 		return err
 	}
 	return nil
 }
 
 func (el *eventloop) loopOpen(c *conn) error {
+	if c.proxyPending {
+		// Opened once the PROXY protocol header is read, see loopReadProxyHeader.
+		c.lastActive = time.Now()
+		return nil
+	}
+	if c.tlsConn == nil {
+		if err := setUpConn(el.svr.openHandler, c); err != nil {
+			return el.loopCloseConn(c, err)
+		}
+		if el.svr.opts.TLSConfig != nil {
+			return el.loopHandshake(c)
+		}
+	}
 	c.opened = true
-	c.localAddr = el.svr.ln.lnaddr
-	c.remoteAddr = netpoll.SockaddrToTCPOrUnixAddr(c.sa)
+	c.lastActive = time.Now()
+	c.lastFrame = c.lastActive
+	el.svr.conns.Store(c, struct{}{})
+	if c.remoteAddr == nil {
+		c.remoteAddr = netpoll.SockaddrToTCPOrUnixAddr(c.sa)
+	}
 	out, action := el.eventHandler.OnOpened(c)
 	if el.svr.opts.TCPKeepAlive > 0 {
-		if _, ok := el.svr.ln.ln.(*net.TCPListener); ok {
-			_ = netpoll.SetKeepAlive(c.fd, int(el.svr.opts.TCPKeepAlive/time.Second))
+		if _, ok := c.localAddr.(*net.TCPAddr); ok {
+			_ = el.svr.setKeepAlive(c.fd)
 		}
 	}
 	if out != nil {
 		c.open(out)
 	}
 
-	if !c.outboundBuffer.IsEmpty() {
-		_ = el.poller.AddWrite(c.fd)
+	if action == Close {
+		return el.loopReject(c)
+	}
+
+	// The fd has been registered with readable event, so renew it with writable event to flush
+	// the pending data in outbound buffer as soon as the socket becomes writable.
+	if !c.outboundEmpty() {
+		_ = el.modReadWrite(c)
 	}
 
 	return el.handleAction(c, action)
 }
 
+// loopReject closes the connection which OnOpened returns Close for, after the data returned along with it
+// is written. Closing a socket with unread data makes the kernel reset the connection, which may discard
+// the data on its way to the peer, so the write side is shut down once the data is flushed and what the
+// peer sends is discarded until it closes its side, or the connection is swept by Options.IdleTimeout.
+func (el *eventloop) loopReject(c *conn) error {
+	c.flushBuffered()
+	c.rejected = true
+	c.writeClosed = true
+	if c.outboundEmpty() {
+		return el.loopShutdownWrite(c)
+	}
+	_ = el.modReadWrite(c)
+	return nil
+}
+
 func (el *eventloop) loopRead(c *conn) error {
-	n, err := unix.Read(c.fd, el.packet)
+	n, err := unix.Read(c.fd, el.packet[:el.svr.readBufferCap()])
 	if n == 0 || err != nil {
 		if err == unix.EAGAIN {
 			return nil
 		}
 		return el.loopCloseConn(c, err)
 	}
+	if c.rejected {
+		return nil
+	}
+	c.addBytesRead(n)
+	c.lastActive = time.Now()
+	if c.limiter != nil {
+		if d := c.limiter.take(n, c.lastActive); d > 0 {
+			el.pauseRead(c, d)
+		}
+	}
+	if c.proxyPending {
+		return el.loopReadProxyHeader(c, el.packet[:n])
+	}
+	if c.tlsTransport != nil {
+		c.tlsTransport.feed(el.packet[:n])
+		return el.loopReadTLS(c)
+	}
 	c.buffer = el.packet[:n]
+	return el.loopReact(c)
+}
 
-	for inFrame, _ := c.read(); inFrame != nil; inFrame, _ = c.read() {
-		out, action := el.eventHandler.React(inFrame, c)
-		if out != nil {
-			outFrame, _ := el.codec.Encode(c, out)
-			el.eventHandler.PreWrite()
-			c.write(outFrame)
+// loopReadProxyHeader parses the PROXY protocol header from the beginning of the stream, then opens the connection
+// with the client address carried by the header, and passes the rest of data read to the TLS layer or the codec.
+func (el *eventloop) loopReadProxyHeader(c *conn, data []byte) error {
+	if len(c.proxyHeader) > 0 {
+		data = append(c.proxyHeader, data...)
+	}
+	addr, n, err := parseProxyHeader(data)
+	if err == ErrIncompletePacket {
+		c.proxyHeader = append(c.proxyHeader[:0:0], data...)
+		return nil
+	}
+	if err != nil {
+		return el.loopCloseConn(c, err)
+	}
+	c.proxyPending, c.proxyHeader = false, nil
+	c.remoteAddr, c.remoteAddrStr = addr, ""
+	rest := data[n:]
+	if err = el.loopOpen(c); err != nil || el.connections[c.fd] != c || c.rejected || len(rest) == 0 {
+		return err
+	}
+	if c.tlsTransport != nil {
+		c.tlsTransport.feed(rest)
+		return el.loopReadTLS(c)
+	}
+	c.buffer = rest
+	return el.loopReact(c)
+}
+
+// loopReact decodes the frames from the data read and reacts to them, the rest of data is kept in inbound buffer.
+// The data is only kept in inbound buffer while less than the read threshold is buffered, see Conn.SetReadThreshold.
+func (el *eventloop) loopReact(c *conn) error {
+	if c.belowReadThreshold() {
+		_, _ = c.inboundBuffer.Write(c.buffer)
+		c.buffer = nil
+		return nil
+	}
+	return el.loopDecode(c)
+}
+
+// loopDecode decodes the frames from the data buffered and reacts to them, the rest of data is kept in inbound buffer.
+func (el *eventloop) loopDecode(c *conn) error {
+	for {
+		inFrame, err := c.read()
+		if err != nil && err != ErrIncompletePacket {
+			// The inbound data can't be decoded any more, e.g. a malformed frame.
+			return el.loopCloseConn(c, err)
+		}
+		if inFrame == nil {
+			break
+		}
+		if !c.takeFrameQuota() {
+			return el.loopCloseConn(c, ErrQuotaExceeded)
+		}
+		c.lastFrame = c.lastActive
+		if dispatchFrame(c.codec, c, inFrame) {
+			c.releaseFrame()
+			continue
+		}
+		if el.svr.reactPool != nil {
+			c.reactQueue = queueReact(c.reactQueue, inFrame)
+			c.releaseFrame()
+			continue
 		}
+		var action Action
+		if el.svr.framesReactor != nil {
+			var outs [][]byte
+			outs, action = el.svr.framesReactor.ReactFrames(inFrame, c)
+			for _, out := range outs {
+				if !c.opened {
+					break
+				}
+				el.writeOut(c, out)
+			}
+		} else {
+			var out []byte
+			out, action = el.eventHandler.React(inFrame, c)
+			el.writeOut(c, out)
+		}
+		c.releaseFrame()
 		switch action {
 		case None:
 		case Close:
+			c.flushBuffered()
 			_ = el.loopWrite(c)
 			return el.loopCloseConn(c, nil)
 		case Shutdown:
+			c.flushBuffered()
 			_ = el.loopWrite(c)
 			return ErrServerShutdown
 		}
 		if !c.opened {
 			return nil
 		}
+		if c.hijacked {
+			break
+		}
 	}
 	_, _ = c.inboundBuffer.Write(c.buffer)
 
+	return el.loopSubmitReact(c)
+}
+
+// writeOut encodes the data returned by React and writes it to the connection.
+func (el *eventloop) writeOut(c *conn, out []byte) {
+	if out != nil {
+		outFrame, _ := c.codec.Encode(c, out)
+		el.eventHandler.PreWrite()
+		c.write(outFrame)
+	}
+}
+
+// loopSubmitReact hands the frames queued for React over to the react pool unless React of the connection
+// is still running there, the results are handled on the event-loop in order, see Options.ReactPool.
+func (el *eventloop) loopSubmitReact(c *conn) error {
+	if c.reacting || len(c.reactQueue) == 0 {
+		return nil
+	}
+	frames := c.reactQueue
+	c.reactQueue, c.reacting = nil, true
+	run := func(job func() error) {
+		_ = el.poller.Trigger(job)
+	}
+	result := func(out []byte, action Action) error {
+		if el.connections[c.fd] != c {
+			return nil // closed while reacting
+		}
+		el.writeOut(c, out)
+		return el.handleAction(c, action)
+	}
+	done := func() error {
+		c.reacting = false
+		if el.connections[c.fd] != c {
+			return nil
+		}
+		return el.loopSubmitReact(c)
+	}
+	if err := el.svr.reactOnPool(c, frames, run, result, done); err != nil {
+		c.reacting = false
+		return el.loopCloseConn(c, err)
+	}
 	return nil
 }
 
 func (el *eventloop) loopWrite(c *conn) error {
+	if c.detached {
+		return nil
+	}
 	el.eventHandler.PreWrite()
+	c.lastActive = time.Now()
+
+	if pf := c.pendingFile; pf != nil {
+		n, err := pf.send(c)
+		if err != nil {
+			return el.loopCloseConn(c, err)
+		}
+		if pf.count == 0 {
+			c.closePendingFile()
+		}
+		c.addBytesWritten(n)
+		if c.pendingFile != nil {
+			return nil
+		}
+	}
 
 	head, tail := c.outboundBuffer.LazyReadAll()
-	n, err := unix.Write(c.fd, head)
+	n, err := ignoringEINTRIO(unix.Write, c.fd, head)
 	if err != nil {
 		if err == unix.EAGAIN {
 			return nil
 		}
-		return el.loopCloseConn(c, err)
+		return el.loopCloseConn(c, sockError(c.fd, err))
 	}
 	c.outboundBuffer.Shift(n)
+	c.syncOutboundLength()
+	c.addBytesWritten(n)
 
 	if len(head) == n && tail != nil {
-		n, err = unix.Write(c.fd, tail)
+		n, err = ignoringEINTRIO(unix.Write, c.fd, tail)
 		if err != nil {
 			if err == unix.EAGAIN {
 				return nil
 			}
-			return el.loopCloseConn(c, err)
+			return el.loopCloseConn(c, sockError(c.fd, err))
 		}
 		c.outboundBuffer.Shift(n)
+		c.syncOutboundLength()
+		c.addBytesWritten(n)
 	}
 
-	if c.outboundBuffer.IsEmpty() {
-		_ = el.poller.ModRead(c.fd)
+	if err = el.loopNotifyWritable(c); err != nil || el.connections[c.fd] != c {
+		return err
+	}
+	if c.outboundEmpty() {
+		_ = el.modRead(c)
+		if c.writeClosed {
+			return el.loopShutdownWrite(c)
+		}
+	}
+	return nil
+}
+
+// loopNotifyWritable fires OnWritable once the pending outbound bytes of the connection that has been full drop
+// to the low-water mark, see WritableHandler.
+func (el *eventloop) loopNotifyWritable(c *conn) error {
+	if el.svr.writableHandler == nil || !c.opened || atomic.LoadInt32(&c.writeFull) == 0 ||
+		c.OutboundBuffered() > el.svr.writeBufferLowWater() {
+		return nil
+	}
+	atomic.StoreInt32(&c.writeFull, 0)
+	out, action := el.svr.writableHandler.OnWritable(c)
+	el.writeOut(c, out)
+	return el.handleAction(c, action)
+}
+
+// modRead renews the fd of the connection with readable event, which is left out while reading is paused.
+func (el *eventloop) modRead(c *conn) error {
+	if c.readPaused {
+		return el.poller.ModNone(c.fd)
+	}
+	return el.poller.ModRead(c.fd)
+}
+
+// modReadWrite renews the fd of the connection with readable and writable events, the readable event is left out
+// while reading is paused.
+func (el *eventloop) modReadWrite(c *conn) error {
+	if c.readPaused {
+		return el.poller.ModWrite(c.fd)
+	}
+	return el.poller.ModReadWrite(c.fd)
+}
+
+// pauseRead stops polling the connection for readable events for d, which is over its rate limit,
+// see Options.ConnRateLimit.
+func (el *eventloop) pauseRead(c *conn, d time.Duration) {
+	c.readPaused = true
+	if !c.hijacked {
+		if c.outboundEmpty() {
+			_ = el.modRead(c)
+		} else {
+			_ = el.modReadWrite(c)
+		}
+	}
+	time.AfterFunc(d, func() {
+		_ = el.poller.Trigger(func() error {
+			return el.loopResumeRead(c)
+		})
+	})
+}
+
+// loopResumeRead polls the connection paused by pauseRead for readable events again once its limiter
+// gets out of debt.
+func (el *eventloop) loopResumeRead(c *conn) error {
+	if el.connections[c.fd] != c || !c.readPaused {
+		return nil
+	}
+	if d := c.limiter.wait(time.Now()); d > 0 {
+		el.pauseRead(c, d)
+		return nil
+	}
+	c.readPaused = false
+	if c.hijacked {
+		return nil
+	}
+	if c.outboundEmpty() {
+		return el.modRead(c)
+	}
+	return el.modReadWrite(c)
+}
+
+// loopShutdownWrite shuts down the write side of the connection, which keeps being read until the peer closes it.
+func (el *eventloop) loopShutdownWrite(c *conn) error {
+	if err := unix.Shutdown(c.fd, unix.SHUT_WR); err != nil {
+		return el.loopCloseConn(c, sockError(c.fd, err))
 	}
 	return nil
 }
 
 func (el *eventloop) loopCloseConn(c *conn, err error) error {
-	err0, err1 := el.poller.Delete(c.fd), unix.Close(c.fd)
+	if c.detached {
+		return nil
+	}
+	if c.connected {
+		return el.loopCloseUDPConn(c, err)
+	}
+	if c.tlsTransport != nil {
+		_ = c.tlsTransport.Close()
+	}
+	var err0 error
+	if !c.hijacked {
+		err0 = el.poller.Delete(c.fd)
+	}
+	err1 := unix.Close(c.fd)
 	if err0 == nil && err1 == nil {
 		delete(el.connections, c.fd)
+		el.svr.conns.Delete(c)
 		el.minusConnCount()
+		el.svr.releaseConnSlot()
+		releaseCodecState(c.codec, c)
 		switch el.eventHandler.OnClosed(c, err) {
 		case Shutdown:
 			return ErrServerShutdown
@@ -178,22 +504,157 @@ func (el *eventloop) loopCloseConn(c *conn, err error) error {
 		c.releaseTCP()
 	} else {
 		if err0 != nil {
-			el.svr.logger.Printf("failed to delete fd:%d from poller, error:%v\n", c.fd, err0)
+			c.errorf("failed to delete fd:%d from poller, error:%v\n", c.fd, err0)
 		}
 		if err1 != nil {
-			el.svr.logger.Printf("failed to close fd:%d, error:%v\n", c.fd, err1)
+			c.errorf("failed to close fd:%d, error:%v\n", c.fd, err1)
+		}
+	}
+	return nil
+}
+
+// loopCloseIdleConns closes the connections that have been idle for longer than IdleTimeout.
+func (el *eventloop) loopCloseIdleConns() error {
+	now := time.Now()
+	if el.svr.opts.IdleTimeout > 0 {
+		for _, c := range el.connections {
+			if !c.hijacked && now.Sub(c.lastActive) > el.svr.opts.IdleTimeout {
+				if err := el.loopCloseConn(c, ErrIdleTimeout); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, c := range el.udpConns {
+		if now.Sub(c.lastActive) > el.svr.idleTimeout() {
+			if err := el.loopCloseUDPConn(c, ErrIdleTimeout); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loopDetach removes the connection detached to nc from the event-loop without firing OnClosed, the data buffered
+// by gnet is handed over to the returned net.Conn.
+func (el *eventloop) loopDetach(c *conn, nc net.Conn) net.Conn {
+	dc := newDetachedConn(nc, c.Read()[c.heldBytes:])
+	head, tail := c.outboundBuffer.LazyReadAll()
+	outbound := append(append([]byte(nil), head...), tail...)
+	c.ResetBuffer()
+	c.heldFrame, c.heldBytes = nil, 0
+	c.opened, c.detached, c.hijacked = false, true, true
+	_ = unix.Close(c.fd)
+	delete(el.connections, c.fd)
+	el.svr.conns.Delete(c)
+	el.minusConnCount()
+	el.svr.releaseConnSlot()
+	releaseCodecState(c.codec, c)
+	// The buffers are still used by the callback detaching the connection, release them afterwards.
+	_ = el.poller.Trigger(func() error {
+		c.releaseTCP()
+		return nil
+	})
+	go dc.flush(outbound)
+	return dc
+}
+
+// loopResume gives the control of a hijacked connection back to the event-loop.
+func (el *eventloop) loopResume(c *conn) error {
+	if !c.opened || !c.hijacked {
+		return nil
+	}
+	c.hijacked = false
+	c.lastActive = time.Now()
+	var err error
+	if c.outboundEmpty() {
+		err = el.poller.AddRead(c.fd)
+	} else {
+		err = el.poller.AddReadWrite(c.fd)
+	}
+	if err != nil {
+		return el.loopCloseConn(c, err)
+	}
+	if c.readPaused {
+		// The fd is registered anew with readable event, which is left out until reading resumes.
+		if c.outboundEmpty() {
+			_ = el.modRead(c)
+		} else {
+			_ = el.modReadWrite(c)
+		}
+	}
+	return nil
+}
+
+// loopReadTimeouts fires OnReadTimeout for the connections without frames for ReadTimeout.
+func (el *eventloop) loopReadTimeouts() error {
+	now := time.Now()
+	for _, c := range el.connections {
+		if !c.opened || c.hijacked || now.Sub(c.lastFrame) < el.svr.opts.ReadTimeout {
+			continue
+		}
+		if c.belowReadThreshold() && c.inboundBuffer.Length() > 0 {
+			// Flush the data held back by the read threshold, OnReadTimeout only fires if no frame is decoded.
+			c.buffer, c.lastFrame = nil, time.Time{}
+			if err := el.loopDecode(c); err != nil {
+				return err
+			}
+			if el.connections[c.fd] != c || !c.lastFrame.IsZero() {
+				continue
+			}
+		}
+		c.lastFrame = now
+		if el.svr.reactPool != nil {
+			c.reactQueue = queueReadTimeout(c.reactQueue)
+			if err := el.loopSubmitReact(c); err != nil {
+				return err
+			}
+			continue
+		}
+		out, action := el.svr.timeoutHandler.OnReadTimeout(c)
+		if out != nil {
+			frame, _ := c.codec.Encode(c, out)
+			c.write(frame)
+		}
+		if err := el.handleAction(c, action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loopBroadcast writes the data to all the connections of event-loop.
+func (el *eventloop) loopBroadcast(buf []byte) error {
+	be := newBroadcastEncoder(buf)
+	write := func(c *conn) {
+		if !c.opened {
+			return
+		}
+		if frame, err := be.encode(c.codec, c); err == nil {
+			c.write(frame)
 		}
 	}
+	for _, c := range el.connections {
+		write(c)
+	}
+	for _, c := range el.udpConns {
+		write(c)
+	}
 	return nil
 }
 
-func (el *eventloop) loopWake(c *conn) error {
+func (el *eventloop) loopWake(c *conn, data []byte) error {
 	//if co, ok := el.connections[c.fd]; !ok || co != c {
 	//	return nil // ignore stale wakes.
 	//}
-	out, action := el.eventHandler.React(nil, c)
+	if el.svr.reactPool != nil && !c.connected {
+		// Queued behind the frames decoded before, so that React never runs concurrently for the connection.
+		c.reactQueue = queueWake(c.reactQueue, data)
+		return el.loopSubmitReact(c)
+	}
+	out, action := el.eventHandler.React(data, c)
 	if out != nil {
-		frame, _ := el.codec.Encode(c, out)
+		frame, _ := c.codec.Encode(c, out)
 		c.write(frame)
 	}
 	return el.handleAction(c, action)
@@ -205,9 +666,12 @@ func (el *eventloop) loopTicker() {
 		open  bool
 		err   error
 	)
+	last := time.Now()
 	for {
 		err = el.poller.Trigger(func() (err error) {
-			delay, action := el.eventHandler.Tick()
+			now := time.Now()
+			delay, action := el.svr.tick(now.Sub(last))
+			last = now
 			el.svr.ticktock <- delay
 			switch action {
 			case None:
@@ -217,7 +681,7 @@ func (el *eventloop) loopTicker() {
 			return
 		})
 		if err != nil {
-			el.svr.logger.Printf("failed to awake poller with error:%v, stopping ticker\n", err)
+			el.svr.logger.Errorf("failed to awake poller with error:%v, stopping ticker\n", err)
 			break
 		}
 		if delay, open = <-el.svr.ticktock; open {
@@ -228,35 +692,83 @@ func (el *eventloop) loopTicker() {
 	}
 }
 
+// loopPerLoopTicker fires OnLoopTick on the event-loop with the time elapsed since the last tick, until the event-loop
+// or the server stops.
+func (el *eventloop) loopPerLoopTicker() {
+	ticktock := make(chan time.Duration, 1)
+	last := time.Now()
+	for {
+		err := el.poller.Trigger(func() (err error) {
+			now := time.Now()
+			delay, action := el.svr.loopTicker.OnLoopTick(el.idx, now.Sub(last))
+			last = now
+			ticktock <- delay
+			if action == Shutdown {
+				err = ErrServerShutdown
+			}
+			return
+		})
+		if err != nil {
+			return
+		}
+		select {
+		case delay := <-ticktock:
+			select {
+			case <-time.After(delay):
+			case <-el.svr.sweeperDone:
+				return
+			}
+		case <-el.svr.sweeperDone:
+			return
+		}
+	}
+}
+
 func (el *eventloop) handleAction(c *conn, action Action) error {
 	switch action {
 	case None:
 		return nil
 	case Close:
-		_ = el.loopWrite(c)
+		c.flushBuffered()
+		if !c.connected {
+			_ = el.loopWrite(c)
+		}
 		return el.loopCloseConn(c, nil)
 	case Shutdown:
-		_ = el.loopWrite(c)
+		c.flushBuffered()
+		if !c.connected {
+			_ = el.loopWrite(c)
+		}
 		return ErrServerShutdown
 	default:
 		return nil
 	}
 }
 
-func (el *eventloop) loopReadUDP(fd int) error {
+func (el *eventloop) loopReadUDP(fd int, localAddr net.Addr) error {
 	n, sa, err := unix.Recvfrom(fd, el.packet, 0)
 	if err != nil || n == 0 {
 		if err != nil && err != unix.EAGAIN {
-			el.svr.logger.Printf("failed to read UDP packet from fd:%d, error:%v\n", fd, err)
+			el.svr.logger.Errorf("failed to read UDP packet from fd:%d, error:%v\n", fd, err)
 		}
 		return nil
 	}
-	c := newUDPConn(fd, el, sa)
+	if el.svr.opts.UDPConnected {
+		return el.loopReadConnectedUDP(fd, sa, localAddr, el.packet[:n])
+	}
+	c := newUDPConn(fd, el, sa, localAddr)
+	c.addBytesRead(n)
+	if el.svr.opts.UDPBatching {
+		c.cork()
+	}
 	out, action := el.eventHandler.React(el.packet[:n], c)
 	if out != nil {
 		el.eventHandler.PreWrite()
 		_ = c.sendTo(out)
 	}
+	if el.svr.opts.UDPBatching {
+		c.uncork()
+	}
 	switch action {
 	case Shutdown:
 		return ErrServerShutdown
@@ -264,3 +776,87 @@ func (el *eventloop) loopReadUDP(fd int) error {
 	c.releaseUDP()
 	return nil
 }
+
+// loopReadConnectedUDP passes the datagram to the connection of its remote peer, which is opened on the first datagram.
+func (el *eventloop) loopReadConnectedUDP(fd int, sa unix.Sockaddr, localAddr net.Addr, packet []byte) error {
+	remoteAddr := netpoll.SockaddrToUDPAddr(sa)
+	key := udpConnKey{fd, remoteAddr.String()}
+	if v, ok := el.svr.udpConns.Load(key); ok {
+		c := v.(*conn)
+		if c.loop == el {
+			return el.loopReactUDP(c, packet)
+		}
+		// The datagram is read by another event-loop polling the same listener, hand it over to the owner.
+		packet = append([]byte{}, packet...)
+		sniffErrorAndLog(el.svr.logger, c.loop.poller.Trigger(func() error {
+			return c.loop.loopReactUDP(c, packet)
+		}))
+		return nil
+	}
+	c := newUDPConn(fd, el, sa, localAddr)
+	c.connected = true
+	c.opened = true
+	c.codec = el.codec
+	c.lastActive = time.Now()
+	c.lastFrame = c.lastActive
+	c.remoteAddrStr = key.addr
+	el.udpConns[key] = c
+	el.svr.udpConns.Store(key, c)
+	el.svr.conns.Store(c, struct{}{})
+	el.plusConnCount()
+	if err := setUpConn(el.svr.openHandler, c); err != nil {
+		return el.loopCloseUDPConn(c, err)
+	}
+	out, action := el.eventHandler.OnOpened(c)
+	if out != nil {
+		el.eventHandler.PreWrite()
+		c.write(out)
+	}
+	if err := el.handleAction(c, action); err != nil || !c.opened {
+		return err
+	}
+	return el.loopReactUDP(c, packet)
+}
+
+// loopReactUDP invokes React with the datagram read from the remote peer of the connected UDP connection.
+func (el *eventloop) loopReactUDP(c *conn, packet []byte) error {
+	if !c.opened {
+		return nil
+	}
+	c.addBytesRead(len(packet))
+	c.lastActive = time.Now()
+	c.lastFrame = c.lastActive
+	if el.svr.opts.UDPBatching {
+		c.cork()
+	}
+	out, action := el.eventHandler.React(packet, c)
+	if out != nil {
+		frame, _ := c.codec.Encode(c, out)
+		el.eventHandler.PreWrite()
+		c.write(frame)
+	}
+	if el.svr.opts.UDPBatching {
+		c.uncork()
+	}
+	return el.handleAction(c, action)
+}
+
+func (el *eventloop) loopCloseUDPConn(c *conn, err error) error {
+	if !c.opened {
+		return nil
+	}
+	c.opened = false
+	key := udpConnKey{c.fd, c.RemoteAddrString()}
+	delete(el.udpConns, key)
+	el.svr.udpConns.Delete(key)
+	el.svr.conns.Delete(c)
+	el.minusConnCount()
+	releaseCodecState(c.codec, c)
+	switch el.eventHandler.OnClosed(c, err) {
+	case Shutdown:
+		return ErrServerShutdown
+	}
+	bytebuffer.Put(c.takeBuffered())
+	c.releaseUDP()
+	return nil
+}
@@ -24,6 +24,7 @@ type eventloop struct {
 	connCount    int32                 // number of active connections in event-loop
 	connections  map[*stdConn]struct{} // track all the sockets bound to this loop
 	eventHandler EventHandler          // user eventHandler
+	jobs         loopQueue             // jobs queued by the users of connections
 }
 
 func (el *eventloop) plusConnCount() {
@@ -38,6 +39,15 @@ func (el *eventloop) loadConnCount() int32 {
 	return atomic.LoadInt32(&el.connCount)
 }
 
+// pushJob queues the job from the users of connections, see Options.LoopQueueCap.
+func (el *eventloop) pushJob(run func() error, drop func()) error {
+	opts := el.svr.opts
+	return el.jobs.push(opts.LoopQueueCap, opts.LoopOverflowPolicy, loopJob{run, drop}, func(drain func() error) error {
+		el.ch <- drain
+		return nil
+	})
+}
+
 func (el *eventloop) loopRun() {
 	var err error
 	defer func() {
@@ -49,9 +59,13 @@ func (el *eventloop) loopRun() {
 		el.loopEgress()
 		el.svr.loopWG.Done()
 	}()
+	el.pinCPU()
 	if el.idx == 0 && el.svr.opts.Ticker {
 		go el.loopTicker()
 	}
+	if el.svr.opts.PerLoopTicker && el.svr.loopTicker != nil {
+		go el.loopPerLoopTicker()
+	}
 	for v := range el.ch {
 		switch v := v.(type) {
 		case error:
@@ -62,15 +76,15 @@ func (el *eventloop) loopRun() {
 			err = el.loopRead(v)
 		case *udpIn:
 			err = el.loopReadUDP(v.c)
+		case *connectedUDPIn:
+			err = el.loopReadConnectedUDP(v.c, v.in)
 		case *stderr:
 			err = el.loopError(v.c, v.err)
-		case wakeReq:
-			err = el.loopWake(v.c)
 		case func() error:
 			err = v()
 		}
 		if err != nil {
-			el.svr.logger.Printf("event-loop:%d exits with error:%v\n", el.idx, err)
+			el.svr.logger.Infof("event-loop:%d exits with error:%v\n", el.idx, err)
 			break
 		}
 	}
@@ -78,14 +92,21 @@ func (el *eventloop) loopRun() {
 
 func (el *eventloop) loopAccept(c *stdConn) error {
 	el.connections[c] = struct{}{}
-	c.localAddr = el.svr.ln.lnaddr
-	c.remoteAddr = c.conn.RemoteAddr()
+	el.svr.conns.Store(c, struct{}{})
+	c.lastActive = time.Now()
+	c.lastFrame = c.lastActive
+	if c.remoteAddr == nil {
+		c.remoteAddr = c.conn.RemoteAddr()
+	}
 	el.plusConnCount()
 
+	if err := setUpConn(el.svr.openHandler, c); err != nil {
+		return el.loopError(c, err)
+	}
 	out, action := el.eventHandler.OnOpened(c)
 	if out != nil {
 		el.eventHandler.PreWrite()
-		_, _ = c.conn.Write(out)
+		_, _ = c.write(out)
 	}
 	if el.svr.opts.TCPKeepAlive > 0 {
 		if c, ok := c.conn.(*net.TCPConn); ok {
@@ -93,25 +114,100 @@ func (el *eventloop) loopAccept(c *stdConn) error {
 			_ = c.SetKeepAlivePeriod(el.svr.opts.TCPKeepAlive)
 		}
 	}
+	if action == Close {
+		return el.loopReject(c)
+	}
 	return el.handleAction(c, action)
 }
 
+// loopReject closes the connection which OnOpened returns Close for. Closing a socket with unread data
+// makes the kernel reset the connection, which may discard the data returned by OnOpened on its way to
+// the peer, so the write side is shut down instead and what the peer sends is discarded until it closes
+// its side, or the connection is swept by Options.IdleTimeout.
+func (el *eventloop) loopReject(c *stdConn) error {
+	wc, ok := c.conn.(interface{ CloseWrite() error })
+	if !ok {
+		return el.handleAction(c, Close)
+	}
+	_ = c.flushBuffered()
+	c.rejected = true
+	c.writeClosed = true
+	if err := wc.CloseWrite(); err != nil {
+		return el.loopError(c, err)
+	}
+	return nil
+}
+
 func (el *eventloop) loopRead(ti *tcpIn) (err error) {
 	c := ti.c
+	if c.detached != nil {
+		c.detached.inbound = append(c.detached.inbound, ti.in.Bytes()...)
+		bytebuffer.Put(ti.in)
+		return nil
+	}
+	if c.rejected {
+		bytebuffer.Put(ti.in)
+		return nil
+	}
 	c.buffer = ti.in
+	c.addBytesRead(c.buffer.Len())
+	c.lastActive = time.Now()
+	if c.belowReadThreshold() {
+		// Keep the data in inbound buffer until the read threshold is reached, see Conn.SetReadThreshold.
+		_, _ = c.inboundBuffer.Write(c.buffer.Bytes())
+		bytebuffer.Put(c.buffer)
+		c.buffer = nil
+		return nil
+	}
+	return el.loopDecode(c)
+}
 
-	for inFrame, _ := c.read(); inFrame != nil; inFrame, _ = c.read() {
-		out, action := el.eventHandler.React(inFrame, c)
-		if out != nil {
-			outFrame, _ := el.codec.Encode(c, out)
-			el.eventHandler.PreWrite()
-			_, err = c.conn.Write(outFrame)
+// loopDecode decodes the frames from the data buffered and reacts to them, the rest of data is kept in inbound buffer.
+func (el *eventloop) loopDecode(c *stdConn) (err error) {
+	for {
+		inFrame, e := c.read()
+		if e != nil && e != ErrIncompletePacket {
+			// The inbound data can't be decoded any more, e.g. a malformed frame.
+			return el.loopError(c, e)
+		}
+		if inFrame == nil {
+			break
+		}
+		if !c.takeFrameQuota() {
+			return el.loopError(c, ErrQuotaExceeded)
+		}
+		c.lastFrame = c.lastActive
+		if dispatchFrame(c.codec, c, inFrame) {
+			c.releaseFrame()
+			continue
 		}
+		if el.svr.reactPool != nil {
+			c.reactQueue = queueReact(c.reactQueue, inFrame)
+			c.releaseFrame()
+			continue
+		}
+		var action Action
+		if el.svr.framesReactor != nil {
+			var outs [][]byte
+			outs, action = el.svr.framesReactor.ReactFrames(inFrame, c)
+			for _, out := range outs {
+				if err = el.writeOut(c, out); err != nil {
+					break
+				}
+			}
+		} else {
+			var out []byte
+			out, action = el.eventHandler.React(inFrame, c)
+			err = el.writeOut(c, out)
+		}
+		c.releaseFrame()
 		switch action {
 		case None:
 		case Close:
+			_ = c.flushBuffered()
 			return el.loopCloseConn(c)
 		case Shutdown:
+			_ = c.flushBuffered()
 			return ErrServerShutdown
 		}
 		if err != nil {
@@ -121,10 +217,64 @@ func (el *eventloop) loopRead(ti *tcpIn) (err error) {
 	_, _ = c.inboundBuffer.Write(c.buffer.Bytes())
 	bytebuffer.Put(c.buffer)
 	c.buffer = nil
+	return el.loopSubmitReact(c)
+}
+
+// writeOut encodes the data returned by React and writes it to the connection.
+func (el *eventloop) writeOut(c *stdConn, out []byte) (err error) {
+	if out != nil {
+		outFrame, _ := c.codec.Encode(c, out)
+		el.eventHandler.PreWrite()
+		_, err = c.write(outFrame)
+	}
+	return
+}
+
+// loopSubmitReact hands the frames queued for React over to the react pool unless React of the connection
+// is still running there, the results are handled on the event-loop in order, see Options.ReactPool.
+func (el *eventloop) loopSubmitReact(c *stdConn) error {
+	if c.reacting || len(c.reactQueue) == 0 {
+		return nil
+	}
+	frames := c.reactQueue
+	c.reactQueue, c.reacting = nil, true
+	run := func(job func() error) {
+		el.ch <- job
+	}
+	closed := func() bool {
+		_, ok := el.connections[c]
+		return !ok || atomic.LoadInt32(&c.done) != 0
+	}
+	result := func(out []byte, action Action) error {
+		if closed() {
+			return nil // closed while reacting
+		}
+		if err := el.writeOut(c, out); err != nil {
+			return el.loopError(c, err)
+		}
+		return el.handleAction(c, action)
+	}
+	done := func() error {
+		c.reacting = false
+		if closed() {
+			return nil
+		}
+		return el.loopSubmitReact(c)
+	}
+	if err := el.svr.reactOnPool(c, frames, run, result, done); err != nil {
+		c.reacting = false
+		return el.loopError(c, err)
+	}
 	return nil
 }
 
 func (el *eventloop) loopCloseConn(c *stdConn) error {
+	if c.connected {
+		return el.loopCloseUDPConn(c, nil)
+	}
+	if c.detached != nil {
+		return nil
+	}
 	atomic.StoreInt32(&c.done, 1)
 	return c.conn.SetReadDeadline(time.Now())
 }
@@ -154,9 +304,12 @@ func (el *eventloop) loopTicker() {
 		delay time.Duration
 		open  bool
 	)
+	last := time.Now()
 	for {
 		el.ch <- func() (err error) {
-			delay, action := el.eventHandler.Tick()
+			now := time.Now()
+			delay, action := el.svr.tick(now.Sub(last))
+			last = now
 			el.svr.ticktock <- delay
 			switch action {
 			case Shutdown:
@@ -172,17 +325,58 @@ func (el *eventloop) loopTicker() {
 	}
 }
 
+// loopPerLoopTicker fires OnLoopTick on the event-loop with the time elapsed since the last tick, until the server stops.
+func (el *eventloop) loopPerLoopTicker() {
+	ticktock := make(chan time.Duration, 1)
+	last := time.Now()
+	tick := func() (err error) {
+		now := time.Now()
+		delay, action := el.svr.loopTicker.OnLoopTick(el.idx, now.Sub(last))
+		last = now
+		ticktock <- delay
+		if action == Shutdown {
+			err = errClosing
+		}
+		return
+	}
+	for {
+		select {
+		case el.ch <- tick:
+		case <-el.svr.sweeperDone:
+			return
+		}
+		select {
+		case delay := <-ticktock:
+			select {
+			case <-time.After(delay):
+			case <-el.svr.sweeperDone:
+				return
+			}
+		case <-el.svr.sweeperDone:
+			return
+		}
+	}
+}
+
 func (el *eventloop) loopError(c *stdConn, err error) (e error) {
+	if c.connected {
+		return el.loopCloseUDPConn(c, err)
+	}
 	if e = c.conn.Close(); e == nil {
 		delete(el.connections, c)
+		el.svr.conns.Delete(c)
 		el.minusConnCount()
+		el.svr.releaseConnSlot()
+		releaseCodecState(c.codec, c)
 		switch atomic.LoadInt32(&c.done) {
 		case 0: // read error
 			if err != io.EOF {
-				el.svr.logger.Printf("socket: %s with err: %v\n", c.remoteAddr.String(), err)
+				c.debugf("socket with err: %v\n", err)
 			}
 		case 1: // closed
-			el.svr.logger.Printf("socket: %s has been closed by client\n", c.remoteAddr.String())
+			c.debugf("socket has been closed by client\n")
+		case 2: // closed for idle timeout
+			err = ErrIdleTimeout
 		}
 		switch el.eventHandler.OnClosed(c, err) {
 		case Shutdown:
@@ -190,19 +384,156 @@ func (el *eventloop) loopError(c *stdConn, err error) (e error) {
 		}
 		c.releaseTCP()
 	} else {
-		el.svr.logger.Printf("failed to close connection:%s, error:%v\n", c.remoteAddr.String(), e)
+		c.errorf("failed to close connection, error:%v\n", e)
 	}
 	return
 }
 
-func (el *eventloop) loopWake(c *stdConn) error {
+// loopDetach removes the connection detached by Detach from the event-loop without firing OnClosed,
+// the data buffered by gnet and the data read until the reader of the connection stops are handed over
+// to the returned net.Conn.
+func (el *eventloop) loopDetach(c *stdConn) net.Conn {
+	c.detached = newDetachedConn(c.conn, c.Read()[c.heldBytes:])
+	c.ResetBuffer()
+	c.heldFrame, c.heldBytes = nil, 0
+	delete(el.connections, c)
+	el.svr.conns.Delete(c)
+	el.minusConnCount()
+	el.svr.releaseConnSlot()
+	releaseCodecState(c.codec, c)
+	// Stop the reader of the connection, see loopDetached.
+	_ = c.conn.SetReadDeadline(time.Now())
+	return c.detached
+}
+
+// loopDetached hands the detached connection over to the caller once its reader has stopped.
+func (el *eventloop) loopDetached(c *stdConn) error {
+	close(c.detached.ready)
+	c.releaseTCP()
+	return nil
+}
+
+// loopHandshakeError closes the connection failed in TLS handshake or reading the PROXY protocol header,
+// which hasn't been opened.
+func (el *eventloop) loopHandshakeError(c *stdConn, err error) error {
+	_ = c.conn.Close()
+	el.svr.releaseConnSlot()
+	c.remoteAddr = c.conn.RemoteAddr()
+	c.debugf("handshake failed with error:%v\n", err)
+	switch el.eventHandler.OnClosed(c, err) {
+	case Shutdown:
+		return errClosing
+	}
+	c.releaseTCP()
+	return nil
+}
+
+// loopCloseIdleConns closes the connections that have been idle for longer than IdleTimeout.
+func (el *eventloop) loopCloseIdleConns() error {
+	now := time.Now()
+	for c := range el.connections {
+		if c.connected {
+			if now.Sub(c.lastActive) > el.svr.idleTimeout() {
+				if err := el.loopCloseUDPConn(c, ErrIdleTimeout); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if el.svr.opts.IdleTimeout > 0 && now.Sub(c.lastActive) > el.svr.opts.IdleTimeout &&
+			atomic.CompareAndSwapInt32(&c.done, 0, 2) {
+			_ = c.conn.SetReadDeadline(now)
+		}
+	}
+	return nil
+}
+
+// loopReadTimeouts fires OnReadTimeout for the connections without frames for ReadTimeout.
+func (el *eventloop) loopReadTimeouts() error {
+	now := time.Now()
+	for c := range el.connections {
+		if c.connected || atomic.LoadInt32(&c.done) != 0 || now.Sub(c.lastFrame) < el.svr.opts.ReadTimeout {
+			continue
+		}
+		if c.belowReadThreshold() && c.inboundBuffer.Length() > 0 {
+			// Flush the data held back by the read threshold, OnReadTimeout only fires if no frame is decoded.
+			c.buffer, c.lastFrame = bytebuffer.Get(), time.Time{}
+			if err := el.loopDecode(c); err != nil {
+				return err
+			}
+			if _, ok := el.connections[c]; !ok || !c.lastFrame.IsZero() {
+				continue
+			}
+		}
+		c.lastFrame = now
+		if el.svr.reactPool != nil {
+			c.reactQueue = queueReadTimeout(c.reactQueue)
+			if err := el.loopSubmitReact(c); err != nil {
+				return err
+			}
+			continue
+		}
+		out, action := el.svr.timeoutHandler.OnReadTimeout(c)
+		if out != nil {
+			frame, _ := c.codec.Encode(c, out)
+			_, _ = c.write(frame)
+		}
+		if err := el.handleAction(c, action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loopBroadcast writes the data to all the connections of event-loop.
+func (el *eventloop) loopBroadcast(buf []byte) error {
+	be := newBroadcastEncoder(buf)
+	for c := range el.connections {
+		frame, err := be.encode(c.codec, c)
+		if err != nil {
+			continue
+		}
+		c.lastActive = time.Now()
+		if _, err = c.write(frame); err != nil {
+			if err = el.loopError(c, err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (el *eventloop) loopWake(c *stdConn, data []byte) error {
 	//if co, ok := el.connections[c]; !ok || co != c {
 	//	return nil // ignore stale wakes.
 	//}
-	out, action := el.eventHandler.React(nil, c)
+	if el.svr.reactPool != nil && !c.connected {
+		// Queued behind the frames decoded before, so that React never runs concurrently for the connection.
+		c.reactQueue = queueWake(c.reactQueue, data)
+		return el.loopSubmitReact(c)
+	}
+	out, action := el.eventHandler.React(data, c)
 	if out != nil {
-		frame, _ := el.codec.Encode(c, out)
-		_, _ = c.conn.Write(frame)
+		frame, _ := c.codec.Encode(c, out)
+		_, _ = c.write(frame)
+	}
+	return el.handleAction(c, action)
+}
+
+// loopNotifyWritable fires OnWritable once the pending outbound bytes of the connection that has been full drop
+// to the low-water mark, see WritableHandler.
+func (el *eventloop) loopNotifyWritable(c *stdConn) error {
+	if el.svr.writableHandler == nil || atomic.LoadInt32(&c.writeFull) == 0 ||
+		c.OutboundBuffered() > el.svr.writeBufferLowWater() {
+		return nil
+	}
+	if _, ok := el.connections[c]; !ok {
+		return nil
+	}
+	atomic.StoreInt32(&c.writeFull, 0)
+	out, action := el.svr.writableHandler.OnWritable(c)
+	if err := el.writeOut(c, out); err != nil {
+		return el.loopError(c, err)
 	}
 	return el.handleAction(c, action)
 }
@@ -212,8 +543,10 @@ func (el *eventloop) handleAction(c *stdConn, action Action) error {
 	case None:
 		return nil
 	case Close:
+		_ = c.flushBuffered()
 		return el.loopCloseConn(c)
 	case Shutdown:
+		_ = c.flushBuffered()
 		return ErrServerShutdown
 	default:
 		return nil
@@ -221,10 +554,11 @@ func (el *eventloop) handleAction(c *stdConn, action Action) error {
 }
 
 func (el *eventloop) loopReadUDP(c *stdConn) error {
+	c.addBytesRead(c.buffer.Len())
 	out, action := el.eventHandler.React(c.buffer.Bytes(), c)
 	if out != nil {
 		el.eventHandler.PreWrite()
-		_, _ = el.svr.ln.pconn.WriteTo(out, c.remoteAddr)
+		_ = c.SendTo(out)
 	}
 	switch action {
 	case Shutdown:
@@ -233,3 +567,57 @@ func (el *eventloop) loopReadUDP(c *stdConn) error {
 	c.releaseUDP()
 	return nil
 }
+
+// loopReadConnectedUDP invokes React with the datagram read from the remote peer of the connected UDP connection,
+// which is opened on the first datagram.
+func (el *eventloop) loopReadConnectedUDP(c *stdConn, in *bytebuffer.ByteBuffer) error {
+	defer bytebuffer.Put(in)
+	if atomic.LoadInt32(&c.done) != 0 {
+		return nil
+	}
+	if _, ok := el.connections[c]; !ok {
+		el.connections[c] = struct{}{}
+		el.svr.conns.Store(c, struct{}{})
+		c.lastActive = time.Now()
+		el.plusConnCount()
+		if err := setUpConn(el.svr.openHandler, c); err != nil {
+			return el.loopCloseUDPConn(c, err)
+		}
+		out, action := el.eventHandler.OnOpened(c)
+		if out != nil {
+			el.eventHandler.PreWrite()
+			_, _ = c.write(out)
+		}
+		if err := el.handleAction(c, action); err != nil || atomic.LoadInt32(&c.done) != 0 {
+			return err
+		}
+	}
+	c.addBytesRead(in.Len())
+	c.lastActive = time.Now()
+	out, action := el.eventHandler.React(in.Bytes(), c)
+	if out != nil {
+		frame, _ := c.codec.Encode(c, out)
+		el.eventHandler.PreWrite()
+		_, _ = c.write(frame)
+	}
+	return el.handleAction(c, action)
+}
+
+func (el *eventloop) loopCloseUDPConn(c *stdConn, err error) error {
+	if _, ok := el.connections[c]; !ok {
+		return nil
+	}
+	atomic.StoreInt32(&c.done, 1)
+	delete(el.connections, c)
+	el.svr.udpConns.Delete(udpConnKey{c.pconn, c.RemoteAddrString()})
+	el.svr.conns.Delete(c)
+	el.minusConnCount()
+	releaseCodecState(c.codec, c)
+	switch el.eventHandler.OnClosed(c, err) {
+	case Shutdown:
+		return errClosing
+	}
+	bytebuffer.Put(c.takeBuffered())
+	c.releaseUDP()
+	return nil
+}
@@ -6,11 +6,14 @@
 package gnet
 
 import (
+	"context"
+	"io"
 	"log"
 	"net"
 	"os"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/panjf2000/gnet/internal/netpoll"
@@ -38,6 +41,47 @@ type Logger interface {
 	Printf(format string, args ...interface{})
 }
 
+// LeveledLogger is used for logging formatted messages by level, e.g. an adapter of zap or logrus,
+// see Options.LeveledLogger. Failures, e.g. an error of closing a socket, are logged by Errorf, the lifecycle
+// of server and event-loops by Infof and the events of connections by Debugf, like the peer closing a connection.
+type LeveledLogger interface {
+	// Debugf logs the events of connections, which are noisy under heavy traffic.
+	Debugf(format string, args ...interface{})
+	// Infof logs the lifecycle of server and event-loops.
+	Infof(format string, args ...interface{})
+	// Errorf logs the failures.
+	Errorf(format string, args ...interface{})
+}
+
+// printfLogger logs the messages of all levels by Logger.Printf.
+type printfLogger struct {
+	Logger
+}
+
+func (l printfLogger) Debugf(format string, args ...interface{}) {
+	l.Printf(format, args...)
+}
+
+func (l printfLogger) Infof(format string, args ...interface{}) {
+	l.Printf(format, args...)
+}
+
+func (l printfLogger) Errorf(format string, args ...interface{}) {
+	l.Printf(format, args...)
+}
+
+// newLogger returns the logger set by options, which is Options.LeveledLogger, or Options.Logger logging
+// the messages of all levels, or the standard logger by default.
+func newLogger(options *Options) LeveledLogger {
+	if options.LeveledLogger != nil {
+		return options.LeveledLogger
+	}
+	if options.Logger != nil {
+		return printfLogger{options.Logger}
+	}
+	return printfLogger{defaultLogger}
+}
+
 // Server represents a server context which provides information about the
 // running server and has control functions for managing state.
 type Server struct {
@@ -50,42 +94,446 @@ type Server struct {
 	Multicore bool
 
 	// The Addr parameter is the listening address that align
-	// with the addr string passed to the Serve function.
+	// with the addr string passed to the Serve function. It's the address the listener is bound to,
+	// e.g. with the port assigned by the system when listening on port 0.
 	Addr net.Addr
 
+	// Addrs are the listening addresses that align with the addr strings passed to the ServeMulti function,
+	// the first one is Addr. Like Addr, they are the addresses the listeners are bound to.
+	Addrs []net.Addr
+
 	// NumEventLoop is the number of event-loops that the server is using.
 	NumEventLoop int
 
 	// ReusePort indicates whether SO_REUSEPORT is enable.
 	ReusePort bool
 
+	// ReuseAddr indicates whether SO_REUSEADDR is enable.
+	ReuseAddr bool
+
 	// TCPKeepAlive (SO_KEEPALIVE) socket option.
 	TCPKeepAlive time.Duration
 }
 
 // CountConnections counts the number of currently active connections and returns it.
 func (s Server) CountConnections() (count int) {
-	s.svr.subLoopGroup.iterate(func(i int, el *eventloop) bool {
-		count += int(el.loadConnCount())
-		return true
+	return s.svr.countConnections()
+}
+
+// Range calls fn for each open connection of all the event-loops until fn returns false, the connections opened
+// or closed during Range may or may not be visited. fn is called on the goroutine calling Range rather than
+// the event-loops of the connections, so only the methods safe for concurrent use, e.g. Context, AsyncWrite and
+// Close, should be invoked on them unless Range is called within their event-loops, e.g. in React.
+// It doesn't block the event-loops and is safe to call anywhere.
+func (s Server) Range(fn func(c Conn) bool) {
+	s.svr.conns.Range(func(key, _ interface{}) bool {
+		return fn(key.(Conn))
 	})
+}
+
+// Stats is a snapshot of the runtime statistics of server.
+type Stats struct {
+	// Connections is the number of currently active connections.
+	Connections int
+
+	// LoopConnections is the number of currently active connections of each event-loop, in the order of loop indices.
+	LoopConnections []int
+
+	// BytesRead is the number of bytes read from connections since the server started.
+	BytesRead uint64
+
+	// BytesWritten is the number of bytes written to connections since the server started.
+	BytesWritten uint64
+}
+
+// Stats returns the runtime statistics of server.
+func (s Server) Stats() (stats Stats) {
+	stats.LoopConnections = s.svr.loopConnections()
+	for _, n := range stats.LoopConnections {
+		stats.Connections += n
+	}
+	stats.BytesRead = atomic.LoadUint64(&s.svr.bytesRead)
+	stats.BytesWritten = atomic.LoadUint64(&s.svr.bytesWritten)
 	return
 }
 
+// LoopQueueLengths returns the number of jobs queued for each event-loop by the users of connections,
+// i.e. AsyncWrite, Flush and Wake, that have not been taken by the event-loop yet, in the order of loop indices.
+func (s Server) LoopQueueLengths() []int {
+	return s.svr.loopQueueLengths()
+}
+
+// Ready returns a channel that is closed once the server is ready to serve, i.e. all the listeners are bound
+// and all the event-loops are running, health checks like the readiness probe of Kubernetes can wait on it.
+// It must be called on the Server passed to EventHandler.OnInitComplete, which is before the server is ready.
+func (s Server) Ready() <-chan struct{} {
+	return s.svr.ready
+}
+
+// Healthy reports whether the server is ready and keeps serving, it turns false for good once the server
+// begins shutting down, which is also the case when an event-loop exits unexpectedly.
+func (s Server) Healthy() bool {
+	select {
+	case <-s.svr.ready:
+		return atomic.LoadInt32(&s.svr.down) == 0
+	default:
+		return false
+	}
+}
+
+// CountEventLoops returns the number of event-loops that new connections are currently assigned to.
+func (s Server) CountEventLoops() int {
+	return s.svr.countLoops()
+}
+
+// AddListener starts serving the given address, formatted as the one of Serve, in the running server with
+// the same event-loops, codec and event handler, it returns ErrAlreadyListening if the address is being served.
+// A UDP address can only be added to a server whose event-loops poll the listeners themselves, i.e. a server
+// with SO_REUSEPORT or UDP listeners, otherwise ErrProtocolNotSupported will be returned.
+// It is safe to call it in event callbacks, e.g. React.
+func (s Server) AddListener(addr string) error {
+	return s.svr.addListener(addr)
+}
+
+// ScaleLoops adds event-loops at runtime to reach the given number, new connections will be assigned
+// to the added event-loops. Event-loops can't be removed, since gnet can't migrate the connections of
+// an event-loop to the others, ErrScaleDownNotSupported will be returned for a number less than the current one.
+// Only the server with a main reactor accepting connections supports it, which means a TCP or Unix server
+// without SO_REUSEPORT on non-Windows platforms, otherwise ErrScalingNotSupported will be returned.
+func (s Server) ScaleLoops(n int) error {
+	return s.svr.scaleLoops(n)
+}
+
+// Shutdown gracefully shuts down the server: it stops accepting new connections and waits for the active
+// connections to be closed, which keep being served by event-loops in the meantime, then it stops the server.
+// If the context is done before all connections are closed, the server is stopped immediately with the remaining
+// connections being closed and the error of context is returned.
+// Connections pending in the listen backlog are dropped when the server stops.
+// It must not be invoked in the event-loops, e.g. in React or Tick, otherwise it blocks the event-loop
+// that is supposed to serve and close connections.
+func (s Server) Shutdown(ctx context.Context) error {
+	return s.svr.shutdown(ctx)
+}
+
+// Broadcast writes buf to the given connections asynchronously like AsyncWrite, while buf is encoded only once
+// per distinct codec of the connections rather than once per connection, except for the codecs keeping
+// per-connection state like AggregatingCodec, which encode it for each connection.
+// It writes to all the connections even if some of them fail, and returns the first error.
+func (s Server) Broadcast(conns []Conn, buf []byte) (err error) {
+	be := newBroadcastEncoder(buf)
+	for _, c := range conns {
+		if e := be.write(c); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// BroadcastAll writes buf to all the open connections of server asynchronously, buf is encoded once per distinct
+// codec of the connections in each event-loop, see Broadcast. Connections opened after it is called may not get
+// buf, while the connections with full write buffers, see Options.WriteBufferCap, still get it.
+func (s Server) BroadcastAll(buf []byte) error {
+	return s.svr.broadcastAll(buf)
+}
+
+// broadcastConn is implemented by the connections of gnet, which can be written with data encoded already.
+type broadcastConn interface {
+	connCodec() ICodec
+	writeBufferFull() bool
+	asyncWriteEncoded(encodedBuf []byte) error
+}
+
+// broadcastEncoder encodes the data to broadcast once per distinct codec, it is not safe for concurrent use.
+type broadcastEncoder struct {
+	buf    []byte
+	frames map[ICodec][]byte
+}
+
+func newBroadcastEncoder(buf []byte) *broadcastEncoder {
+	return &broadcastEncoder{buf: buf, frames: make(map[ICodec][]byte)}
+}
+
+// encode encodes the data for the connection with the codec, the frame is shared by the connections of the same
+// stateless codec.
+func (be *broadcastEncoder) encode(codec ICodec, c Conn) ([]byte, error) {
+	if _, ok := codec.(connStateCodec); ok {
+		return codec.Encode(c, be.buf)
+	}
+	if frame, ok := be.frames[codec]; ok {
+		return frame, nil
+	}
+	frame, err := codec.Encode(c, be.buf)
+	if err == nil {
+		be.frames[codec] = frame
+	}
+	return frame, err
+}
+
+// write writes the data to the connection asynchronously.
+func (be *broadcastEncoder) write(c Conn) error {
+	bc, ok := c.(broadcastConn)
+	if !ok {
+		return c.AsyncWrite(be.buf)
+	}
+	if bc.writeBufferFull() {
+		return ErrWriteBufferFull
+	}
+	frame, err := be.encode(bc.connCodec(), c)
+	if err != nil {
+		return err
+	}
+	return bc.asyncWriteEncoded(frame)
+}
+
+// minIdleSweepInterval is the minimum interval of sweeping idle connections.
+const minIdleSweepInterval = time.Millisecond
+
+// defaultUDPConnIdleTimeout is the idle timeout of connected UDP connections if IdleTimeout is not set.
+const defaultUDPConnIdleTimeout = time.Minute
+
+// defaultReadBufferCap is the number of bytes read from a connection at a time by default, which is also
+// the minimum size of the buffer for reading datagrams.
+const defaultReadBufferCap = 0x10000
+
+// readBufferCap returns the number of bytes read from a TCP connection at a time, see Options.ReadBufferCap.
+func (svr *server) readBufferCap() int {
+	if svr.opts.ReadBufferCap > 0 {
+		return svr.opts.ReadBufferCap
+	}
+	return defaultReadBufferCap
+}
+
+// packetSize returns the size of the buffer for reading, which fits both the chunks of TCP and datagrams.
+func (svr *server) packetSize() int {
+	if n := svr.readBufferCap(); n > defaultReadBufferCap {
+		return n
+	}
+	return defaultReadBufferCap
+}
+
+// writeBufferLowWater returns the number of pending outbound bytes to which a full connection has to drain
+// before OnWritable fires, see Options.WriteBufferLowWater.
+func (svr *server) writeBufferLowWater() int {
+	if svr.opts.WriteBufferLowWater > 0 {
+		return svr.opts.WriteBufferLowWater
+	}
+	return svr.opts.WriteBufferCap / 2
+}
+
+// tick fires OnTick of the event handler with the time elapsed since the last tick if it's an ElapsedTicker,
+// otherwise Tick, see Options.Ticker.
+func (svr *server) tick(elapsed time.Duration) (time.Duration, Action) {
+	if svr.elapsedTicker != nil {
+		return svr.elapsedTicker.OnTick(elapsed)
+	}
+	return svr.eventHandler.Tick()
+}
+
+// inboundGrowthPolicy returns the policy of resizing the inbound ring-buffers of connections.
+func (svr *server) inboundGrowthPolicy() BufferGrowthPolicy {
+	policy := svr.opts.BufferGrowthPolicy
+	if policy.MinSize < svr.opts.ReadBufferCap {
+		policy.MinSize = svr.opts.ReadBufferCap
+	}
+	return policy
+}
+
+// readyJob returns the job to be run by each of n event-loops, the last one to run it closes ready.
+func (svr *server) readyJob(n int) func() error {
+	pending := int32(n)
+	return func() error {
+		if atomic.AddInt32(&pending, -1) == 0 {
+			close(svr.ready)
+		}
+		return nil
+	}
+}
+
+// listeners returns a snapshot of all the listeners, listeners are only appended so that it is safe to iterate it
+// without the lock.
+func (svr *server) listeners() []*listener {
+	svr.lnsLock.RLock()
+	defer svr.lnsLock.RUnlock()
+	return svr.lns
+}
+
+// appendListener appends the listener to the listeners of server.
+func (svr *server) appendListener(ln *listener) {
+	svr.lnsLock.Lock()
+	svr.lns = append(svr.lns, ln)
+	svr.lnsLock.Unlock()
+}
+
+// listening reports whether the given network address is being served.
+func (svr *server) listening(network, addr string) bool {
+	for _, ln := range svr.listeners() {
+		if ln.network == network && ln.addr == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// addrs returns the addresses of all the listeners.
+func (svr *server) addrs() []net.Addr {
+	lns := svr.listeners()
+	addrs := make([]net.Addr, len(lns))
+	for i, ln := range lns {
+		addrs[i] = ln.lnaddr
+	}
+	return addrs
+}
+
+// hasPacketListener reports whether any of the listeners is UDP.
+func (svr *server) hasPacketListener() bool {
+	for _, ln := range svr.listeners() {
+		if ln.pconn != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// hasStreamListener reports whether any of the listeners is TCP or Unix.
+func (svr *server) hasStreamListener() bool {
+	for _, ln := range svr.listeners() {
+		if ln.pconn == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// addBytesRead adds n to the number of bytes read by server.
+func (svr *server) addBytesRead(n int) {
+	if n > 0 {
+		atomic.AddUint64(&svr.bytesRead, uint64(n))
+	}
+}
+
+// addBytesWritten adds n to the number of bytes written by server.
+func (svr *server) addBytesWritten(n int) {
+	if n > 0 {
+		atomic.AddUint64(&svr.bytesWritten, uint64(n))
+	}
+}
+
+// sweepsIdleConns reports whether there are connections to be swept when they are idle.
+func (svr *server) sweepsIdleConns() bool {
+	return svr.opts.IdleTimeout > 0 && svr.hasStreamListener() || svr.opts.UDPConnected && svr.hasPacketListener()
+}
+
+// idleTimeout returns the timeout of idle connections, connected UDP connections are always reaped
+// when they are idle.
+func (svr *server) idleTimeout() time.Duration {
+	if svr.opts.IdleTimeout > 0 {
+		return svr.opts.IdleTimeout
+	}
+	return defaultUDPConnIdleTimeout
+}
+
+// idleSweepInterval returns the interval of sweeping connections idle for longer than the given timeout.
+func idleSweepInterval(idleTimeout time.Duration) time.Duration {
+	if interval := idleTimeout / 2; interval > minIdleSweepInterval {
+		return interval
+	}
+	return minIdleSweepInterval
+}
+
+// readTimeoutCheckInterval returns the interval of checking connections for the given read timeout.
+func readTimeoutCheckInterval(readTimeout time.Duration) time.Duration {
+	if interval := readTimeout / 10; interval > minIdleSweepInterval {
+		return interval
+	}
+	return minIdleSweepInterval
+}
+
+// shutdownPollInterval is the interval of polling the number of active connections during graceful shutdown.
+const shutdownPollInterval = 10 * time.Millisecond
+
+// waitForConnections waits until there are no active connections or the context is done.
+func waitForConnections(ctx context.Context, countConnections func() int) error {
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for countConnections() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// contextEqual reports whether the contexts are equal, the ones that are not comparable, e.g. maps, slices
+// or structs holding them, are never equal rather than panicking.
+func contextEqual(a, b interface{}) (equal bool) {
+	defer func() {
+		if recover() != nil {
+			equal = false
+		}
+	}()
+	return a == b
+}
+
+// setUpConn applies the context, codec and options returned by OpenHandler.OnOpen to the connection.
+func setUpConn(openHandler OpenHandler, c Conn) error {
+	if openHandler == nil {
+		return nil
+	}
+	ctx, codec, opts := openHandler.OnOpen(c)
+	if ctx != nil {
+		c.SetContext(ctx)
+	}
+	if codec != nil {
+		if err := c.SetCodec(codec); err != nil {
+			return err
+		}
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Conn is a interface of gnet connection.
 type Conn interface {
 	// Context returns a user-defined context.
 	Context() (ctx interface{})
 
+	// LoadContext returns the user-defined context and whether it has been set, which tells a context set to nil
+	// from the one never set. Once set, the context stays set until the connection is closed, even if it's nil.
+	LoadContext() (ctx interface{}, ok bool)
+
 	// SetContext sets a user-defined context.
 	SetContext(ctx interface{})
 
+	// CompareAndSwapContext sets the user-defined context to new only if the current one equals to old,
+	// it reports whether the swap has been done. It is safe for concurrent use, and it never swaps
+	// a context that is not comparable, e.g. a map or a slice.
+	CompareAndSwapContext(old, new interface{}) (swapped bool)
+
+	// SetLogLabel attaches a key-value label to the logging context of the connection, all the internal log lines
+	// about this connection will carry the connection's id, remote address and labels.
+	SetLogLabel(key, value string)
+
 	// LocalAddr is the connection's local socket address.
 	LocalAddr() (addr net.Addr)
 
 	// RemoteAddr is the connection's remote peer address.
 	RemoteAddr() (addr net.Addr)
 
+	// RemoteAddrString returns the string form of RemoteAddr, which is computed on the first call and cached
+	// for the lifetime of the connection, so that logging the remote address of every frame doesn't allocate.
+	RemoteAddrString() string
+
+	// Network returns the transport of the connection: "tcp", "udp" or "unix", regardless of the IP version of
+	// the address it's served on, e.g. "tcp" for "tcp4://" and "tcp6://", so that a handler serving multiple
+	// listeners can tell datagrams from streams.
+	Network() string
+
 	// Read reads all data from inbound ring-buffer and event-loop-buffer without moving "read" pointer, which means
 	// it does not evict the data from buffers actually and those data will present in buffers until the
 	// ResetBuffer method is invoked.
@@ -102,15 +550,37 @@ type Conn interface {
 	// should make use of the variable "size" returned by it to be aware of the exact length of the returned data.
 	ReadN(n int) (size int, buf []byte)
 
-	// ShiftN shifts "read" pointer in buffers with the given length.
+	// Peek returns the first n bytes from inbound ring-buffer and event-loop-buffer without evicting them, so that
+	// a header can be inspected before deciding how to consume the data. If there are less than n bytes available,
+	// all of them are returned along with ErrIncompletePacket, and a non-positive n returns all available data.
+	Peek(n int) (buf []byte, err error)
+
+	// ShiftN shifts "read" pointer in buffers with the given length, all data in buffers is evicted if n is
+	// not positive or exceeds the length of the available data.
 	ShiftN(n int) (size int)
 
+	// ShiftNErr shifts "read" pointer in buffers with the given length like ShiftN, but it returns ErrShiftOutOfRange
+	// and leaves the buffers untouched if n is negative or exceeds the length of the available data, so that
+	// a codec can detect its own miscalculation instead of discarding the data of the next frame.
+	ShiftNErr(n int) error
+
+	// DrainTo writes all data in inbound ring-buffer and event-loop-buffer to w and evicts the data written,
+	// unlike Read which leaves the data in buffers, it returns the number of bytes written and the error
+	// of w if any, in which case the data not written is left in buffers.
+	DrainTo(w io.Writer) (n int, err error)
+
 	// BufferLength returns the length of available data in the inbound ring-buffer.
 	BufferLength() (size int)
 
 	// InboundBuffer returns the inbound ring-buffer.
 	//InboundBuffer() *ringbuffer.RingBuffer
 
+	// BytesRead returns the number of bytes read from the connection since it was opened.
+	BytesRead() int64
+
+	// BytesWritten returns the number of bytes written to the connection since it was opened.
+	BytesWritten() int64
+
 	// SendTo writes data for UDP sockets, it allows you to send data back to UDP socket in individual goroutines.
 	SendTo(buf []byte) error
 
@@ -118,11 +588,156 @@ type Conn interface {
 	// instead of the event-loop goroutines.
 	AsyncWrite(buf []byte) error
 
+	// AsyncWriteSeq encodes each of the buffers and writes the encoded frames to the connection asynchronously
+	// by one job of the event-loop, so that they are written back-to-back without any data written by other
+	// AsyncWrite calls in between, e.g. a header frame and its body frame. Nothing is written if any of
+	// the buffers fails to be encoded. The frames are written by one vectored write on TCP connections
+	// and as individual datagrams on UDP connections.
+	AsyncWriteSeq(bufs ...[]byte) error
+
+	// TryWrite encodes the data and performs a single non-blocking write of the encoded frame to the connection
+	// synchronously, it returns the number of bytes of the encoded frame that have been written, which may be
+	// fewer than the frame, and ErrWouldBlock if nothing can be written for now, e.g. the socket send buffer is full
+	// or there are pending data in the outbound buffer, leaving the caller to decide what to do with the rest,
+	// and ErrHijacked while the connection is hijacked.
+	// It must be invoked within the event-loop, e.g. in React, and it is not supported on Windows.
+	TryWrite(buf []byte) (n int, err error)
+
+	// OutboundBuffered returns the number of bytes pending to be written to the connection, including the data
+	// queued by AsyncWrite and the data in outbound buffer, which is bounded by Options.WriteBufferCap.
+	// It is safe for concurrent use.
+	OutboundBuffered() int
+
+	// Writev writes the buffers to the connection as they are, without being encoded by codec, by one vectored write
+	// like writev(2) or WSASend, so that a header and a large payload can be written without copying them into one
+	// buffer, see LengthFieldBasedFrameCodec.EncodeHeader. The buffers are concatenated on the platforms without
+	// vectored I/O and for TLS or UDP connections. It must be called within the event-loop, e.g. in React.
+	Writev(bufs ...[]byte) error
+
+	// SendFile sends count bytes of the file from offset to the connection as they are, without being encoded
+	// by codec, by sendfile(2) on Linux so that the file isn't copied through the user space, the rest which can't
+	// be sent right now is sent once the socket becomes writable, and the file can be closed once SendFile returns.
+	// The file is copied into the outbound buffer if there are data pending to be written, and for TLS connections
+	// or on the platforms other than Linux it's copied through a buffer. io.ErrUnexpectedEOF is returned if
+	// the file is shorter than the region. It must be called within the event-loop and doesn't support UDP.
+	SendFile(f *os.File, offset int64, count int) error
+
+	// WriteBuffered encodes the data and appends the encoded frame to a per-connection buffer instead of writing it
+	// to the connection, all the buffered frames will be written in one shot when Flush or Close is invoked.
+	// It is safe for concurrent use.
+	WriteBuffered(buf []byte) error
+
+	// Flush writes all the frames buffered by WriteBuffered to the connection asynchronously.
+	Flush() error
+
+	// SetDeadline sets both the read and write deadlines of the underlying net.Conn, which behaves like
+	// net.Conn.SetDeadline, a connection whose read deadline has been exceeded will be closed.
+	// It is only supported by the TCP connections on Windows, ErrUnsupportedOp will be returned otherwise.
+	SetDeadline(t time.Time) error
+
+	// SetReadDeadline sets the read deadline of the underlying net.Conn, see SetDeadline for more details.
+	SetReadDeadline(t time.Time) error
+
+	// SetWriteDeadline sets the write deadline of the underlying net.Conn, which bounds how long a write to
+	// the connection can block the event-loop, see SetDeadline for more details.
+	SetWriteDeadline(t time.Time) error
+
+	// TCPInfo retrieves the information about the TCP connection from the kernel via getsockopt(TCP_INFO),
+	// like RTT, congestion window and retransmits. It is only supported on Linux, ErrUnsupportedOp will be returned
+	// on other platforms, and an error will be returned for non-TCP connections.
+	TCPInfo() (*TCPInfo, error)
+
+	// SetNoDelay controls whether the operating system should delay packet transmission in hopes of sending
+	// fewer packets (Nagle's algorithm) for this connection by the TCP_NODELAY socket option.
+	// It only works for TCP connections, an error will be returned otherwise.
+	SetNoDelay(noDelay bool) error
+
+	// FD returns the file descriptor of the connection, with which the socket options not wrapped by gnet can be set,
+	// e.g. SO_SNDBUF. UDP connections share the fd of their listener. The fd is owned by gnet, it must not be closed
+	// or read from/written to by the caller, see Hijack for taking it over. It returns -1 on Windows, where
+	// connections aren't backed by file descriptors of gnet.
+	FD() int
+
+	// LoopIndex returns the index of the event-loop which the connection belongs to, which stays the same for
+	// the life of the connection. It's the index passed to OnLoopTick and the one of Server.LoopQueueLengths,
+	// with which the data structures sharded by event-loops can be accessed in the callbacks without locking,
+	// except in React offloaded by Options.ReactPool.
+	LoopIndex() int
+
+	// JoinGroup joins the multicast group of the given address on the default interface by the IP_ADD_MEMBERSHIP
+	// or IPV6_JOIN_GROUP socket option, so that the UDP listener of the connection receives the datagrams sent to
+	// the group. The membership belongs to the listener rather than the connection, until LeaveGroup is called.
+	// It only works for UDP connections, an error will be returned otherwise.
+	JoinGroup(addr net.IP) error
+
+	// LeaveGroup leaves the multicast group of the given address joined by JoinGroup.
+	LeaveGroup(addr net.IP) error
+
+	// Hijack takes over the file descriptor of the connection: the fd is removed from the poller so that
+	// the event-loop stops reading from and writing to it, while the connection is still counted by gnet,
+	// data written by gnet in the meantime is kept in the outbound buffer. The returned cleanup gives the control
+	// back to the event-loop, after which the connection can be used or closed as usual.
+	// Unlike detaching to a net.Conn, the fd is non-blocking and must not be closed by the caller.
+	// It must be called within the event-loop, e.g. in React, and it is only supported on Unix-like systems.
+	Hijack() (fd int, cleanup func(), err error)
+
+	// Detach hands the connection over to the caller for good, e.g. to run an existing blocking implementation
+	// of a protocol after the initial handshake: the connection is removed from the event-loop without firing
+	// OnClosed, gnet stops reading from and writing to it, and the returned net.Conn wraps the same socket with
+	// blocking reads and writes. The data read but not decoded yet is returned by the first reads of the net.Conn,
+	// and the data pending in the outbound buffer is written before its first write, while the data written by gnet
+	// after Detach, e.g. the out of the React calling it, is discarded. The caller is responsible for closing
+	// the net.Conn. It returns ErrUnsupportedOp for UDP and TLS connections, ErrHijacked for a hijacked one
+	// and ErrDetached for the one detached or closed. It must be called within the event-loop, e.g. in React.
+	Detach() (net.Conn, error)
+
+	// SetCodec switches the codec of the connection, e.g. after a protocol upgrade, which takes effect at the frame
+	// boundary: the frames decoded so far are not affected, the data remaining in the inbound buffer is decoded by
+	// the new codec and the data written from now on is encoded by it. If the current codec is in the middle of
+	// decoding a frame, e.g. StreamingLengthFieldBasedFrameCodec has parsed the header of a frame whose payload
+	// is yet to arrive, ErrPartialFrame is returned and the current codec is kept to complete the frame, then
+	// SetCodec can be called again once the frame has been decoded. Codecs that don't keep partial frames across
+	// calls of Decode, like LengthFieldBasedFrameCodec, are always at a frame boundary and hand over the buffered
+	// data as it is. The per-connection state of the current codec is released once it has been switched.
+	// It must be called within the event-loop, e.g. in React.
+	SetCodec(codec ICodec) error
+
+	// SetFrameQuota sets the number of frames the connection is allowed to send from now on, the connection is closed
+	// with ErrQuotaExceeded when a frame beyond the quota is decoded, so that the client has to reconnect.
+	// A quota of 0 means unlimited, which is the default. It must be called within the event-loop, e.g. in React.
+	SetFrameQuota(n int64)
+
+	// SetReadThreshold sets the minimum number of bytes buffered before the inbound data of a stream connection is
+	// decoded, so that React is invoked once for a number of tiny frames rather than for each read, which amortizes
+	// the cost of callbacks. The data less than the threshold is kept in the inbound buffer until more data arrives,
+	// or until the connection has been without frames for Options.ReadTimeout, when the data buffered is decoded
+	// regardless of the threshold and ReadTimeoutHandler.OnReadTimeout only fires if no frame is decoded from it. Keep
+	// the threshold no more than the size of a complete request, or set ReadTimeout, lest the last frames of the peer
+	// wait forever. A threshold of 0 disables it, which is the default, and the new threshold applies from the next
+	// read. It must be called within the event-loop, e.g. in OnOpened or React.
+	SetReadThreshold(n int)
+
+	// RateLimiter returns the limiter of the bytes read from the connection, by which the limit of the connection
+	// can be adjusted at runtime, e.g. lifted for a trusted client. It returns nil if Options.ConnRateLimit
+	// is not set or the connection is not a TCP connection.
+	RateLimiter() *RateLimiter
+
 	// Wake triggers a React event for this connection.
 	Wake() error
 
+	// WakeWith triggers a React event for this connection like Wake, the frame of which is data rather than nil,
+	// e.g. a piece of work handed over to the event-loop along with the wake. data is not decoded by codec and
+	// must not be modified after WakeWith is called, a nil data is the same as Wake.
+	WakeWith(data []byte) error
+
 	// Close closes the current connection.
 	Close() error
+
+	// CloseWrite shuts down the write side of the connection asynchronously once the data pending to be written
+	// is flushed, while the read side is left open, so that React keeps receiving frames until the peer closes
+	// the connection. The data written afterwards is discarded. It's not supported by UDP, for which
+	// ErrUnsupportedOp is returned.
+	CloseWrite() error
 }
 
 type (
@@ -137,7 +752,8 @@ type (
 		// OnOpened fires when a new connection has been opened.
 		// The info parameter has information about the connection such as
 		// it's local and remote address.
-		// Use the out return value to write data to the connection.
+		// Use the out return value to write data to the connection. If action is Close, out is written
+		// before the connection is closed and nothing is read from it, e.g. to send a rejection banner.
 		OnOpened(c Conn) (out []byte, action Action)
 
 		// OnClosed fires when a connection has been closed.
@@ -147,13 +763,17 @@ type (
 		// PreWrite fires just before any data is written to any client socket.
 		PreWrite()
 
-		// React fires when a connection sends the server data.
+		// React fires when a connection sends the server data, once for each frame decoded by the codec.
+		// All the complete frames read at a time are handed to React before the event-loop moves on
+		// to other connections, so a burst of small frames isn't held until the next readable event.
 		// Invoke c.Read() or c.ReadN(n) within the parameter c to read incoming data from client/connection.
 		// Use the out return value to write data to the client/connection.
 		React(frame []byte, c Conn) (out []byte, action Action)
 
 		// Tick fires immediately after the server starts and will fire again
 		// following the duration specified by the delay return value.
+		// It fires on a single event-loop when the ticker is set up by Options.Ticker, in which case
+		// ElapsedTicker.OnTick fires in its place if the event handler implements it.
 		Tick() (delay time.Duration, action Action)
 	}
 
@@ -162,6 +782,73 @@ type (
 	// in EventHandler.
 	EventServer struct {
 	}
+
+	// FramesReactor is implemented by the event handlers which respond to a frame with several frames.
+	// ReactFrames fires in place of React for each frame decoded from a TCP or Unix connection, and each of
+	// the outs is encoded by codec and written to the connection in order, just like the out of React.
+	// React still fires for the frames of Wake, WakeWith and read timeouts, and for the packets of UDP.
+	FramesReactor interface {
+		ReactFrames(frame []byte, c Conn) (outs [][]byte, action Action)
+	}
+
+	// WritableHandler is implemented by the event handlers which stop producing data for a connection whose write
+	// buffer is full, i.e. AsyncWrite returns ErrWriteBufferFull or Conn.OutboundBuffered exceeds
+	// Options.WriteBufferCap, and resume once it has been drained. OnWritable fires on the event-loop once
+	// the pending outbound bytes of a connection that has been full drop to Options.WriteBufferLowWater,
+	// it fires once for each time the connection gets full, and never fires without WriteBufferCap.
+	// Use the out return value to write data to the connection, just like the out of React.
+	WritableHandler interface {
+		OnWritable(c Conn) (out []byte, action Action)
+	}
+
+	// OpenHandler is implemented by the event handlers which set up the connections in one place.
+	// OnOpen fires when a new connection has been accepted, before OnOpened and the first read of it:
+	// the context is set as the one of connection and the codec replaces the one of server for this connection
+	// unless they are nil, then the options are applied in order. The connection is closed with the error of
+	// the first option that fails, without firing OnOpened.
+	OpenHandler interface {
+		OnOpen(c Conn) (ctx interface{}, codec ICodec, opts []ConnOption)
+	}
+
+	// RejectionHandler is implemented by the event handlers which track the connections rejected by the server.
+	// OnConnectionRejected fires when a new connection is closed right after being accepted because the server
+	// has reached the limit of Options.MaxConnections, addr is the remote address of the connection.
+	// It is invoked in the goroutine accepting connections, concurrently with the other event callbacks.
+	RejectionHandler interface {
+		OnConnectionRejected(addr net.Addr)
+	}
+
+	// WriteCompleter is implemented by the event handlers which release the resources tied to the data sent,
+	// or track the progress of sending. OnWriteComplete fires on the event-loop right after n bytes are written
+	// to the socket of connection, which may be a part of the data written by a call, the rest will be reported
+	// by later events once it's flushed. The bytes are counted as Conn.BytesWritten does.
+	WriteCompleter interface {
+		OnWriteComplete(c Conn, n int)
+	}
+
+	// LoopTicker is implemented by the event handlers which tick on each event-loop. OnLoopTick fires on each
+	// event-loop with its index when the per-loop ticker is set up by Options.PerLoopTicker, elapsed is the real
+	// time since the last tick of the event-loop, or since the event-loop started for the first tick. It fires
+	// again following the duration specified by the delay return value, independently of the other event-loops
+	// and Tick.
+	LoopTicker interface {
+		OnLoopTick(loopIdx int, elapsed time.Duration) (delay time.Duration, action Action)
+	}
+
+	// ElapsedTicker is implemented by the event handlers which need the real time elapsed between ticks.
+	// OnTick fires in place of Tick when the ticker is set up by Options.Ticker, elapsed is the real time
+	// since the last tick, or since the ticker started for the first tick. The ticks of Options.PerLoopTicker
+	// fire LoopTicker.OnLoopTick on each event-loop instead, whether the event handler implements ElapsedTicker or not.
+	ElapsedTicker interface {
+		OnTick(elapsed time.Duration) (delay time.Duration, action Action)
+	}
+
+	// ReadTimeoutHandler is implemented by the event handlers which do periodic work on idle connections,
+	// e.g. sending keepalives. OnReadTimeout fires on the event-loop when no frame has been decoded from
+	// a connection for Options.ReadTimeout, and keeps firing every ReadTimeout while no frame is decoded.
+	ReadTimeoutHandler interface {
+		OnReadTimeout(c Conn) (out []byte, action Action)
+	}
 )
 
 // OnInitComplete fires when the server is ready for accepting connections.
@@ -173,7 +860,8 @@ func (es *EventServer) OnInitComplete(svr Server) (action Action) {
 // OnOpened fires when a new connection has been opened.
 // The info parameter has information about the connection such as
 // it's local and remote address.
-// Use the out return value to write data to the connection.
+// Use the out return value to write data to the connection. If action is Close, out is written
+// before the connection is closed and nothing is read from it, e.g. to send a rejection banner.
 func (es *EventServer) OnOpened(c Conn) (out []byte, action Action) {
 	return
 }
@@ -188,7 +876,9 @@ func (es *EventServer) OnClosed(c Conn, err error) (action Action) {
 func (es *EventServer) PreWrite() {
 }
 
-// React fires when a connection sends the server data.
+// React fires when a connection sends the server data, once for each frame decoded by the codec.
+// All the complete frames read at a time are handed to React before the event-loop moves on
+// to other connections, so a burst of small frames isn't held until the next readable event.
 // Invoke c.Read() or c.ReadN(n) within the parameter c to read incoming data from client/connection.
 // Use the out return value to write data to the client/connection.
 func (es *EventServer) React(frame []byte, c Conn) (out []byte, action Action) {
@@ -216,53 +906,117 @@ func (es *EventServer) Tick() (delay time.Duration, action Action) {
 //
 // The "tcp" network scheme is assumed when one is not specified.
 func Serve(eventHandler EventHandler, addr string, opts ...Option) error {
-	var ln listener
+	return ServeMulti(eventHandler, []string{addr}, opts...)
+}
+
+// ServeMulti starts handling events for all the specified addresses in one server, the listeners share
+// the event-loops, the codec and the event handler, and a Shutdown action tears them all down.
+// Each address is formatted as the one of Serve. If any of the addresses is UDP, event-loops will
+// poll the listeners themselves as they do with SO_REUSEPORT, rather than accepting by a main reactor.
+func ServeMulti(eventHandler EventHandler, addrs []string, opts ...Option) error {
+	if len(addrs) == 0 {
+		return ErrNoAddress
+	}
+	listeners := make([]*listener, 0, len(addrs))
 	defer func() {
-		ln.close()
-		if ln.network == "unix" {
-			sniffErrorAndLog(os.RemoveAll(ln.addr))
+		for _, ln := range listeners {
+			ln.close()
 		}
 	}()
 
 	options := loadOptions(opts...)
 
-	if options.Logger != nil {
-		defaultLogger = options.Logger
+	for _, addr := range addrs {
+		ln, err := initListener(addr, options)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, ln)
+	}
+	return serve(eventHandler, listeners, options)
+}
+
+// addrNetwork returns the transport of the address, see Conn.Network.
+func addrNetwork(addr net.Addr) string {
+	switch addr.(type) {
+	case *net.TCPAddr:
+		return "tcp"
+	case *net.UDPAddr:
+		return "udp"
+	case *net.UnixAddr:
+		return "unix"
 	}
+	return ""
+}
+
+// numEventLoops figures out the correct number of loops/goroutines to use.
+func numEventLoops(options *Options) int {
+	numEventLoop := 1
+	if options.Multicore {
+		numEventLoop = runtime.NumCPU()
+	}
+	if options.NumEventLoop > 0 {
+		numEventLoop = options.NumEventLoop
+	}
+	return numEventLoop
+}
 
+// initListener listens on the given address.
+func initListener(addr string, options *Options) (*listener, error) {
+	ln := &listener{logger: newLogger(options)}
 	ln.network, ln.addr = parseAddr(addr)
-	if ln.network == "unix" {
-		sniffErrorAndLog(os.RemoveAll(ln.addr))
+	if ln.hasSocketFile() {
+		sniffErrorAndLog(ln.logger, os.RemoveAll(ln.addr))
 		if runtime.GOOS == "windows" {
-			return ErrProtocolNotSupported
+			return nil, ErrProtocolNotSupported
 		}
 	}
 	var err error
 	if ln.network == "udp" {
-		if options.ReusePort && runtime.GOOS != "windows" {
+		// Listening on a multicast address joins the group on the default interface.
+		if udpAddr, e := net.ResolveUDPAddr(ln.network, ln.addr); e == nil && udpAddr.IP.IsMulticast() {
+			ln.pconn, err = net.ListenMulticastUDP(ln.network, nil, udpAddr)
+		} else if options.ReusePort && runtime.GOOS != "windows" {
 			ln.pconn, err = netpoll.ReusePortListenPacket(ln.network, ln.addr)
+		} else if options.ReuseAddr {
+			lc := netpoll.ReuseAddrListenConfig()
+			ln.pconn, err = lc.ListenPacket(context.Background(), ln.network, ln.addr)
 		} else {
 			ln.pconn, err = net.ListenPacket(ln.network, ln.addr)
 		}
 	} else {
 		if options.ReusePort && runtime.GOOS != "windows" {
 			ln.ln, err = netpoll.ReusePortListen(ln.network, ln.addr)
+		} else if options.ReuseAddr {
+			lc := netpoll.ReuseAddrListenConfig()
+			ln.ln, err = lc.Listen(context.Background(), ln.network, ln.addr)
 		} else {
 			ln.ln, err = net.Listen(ln.network, ln.addr)
 		}
 	}
 	if err != nil {
-		return err
+		return nil, &ListenError{Op: "listen", Addr: addr, Err: err}
 	}
 	if ln.pconn != nil {
 		ln.lnaddr = ln.pconn.LocalAddr()
 	} else {
 		ln.lnaddr = ln.ln.Addr()
 	}
-	if err := ln.system(); err != nil {
-		return err
+	if err = ln.system(options); err != nil {
+		return nil, err
+	}
+	return ln, nil
+}
+
+// hasSocketFile reports whether the listener is a Unix domain socket bound to a file, which is removed before
+// listening and after closing, rather than one in the abstract namespace of Linux, whose address starts with '@'
+// or a null byte and leaves nothing in the filesystem.
+func (ln *listener) hasSocketFile() bool {
+	if ln.network != "unix" {
+		return false
 	}
-	return serve(eventHandler, &ln, options)
+	abstract := len(ln.addr) > 0 && (ln.addr[0] == '@' || ln.addr[0] == 0)
+	return !abstract || runtime.GOOS != "linux"
 }
 
 func parseAddr(addr string) (network, address string) {
@@ -276,8 +1030,8 @@ func parseAddr(addr string) (network, address string) {
 	return
 }
 
-func sniffErrorAndLog(err error) {
+func sniffErrorAndLog(logger LeveledLogger, err error) {
 	if err != nil {
-		defaultLogger.Printf(err.Error())
+		logger.Errorf("%v\n", err)
 	}
 }
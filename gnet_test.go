@@ -7,15 +7,29 @@ package gnet
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"math/big"
 	"math/rand"
 	"net"
 	"os"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
@@ -649,6 +663,156 @@ func testWakeConn(network, addr string) {
 		WithLogger(log.New(os.Stderr, "", log.LstdFlags))))
 }
 
+func TestWakeWith(t *testing.T) {
+	events := &testWakeWithServer{done: make(chan error, 1), opened: make(chan Conn, 1)}
+	must(Serve(events, "tcp://:9991", WithCodec(&LineBasedFrameCodec{}), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testWakeWithServer struct {
+	*EventServer
+	action bool
+	done   chan error
+	opened chan Conn
+}
+
+func (t *testWakeWithServer) OnOpened(c Conn) (out []byte, action Action) {
+	t.opened <- c
+	return
+}
+
+func (t *testWakeWithServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	if frame == nil {
+		out = []byte("wake")
+		return
+	}
+	out = append([]byte("job:"), frame...)
+	return
+}
+
+func (t *testWakeWithServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				c := <-t.opened
+				// The payloads are handed to React in order as they are, without being decoded by codec.
+				for _, wake := range []func() error{
+					func() error { return c.WakeWith([]byte("1")) },
+					func() error { return c.WakeWith([]byte("2\n3")) },
+					c.Wake,
+				} {
+					if err = wake(); err != nil {
+						return err
+					}
+				}
+				expected := "job:1\njob:2\n3\nwake\n"
+				reply := make([]byte, len(expected))
+				if _, err = io.ReadFull(conn, reply); err != nil || string(reply) != expected {
+					return fmt.Errorf("expected %q, got %q, error: %v", expected, reply, err)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestAsyncWriteSeq(t *testing.T) {
+	events := &testAsyncWriteSeqServer{done: make(chan error, 1), opened: make(chan Conn, 1)}
+	must(Serve(events, "tcp://:9991", WithCodec(&LineBasedFrameCodec{}), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testAsyncWriteSeqServer struct {
+	*EventServer
+	action bool
+	done   chan error
+	opened chan Conn
+}
+
+func (t *testAsyncWriteSeqServer) OnOpened(c Conn) (out []byte, action Action) {
+	t.opened <- c
+	return
+}
+
+func (t *testAsyncWriteSeqServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				c := <-t.opened
+				// The headers and bodies written concurrently are never interleaved.
+				const writers, n = 8, 100
+				errs := make(chan error, writers)
+				for i := 0; i < writers; i++ {
+					go func(i int) {
+						for j := 0; j < n; j++ {
+							id := fmt.Sprintf("%d-%d", i, j)
+							if err := c.AsyncWriteSeq([]byte("header "+id), []byte("body "+id)); err != nil {
+								errs <- err
+								return
+							}
+						}
+						errs <- nil
+					}(i)
+				}
+				for i := 0; i < writers; i++ {
+					if err = <-errs; err != nil {
+						return err
+					}
+				}
+				rd := bufio.NewReader(conn)
+				for i := 0; i < writers*n; i++ {
+					header, err := rd.ReadString('\n')
+					if err != nil {
+						return err
+					}
+					body, err := rd.ReadString('\n')
+					if err != nil {
+						return err
+					}
+					if !strings.HasPrefix(header, "header ") || body != "body "+header[len("header "):] {
+						return fmt.Errorf("expected header and its body back-to-back, got %q and %q", header, body)
+					}
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
 func TestShutdown(t *testing.T) {
 	testShutdown("tcp", ":9991")
 }
@@ -981,3 +1145,4030 @@ func testCloseConnection(network, addr string) {
 	events := &testCloseConnectionServer{network: network, addr: addr}
 	must(Serve(events, network+"://"+addr, WithTicker(true)))
 }
+
+func TestCompareAndSwapContext(t *testing.T) {
+	testCompareAndSwapContext("tcp", ":9991")
+}
+
+type testCompareAndSwapContextServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+	rounds        int
+	workers       int
+}
+
+func (t *testCompareAndSwapContextServer) OnOpened(c Conn) (out []byte, action Action) {
+	c.SetContext(0)
+	for round := 0; round < t.rounds; round++ {
+		var (
+			wg      sync.WaitGroup
+			swapped int32
+		)
+		wg.Add(t.workers)
+		for i := 0; i < t.workers; i++ {
+			go func(round int) {
+				defer wg.Done()
+				if c.CompareAndSwapContext(round, round+1) {
+					atomic.AddInt32(&swapped, 1)
+				}
+			}(round)
+		}
+		wg.Wait()
+		if swapped != 1 {
+			panic(fmt.Sprintf("expected exactly one winner in round %d, got %d", round, swapped))
+		}
+	}
+	if c.Context() != t.rounds {
+		panic("bad context after all rounds of CAS")
+	}
+	action = Close
+	return
+}
+func (t *testCompareAndSwapContextServer) OnClosed(c Conn, err error) (action Action) {
+	action = Shutdown
+	return
+}
+func (t *testCompareAndSwapContextServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			conn, err := net.Dial(t.network, t.addr)
+			must(err)
+			defer conn.Close()
+		}()
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func testCompareAndSwapContext(network, addr string) {
+	events := &testCompareAndSwapContextServer{network: network, addr: addr, rounds: 100, workers: 8}
+	must(Serve(events, network+"://"+addr, WithTicker(true)))
+}
+
+func TestLoadContext(t *testing.T) {
+	events := &testLoadContextServer{}
+	must(Serve(events, "tcp://:9991", WithTicker(true)))
+	if events.err != nil {
+		t.Fatal(events.err)
+	}
+}
+
+type testLoadContextServer struct {
+	*EventServer
+	action bool
+	err    error
+}
+
+func (t *testLoadContextServer) OnOpened(c Conn) (out []byte, action Action) {
+	action = Close
+	if ctx, ok := c.LoadContext(); ctx != nil || ok {
+		t.err = fmt.Errorf("expected the context to be unset, got (%v, %t)", ctx, ok)
+		return
+	}
+	c.SetContext(nil)
+	if ctx, ok := c.LoadContext(); ctx != nil || !ok {
+		t.err = fmt.Errorf("expected the context to be set to nil, got (%v, %t)", ctx, ok)
+		return
+	}
+	c.SetContext("ctx")
+	if ctx, ok := c.LoadContext(); ctx != "ctx" || !ok {
+		t.err = fmt.Errorf("expected the context to be set to %q, got (%v, %t)", "ctx", ctx, ok)
+	}
+	return
+}
+
+func (t *testLoadContextServer) OnClosed(c Conn, err error) (action Action) {
+	action = Shutdown
+	return
+}
+
+func (t *testLoadContextServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			conn, err := net.Dial("tcp", ":9991")
+			must(err)
+			defer conn.Close()
+		}()
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestSlowReader(t *testing.T) {
+	testSlowReader("tcp", ":9991")
+}
+
+type testSlowReaderServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+	ticks         int32
+	data          []byte
+}
+
+func (t *testSlowReaderServer) OnOpened(c Conn) (out []byte, action Action) {
+	out = t.data
+	return
+}
+func (t *testSlowReaderServer) OnClosed(c Conn, err error) (action Action) {
+	action = Shutdown
+	return
+}
+func (t *testSlowReaderServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	out = t.data
+	return
+}
+func (t *testSlowReaderServer) Tick() (delay time.Duration, action Action) {
+	atomic.AddInt32(&t.ticks, 1)
+	if !t.action {
+		t.action = true
+		go func() {
+			conn, err := net.Dial(t.network, t.addr)
+			must(err)
+			defer conn.Close()
+			for i := 0; i < 2; i++ {
+				if i > 0 {
+					_, err = conn.Write([]byte("ping"))
+					must(err)
+				}
+				// Leave the data piling up in the server until its socket send buffer is full.
+				ticks := atomic.LoadInt32(&t.ticks)
+				time.Sleep(time.Millisecond * 200)
+				if atomic.LoadInt32(&t.ticks) == ticks {
+					panic("event-loop was blocked by the slow reader")
+				}
+				buf := make([]byte, len(t.data))
+				for n := 0; n < len(buf); {
+					nn, err := conn.Read(buf[n:])
+					must(err)
+					n += nn
+				}
+				if string(buf) != string(t.data) {
+					panic("data mismatched after draining the outbound buffer")
+				}
+			}
+		}()
+	}
+	delay = time.Millisecond * 10
+	return
+}
+
+func testSlowReader(network, addr string) {
+	data := make([]byte, 16*1024*1024)
+	_, _ = rand.Read(data)
+	events := &testSlowReaderServer{network: network, addr: addr, data: data}
+	must(Serve(events, network+"://"+addr, WithTicker(true)))
+}
+
+func TestConnLogLabels(t *testing.T) {
+	testConnLogLabels("tcp", ":9991")
+}
+
+type testCaptureLogger struct {
+	sync.Mutex
+	lines []string
+}
+
+func (l *testCaptureLogger) Printf(format string, args ...interface{}) {
+	l.Lock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+	l.Unlock()
+}
+
+func (l *testCaptureLogger) find(substr string) string {
+	l.Lock()
+	defer l.Unlock()
+	for _, line := range l.lines {
+		if strings.Contains(line, substr) {
+			return line
+		}
+	}
+	return ""
+}
+
+type testConnLogLabelsServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+	logger        *testCaptureLogger
+}
+
+func (t *testConnLogLabelsServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	c.SetLogLabel("user", "gnet")
+	c.SetLogLabel("tenant", "t1")
+	// the second close fails since the connection has been closed.
+	_ = c.Close()
+	_ = c.Close()
+	return
+}
+func (t *testConnLogLabelsServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			conn, err := net.Dial(t.network, t.addr)
+			must(err)
+			defer conn.Close()
+			_, err = conn.Write([]byte("Hello World!"))
+			must(err)
+		}()
+	} else if t.logger.find("failed to") != "" {
+		action = Shutdown
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func testConnLogLabels(network, addr string) {
+	logger := new(testCaptureLogger)
+	events := &testConnLogLabelsServer{network: network, addr: addr, logger: logger}
+	must(Serve(events, network+"://"+addr, WithTicker(true), WithLogger(logger)))
+	line := logger.find("failed to")
+	if !strings.Contains(line, "conn[id=") || !strings.Contains(line, "user=gnet tenant=t1]") {
+		panic("connection-scoped log line should carry the id and labels of connection, got: " + line)
+	}
+}
+
+func TestLeveledLogger(t *testing.T) {
+	logger := &testLeveledLogger{debug: new(testCaptureLogger), info: new(testCaptureLogger), errors: new(testCaptureLogger)}
+	printf := new(testCaptureLogger)
+	events := &testConnLogLabelsServer{network: "tcp", addr: ":9991", logger: logger.errors}
+	must(Serve(events, "tcp://:9991", WithTicker(true), WithLogger(printf), WithLeveledLogger(logger)))
+	if line := logger.errors.find("failed to"); !strings.Contains(line, "user=gnet tenant=t1]") {
+		t.Fatalf("expected failure of connection logged by Errorf, got %q", line)
+	}
+	if line := logger.info.find("exits with error"); line == "" {
+		t.Fatal("expected exit of event-loops logged by Infof")
+	}
+	if len(printf.lines) != 0 {
+		t.Fatalf("expected nothing logged by Logger while LeveledLogger is set, got %q", printf.lines)
+	}
+}
+
+type testLeveledLogger struct {
+	debug, info, errors *testCaptureLogger
+}
+
+func (l *testLeveledLogger) Debugf(format string, args ...interface{}) {
+	l.debug.Printf(format, args...)
+}
+
+func (l *testLeveledLogger) Infof(format string, args ...interface{}) {
+	l.info.Printf(format, args...)
+}
+
+func (l *testLeveledLogger) Errorf(format string, args ...interface{}) {
+	l.errors.Printf(format, args...)
+}
+
+func TestScaleLoops(t *testing.T) {
+	testScaleLoops("tcp", ":9991")
+}
+
+type testScaleLoopsServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+	svr           Server
+	done          int32
+	closed        int32
+}
+
+func (t *testScaleLoopsServer) OnInitComplete(svr Server) (action Action) {
+	t.svr = svr
+	return
+}
+func (t *testScaleLoopsServer) OnClosed(c Conn, err error) (action Action) {
+	atomic.AddInt32(&t.closed, 1)
+	return
+}
+func (t *testScaleLoopsServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	out = frame
+	return
+}
+func (t *testScaleLoopsServer) echo(wg *sync.WaitGroup, stop chan struct{}) {
+	defer wg.Done()
+	conn, err := net.Dial(t.network, t.addr)
+	must(err)
+	defer conn.Close()
+	data := make([]byte, 64)
+	buf := make([]byte, len(data))
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		_, _ = rand.Read(data)
+		_, err = conn.Write(data)
+		must(err)
+		_, err = io.ReadFull(conn, buf)
+		must(err)
+		if string(data) != string(buf) {
+			panic("mismatched echo data")
+		}
+	}
+}
+func (t *testScaleLoopsServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			var wg sync.WaitGroup
+			stop := make(chan struct{})
+			spawn := func(n int) {
+				wg.Add(n)
+				for i := 0; i < n; i++ {
+					go t.echo(&wg, stop)
+				}
+			}
+			spawn(8)
+			time.Sleep(100 * time.Millisecond)
+			must(t.svr.ScaleLoops(4))
+			if n := t.svr.CountEventLoops(); n != 4 {
+				panic(fmt.Sprintf("expected 4 event-loops after scaling up, got %d", n))
+			}
+			spawn(8)
+			time.Sleep(100 * time.Millisecond)
+			if err := t.svr.ScaleLoops(1); err != ErrScaleDownNotSupported {
+				panic(fmt.Sprintf("expected ErrScaleDownNotSupported when scaling down, got %v", err))
+			}
+			if n := t.svr.CountEventLoops(); n != 4 {
+				panic(fmt.Sprintf("expected 4 event-loops to be kept after scaling down, got %d", n))
+			}
+			if err := t.svr.ScaleLoops(0); err != ErrInvalidNumEventLoop {
+				panic(fmt.Sprintf("expected ErrInvalidNumEventLoop when scaling to zero, got %v", err))
+			}
+			must(t.svr.ScaleLoops(4))
+			spawn(8)
+			time.Sleep(100 * time.Millisecond)
+			if n := t.svr.CountConnections(); n != 24 {
+				panic(fmt.Sprintf("expected 24 active connections after scaling, got %d", n))
+			}
+			if n := atomic.LoadInt32(&t.closed); n != 0 {
+				panic(fmt.Sprintf("%d connections dropped during scaling", n))
+			}
+			close(stop)
+			wg.Wait()
+			atomic.StoreInt32(&t.done, 1)
+		}()
+	} else if atomic.LoadInt32(&t.done) == 1 && t.svr.CountConnections() == 0 {
+		action = Shutdown
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func testScaleLoops(network, addr string) {
+	events := &testScaleLoopsServer{network: network, addr: addr}
+	must(Serve(events, network+"://"+addr, WithNumEventLoop(2), WithTicker(true)))
+}
+
+func TestTryWrite(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("TryWrite is not supported on Windows")
+	}
+	testTryWrite("tcp", ":9991")
+}
+
+type testTryWriteServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+	wouldBlock    bool
+	partial       bool
+}
+
+func (t *testTryWriteServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	// keep writing to the connection whose peer never reads until the socket send buffer is full.
+	data := make([]byte, 1024*1024)
+	for i := 0; i < 1024; i++ {
+		n, err := c.TryWrite(data)
+		if err == ErrWouldBlock {
+			if n != 0 {
+				panic("nothing should be written when the write would block")
+			}
+			t.wouldBlock = true
+			break
+		}
+		must(err)
+		if n < len(data) {
+			t.partial = true
+		}
+	}
+	action = Shutdown
+	return
+}
+func (t *testTryWriteServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			conn, err := net.Dial(t.network, t.addr)
+			must(err)
+			defer conn.Close()
+			_, err = conn.Write([]byte("Hello World!"))
+			must(err)
+			time.Sleep(time.Second)
+		}()
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func testTryWrite(network, addr string) {
+	events := &testTryWriteServer{network: network, addr: addr}
+	must(Serve(events, network+"://"+addr, WithTicker(true)))
+	if !events.wouldBlock {
+		panic("expected ErrWouldBlock when the socket send buffer is full")
+	}
+	if !events.partial {
+		panic("expected a partial write before the socket send buffer is full")
+	}
+}
+
+func TestWriteBuffered(t *testing.T) {
+	testWriteBuffered("tcp", ":9991")
+}
+
+type testWriteBufferedServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+	frames        int
+}
+
+func (t *testWriteBufferedServer) OnClosed(c Conn, err error) (action Action) {
+	action = Shutdown
+	return
+}
+func (t *testWriteBufferedServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	switch string(frame) {
+	case "flush\n":
+		for i := 0; i < t.frames; i++ {
+			must(c.WriteBuffered([]byte(fmt.Sprintf("frame-%d\n", i))))
+		}
+		must(c.Flush())
+	case "close\n":
+		must(c.WriteBuffered([]byte("bye\n")))
+		must(c.Close())
+	}
+	return
+}
+func (t *testWriteBufferedServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			conn, err := net.Dial(t.network, t.addr)
+			must(err)
+			defer conn.Close()
+			rd := bufio.NewReader(conn)
+			_, err = conn.Write([]byte("flush\n"))
+			must(err)
+			for i := 0; i < t.frames; i++ {
+				line, err := rd.ReadString('\n')
+				must(err)
+				if line != fmt.Sprintf("frame-%d\n", i) {
+					panic("mismatched frame: " + line)
+				}
+			}
+			_, err = conn.Write([]byte("close\n"))
+			must(err)
+			line, err := rd.ReadString('\n')
+			must(err)
+			if line != "bye\n" {
+				panic("buffered frames should be flushed before closing, got: " + line)
+			}
+			if _, err = rd.ReadByte(); err != io.EOF {
+				panic(fmt.Sprintf("expected EOF after closing, got %v", err))
+			}
+		}()
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func testWriteBuffered(network, addr string) {
+	events := &testWriteBufferedServer{network: network, addr: addr, frames: 50}
+	must(Serve(events, network+"://"+addr, WithTicker(true)))
+}
+
+func TestSetDeadline(t *testing.T) {
+	testSetDeadline("tcp", ":9991")
+}
+
+type testSetDeadlineServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+}
+
+func (t *testSetDeadlineServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	deadline := time.Now().Add(time.Second)
+	for _, set := range []func(time.Time) error{c.SetDeadline, c.SetReadDeadline, c.SetWriteDeadline} {
+		err := set(deadline)
+		if runtime.GOOS == "windows" && err != nil {
+			panic(fmt.Sprintf("failed to set deadline: %v", err))
+		}
+		if runtime.GOOS != "windows" && err != ErrUnsupportedOp {
+			panic(fmt.Sprintf("expected ErrUnsupportedOp, got %v", err))
+		}
+	}
+	action = Shutdown
+	return
+}
+func (t *testSetDeadlineServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			conn, err := net.Dial(t.network, t.addr)
+			must(err)
+			defer conn.Close()
+			_, err = conn.Write([]byte("Hello World!"))
+			must(err)
+		}()
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func testSetDeadline(network, addr string) {
+	events := &testSetDeadlineServer{network: network, addr: addr}
+	must(Serve(events, network+"://"+addr, WithTicker(true)))
+}
+
+func TestFrameDispatch(t *testing.T) {
+	testFrameDispatch("tcp", ":9991")
+}
+
+type testFrameDispatchServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+	codec         *FrameDispatchCodec
+	reacted       int32
+}
+
+func (t *testFrameDispatchServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	atomic.AddInt32(&t.reacted, 1)
+	return
+}
+func (t *testFrameDispatchServer) OnClosed(c Conn, err error) (action Action) {
+	action = Shutdown
+	return
+}
+func (t *testFrameDispatchServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			conn, err := net.Dial(t.network, t.addr)
+			must(err)
+			defer conn.Close()
+			for _, frameType := range []uint16{1, 2, 3, 1} {
+				out, _ := t.codec.Encode(nil, NewTypedFrame(frameType, []byte("gnet")))
+				_, err = conn.Write(out)
+				must(err)
+			}
+			for _, expected := range []string{"echo:gnet", "GNET", "unknown:3", "echo:gnet"} {
+				header := make([]byte, 6)
+				_, err = io.ReadFull(conn, header)
+				must(err)
+				reply := make([]byte, binary.BigEndian.Uint32(header[2:]))
+				_, err = io.ReadFull(conn, reply)
+				must(err)
+				if string(reply) != expected {
+					panic(fmt.Sprintf("frame routed to wrong handler, expected: %s, got: %s", expected, reply))
+				}
+			}
+		}()
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func testFrameDispatch(network, addr string) {
+	codec := NewFrameDispatchCodec()
+	codec.RegisterFrameHandler(1, func(c Conn, payload []byte) {
+		must(c.AsyncWrite(NewTypedFrame(1, append([]byte("echo:"), payload...))))
+	})
+	codec.RegisterFrameHandler(2, func(c Conn, payload []byte) {
+		must(c.AsyncWrite(NewTypedFrame(2, []byte(strings.ToUpper(string(payload))))))
+	})
+	codec.SetDefaultFrameHandler(func(c Conn, frameType uint16, payload []byte) {
+		must(c.AsyncWrite(NewTypedFrame(frameType, []byte(fmt.Sprintf("unknown:%d", frameType)))))
+	})
+	events := &testFrameDispatchServer{network: network, addr: addr, codec: codec}
+	must(Serve(events, network+"://"+addr, WithTicker(true), WithCodec(codec)))
+	if atomic.LoadInt32(&events.reacted) != 0 {
+		panic("dispatched frames should not be passed to React")
+	}
+}
+
+func TestTCPInfo(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("TCP_INFO is only supported on Linux")
+	}
+	t.Run("tcp", func(t *testing.T) {
+		testTCPInfo("tcp", ":9991")
+	})
+	t.Run("udp", func(t *testing.T) {
+		testTCPInfo("udp", ":9991")
+	})
+}
+
+type testTCPInfoServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+}
+
+func (t *testTCPInfoServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	info, err := c.TCPInfo()
+	if t.network == "udp" {
+		if err == nil {
+			panic("expected error when retrieving TCP_INFO of UDP connection")
+		}
+	} else {
+		must(err)
+		if info.RTT <= 0 || info.RTT > time.Second {
+			panic(fmt.Sprintf("implausible RTT over loopback: %v", info.RTT))
+		}
+		if info.SndCwnd == 0 || info.CongestionControl == "" {
+			panic(fmt.Sprintf("incomplete TCP_INFO: %+v", info))
+		}
+	}
+	action = Shutdown
+	return
+}
+func (t *testTCPInfoServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			conn, err := net.Dial(t.network, t.addr)
+			must(err)
+			defer conn.Close()
+			_, err = conn.Write([]byte("Hello World!"))
+			must(err)
+		}()
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func testTCPInfo(network, addr string) {
+	events := &testTCPInfoServer{network: network, addr: addr}
+	must(Serve(events, network+"://"+addr, WithTicker(true)))
+}
+
+func TestSetNoDelay(t *testing.T) {
+	t.Run("tcp", func(t *testing.T) {
+		testSetNoDelay("tcp", ":9991")
+	})
+	t.Run("udp", func(t *testing.T) {
+		testSetNoDelay("udp", ":9991")
+	})
+}
+
+type testSetNoDelayServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+}
+
+func (t *testSetNoDelayServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	for _, noDelay := range []bool{false, true} {
+		err := c.SetNoDelay(noDelay)
+		if t.network == "udp" && err == nil {
+			panic("expected error when setting TCP_NODELAY on UDP connection")
+		}
+		if t.network == "tcp" {
+			must(err)
+		}
+	}
+	action = Shutdown
+	return
+}
+func (t *testSetNoDelayServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			conn, err := net.Dial(t.network, t.addr)
+			must(err)
+			defer conn.Close()
+			_, err = conn.Write([]byte("Hello World!"))
+			must(err)
+		}()
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func testSetNoDelay(network, addr string) {
+	events := &testSetNoDelayServer{network: network, addr: addr}
+	must(Serve(events, network+"://"+addr, WithTicker(true)))
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	t.Run("tcp", func(t *testing.T) {
+		testGracefulShutdown("tcp", ":9991", false, time.Second*5)
+	})
+	t.Run("tcp-reuseport", func(t *testing.T) {
+		testGracefulShutdown("tcp", ":9991", true, time.Second*5)
+	})
+	t.Run("tcp-timeout", func(t *testing.T) {
+		testGracefulShutdown("tcp", ":9991", false, time.Millisecond*200)
+	})
+}
+
+type testGracefulShutdownServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+	timeout       time.Duration
+	svr           Server
+	opened        int32
+	shutdownErr   chan error
+}
+
+func (t *testGracefulShutdownServer) OnInitComplete(svr Server) (action Action) {
+	t.svr = svr
+	return
+}
+func (t *testGracefulShutdownServer) OnOpened(c Conn) (out []byte, action Action) {
+	atomic.AddInt32(&t.opened, 1)
+	return
+}
+func (t *testGracefulShutdownServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	out = frame
+	return
+}
+func (t *testGracefulShutdownServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			echo := func(conn net.Conn) error {
+				if _, err := conn.Write([]byte("ping")); err != nil {
+					return err
+				}
+				buf := make([]byte, 4)
+				_, err := io.ReadFull(conn, buf)
+				return err
+			}
+			var conns []net.Conn
+			for i := 0; i < 4; i++ {
+				conn, err := net.Dial(t.network, t.addr)
+				must(err)
+				must(echo(conn))
+				conns = append(conns, conn)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+			defer cancel()
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- t.svr.Shutdown(ctx)
+			}()
+			time.Sleep(time.Millisecond * 50)
+
+			// new connections are no longer accepted while the active ones are still being served.
+			if conn, err := net.Dial(t.network, t.addr); err == nil {
+				_ = conn.SetReadDeadline(time.Now().Add(time.Millisecond * 50))
+				if echo(conn) == nil {
+					panic("new connection should not be served during graceful shutdown")
+				}
+				_ = conn.Close()
+			}
+			for _, conn := range conns {
+				must(echo(conn))
+			}
+			if atomic.LoadInt32(&t.opened) != 4 {
+				panic("new connection should not be accepted during graceful shutdown")
+			}
+
+			if t.timeout < time.Second {
+				// keep the connections open until the server closes them forcibly.
+				t.shutdownErr <- <-errCh
+				for _, conn := range conns {
+					_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+					if _, err := conn.Read(make([]byte, 1)); err == nil {
+						panic("connection should have been closed after the context is done")
+					}
+					_ = conn.Close()
+				}
+				return
+			}
+			for _, conn := range conns {
+				_ = conn.Close()
+			}
+			t.shutdownErr <- <-errCh
+		}()
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func testGracefulShutdown(network, addr string, reusePort bool, timeout time.Duration) {
+	events := &testGracefulShutdownServer{network: network, addr: addr, timeout: timeout, shutdownErr: make(chan error, 1)}
+	must(Serve(events, network+"://"+addr, WithNumEventLoop(2), WithReusePort(reusePort), WithTicker(true)))
+	err := <-events.shutdownErr
+	if timeout < time.Second {
+		if err != context.DeadlineExceeded {
+			panic(fmt.Sprintf("expected context.DeadlineExceeded, got %v", err))
+		}
+	} else if err != nil {
+		panic(fmt.Sprintf("failed to shutdown gracefully: %v", err))
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	testIdleTimeout("tcp", ":9991", time.Millisecond*100)
+}
+
+type testIdleTimeoutServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+	closed        int32
+	idleErr       error
+	busyErr       error
+}
+
+func (t *testIdleTimeoutServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	if c.Context() == nil {
+		c.SetContext(string(frame))
+	}
+	out = frame
+	return
+}
+func (t *testIdleTimeoutServer) OnClosed(c Conn, err error) (action Action) {
+	if c.Context() == "idle" {
+		t.idleErr = err
+	} else {
+		t.busyErr = err
+	}
+	if atomic.AddInt32(&t.closed, 1) == 2 {
+		action = Shutdown
+	}
+	return
+}
+func (t *testIdleTimeoutServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		dial := func(kind string) net.Conn {
+			conn, err := net.Dial(t.network, t.addr)
+			must(err)
+			_, err = conn.Write([]byte(kind))
+			must(err)
+			_, err = io.ReadFull(conn, make([]byte, len(kind)))
+			must(err)
+			return conn
+		}
+		go func() {
+			conn := dial("idle")
+			defer conn.Close()
+			// the connection should be closed by server without sending anything.
+			_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+			if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+				panic(fmt.Sprintf("expected EOF from idle connection, got %v", err))
+			}
+		}()
+		go func() {
+			conn := dial("busy")
+			defer conn.Close()
+			for i := 0; i < 10; i++ {
+				time.Sleep(time.Millisecond * 30)
+				_, err := conn.Write([]byte("ping"))
+				must(err)
+				_, err = io.ReadFull(conn, make([]byte, 4))
+				must(err)
+			}
+		}()
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func testIdleTimeout(network, addr string, idleTimeout time.Duration) {
+	events := &testIdleTimeoutServer{network: network, addr: addr}
+	must(Serve(events, network+"://"+addr, WithIdleTimeout(idleTimeout), WithTicker(true)))
+	if events.idleErr != ErrIdleTimeout {
+		panic(fmt.Sprintf("expected ErrIdleTimeout for idle connection, got %v", events.idleErr))
+	}
+	if events.busyErr == ErrIdleTimeout {
+		panic("active connection should not be closed for idle timeout")
+	}
+}
+
+func TestMaxConnections(t *testing.T) {
+	t.Run("tcp", func(t *testing.T) {
+		testMaxConnections("tcp", ":9991", false)
+	})
+	t.Run("tcp-reuseport", func(t *testing.T) {
+		testMaxConnections("tcp", ":9991", true)
+	})
+}
+
+type testMaxConnectionsServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+	done          int32
+	rejected      chan net.Addr
+}
+
+func (t *testMaxConnectionsServer) OnOpened(c Conn) (out []byte, action Action) {
+	out = []byte("welcome")
+	return
+}
+func (t *testMaxConnectionsServer) OnConnectionRejected(addr net.Addr) {
+	t.rejected <- addr
+}
+func (t *testMaxConnectionsServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			welcome := func() (net.Conn, error) {
+				conn, err := net.Dial(t.network, t.addr)
+				must(err)
+				_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+				_, err = io.ReadFull(conn, make([]byte, len("welcome")))
+				return conn, err
+			}
+			var conns []net.Conn
+			for i := 0; i < 2; i++ {
+				conn, err := welcome()
+				must(err)
+				conns = append(conns, conn)
+			}
+			conn, err := welcome()
+			if err == nil {
+				panic("connection beyond MaxConnections should be rejected")
+			}
+			if addr := <-t.rejected; addr.String() != conn.LocalAddr().String() {
+				panic(fmt.Sprintf("expected rejected address %s, got %s", conn.LocalAddr(), addr))
+			}
+			_ = conn.Close()
+
+			// a slot is given back once a connection is closed.
+			_ = conns[0].Close()
+			for i := 0; ; i++ {
+				if conn, err = welcome(); err == nil {
+					_ = conn.Close()
+					break
+				}
+				<-t.rejected
+				if i == 10 {
+					panic("connection should be accepted after another one is closed")
+				}
+				time.Sleep(time.Millisecond * 10)
+			}
+			_ = conns[1].Close()
+			atomic.StoreInt32(&t.done, 1)
+		}()
+	} else if atomic.LoadInt32(&t.done) == 1 {
+		action = Shutdown
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func testMaxConnections(network, addr string, reusePort bool) {
+	events := &testMaxConnectionsServer{network: network, addr: addr, rejected: make(chan net.Addr, 16)}
+	must(Serve(events, network+"://"+addr, WithMaxConnections(2), WithReusePort(reusePort), WithTicker(true)))
+}
+
+func TestLoadBalancer(t *testing.T) {
+	lb := new(testLastLoopBalancer)
+	events := &testLoadBalancerServer{network: "tcp", addr: ":9991", numConns: 4}
+	must(Serve(events, events.network+"://"+events.addr, WithNumEventLoop(3), WithLoadBalancer(lb), WithTicker(true)))
+	if n := atomic.LoadInt32(&lb.picked); n != events.numConns {
+		t.Fatalf("expected load balancer to pick %d times, got %d", events.numConns, n)
+	}
+	if n := atomic.LoadInt32(&events.misplaced); n != 0 {
+		t.Fatalf("%d connections were not assigned to the event-loop picked by load balancer", n)
+	}
+}
+
+// testLastLoopBalancer assigns all connections to the last event-loop.
+type testLastLoopBalancer struct {
+	picked int32
+}
+
+func (lb *testLastLoopBalancer) Next(loops []EventLoop, remoteAddr net.Addr) EventLoop {
+	if remoteAddr == nil {
+		panic("remote address should be passed to load balancer")
+	}
+	atomic.AddInt32(&lb.picked, 1)
+	return loops[len(loops)-1]
+}
+
+type testLoadBalancerServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+	numConns      int32
+	opened        int32
+	misplaced     int32
+	svr           Server
+}
+
+func (t *testLoadBalancerServer) OnInitComplete(svr Server) (action Action) {
+	t.svr = svr
+	return
+}
+func (t *testLoadBalancerServer) OnOpened(c Conn) (out []byte, action Action) {
+	atomic.AddInt32(&t.opened, 1)
+	last := t.svr.svr.countLoops() - 1
+	t.svr.svr.subLoopGroup.iterate(func(i int, el *eventloop) bool {
+		if i != last && el.CountConnections() > 0 {
+			atomic.AddInt32(&t.misplaced, 1)
+		}
+		return true
+	})
+	return
+}
+func (t *testLoadBalancerServer) Tick() (delay time.Duration, action Action) {
+	if atomic.LoadInt32(&t.opened) == t.numConns {
+		action = Shutdown
+		return
+	}
+	if !t.action {
+		t.action = true
+		for i := int32(0); i < t.numConns; i++ {
+			go func() {
+				conn, err := net.Dial(t.network, t.addr)
+				must(err)
+				defer conn.Close()
+				time.Sleep(time.Second)
+			}()
+		}
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestStats(t *testing.T) {
+	t.Run("tcp", func(t *testing.T) {
+		testStats(t, "tcp", ":9991")
+	})
+	t.Run("udp", func(t *testing.T) {
+		testStats(t, "udp", ":9991")
+	})
+}
+
+type testStatsServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+	svr           Server
+	done          chan Stats
+	connRead      int64 // bytes read from the connection when the last frame was reacted
+	connWritten   int64 // bytes written to the connection when the last frame was reacted
+}
+
+func (t *testStatsServer) OnInitComplete(svr Server) (action Action) {
+	t.svr = svr
+	return
+}
+func (t *testStatsServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	atomic.StoreInt64(&t.connRead, c.BytesRead())
+	atomic.StoreInt64(&t.connWritten, c.BytesWritten())
+	out = frame
+	return
+}
+func (t *testStatsServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			conn, err := net.Dial(t.network, t.addr)
+			must(err)
+			defer conn.Close()
+			buf := make([]byte, 5)
+			for i := 0; i < 10; i++ {
+				_, err = conn.Write([]byte("hello"))
+				must(err)
+				_, err = io.ReadFull(conn, buf)
+				must(err)
+			}
+			t.done <- t.svr.Stats()
+		}()
+	}
+	select {
+	case stats := <-t.done:
+		t.done <- stats
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func testStats(t *testing.T, network, addr string) {
+	events := &testStatsServer{network: network, addr: addr, done: make(chan Stats, 1)}
+	must(Serve(events, network+"://"+addr, WithNumEventLoop(2), WithTicker(true)))
+	stats := <-events.done
+	if stats.BytesRead != 50 || stats.BytesWritten != 50 {
+		t.Fatalf("expected 50 bytes read and written, got %d and %d", stats.BytesRead, stats.BytesWritten)
+	}
+	if len(stats.LoopConnections) != 2 {
+		t.Fatalf("expected connection counts of 2 event-loops, got %v", stats.LoopConnections)
+	}
+	if network == "tcp" && stats.Connections != 1 {
+		t.Fatalf("expected 1 active connection, got %d", stats.Connections)
+	}
+	// Counters of a TCP connection accumulate over its lifetime, while each UDP packet comes with a new Conn.
+	connRead, connWritten := atomic.LoadInt64(&events.connRead), atomic.LoadInt64(&events.connWritten)
+	if network == "tcp" && (connRead != 50 || connWritten != 45) {
+		t.Fatalf("expected 50 bytes read from and 45 bytes written to connection, got %d and %d", connRead, connWritten)
+	}
+	if network == "udp" && (connRead != 5 || connWritten != 0) {
+		t.Fatalf("expected 5 bytes read from and 0 bytes written to connection, got %d and %d", connRead, connWritten)
+	}
+}
+
+func TestServeMulti(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix Domain Socket is not supported on Windows")
+	}
+	t.Run("tcp-unix", func(t *testing.T) {
+		testServeMulti(t, []string{"tcp://:9991", "unix://gnet1.sock"})
+	})
+	t.Run("tcp-unix-udp", func(t *testing.T) {
+		testServeMulti(t, []string{"tcp://:9991", "unix://gnet1.sock", "udp://:9992", "tcp4://:9993"})
+	})
+}
+
+type testServeMultiServer struct {
+	*EventServer
+	addrs  []string
+	action bool
+	svr    Server
+	done   chan error
+}
+
+func (t *testServeMultiServer) OnInitComplete(svr Server) (action Action) {
+	t.svr = svr
+	return
+}
+func (t *testServeMultiServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	// Echo the network of listener which the connection comes from.
+	if c.Network() != c.LocalAddr().Network() {
+		out = []byte("mismatched " + c.Network())
+		return
+	}
+	out = []byte(c.Network())
+	return
+}
+func (t *testServeMultiServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				for _, addr := range t.addrs {
+					network, address := parseAddr(addr)
+					conn, err := net.Dial(network, address)
+					if err != nil {
+						return err
+					}
+					_, err = conn.Write([]byte("ping"))
+					if err == nil {
+						buf := make([]byte, 64)
+						var n int
+						// Conn.Network is regardless of the IP version.
+						expected := strings.TrimRight(network, "46")
+						if n, err = conn.Read(buf); err == nil && string(buf[:n]) != expected {
+							err = fmt.Errorf("expected connection from %s listener, got %s", expected, buf[:n])
+						}
+					}
+					_ = conn.Close()
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func testServeMulti(t *testing.T, addrs []string) {
+	events := &testServeMultiServer{addrs: addrs, done: make(chan error, 1)}
+	must(ServeMulti(events, addrs, WithMulticore(true), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+	if len(events.svr.Addrs) != len(addrs) || events.svr.Addr != events.svr.Addrs[0] {
+		t.Fatalf("expected %d listening addresses, got %v", len(addrs), events.svr.Addrs)
+	}
+	if err := ServeMulti(events, nil); err != ErrNoAddress {
+		t.Fatalf("expected ErrNoAddress, got %v", err)
+	}
+}
+
+func TestServeEphemeralPort(t *testing.T) {
+	events := &testEphemeralPortServer{done: make(chan error, 1)}
+	must(ServeMulti(events, []string{"tcp://127.0.0.1:0", "udp://127.0.0.1:0"}, WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testEphemeralPortServer struct {
+	*EventServer
+	svr    Server
+	action bool
+	done   chan error
+}
+
+func (t *testEphemeralPortServer) OnInitComplete(svr Server) (action Action) {
+	t.svr = svr
+	return
+}
+
+func (t *testEphemeralPortServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	out = frame
+	return
+}
+
+func (t *testEphemeralPortServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				// The listening addresses are reachable with the ports assigned by the system.
+				for _, addr := range t.svr.Addrs {
+					var port int
+					switch addr := addr.(type) {
+					case *net.TCPAddr:
+						port = addr.Port
+					case *net.UDPAddr:
+						port = addr.Port
+					}
+					if port == 0 {
+						return fmt.Errorf("expected the port assigned to %s, got %v", addr.Network(), addr)
+					}
+					conn, err := net.Dial(addr.Network(), addr.String())
+					if err != nil {
+						return err
+					}
+					_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+					_, err = conn.Write([]byte("ping"))
+					reply := make([]byte, 4)
+					if err == nil {
+						_, err = io.ReadFull(conn, reply)
+					}
+					_ = conn.Close()
+					if err != nil || string(reply) != "ping" {
+						return fmt.Errorf("expected ping echoed by %v, got %q, error: %v", addr, reply, err)
+					}
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestListenError(t *testing.T) {
+	l, err := net.Listen("tcp", ":9991")
+	must(err)
+	defer l.Close()
+	err = Serve(new(EventServer), "tcp://:9991")
+	var le *ListenError
+	if !errors.As(err, &le) {
+		t.Fatalf("expected a *ListenError, got %v", err)
+	}
+	if le.Op != "listen" || le.Addr != "tcp://:9991" {
+		t.Fatalf("expected to fail in listening on %q, got %v", "tcp://:9991", le)
+	}
+	if runtime.GOOS != "windows" && !errors.Is(err, syscall.EADDRINUSE) {
+		t.Fatalf("expected %v, got %v", syscall.EADDRINUSE, err)
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	t.Run("event-loop", func(t *testing.T) {
+		testReadTimeout(t)
+	})
+	t.Run("react-pool", func(t *testing.T) {
+		testReadTimeout(t, WithReactPool(4))
+	})
+}
+
+func testReadTimeout(t *testing.T, opts ...Option) {
+	events := &testReadTimeoutServer{network: "tcp", addr: ":9991", done: make(chan error, 1)}
+	opts = append(opts, WithReadTimeout(time.Millisecond*50), WithTicker(true))
+	must(Serve(events, events.network+"://"+events.addr, opts...))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testReadTimeoutServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+	timeouts      int32
+	done          chan error
+}
+
+func (t *testReadTimeoutServer) OnReadTimeout(c Conn) (out []byte, action Action) {
+	atomic.AddInt32(&t.timeouts, 1)
+	out = []byte("keepalive")
+	return
+}
+func (t *testReadTimeoutServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial(t.network, t.addr)
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				// The read timeout keeps firing while the connection is idle.
+				time.Sleep(time.Millisecond * 300)
+				if n := atomic.LoadInt32(&t.timeouts); n < 3 || n > 7 {
+					return fmt.Errorf("expected read timeout to fire about 6 times while idle, got %d", n)
+				}
+				buf := make([]byte, len("keepalive"))
+				if _, err = io.ReadFull(conn, buf); err != nil || string(buf) != "keepalive" {
+					return fmt.Errorf("expected keepalive written on read timeout, got %q, error: %v", buf, err)
+				}
+				// It stops firing while frames keep coming.
+				before := atomic.LoadInt32(&t.timeouts)
+				for i := 0; i < 30; i++ {
+					if _, err = conn.Write([]byte("data")); err != nil {
+						return err
+					}
+					time.Sleep(time.Millisecond * 10)
+				}
+				if n := atomic.LoadInt32(&t.timeouts) - before; n > 1 {
+					return fmt.Errorf("expected read timeout not to fire while data flows, got %d", n)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestAddListener(t *testing.T) {
+	t.Run("reactor", func(t *testing.T) {
+		testAddListener(t, false)
+	})
+	t.Run("reuseport", func(t *testing.T) {
+		testAddListener(t, true)
+	})
+}
+
+type testAddListenerServer struct {
+	*EventServer
+	action bool
+	svr    Server
+	done   chan error
+}
+
+func (t *testAddListenerServer) OnInitComplete(svr Server) (action Action) {
+	t.svr = svr
+	return
+}
+
+func (t *testAddListenerServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	if string(frame) != "add" {
+		out = frame
+		return
+	}
+	// Reply with the result of adding the listener for the client to check.
+	if err := t.svr.AddListener("tcp://:9992"); err != nil {
+		out = []byte(err.Error())
+	} else {
+		out = []byte("ok")
+	}
+	return
+}
+
+func (t *testAddListenerServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				roundTrip := func(addr, msg string) (string, error) {
+					conn, err := net.Dial("tcp", addr)
+					if err != nil {
+						return "", err
+					}
+					defer conn.Close()
+					if _, err = conn.Write([]byte(msg)); err != nil {
+						return "", err
+					}
+					buf := make([]byte, 64)
+					n, err := conn.Read(buf)
+					return string(buf[:n]), err
+				}
+				if resp, err := roundTrip(":9991", "add"); err != nil || resp != "ok" {
+					return fmt.Errorf("failed to add listener, response: %q, error: %v", resp, err)
+				}
+				if resp, err := roundTrip(":9992", "ping"); err != nil || resp != "ping" {
+					return fmt.Errorf("expected echo from the added listener, response: %q, error: %v", resp, err)
+				}
+				if resp, err := roundTrip(":9991", "add"); err != nil || resp != ErrAlreadyListening.Error() {
+					return fmt.Errorf("expected ErrAlreadyListening, response: %q, error: %v", resp, err)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func testAddListener(t *testing.T, reuseport bool) {
+	events := &testAddListenerServer{done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithMulticore(true), WithReusePort(reuseport), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := net.Dial("tcp", ":9992"); err == nil {
+		t.Fatal("expected the added listener to be closed on shutdown")
+	}
+}
+
+func TestMulticast(t *testing.T) {
+	events := &testMulticastServer{done: make(chan error, 1)}
+	must(Serve(events, "udp://239.1.2.3:9991", WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testMulticastServer struct {
+	*EventServer
+	action bool
+	done   chan error
+}
+
+func (t *testMulticastServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	// Join or leave another group on demand, and echo the datagrams sent to any of the groups.
+	if string(frame) == "join" {
+		if err := c.JoinGroup(net.IPv4(127, 0, 0, 1)); err != ErrNotMulticast {
+			out = []byte(fmt.Sprintf("expected ErrNotMulticast, got %v", err))
+		} else if err = c.JoinGroup(net.IPv4(239, 1, 2, 4)); err != nil {
+			out = []byte(err.Error())
+		} else {
+			out = []byte("ok")
+		}
+		return
+	}
+	if string(frame) == "leave" {
+		if err := c.LeaveGroup(net.IPv4(239, 1, 2, 4)); err != nil {
+			out = []byte(err.Error())
+		} else {
+			out = []byte("ok")
+		}
+		return
+	}
+	out = frame
+	return
+}
+
+func (t *testMulticastServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				// The replies come from the unicast address of the server, so don't connect the client.
+				client, err := net.ListenUDP("udp", nil)
+				if err != nil {
+					return err
+				}
+				defer client.Close()
+				roundTrip := func(group, msg string) (string, error) {
+					addr, err := net.ResolveUDPAddr("udp", group)
+					if err != nil {
+						return "", err
+					}
+					if _, err = client.WriteTo([]byte(msg), addr); err != nil {
+						return "", err
+					}
+					_ = client.SetReadDeadline(time.Now().Add(time.Second))
+					buf := make([]byte, 64)
+					n, _, err := client.ReadFrom(buf)
+					return string(buf[:n]), err
+				}
+				if resp, err := roundTrip("239.1.2.3:9991", "join"); err != nil || resp != "ok" {
+					return fmt.Errorf("failed to join group, response: %q, error: %v", resp, err)
+				}
+				if resp, err := roundTrip("239.1.2.4:9991", "ping"); err != nil || resp != "ping" {
+					return fmt.Errorf("expected echo from the joined group, response: %q, error: %v", resp, err)
+				}
+				if resp, err := roundTrip("239.1.2.3:9991", "leave"); err != nil || resp != "ok" {
+					return fmt.Errorf("failed to leave group, response: %q, error: %v", resp, err)
+				}
+				if resp, err := roundTrip("239.1.2.4:9991", "ping"); err == nil {
+					return fmt.Errorf("expected no echo from the left group, got %q", resp)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestRemoteAddrString(t *testing.T) {
+	addrs := []string{"tcp://:9991", "udp://:9992"}
+	if runtime.GOOS != "windows" {
+		addrs = append(addrs, "unix://gnet1.sock")
+	}
+	events := &testRemoteAddrStringServer{addrs: addrs, done: make(chan error, 1)}
+	must(ServeMulti(events, addrs, WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testRemoteAddrStringServer struct {
+	*EventServer
+	addrs  []string
+	action bool
+	done   chan error
+}
+
+func (t *testRemoteAddrStringServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	s := c.RemoteAddrString()
+	if expected := c.RemoteAddr().String(); s != expected || c.RemoteAddrString() != s {
+		out = []byte(fmt.Sprintf("mismatched remote address, expected: %q, got: %q", expected, s))
+		return
+	}
+	out = []byte("addr:" + s)
+	return
+}
+
+func (t *testRemoteAddrStringServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				for _, addr := range t.addrs {
+					network, address := parseAddr(addr)
+					conn, err := net.Dial(network, address)
+					if err != nil {
+						return err
+					}
+					// Send twice to get the cached string of the same TCP and unix connection.
+					for i := 0; i < 2 && err == nil; i++ {
+						if _, err = conn.Write([]byte("ping")); err != nil {
+							break
+						}
+						buf := make([]byte, 128)
+						var n int
+						if n, err = conn.Read(buf); err == nil && string(buf[:n]) != "addr:"+conn.LocalAddr().String() {
+							err = fmt.Errorf("unexpected remote address of %s connection: %s", network, buf[:n])
+						}
+					}
+					_ = conn.Close()
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestUDPConnected(t *testing.T) {
+	events := &testUDPConnectedServer{done: make(chan error, 1), closed: make(chan error, 4)}
+	must(Serve(events, "udp://:9991", WithMulticore(true), WithUDPConnected(true),
+		WithIdleTimeout(time.Millisecond*200), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testUDPConnectedServer struct {
+	*EventServer
+	action bool
+	opened int32
+	done   chan error
+	closed chan error
+}
+
+func (t *testUDPConnectedServer) OnOpened(c Conn) (out []byte, action Action) {
+	atomic.AddInt32(&t.opened, 1)
+	c.SetContext(0)
+	return
+}
+
+func (t *testUDPConnectedServer) OnClosed(c Conn, err error) (action Action) {
+	t.closed <- err
+	return
+}
+
+func (t *testUDPConnectedServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	// Reply with the number of datagrams received from the peer asynchronously.
+	n := c.Context().(int) + 1
+	c.SetContext(n)
+	go func() {
+		_ = c.AsyncWrite([]byte(strconv.Itoa(n)))
+	}()
+	return
+}
+
+func (t *testUDPConnectedServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				var clients []net.Conn
+				for i := 0; i < 2; i++ {
+					client, err := net.Dial("udp", ":9991")
+					if err != nil {
+						return err
+					}
+					defer client.Close()
+					clients = append(clients, client)
+				}
+				roundTrip := func(client net.Conn, expected string) error {
+					if _, err := client.Write([]byte("ping")); err != nil {
+						return err
+					}
+					_ = client.SetReadDeadline(time.Now().Add(time.Second))
+					buf := make([]byte, 64)
+					n, err := client.Read(buf)
+					if err == nil && string(buf[:n]) != expected {
+						err = fmt.Errorf("expected reply %q, got %q", expected, buf[:n])
+					}
+					return err
+				}
+				for i := 1; i <= 3; i++ {
+					for _, client := range clients {
+						if err := roundTrip(client, strconv.Itoa(i)); err != nil {
+							return err
+						}
+					}
+				}
+				if opened := atomic.LoadInt32(&t.opened); opened != 2 {
+					return fmt.Errorf("expected a connection per peer, opened %d", opened)
+				}
+				for range clients {
+					select {
+					case err := <-t.closed:
+						if err != ErrIdleTimeout {
+							return fmt.Errorf("expected ErrIdleTimeout, got %v", err)
+						}
+					case <-time.After(time.Second):
+						return errors.New("idle connections were not reaped")
+					}
+				}
+				// A new connection is opened for the peer whose connection was reaped.
+				return roundTrip(clients[0], "1")
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+// selfSignedTLSConfig returns the TLS config of a self-signed certificate for localhost.
+func selfSignedTLSConfig() (*tls.Config, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(crand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+func TestTLS(t *testing.T) {
+	config, err := selfSignedTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := &testTLSServer{done: make(chan error, 1), closed: make(chan error, 2)}
+	must(Serve(events, "tcp://:9991", WithTLSConfig(config), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testTLSServer struct {
+	*EventServer
+	action bool
+	done   chan error
+	closed chan error
+}
+
+func (t *testTLSServer) OnOpened(c Conn) (out []byte, action Action) {
+	c.SetContext(true)
+	out = []byte("welcome")
+	return
+}
+
+func (t *testTLSServer) OnClosed(c Conn, err error) (action Action) {
+	t.closed <- err
+	return
+}
+
+func (t *testTLSServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	if c.Context() == nil {
+		out = []byte("reacted before handshake")
+		return
+	}
+	out = frame
+	return
+}
+
+func (t *testTLSServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := tls.Dial("tcp", "localhost:9991", &tls.Config{InsecureSkipVerify: true})
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				welcome := make([]byte, len("welcome"))
+				if _, err = io.ReadFull(conn, welcome); err != nil || string(welcome) != "welcome" {
+					return fmt.Errorf("expected welcome, got %q, error: %v", welcome, err)
+				}
+				// Large enough to span multiple TLS records and reads.
+				data := make([]byte, 1<<18)
+				rand.Read(data)
+				go func() {
+					_, _ = conn.Write(data)
+				}()
+				echo := make([]byte, len(data))
+				if _, err = io.ReadFull(conn, echo); err != nil {
+					return err
+				}
+				if !bytes.Equal(echo, data) {
+					return errors.New("mismatched echo over TLS")
+				}
+
+				// A client speaking plaintext fails the handshake.
+				plain, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer plain.Close()
+				if _, err = plain.Write([]byte("GET / HTTP/1.1\r\n\r\n")); err != nil {
+					return err
+				}
+				select {
+				case err = <-t.closed:
+					if err == nil {
+						return errors.New("expected the error of handshake")
+					}
+				case <-time.After(time.Second):
+					return errors.New("connection failed in handshake was not closed")
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestIncompletePacket(t *testing.T) {
+	events := &testIncompletePacketServer{done: make(chan error, 1), closed: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithCodec(NewVarintLengthFrameCodec(16)), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testIncompletePacketServer struct {
+	*EventServer
+	action bool
+	done   chan error
+	closed chan error
+}
+
+func (t *testIncompletePacketServer) OnClosed(c Conn, err error) (action Action) {
+	t.closed <- err
+	return
+}
+
+func (t *testIncompletePacketServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	out = frame
+	return
+}
+
+func (t *testIncompletePacketServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				// A partial frame is kept buffered until the rest of it arrives.
+				if _, err = conn.Write([]byte{5, 'h', 'e'}); err != nil {
+					return err
+				}
+				time.Sleep(time.Millisecond * 100)
+				if _, err = conn.Write([]byte("llo")); err != nil {
+					return err
+				}
+				echo := make([]byte, 6)
+				if _, err = io.ReadFull(conn, echo); err != nil || string(echo[1:]) != "hello" {
+					return fmt.Errorf("expected echo of hello, got %q, error: %v", echo, err)
+				}
+				// A frame that can't be decoded closes the connection with the error of codec.
+				if _, err = conn.Write([]byte{100}); err != nil {
+					return err
+				}
+				select {
+				case err = <-t.closed:
+					if !errors.Is(err, ErrFrameTooLarge) {
+						return fmt.Errorf("expected ErrFrameTooLarge, got %v", err)
+					}
+				case <-time.After(time.Second):
+					return errors.New("connection with malformed frame was not closed")
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestSetCodec(t *testing.T) {
+	events := &testSetCodecServer{
+		done:     make(chan error, 1),
+		opened:   make(chan Conn, 1),
+		switched: make(chan error, 1),
+		streaming: NewStreamingLengthFieldBasedFrameCodec(
+			EncoderConfig{ByteOrder: binary.BigEndian, LengthFieldLength: 1},
+			DecoderConfig{ByteOrder: binary.BigEndian, LengthFieldLength: 1, InitialBytesToStrip: 1},
+		),
+	}
+	must(Serve(events, "tcp://:9991", WithCodec(&LineBasedFrameCodec{}), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testSetCodecServer struct {
+	*EventServer
+	action    bool
+	streaming *StreamingLengthFieldBasedFrameCodec
+	done      chan error
+	opened    chan Conn
+	switched  chan error
+}
+
+func (t *testSetCodecServer) OnOpened(c Conn) (out []byte, action Action) {
+	t.opened <- c
+	return
+}
+
+func (t *testSetCodecServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	switch string(frame) {
+	case "":
+		// Woken up in the middle of a frame of the streaming codec.
+		t.switched <- c.SetCodec(&LineBasedFrameCodec{})
+	case "upgrade":
+		t.switched <- c.SetCodec(t.streaming)
+		out = []byte("ok")
+	case "line":
+		t.switched <- c.SetCodec(&LineBasedFrameCodec{})
+		out = frame
+	default:
+		out = frame
+	}
+	return
+}
+
+func (t *testSetCodecServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				c := <-t.opened
+				// The frame pipelined after the upgrade is decoded by the new codec, so is the response encoded.
+				if _, err = conn.Write([]byte("upgrade\n\x03abc")); err != nil {
+					return err
+				}
+				if err = <-t.switched; err != nil {
+					return fmt.Errorf("expected codec switched at frame boundary, got %v", err)
+				}
+				reply := make([]byte, 7)
+				if _, err = io.ReadFull(conn, reply); err != nil || string(reply) != "\x02ok\x03abc" {
+					return fmt.Errorf("expected reply encoded by new codec, got %q, error: %v", reply, err)
+				}
+				// The codec can't be switched while the streaming codec waits for the payload of a frame.
+				if _, err = conn.Write([]byte("\x04li")); err != nil {
+					return err
+				}
+				time.Sleep(time.Millisecond * 100)
+				if err = c.Wake(); err != nil {
+					return err
+				}
+				if err = <-t.switched; !errors.Is(err, ErrPartialFrame) {
+					return fmt.Errorf("expected ErrPartialFrame, got %v", err)
+				}
+				// Once the frame is complete, the codec is switched back.
+				if _, err = conn.Write([]byte("ne")); err != nil {
+					return err
+				}
+				if err = <-t.switched; err != nil {
+					return fmt.Errorf("expected codec switched after the frame, got %v", err)
+				}
+				if _, err = conn.Write([]byte("bye\n")); err != nil {
+					return err
+				}
+				reply = make([]byte, 9)
+				if _, err = io.ReadFull(conn, reply); err != nil || string(reply) != "line\nbye\n" {
+					return fmt.Errorf("expected reply encoded by line codec, got %q, error: %v", reply, err)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+var errConnOptionFailed = errors.New("connection option failed")
+
+func TestSniffingCodec(t *testing.T) {
+	sniff := func(head []byte) (ICodec, error) {
+		switch {
+		case len(head) > 0 && head[0] == '+':
+			return &LineBasedFrameCodec{}, nil
+		case bytes.HasPrefix(head, []byte("GET ")):
+			return NewHTTPCodec(0), nil
+		case len(head) < 4:
+			return nil, nil
+		}
+		return nil, ErrUnknownProtocol
+	}
+	events := &testSniffingCodecServer{done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithCodec(NewSniffingCodec(sniff, 4)), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testSniffingCodecServer struct {
+	*EventServer
+	action bool
+	done   chan error
+}
+
+func (t *testSniffingCodecServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	if bytes.HasPrefix(frame, []byte("GET ")) {
+		out = []byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n")
+		return
+	}
+	out = frame
+	return
+}
+
+func (t *testSniffingCodecServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				exchange := func(reqs []string, replyLen int) (string, error) {
+					conn, err := net.Dial("tcp", ":9991")
+					if err != nil {
+						return "", err
+					}
+					defer conn.Close()
+					for _, req := range reqs {
+						if _, err = conn.Write([]byte(req)); err != nil {
+							return "", err
+						}
+						time.Sleep(time.Millisecond * 50)
+					}
+					reply := make([]byte, replyLen)
+					n, err := io.ReadFull(conn, reply)
+					return string(reply[:n]), err
+				}
+				// The bytes sniffed are decoded by the codec chosen, even if they arrive piece by piece.
+				reply, err := exchange([]string{"GE", "T / HTTP/1.1\r\nHost: gnet\r\n\r\n"}, 38)
+				if err != nil || reply != "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n" {
+					return fmt.Errorf("expected HTTP response, got %q, error: %v", reply, err)
+				}
+				if reply, err = exchange([]string{"+hello\n+gnet\n"}, 13); err != nil || reply != "+hello\n+gnet\n" {
+					return fmt.Errorf("expected lines echoed, got %q, error: %v", reply, err)
+				}
+				if reply, err = exchange([]string{"hello"}, 1); err != io.EOF {
+					return fmt.Errorf("expected connection of unknown protocol closed, got %q, error: %v", reply, err)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestOnOpen(t *testing.T) {
+	events := &testOnOpenServer{done: make(chan error, 1), closed: make(chan error, 1)}
+	must(ServeMulti(events, []string{"tcp://:9991", "tcp://:9992", "tcp://:9993"}, WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testOnOpenServer struct {
+	*EventServer
+	action bool
+	done   chan error
+	closed chan error
+}
+
+func (t *testOnOpenServer) OnOpen(c Conn) (ctx interface{}, codec ICodec, opts []ConnOption) {
+	opts = []ConnOption{WithConnNoDelay(true)}
+	switch c.LocalAddr().(*net.TCPAddr).Port {
+	case 9991:
+		return "line", &LineBasedFrameCodec{}, opts
+	case 9992:
+		return "delimiter", NewDelimiterBasedFrameCodec(';'), opts
+	default:
+		return nil, nil, append(opts, func(c Conn) error { return errConnOptionFailed })
+	}
+}
+
+func (t *testOnOpenServer) OnOpened(c Conn) (out []byte, action Action) {
+	if c.Context() == nil {
+		t.closed <- errors.New("connection opened without being set up")
+	}
+	return
+}
+
+func (t *testOnOpenServer) OnClosed(c Conn, err error) (action Action) {
+	if c.Context() == nil {
+		t.closed <- err
+	}
+	return
+}
+
+func (t *testOnOpenServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	out = append([]byte(c.Context().(string)+":"), frame...)
+	return
+}
+
+func (t *testOnOpenServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				for addr, expected := range map[string]string{":9991": "line:a;b\n", ":9992": "delimiter:a;"} {
+					conn, err := net.Dial("tcp", addr)
+					if err != nil {
+						return err
+					}
+					// The first frame is decoded by the codec assigned to the connection of the listener.
+					if _, err = conn.Write([]byte("a;b\n")); err != nil {
+						conn.Close()
+						return err
+					}
+					reply := make([]byte, len(expected))
+					_, err = io.ReadFull(conn, reply)
+					conn.Close()
+					if err != nil || string(reply) != expected {
+						return fmt.Errorf("expected %q from %s, got %q, error: %v", expected, addr, reply, err)
+					}
+				}
+				conn, err := net.Dial("tcp", ":9993")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				select {
+				case err = <-t.closed:
+					if err != errConnOptionFailed {
+						return fmt.Errorf("expected connection closed with error of option, got %v", err)
+					}
+				case <-time.After(time.Second):
+					return errors.New("connection with failed option was not closed")
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestConnRateLimit(t *testing.T) {
+	events := &testConnRateLimitServer{done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithConnRateLimit(4000, 1000), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testConnRateLimitServer struct {
+	*EventServer
+	action bool
+	opened int
+	done   chan error
+}
+
+func (t *testConnRateLimitServer) OnOpened(c Conn) (out []byte, action Action) {
+	if t.opened++; t.opened == 2 {
+		// Lift the limit of the second connection.
+		c.RateLimiter().SetLimit(0, 0)
+	}
+	return
+}
+
+func (t *testConnRateLimitServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	out = frame
+	return
+}
+
+func (t *testConnRateLimitServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				// echo sends 4000 bytes in 4 rounds and returns how long it takes to get them echoed.
+				echo := func() (time.Duration, error) {
+					conn, err := net.Dial("tcp", ":9991")
+					if err != nil {
+						return 0, err
+					}
+					defer conn.Close()
+					start := time.Now()
+					data := bytes.Repeat([]byte("x"), 1000)
+					reply := make([]byte, len(data))
+					for i := 0; i < 4; i++ {
+						if _, err = conn.Write(data); err != nil {
+							return 0, err
+						}
+						if _, err = io.ReadFull(conn, reply); err != nil {
+							return 0, err
+						}
+					}
+					return time.Since(start), nil
+				}
+				// 1000 bytes of the burst are read at once, the other 3000 bytes are throttled at 4000 bytes/s,
+				// which makes the last 1000 bytes wait for at least 500ms.
+				elapsed, err := echo()
+				if err != nil {
+					return err
+				}
+				if elapsed < time.Millisecond*400 {
+					return fmt.Errorf("expected reading to be throttled, all data echoed in %v", elapsed)
+				}
+				if elapsed, err = echo(); err != nil {
+					return err
+				}
+				if elapsed >= time.Millisecond*400 {
+					return fmt.Errorf("expected no throttling once the limit is lifted, all data echoed in %v", elapsed)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestFrameQuota(t *testing.T) {
+	events := &testFrameQuotaServer{done: make(chan error, 1), closed: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithCodec(&LineBasedFrameCodec{}), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testFrameQuotaServer struct {
+	*EventServer
+	action bool
+	done   chan error
+	closed chan error
+}
+
+func (t *testFrameQuotaServer) OnOpen(c Conn) (ctx interface{}, codec ICodec, opts []ConnOption) {
+	return nil, nil, []ConnOption{WithConnFrameQuota(3)}
+}
+
+func (t *testFrameQuotaServer) OnClosed(c Conn, err error) (action Action) {
+	t.closed <- err
+	return
+}
+
+func (t *testFrameQuotaServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	out = frame
+	return
+}
+
+func (t *testFrameQuotaServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for i := 0; i < 3; i++ {
+					line := "frame" + strconv.Itoa(i) + "\n"
+					if _, err = conn.Write([]byte(line)); err != nil {
+						return err
+					}
+					if echo, err := reader.ReadString('\n'); err != nil || echo != line {
+						return fmt.Errorf("expected echo of %q within quota, got %q, error: %v", line, echo, err)
+					}
+				}
+				// The frame beyond the quota closes the connection.
+				if _, err = conn.Write([]byte("frame3\n")); err != nil {
+					return err
+				}
+				select {
+				case err = <-t.closed:
+					if err != ErrQuotaExceeded {
+						return fmt.Errorf("expected ErrQuotaExceeded, got %v", err)
+					}
+				case <-time.After(time.Second):
+					return errors.New("connection exceeding frame quota was not closed")
+				}
+				if _, err = reader.ReadByte(); err != io.EOF {
+					return fmt.Errorf("expected EOF after the frame beyond quota, got %v", err)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestWritev(t *testing.T) {
+	codec := NewLengthFieldBasedFrameCodec(
+		EncoderConfig{ByteOrder: binary.BigEndian, LengthFieldLength: 4},
+		DecoderConfig{ByteOrder: binary.BigEndian, LengthFieldLength: 4, InitialBytesToStrip: 4},
+	)
+	events := &testWritevServer{codec: codec, done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithCodec(codec), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testWritevServer struct {
+	*EventServer
+	action bool
+	codec  *LengthFieldBasedFrameCodec
+	done   chan error
+}
+
+func (t *testWritevServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	header, err := t.codec.EncodeHeader(frame)
+	if err == nil {
+		// LengthFieldBasedFrameCodec decodes a frame into a copy of the inbound data, which outlives React.
+		err = c.Writev(header, frame)
+	}
+	if err != nil {
+		action = Close
+	}
+	return
+}
+
+func (t *testWritevServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				// Frames large enough to overflow the socket buffer are partially written by writev.
+				for _, size := range []int{16, 8 * 1024 * 1024} {
+					payload := make([]byte, size)
+					rand.Read(payload)
+					frame := make([]byte, 4+size)
+					binary.BigEndian.PutUint32(frame, uint32(size))
+					copy(frame[4:], payload)
+					go func() {
+						_, _ = conn.Write(frame)
+					}()
+					echo := make([]byte, len(frame))
+					if _, err = io.ReadFull(conn, echo); err != nil {
+						return err
+					}
+					if !bytes.Equal(echo, frame) {
+						return fmt.Errorf("mismatched echo of frame with %d bytes of payload", size)
+					}
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestUDPBatching(t *testing.T) {
+	events := &testUDPBatchingServer{done: make(chan error, 1)}
+	must(Serve(events, "udp://:9991", WithUDPBatching(true), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testUDPBatchingServer struct {
+	*EventServer
+	action bool
+	done   chan error
+}
+
+func (t *testUDPBatchingServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	buf := make([]byte, 1)
+	for i := 0; i < 5; i++ {
+		// The datagrams are copied when being queued, so the buffer can be reused.
+		buf[0] = byte('0' + i)
+		_ = c.SendTo(buf)
+	}
+	out = []byte("end")
+	return
+}
+
+func (t *testUDPBatchingServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("udp", "127.0.0.1:9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				if _, err = conn.Write([]byte("go")); err != nil {
+					return err
+				}
+				_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+				buf := make([]byte, 16)
+				for _, expected := range []string{"0", "1", "2", "3", "4", "end"} {
+					n, err := conn.Read(buf)
+					if err != nil || string(buf[:n]) != expected {
+						return fmt.Errorf("expected datagram %q, got %q, error: %v", expected, buf[:n], err)
+					}
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+// countingCodec counts the frames encoded by LineBasedFrameCodec.
+type countingCodec struct {
+	LineBasedFrameCodec
+	encoded int32
+}
+
+func (cc *countingCodec) Encode(c Conn, buf []byte) ([]byte, error) {
+	atomic.AddInt32(&cc.encoded, 1)
+	return cc.LineBasedFrameCodec.Encode(c, buf)
+}
+
+func TestBroadcast(t *testing.T) {
+	events := &testBroadcastServer{codec: new(countingCodec), subscribed: make(chan Conn, 3), done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithCodec(events.codec), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testBroadcastServer struct {
+	*EventServer
+	svr        Server
+	action     bool
+	codec      *countingCodec
+	subscribed chan Conn
+	done       chan error
+}
+
+func (t *testBroadcastServer) OnInitComplete(svr Server) (action Action) {
+	t.svr = svr
+	return
+}
+
+func (t *testBroadcastServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	t.subscribed <- c
+	return
+}
+
+func (t *testBroadcastServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				var (
+					subscribers []*bufio.Reader
+					conns       []Conn
+				)
+				for i := 0; i < 3; i++ {
+					conn, err := net.Dial("tcp", ":9991")
+					if err != nil {
+						return err
+					}
+					defer conn.Close()
+					if _, err = conn.Write([]byte("subscribe\n")); err != nil {
+						return err
+					}
+					subscribers = append(subscribers, bufio.NewReader(conn))
+					conns = append(conns, <-t.subscribed)
+				}
+				expect := func(msg string, encoded int32) error {
+					for i, r := range subscribers {
+						if line, err := r.ReadString('\n'); err != nil || line != msg+"\n" {
+							return fmt.Errorf("expected subscriber %d to get %q, got %q, error: %v", i, msg, line, err)
+						}
+					}
+					if n := atomic.LoadInt32(&t.codec.encoded); n != encoded {
+						return fmt.Errorf("expected %d frames encoded, got %d", encoded, n)
+					}
+					return nil
+				}
+				// The message is encoded once for all the connections of the same codec.
+				if err := t.svr.Broadcast(conns, []byte("news")); err != nil {
+					return err
+				}
+				if err := expect("news", 1); err != nil {
+					return err
+				}
+				if err := t.svr.BroadcastAll([]byte("all")); err != nil {
+					return err
+				}
+				return expect("all", 2)
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestPerLoopTicker(t *testing.T) {
+	events := &testPerLoopTickerServer{ticks: make(map[int][]time.Duration)}
+	must(Serve(events, "tcp://:9991", WithNumEventLoop(2), WithPerLoopTicker(true)))
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	if len(events.ticks) != 2 {
+		t.Fatalf("expected ticks on 2 event-loops, got %d", len(events.ticks))
+	}
+	for idx, elapsed := range events.ticks {
+		// The first tick measures the time since the event-loop started.
+		for _, d := range elapsed[1:] {
+			if d < perLoopTickDelay {
+				t.Fatalf("expected the ticks of event-loop %d to be at least %v apart, got %v", idx, perLoopTickDelay, d)
+			}
+		}
+	}
+}
+
+const perLoopTickDelay = time.Millisecond * 20
+
+type testPerLoopTickerServer struct {
+	*EventServer
+	mu    sync.Mutex
+	ticks map[int][]time.Duration
+}
+
+func (t *testPerLoopTickerServer) OnLoopTick(loopIdx int, elapsed time.Duration) (delay time.Duration, action Action) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ticks[loopIdx] = append(t.ticks[loopIdx], elapsed)
+	if len(t.ticks) == 2 && len(t.ticks[0]) >= 3 && len(t.ticks[1]) >= 3 {
+		action = Shutdown
+	}
+	delay = perLoopTickDelay
+	return
+}
+
+func TestElapsedTicker(t *testing.T) {
+	events := &testElapsedTickerServer{}
+	must(Serve(events, "tcp://:9991", WithTicker(true)))
+	if events.ticks != 0 {
+		t.Fatalf("expected Tick not to fire for an ElapsedTicker, got %d ticks", events.ticks)
+	}
+	if len(events.elapsed) != 3 {
+		t.Fatalf("expected 3 ticks with elapsed time, got %d", len(events.elapsed))
+	}
+	// The first tick measures the time since the ticker started.
+	for _, d := range events.elapsed[1:] {
+		if d < perLoopTickDelay {
+			t.Fatalf("expected the ticks to be at least %v apart, got %v", perLoopTickDelay, d)
+		}
+	}
+}
+
+type testElapsedTickerServer struct {
+	*EventServer
+	ticks   int
+	elapsed []time.Duration
+}
+
+func (t *testElapsedTickerServer) Tick() (delay time.Duration, action Action) {
+	t.ticks++
+	action = Shutdown
+	return
+}
+
+func (t *testElapsedTickerServer) OnTick(elapsed time.Duration) (delay time.Duration, action Action) {
+	t.elapsed = append(t.elapsed, elapsed)
+	if len(t.elapsed) == 3 {
+		action = Shutdown
+	}
+	delay = perLoopTickDelay
+	return
+}
+
+func TestReady(t *testing.T) {
+	t.Run("tcp", func(t *testing.T) {
+		testReady(t, "tcp", ":9991", false)
+	})
+	t.Run("tcp-multicore", func(t *testing.T) {
+		testReady(t, "tcp", ":9991", true)
+	})
+	t.Run("tcp-reuseport", func(t *testing.T) {
+		testReady(t, "tcp", ":9991", true, WithReusePort(true))
+	})
+}
+
+func testReady(t *testing.T, network, addr string, multicore bool, opts ...Option) {
+	events := &testReadyServer{network: network, addr: addr, done: make(chan error, 1)}
+	must(Serve(events, network+"://"+addr, append(opts, WithMulticore(multicore))...))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+	if events.svr.Healthy() {
+		t.Fatal("expected the server to be unhealthy after being shut down")
+	}
+}
+
+type testReadyServer struct {
+	*EventServer
+	network, addr string
+	svr           Server
+	done          chan error
+}
+
+func (t *testReadyServer) OnInitComplete(svr Server) (action Action) {
+	t.svr = svr
+	if svr.Healthy() {
+		t.done <- errors.New("expected the server to be unhealthy before being ready")
+		return Shutdown
+	}
+	go func() {
+		err := t.probe()
+		if e := svr.Shutdown(context.Background()); err == nil {
+			err = e
+		}
+		t.done <- err
+	}()
+	return
+}
+
+// probe dials the server as soon as it's ready, which must succeed without retrying.
+func (t *testReadyServer) probe() error {
+	select {
+	case <-t.svr.Ready():
+	case <-time.After(5 * time.Second):
+		return errors.New("server is not ready in time")
+	}
+	if !t.svr.Healthy() {
+		return errors.New("expected the server to be healthy once it's ready")
+	}
+	conn, err := net.Dial(t.network, t.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte("ping")); err != nil {
+		return err
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 4)
+	if _, err = io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if string(buf) != "ping" {
+		return fmt.Errorf("expected the echo of %q, got %q", "ping", buf)
+	}
+	return nil
+}
+
+func (t *testReadyServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	out = frame
+	return
+}
+
+func TestZeroCopyDebug(t *testing.T) {
+	events := &testZeroCopyDebugServer{done: make(chan error, 1)}
+	codec := NewZeroCopyLengthFieldBasedFrameCodec(
+		EncoderConfig{ByteOrder: binary.BigEndian, LengthFieldLength: 4},
+		DecoderConfig{ByteOrder: binary.BigEndian, LengthFieldLength: 4, InitialBytesToStrip: 4},
+	)
+	must(Serve(events, "tcp://:9991", WithCodec(codec), WithZeroCopyDebug(true), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testZeroCopyDebugServer struct {
+	*EventServer
+	action   bool
+	retained []byte
+	done     chan error
+}
+
+func (t *testZeroCopyDebugServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	if frame != nil {
+		// Retain the frame past the return of React on purpose, which is a misuse of ZeroCopyCodec,
+		// and check it in the React fired by Wake, before the buffer is reused by another read.
+		t.retained = frame
+		must(c.Wake())
+		return
+	}
+	if !bytes.Equal(t.retained, bytes.Repeat([]byte{framePoison}, len("retained"))) {
+		t.done <- fmt.Errorf("expected the released frame to be poisoned, got %q", t.retained)
+	} else {
+		t.done <- nil
+	}
+	action = Shutdown
+	return
+}
+
+func (t *testZeroCopyDebugServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			conn, err := net.Dial("tcp", ":9991")
+			must(err)
+			defer conn.Close()
+			frame := make([]byte, 4+len("retained"))
+			binary.BigEndian.PutUint32(frame, uint32(len("retained")))
+			copy(frame[4:], "retained")
+			_, err = conn.Write(frame)
+			must(err)
+			time.Sleep(100 * time.Millisecond)
+		}()
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestAbstractUnixSocket(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("abstract Unix domain sockets are only supported on Linux")
+	}
+	const addr = "@gnet-abstract-socket"
+	// A file with the same name as the abstract socket must be left alone.
+	f, err := os.Create(addr)
+	must(err)
+	must(f.Close())
+	defer os.Remove(addr)
+	events := &testAbstractUnixSocketServer{done: make(chan error, 1)}
+	must(Serve(events, "unix://"+addr, WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(addr); err != nil {
+		t.Fatalf("expected the file named after the abstract socket to be left alone, got %v", err)
+	}
+}
+
+type testAbstractUnixSocketServer struct {
+	*EventServer
+	action bool
+	done   chan error
+}
+
+func (t *testAbstractUnixSocketServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	out = frame
+	return
+}
+
+func (t *testAbstractUnixSocketServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("unix", "@gnet-abstract-socket")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				if _, err = conn.Write([]byte("ping")); err != nil {
+					return err
+				}
+				buf := make([]byte, 4)
+				if _, err = io.ReadFull(conn, buf); err != nil {
+					return err
+				}
+				if string(buf) != "ping" {
+					return fmt.Errorf("expected the echo of %q, got %q", "ping", buf)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestProxyProtocol(t *testing.T) {
+	events := &testProxyProtocolServer{closed: make(chan error, 1), done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithProxyProtocol(true), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testProxyProtocolServer struct {
+	*EventServer
+	action bool
+	closed chan error
+	done   chan error
+}
+
+func (t *testProxyProtocolServer) OnOpened(c Conn) (out []byte, action Action) {
+	out = []byte(c.RemoteAddr().String() + "\n")
+	return
+}
+
+func (t *testProxyProtocolServer) OnClosed(c Conn, err error) (action Action) {
+	if err != nil {
+		t.closed <- err
+	}
+	return
+}
+
+func (t *testProxyProtocolServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	out = frame
+	return
+}
+
+func (t *testProxyProtocolServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				// The header arrives in pieces, along with the data after it.
+				header := "PROXY TCP4 203.0.113.7 198.51.100.1 51234 443\r\n"
+				if _, err = conn.Write([]byte(header[:20])); err != nil {
+					return err
+				}
+				time.Sleep(50 * time.Millisecond)
+				if _, err = conn.Write([]byte(header[20:] + "ping")); err != nil {
+					return err
+				}
+				expected := "203.0.113.7:51234\nping"
+				buf := make([]byte, len(expected))
+				if _, err = io.ReadFull(conn, buf); err != nil {
+					return err
+				}
+				if string(buf) != expected {
+					return fmt.Errorf("expected %q, got %q", expected, buf)
+				}
+
+				bad, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer bad.Close()
+				if _, err = bad.Write([]byte("GET / HTTP/1.1\r\n\r\n")); err != nil {
+					return err
+				}
+				if n, err := bad.Read(buf); err == nil {
+					return fmt.Errorf("expected the connection without header to be closed, got %q", buf[:n])
+				}
+				select {
+				case err = <-t.closed:
+					if err != ErrInvalidProxyHeader {
+						return fmt.Errorf("expected %v, got %v", ErrInvalidProxyHeader, err)
+					}
+				case <-time.After(time.Second):
+					return errors.New("connection without header was not closed")
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestOnWriteComplete(t *testing.T) {
+	events := &testOnWriteCompleteServer{data: bytes.Repeat([]byte("x"), 4*1024*1024), done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testOnWriteCompleteServer struct {
+	*EventServer
+	action  bool
+	data    []byte
+	written int64
+	events  int
+	err     error
+	done    chan error
+}
+
+func (t *testOnWriteCompleteServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	out = t.data
+	return
+}
+
+func (t *testOnWriteCompleteServer) OnWriteComplete(c Conn, n int) {
+	t.written += int64(n)
+	t.events++
+	if t.err == nil && t.written != c.BytesWritten() {
+		t.err = fmt.Errorf("expected %d bytes reported as Conn.BytesWritten, got %d", c.BytesWritten(), t.written)
+	}
+}
+
+func (t *testOnWriteCompleteServer) OnClosed(c Conn, err error) (action Action) {
+	if t.err == nil && t.written != int64(len(t.data)) {
+		t.err = fmt.Errorf("expected %d bytes reported, got %d in %d events", len(t.data), t.written, t.events)
+	}
+	t.done <- t.err
+	action = Shutdown
+	return
+}
+
+func (t *testOnWriteCompleteServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			conn, err := net.Dial("tcp", ":9991")
+			must(err)
+			defer conn.Close()
+			_, err = conn.Write([]byte("go"))
+			must(err)
+			// Read the reply slowly so that it's written in parts.
+			time.Sleep(100 * time.Millisecond)
+			_, err = io.ReadFull(conn, make([]byte, len(t.data)))
+			must(err)
+		}()
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestSendFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "gnet-sendfile")
+	must(err)
+	defer os.Remove(f.Name())
+	data := make([]byte, 8*1024*1024)
+	_, _ = rand.Read(data)
+	_, err = f.Write(data)
+	must(err)
+	must(f.Close())
+
+	events := &testSendFileServer{name: f.Name(), data: data, done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testSendFileServer struct {
+	*EventServer
+	action bool
+	name   string
+	data   []byte
+	err    error
+	done   chan error
+}
+
+func (t *testSendFileServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	f, err := os.Open(t.name)
+	must(err)
+	// The file is closed before the rest of region is sent.
+	defer f.Close()
+	if err = c.SendFile(f, 10, len(t.data)-20); err != nil {
+		t.err = err
+	}
+	if err = c.SendFile(f, int64(len(t.data)-10), 20); err != io.ErrUnexpectedEOF && t.err == nil {
+		t.err = fmt.Errorf("expected %v with the region beyond the end of file, got %v", io.ErrUnexpectedEOF, err)
+	}
+	// The reply is written after the whole file region.
+	out = []byte("END")
+	return
+}
+
+func (t *testSendFileServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				if _, err = conn.Write([]byte("get")); err != nil {
+					return err
+				}
+				// Read slowly so that the file region is sent in parts.
+				time.Sleep(100 * time.Millisecond)
+				// The part of the second region within the file is sent as well, followed by the reply.
+				expected := append(append([]byte{}, t.data[10:]...), "END"...)
+				buf := make([]byte, len(expected))
+				if _, err = io.ReadFull(conn, buf); err != nil {
+					return err
+				}
+				if !bytes.Equal(buf, expected) {
+					return errors.New("unexpected data sent")
+				}
+				return t.err
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestReactPool(t *testing.T) {
+	events := &testReactPoolServer{done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithReactPool(4), WithNumEventLoop(1),
+		WithCodec(NewDelimiterBasedFrameCodec('\n')), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testReactPoolServer struct {
+	*EventServer
+	action bool
+	done   chan error
+}
+
+func (t *testReactPoolServer) OnOpened(c Conn) (out []byte, action Action) {
+	c.SetContext(new(int32))
+	return
+}
+
+func (t *testReactPoolServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	reacting := c.Context().(*int32)
+	if atomic.AddInt32(reacting, 1) != 1 {
+		panic("React of a connection runs concurrently")
+	}
+	defer atomic.AddInt32(reacting, -1)
+	if string(frame) == "slow" {
+		time.Sleep(time.Second)
+	}
+	out = frame
+	return
+}
+
+func (t *testReactPoolServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				slow, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer slow.Close()
+				if _, err = slow.Write([]byte("slow\n")); err != nil {
+					return err
+				}
+				time.Sleep(50 * time.Millisecond)
+
+				// The connection on the same event-loop isn't held up by the slow React.
+				start := time.Now()
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				var lines []byte
+				for i := 0; i < 100; i++ {
+					lines = append(lines, strconv.Itoa(i)+"\n"...)
+				}
+				if _, err = conn.Write(lines); err != nil {
+					return err
+				}
+				buf := make([]byte, len(lines))
+				if _, err = io.ReadFull(conn, buf); err != nil {
+					return err
+				}
+				if !bytes.Equal(buf, lines) {
+					return fmt.Errorf("expected the frames to be reacted to in order, got %q", buf)
+				}
+				if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+					return fmt.Errorf("the connection was held up by the slow React for %v", elapsed)
+				}
+
+				buf = buf[:len("slow\n")]
+				if _, err = io.ReadFull(slow, buf); err != nil {
+					return err
+				}
+				if string(buf) != "slow\n" {
+					return fmt.Errorf("expected %q, got %q", "slow\n", buf)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestReactPoolWake(t *testing.T) {
+	events := &testReactPoolWakeServer{done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithReactPool(4), WithCodec(NewDelimiterBasedFrameCodec('\n')), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&events.overlapped) != 0 {
+		t.Fatal("React of the wake ran concurrently with the pooled React of the connection")
+	}
+}
+
+type testReactPoolWakeServer struct {
+	*EventServer
+	action     bool
+	reacting   int32
+	overlapped int32
+	done       chan error
+}
+
+func (t *testReactPoolWakeServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	if atomic.AddInt32(&t.reacting, 1) != 1 {
+		atomic.StoreInt32(&t.overlapped, 1)
+	}
+	defer atomic.AddInt32(&t.reacting, -1)
+	if frame == nil {
+		out = []byte("woken")
+		return
+	}
+	// The wake arrives while the pooled React is still running.
+	must(c.Wake())
+	time.Sleep(200 * time.Millisecond)
+	out = frame
+	return
+}
+
+func (t *testReactPoolWakeServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				if _, err = conn.Write([]byte("slow\n")); err != nil {
+					return err
+				}
+				buf := make([]byte, len("slow\nwoken\n"))
+				if _, err = io.ReadFull(conn, buf); err != nil {
+					return err
+				}
+				if string(buf) != "slow\nwoken\n" {
+					return fmt.Errorf("expected the wake to be reacted to after the frame, got %q", buf)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestLoopIndex(t *testing.T) {
+	events := &testLoopIndexServer{loops: make([]int, 2), done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithNumEventLoop(2), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+	if events.loops[0] != 2 || events.loops[1] != 2 {
+		t.Fatalf("expected 2 connections on each event-loop with round-robin, got %v", events.loops)
+	}
+}
+
+type testLoopIndexServer struct {
+	*EventServer
+	action bool
+	mu     sync.Mutex
+	loops  []int
+	done   chan error
+}
+
+func (t *testLoopIndexServer) OnOpened(c Conn) (out []byte, action Action) {
+	t.mu.Lock()
+	t.loops[c.LoopIndex()]++
+	t.mu.Unlock()
+	c.SetContext(c.LoopIndex())
+	return
+}
+
+func (t *testLoopIndexServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	if c.Context() != c.LoopIndex() {
+		out = []byte("changed")
+		return
+	}
+	out = frame
+	return
+}
+
+func (t *testLoopIndexServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				for i := 0; i < 4; i++ {
+					conn, err := net.Dial("tcp", ":9991")
+					if err != nil {
+						return err
+					}
+					defer conn.Close()
+					if _, err = conn.Write([]byte("ping")); err != nil {
+						return err
+					}
+					buf := make([]byte, 4)
+					if _, err = io.ReadFull(conn, buf); err != nil {
+						return err
+					}
+					if string(buf) != "ping" {
+						return fmt.Errorf("expected the loop index to stay the same, got %q", buf)
+					}
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestClient(t *testing.T) {
+	events := &testClientServer{done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testClientServer struct {
+	*EventServer
+	action bool
+	done   chan error
+}
+
+func (t *testClientServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	out = frame
+	return
+}
+
+func (t *testClientServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				events := &testClientEvents{frames: make(chan string, 1), closed: make(chan struct{})}
+				cli, err := NewClient(events)
+				if err != nil {
+					return err
+				}
+				c, err := cli.Dial("tcp://127.0.0.1:9991")
+				if err != nil {
+					cli.Stop()
+					return err
+				}
+				if atomic.LoadInt32(&events.opened) != 1 {
+					cli.Stop()
+					return errors.New("expected OnOpened to fire before Dial returns")
+				}
+				if err = c.AsyncWrite([]byte("ping")); err != nil {
+					cli.Stop()
+					return err
+				}
+				select {
+				case frame := <-events.frames:
+					if frame != "ping" {
+						cli.Stop()
+						return fmt.Errorf("expected the echo of ping, got %q", frame)
+					}
+				case <-time.After(time.Second * 3):
+					cli.Stop()
+					return errors.New("timed out waiting for the echo")
+				}
+				cli.Stop()
+				select {
+				case <-events.closed:
+				default:
+					return errors.New("expected OnClosed to fire once the client stops")
+				}
+				if _, err = cli.Dial("tcp://127.0.0.1:9991"); err != ErrServerShutdown {
+					return fmt.Errorf("expected ErrServerShutdown dialing by the stopped client, got %v", err)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+type testClientEvents struct {
+	*EventServer
+	opened int32
+	frames chan string
+	closed chan struct{}
+}
+
+func (t *testClientEvents) OnOpened(c Conn) (out []byte, action Action) {
+	atomic.StoreInt32(&t.opened, 1)
+	return
+}
+
+func (t *testClientEvents) React(frame []byte, c Conn) (out []byte, action Action) {
+	t.frames <- string(frame)
+	return
+}
+
+func (t *testClientEvents) OnClosed(c Conn, err error) (action Action) {
+	close(t.closed)
+	return
+}
+
+func TestReactFramesBurst(t *testing.T) {
+	events := &testReactFramesBurstServer{done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithTicker(true), WithCodec(new(LineBasedFrameCodec))))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&events.reacted); n != 10 {
+		t.Fatalf("expected React to fire for each of the 10 frames, got %d", n)
+	}
+}
+
+type testReactFramesBurstServer struct {
+	*EventServer
+	action  bool
+	reacted int32
+	done    chan error
+}
+
+func (t *testReactFramesBurstServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	atomic.AddInt32(&t.reacted, 1)
+	out = frame
+	return
+}
+
+func (t *testReactFramesBurstServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				burst := strings.Repeat("ping\n", 10)
+				if _, err = conn.Write([]byte(burst)); err != nil {
+					return err
+				}
+				// The echoes are only written if all the frames are reacted without any more data sent.
+				_ = conn.SetReadDeadline(time.Now().Add(time.Second * 3))
+				buf := make([]byte, len(burst))
+				if _, err = io.ReadFull(conn, buf); err != nil {
+					return err
+				}
+				if string(buf) != burst {
+					return fmt.Errorf("expected the echoes of the frames, got %q", buf)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestReactFrames(t *testing.T) {
+	t.Run("event-loop", func(t *testing.T) {
+		testReactFrames(t)
+	})
+	t.Run("react-pool", func(t *testing.T) {
+		testReactFrames(t, WithReactPool(2))
+	})
+}
+
+func testReactFrames(t *testing.T, opts ...Option) {
+	events := &testReactFramesServer{done: make(chan error, 1)}
+	opts = append(opts, WithTicker(true), WithCodec(new(LineBasedFrameCodec)))
+	must(Serve(events, "tcp://:9991", opts...))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testReactFramesServer struct {
+	*EventServer
+	action bool
+	done   chan error
+}
+
+func (t *testReactFramesServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	out = []byte("React")
+	return
+}
+
+func (t *testReactFramesServer) ReactFrames(frame []byte, c Conn) (outs [][]byte, action Action) {
+	for i := 1; i <= 3; i++ {
+		outs = append(outs, []byte(fmt.Sprintf("%s-%d", frame, i)))
+	}
+	return
+}
+
+func (t *testReactFramesServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				if _, err = conn.Write([]byte("a\nb\n")); err != nil {
+					return err
+				}
+				expected := "a-1\na-2\na-3\nb-1\nb-2\nb-3\n"
+				_ = conn.SetReadDeadline(time.Now().Add(time.Second * 3))
+				buf := make([]byte, len(expected))
+				if _, err = io.ReadFull(conn, buf); err != nil {
+					return err
+				}
+				if string(buf) != expected {
+					return fmt.Errorf("expected the frames of ReactFrames in order, got %q", buf)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestRange(t *testing.T) {
+	events := &testRangeServer{done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithNumEventLoop(2), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testRangeServer struct {
+	*EventServer
+	svr    Server
+	action bool
+	done   chan error
+}
+
+func (t *testRangeServer) OnInitComplete(svr Server) (action Action) {
+	t.svr = svr
+	return
+}
+
+func (t *testRangeServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	c.SetContext(string(frame))
+	out = frame
+	return
+}
+
+// names returns the names of the connections visited by Range.
+func (t *testRangeServer) names() map[string]Conn {
+	conns := make(map[string]Conn)
+	t.svr.Range(func(c Conn) bool {
+		if name, ok := c.Context().(string); ok {
+			conns[name] = c
+		}
+		return true
+	})
+	return conns
+}
+
+func (t *testRangeServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				var conns []net.Conn
+				defer func() {
+					for _, conn := range conns {
+						conn.Close()
+					}
+				}()
+				for i := 0; i < 3; i++ {
+					conn, err := net.Dial("tcp", ":9991")
+					if err != nil {
+						return err
+					}
+					conns = append(conns, conn)
+					name := fmt.Sprintf("user-%d", i)
+					if _, err = conn.Write([]byte(name)); err != nil {
+						return err
+					}
+					if _, err = io.ReadFull(conn, make([]byte, len(name))); err != nil {
+						return err
+					}
+				}
+				visited := 0
+				t.svr.Range(func(c Conn) bool {
+					visited++
+					return false
+				})
+				if visited != 1 {
+					return fmt.Errorf("expected Range to stop once fn returns false, visited %d", visited)
+				}
+				names := t.names()
+				if len(names) != 3 {
+					return fmt.Errorf("expected 3 connections, got %v", names)
+				}
+				// Disconnect user-1.
+				if err := names["user-1"].Close(); err != nil {
+					return err
+				}
+				_ = conns[1].SetReadDeadline(time.Now().Add(time.Second * 3))
+				if _, err := conns[1].Read(make([]byte, 1)); err != io.EOF {
+					return fmt.Errorf("expected user-1 to be disconnected, got %v", err)
+				}
+				for start := time.Now(); len(t.names()) != 2; {
+					if time.Since(start) > time.Second*3 {
+						return fmt.Errorf("expected 2 connections after disconnecting user-1, got %v", t.names())
+					}
+					time.Sleep(time.Millisecond * 10)
+				}
+				if _, ok := t.names()["user-1"]; ok {
+					return errors.New("expected user-1 not to be visited after being closed")
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestReadThreshold(t *testing.T) {
+	events := &testReadThresholdServer{done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithCodec(&LineBasedFrameCodec{}), WithReadTimeout(time.Millisecond*300),
+		WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testReadThresholdServer struct {
+	*EventServer
+	action   bool
+	timeouts int32
+	done     chan error
+}
+
+func (t *testReadThresholdServer) OnOpened(c Conn) (out []byte, action Action) {
+	c.SetReadThreshold(12)
+	return
+}
+
+func (t *testReadThresholdServer) OnReadTimeout(c Conn) (out []byte, action Action) {
+	atomic.AddInt32(&t.timeouts, 1)
+	return
+}
+
+func (t *testReadThresholdServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	out = frame
+	return
+}
+
+func (t *testReadThresholdServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				reply := make([]byte, 12)
+				// 10 bytes are held back by the threshold of 12 bytes, the 6th line gets all of them reacted to.
+				for i := 0; i < 5; i++ {
+					if _, err = conn.Write([]byte("a\n")); err != nil {
+						return err
+					}
+				}
+				_ = conn.SetReadDeadline(time.Now().Add(time.Millisecond * 100))
+				if n, err := conn.Read(reply); err == nil {
+					return fmt.Errorf("expected no reply below the read threshold, got %q", reply[:n])
+				}
+				_ = conn.SetReadDeadline(time.Now().Add(time.Second * 2))
+				if _, err = conn.Write([]byte("b\n")); err != nil {
+					return err
+				}
+				if _, err = io.ReadFull(conn, reply); err != nil {
+					return err
+				}
+				if string(reply) != "a\na\na\na\na\nb\n" {
+					return fmt.Errorf("unexpected reply %q", reply)
+				}
+				// The last line below the threshold is flushed on read timeout rather than firing OnReadTimeout.
+				if _, err = conn.Write([]byte("tail\n")); err != nil {
+					return err
+				}
+				if _, err = io.ReadFull(conn, reply[:5]); err != nil {
+					return err
+				}
+				if string(reply[:5]) != "tail\n" {
+					return fmt.Errorf("unexpected reply %q", reply[:5])
+				}
+				if n := atomic.LoadInt32(&t.timeouts); n != 0 {
+					return fmt.Errorf("expected OnReadTimeout not to fire while data was buffered, got %d", n)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestOnWritable(t *testing.T) {
+	events := &testOnWritableServer{done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithWriteBufferCap(64<<10), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// onWritableTotal is the number of bytes produced for the client, far more than the write buffer cap.
+const onWritableTotal = 8 << 20
+
+type testOnWritableServer struct {
+	*EventServer
+	action   bool
+	produced int
+	resumed  int32
+	done     chan error
+}
+
+// produce writes chunks to the connection until the write buffer is full or all data has been produced.
+func (t *testOnWritableServer) produce(c Conn) {
+	chunk := make([]byte, 16<<10)
+	for t.produced < onWritableTotal {
+		if err := c.AsyncWrite(chunk); err == ErrWriteBufferFull {
+			return
+		}
+		t.produced += len(chunk)
+	}
+}
+
+func (t *testOnWritableServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	t.produce(c)
+	return
+}
+
+func (t *testOnWritableServer) OnWritable(c Conn) (out []byte, action Action) {
+	if pending := c.OutboundBuffered(); pending > 32<<10 {
+		select {
+		case t.done <- fmt.Errorf("OnWritable fired with %d bytes pending", pending):
+		default:
+		}
+	}
+	atomic.AddInt32(&t.resumed, 1)
+	t.produce(c)
+	return
+}
+
+func (t *testOnWritableServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				if _, err = conn.Write([]byte("start")); err != nil {
+					return err
+				}
+				// Let the write buffer get full before reading.
+				time.Sleep(time.Millisecond * 200)
+				_ = conn.SetReadDeadline(time.Now().Add(time.Second * 10))
+				n, err := io.CopyN(ioutil.Discard, conn, onWritableTotal)
+				if err != nil {
+					return fmt.Errorf("read %d of %d bytes: %v", n, onWritableTotal, err)
+				}
+				if atomic.LoadInt32(&t.resumed) == 0 {
+					return errors.New("expected OnWritable to resume the producer")
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func TestDetach(t *testing.T) {
+	events := &testDetachServer{done: make(chan error, 1)}
+	must(Serve(events, "tcp://:9991", WithCodec(&LineBasedFrameCodec{}), WithTicker(true)))
+	if err := <-events.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDetachedConn(t *testing.T) {
+	local, peer := net.Pipe()
+	defer peer.Close()
+	dc := newDetachedConn(local, []byte("inbound"))
+	go dc.flush([]byte("outbound"))
+	go func() {
+		_, _ = dc.Write([]byte("-written"))
+	}()
+	buf := make([]byte, len("outbound-written"))
+	if _, err := io.ReadFull(peer, buf); err != nil || string(buf) != "outbound-written" {
+		t.Fatalf("expected the pending data to be written first, got %q, error: %v", buf, err)
+	}
+	go func() {
+		_, _ = peer.Write([]byte("-read"))
+	}()
+	buf = make([]byte, len("inbound-read"))
+	if _, err := io.ReadFull(dc, buf); err != nil || string(buf) != "inbound-read" {
+		t.Fatalf("expected the buffered data to be read first, got %q, error: %v", buf, err)
+	}
+}
+
+type testDetachServer struct {
+	*EventServer
+	svr    Server
+	action bool
+	closed int32
+	done   chan error
+}
+
+func (t *testDetachServer) OnInitComplete(svr Server) (action Action) {
+	t.svr = svr
+	return
+}
+
+func (t *testDetachServer) OnClosed(c Conn, err error) (action Action) {
+	atomic.AddInt32(&t.closed, 1)
+	return
+}
+
+func (t *testDetachServer) React(frame []byte, c Conn) (out []byte, action Action) {
+	if string(frame) != "detach" {
+		out = frame
+		return
+	}
+	nc, err := c.Detach()
+	must(err)
+	if _, err = c.Detach(); err != ErrDetached {
+		panic("expected ErrDetached when detaching a detached connection")
+	}
+	go func() {
+		// Serve the rest of the connection by blocking reads and writes, starting with the data read by gnet.
+		defer nc.Close()
+		buf := make([]byte, 64)
+		for {
+			n, err := nc.Read(buf)
+			if err != nil {
+				return
+			}
+			if _, err = nc.Write(append([]byte("raw:"), buf[:n]...)); err != nil {
+				return
+			}
+		}
+	}()
+	// Data written by gnet after Detach is discarded.
+	out = []byte("discarded")
+	return
+}
+
+func (t *testDetachServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		go func() {
+			t.done <- func() error {
+				conn, err := net.Dial("tcp", ":9991")
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+				_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+				expect := func(s string) error {
+					buf := make([]byte, len(s))
+					if _, err := io.ReadFull(conn, buf); err != nil {
+						return err
+					}
+					if string(buf) != s {
+						return fmt.Errorf("expected %q, got %q", s, buf)
+					}
+					return nil
+				}
+				if _, err = conn.Write([]byte("hello\n")); err != nil {
+					return err
+				}
+				if err = expect("hello\n"); err != nil {
+					return err
+				}
+				if _, err = conn.Write([]byte("detach\nleftover")); err != nil {
+					return err
+				}
+				if err = expect("raw:leftover"); err != nil {
+					return err
+				}
+				if _, err = conn.Write([]byte("more")); err != nil {
+					return err
+				}
+				if err = expect("raw:more"); err != nil {
+					return err
+				}
+				if n := t.svr.CountConnections(); n != 0 {
+					return fmt.Errorf("expected the detached connection to be removed, %d connections left", n)
+				}
+				if n := atomic.LoadInt32(&t.closed); n != 0 {
+					return fmt.Errorf("expected no OnClosed for the detached connection, got %d", n)
+				}
+				return nil
+			}()
+		}()
+	}
+	select {
+	case err := <-t.done:
+		t.done <- err
+		action = Shutdown
+		return
+	default:
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+// bareEventHandler implements EventHandler without embedding EventServer, which must keep compiling
+// as the optional hooks are added by interfaces of their own, e.g. FramesReactor and LoopTicker.
+type bareEventHandler struct{}
+
+var _ EventHandler = bareEventHandler{}
+
+func (bareEventHandler) OnInitComplete(server Server) (action Action)           { return }
+func (bareEventHandler) OnOpened(c Conn) (out []byte, action Action)            { return }
+func (bareEventHandler) OnClosed(c Conn, err error) (action Action)             { return }
+func (bareEventHandler) PreWrite()                                              {}
+func (bareEventHandler) React(frame []byte, c Conn) (out []byte, action Action) { return }
+func (bareEventHandler) Tick() (delay time.Duration, action Action)             { return }
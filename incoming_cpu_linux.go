@@ -0,0 +1,14 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package gnet
+
+import "golang.org/x/sys/unix"
+
+// incomingCPU returns the CPU where the packets of connection arrive, -1 means it is unknown yet.
+func incomingCPU(fd int) (int, error) {
+	return unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_INCOMING_CPU)
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package gnet
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIncomingCPUAffinity(t *testing.T) {
+	testIncomingCPUAffinity("tcp", ":9991", 2, 16)
+}
+
+type testIncomingCPUAffinityServer struct {
+	*EventServer
+	network, addr string
+	action        bool
+	numLoops      int
+	numConns      int32
+	opened        int32
+	mismatched    int32
+}
+
+func (t *testIncomingCPUAffinityServer) OnOpened(c Conn) (out []byte, action Action) {
+	conn := c.(*conn)
+	if cpu, err := incomingCPU(conn.fd); err == nil && cpu >= 0 && conn.loop.idx != cpu%t.numLoops {
+		atomic.AddInt32(&t.mismatched, 1)
+	}
+	if atomic.AddInt32(&t.opened, 1) == t.numConns {
+		action = Shutdown
+	}
+	return
+}
+func (t *testIncomingCPUAffinityServer) Tick() (delay time.Duration, action Action) {
+	if !t.action {
+		t.action = true
+		for i := int32(0); i < t.numConns; i++ {
+			go func() {
+				conn, err := net.Dial(t.network, t.addr)
+				must(err)
+				defer conn.Close()
+				// don't send anything lest the incoming CPU changes before OnOpened.
+				time.Sleep(time.Millisecond * 200)
+			}()
+		}
+	}
+	delay = time.Millisecond * 100
+	return
+}
+
+func testIncomingCPUAffinity(network, addr string, numLoops int, numConns int32) {
+	events := &testIncomingCPUAffinityServer{network: network, addr: addr, numLoops: numLoops, numConns: numConns}
+	must(Serve(events, network+"://"+addr, WithNumEventLoop(numLoops), WithIncomingCPUAffinity(true),
+		WithTicker(true)))
+	if events.mismatched > 0 {
+		panic(fmt.Sprintf("%d connections are not assigned to the event-loop of their incoming CPU", events.mismatched))
+	}
+}
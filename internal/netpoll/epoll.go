@@ -132,6 +132,17 @@ func (p *Poller) ModReadWrite(fd int) error {
 	return unix.EpollCtl(p.fd, unix.EPOLL_CTL_MOD, fd, &unix.EpollEvent{Fd: int32(fd), Events: readWriteEvents})
 }
 
+// ModWrite renews the given file-descriptor with writable event in the poller, the readable event is disabled.
+func (p *Poller) ModWrite(fd int) error {
+	return unix.EpollCtl(p.fd, unix.EPOLL_CTL_MOD, fd, &unix.EpollEvent{Fd: int32(fd), Events: writeEvents})
+}
+
+// ModNone renews the given file-descriptor with no event in the poller, the readable and writable events
+// are disabled while the exceptional events are still reported.
+func (p *Poller) ModNone(fd int) error {
+	return unix.EpollCtl(p.fd, unix.EPOLL_CTL_MOD, fd, &unix.EpollEvent{Fd: int32(fd)})
+}
+
 // Delete removes the given file-descriptor from the poller.
 func (p *Poller) Delete(fd int) error {
 	return unix.EpollCtl(p.fd, unix.EPOLL_CTL_DEL, fd, nil)
@@ -128,7 +128,9 @@ func (p *Poller) AddWrite(fd int) error {
 // ModRead renews the given file-descriptor with readable event in the poller.
 func (p *Poller) ModRead(fd int) error {
 	if _, err := unix.Kevent(p.fd, []unix.Kevent_t{
-		{Ident: uint64(fd), Flags: unix.EV_DELETE, Filter: unix.EVFILT_WRITE}}, nil, nil); err != nil {
+		{Ident: uint64(fd), Flags: unix.EV_ENABLE, Filter: unix.EVFILT_READ},
+		{Ident: uint64(fd), Flags: unix.EV_DELETE, Filter: unix.EVFILT_WRITE},
+	}, nil, nil); err != nil {
 		return err
 	}
 	return nil
@@ -137,7 +139,32 @@ func (p *Poller) ModRead(fd int) error {
 // ModReadWrite renews the given file-descriptor with readable and writable events in the poller.
 func (p *Poller) ModReadWrite(fd int) error {
 	if _, err := unix.Kevent(p.fd, []unix.Kevent_t{
-		{Ident: uint64(fd), Flags: unix.EV_ADD, Filter: unix.EVFILT_WRITE}}, nil, nil); err != nil {
+		{Ident: uint64(fd), Flags: unix.EV_ENABLE, Filter: unix.EVFILT_READ},
+		{Ident: uint64(fd), Flags: unix.EV_ADD, Filter: unix.EVFILT_WRITE},
+	}, nil, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ModWrite renews the given file-descriptor with writable event in the poller, the readable event is disabled.
+func (p *Poller) ModWrite(fd int) error {
+	if _, err := unix.Kevent(p.fd, []unix.Kevent_t{
+		{Ident: uint64(fd), Flags: unix.EV_DISABLE, Filter: unix.EVFILT_READ},
+		{Ident: uint64(fd), Flags: unix.EV_ADD, Filter: unix.EVFILT_WRITE},
+	}, nil, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ModNone renews the given file-descriptor with no event in the poller, the readable and writable events
+// are disabled.
+func (p *Poller) ModNone(fd int) error {
+	if _, err := unix.Kevent(p.fd, []unix.Kevent_t{
+		{Ident: uint64(fd), Flags: unix.EV_DISABLE, Filter: unix.EVFILT_READ},
+		{Ident: uint64(fd), Flags: unix.EV_DELETE, Filter: unix.EVFILT_WRITE},
+	}, nil, nil); err != nil {
 		return err
 	}
 	return nil
@@ -9,13 +9,26 @@ import "golang.org/x/sys/unix"
 
 // SetKeepAlive sets the keepalive for the connection.
 func SetKeepAlive(fd, secs int) error {
+	return SetKeepAliveEx(fd, secs, secs, 0)
+}
+
+// SetKeepAliveEx sets the keepalive for the connection with the idle time and the interval of probes in seconds,
+// and the number of unacknowledged probes before the connection is dropped, which is left to the system if 0.
+func SetKeepAliveEx(fd, idle, interval, count int) error {
 	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, 0x8, 1); err != nil {
 		return err
 	}
-	switch err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, 0x101, secs); err {
+	switch err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, 0x101, interval); err {
 	case nil, unix.ENOPROTOOPT: // OS X 10.7 and earlier don't support this option
 	default:
 		return err
 	}
-	return unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPALIVE, secs)
+	if count > 0 {
+		switch err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, 0x102, count); err {
+		case nil, unix.ENOPROTOOPT: // TCP_KEEPCNT, neither is it supported by OS X 10.7 and earlier
+		default:
+			return err
+		}
+	}
+	return unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPALIVE, idle)
 }
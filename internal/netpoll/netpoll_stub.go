@@ -18,6 +18,12 @@ func SetKeepAlive(fd, secs int) error {
 	return nil
 }
 
+// SetKeepAliveEx sets the keepalive for the connection with the idle time, the interval and the count of probes.
+func SetKeepAliveEx(fd, idle, interval, count int) error {
+	// OpenBSD has no user-settable per-socket TCP keepalive options.
+	return nil
+}
+
 // ReusePortListenPacket returns a net.PacketConn for UDP.
 func ReusePortListenPacket(proto, addr string) (net.PacketConn, error) {
 	return nil, errors.New("reuseport is not available")
@@ -27,3 +33,8 @@ func ReusePortListenPacket(proto, addr string) (net.PacketConn, error) {
 func ReusePortListen(proto, addr string) (net.Listener, error) {
 	return nil, errors.New("reuseport is not available")
 }
+
+// ReuseAddrListenConfig returns a net.ListenConfig without setting up SO_REUSEADDR socket option.
+func ReuseAddrListenConfig() net.ListenConfig {
+	return net.ListenConfig{}
+}
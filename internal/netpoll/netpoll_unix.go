@@ -11,11 +11,22 @@ import "golang.org/x/sys/unix"
 
 // SetKeepAlive sets the keepalive for the connection.
 func SetKeepAlive(fd, secs int) error {
+	return SetKeepAliveEx(fd, secs, secs, 0)
+}
+
+// SetKeepAliveEx sets the keepalive for the connection with the idle time and the interval of probes in seconds,
+// and the number of unacknowledged probes before the connection is dropped, which is left to the system if 0.
+func SetKeepAliveEx(fd, idle, interval, count int) error {
 	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_KEEPALIVE, 1); err != nil {
 		return err
 	}
-	if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPINTVL, secs); err != nil {
+	if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPINTVL, interval); err != nil {
 		return err
 	}
-	return unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPIDLE, secs)
+	if count > 0 {
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPCNT, count); err != nil {
+			return err
+		}
+	}
+	return unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPIDLE, idle)
 }
@@ -8,8 +8,10 @@ package netpoll
 
 import (
 	"net"
+	"syscall"
 
 	"github.com/libp2p/go-reuseport"
+	"golang.org/x/sys/unix"
 )
 
 // ReusePortListenPacket returns a net.PacketConn for UDP.
@@ -21,3 +23,15 @@ func ReusePortListenPacket(proto, addr string) (net.PacketConn, error) {
 func ReusePortListen(proto, addr string) (net.Listener, error) {
 	return reuseport.Listen(proto, addr)
 }
+
+// ReuseAddrListenConfig returns a net.ListenConfig which sets up SO_REUSEADDR socket option before binding.
+func ReuseAddrListenConfig() net.ListenConfig {
+	return net.ListenConfig{Control: func(network, address string, c syscall.RawConn) (err error) {
+		if e := c.Control(func(fd uintptr) {
+			err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1)
+		}); e != nil {
+			return e
+		}
+		return
+	}}
+}
@@ -23,11 +23,13 @@ type listener struct {
 	pconn         net.PacketConn
 	lnaddr        net.Addr
 	addr, network string
+	logger        LeveledLogger // logger for the errors of closing the listener
 }
 
 // system takes the net listener and detaches it from it's parent
-// event loop, grabs the file descriptor, and makes it non-blocking.
-func (ln *listener) system() error {
+// event loop, grabs the file descriptor, makes it non-blocking,
+// renews its backlog with Options.AcceptBacklog and applies Options.SocketOpt to it.
+func (ln *listener) system(opts *Options) error {
 	var err error
 	switch netln := ln.ln.(type) {
 	case nil:
@@ -45,23 +47,48 @@ func (ln *listener) system() error {
 		return err
 	}
 	ln.fd = int(ln.f.Fd())
-	return unix.SetNonblock(ln.fd, true)
+	if err = unix.SetNonblock(ln.fd, true); err != nil {
+		ln.close()
+		return err
+	}
+	if opts.AcceptBacklog > 0 && ln.ln != nil {
+		// Listening again on a listening socket renews its backlog.
+		if err = unix.Listen(ln.fd, listenBacklog(opts.AcceptBacklog)); err != nil {
+			ln.close()
+			return err
+		}
+	}
+	if opts.SocketOpt != nil {
+		if err = opts.SocketOpt(ln.fd); err != nil {
+			ln.close()
+			return err
+		}
+	}
+	return nil
+}
+
+// listenBacklog clamps the backlog to the maximum of the system.
+func listenBacklog(n int) int {
+	if max := maxListenerBacklog(); n > max {
+		return max
+	}
+	return n
 }
 
 func (ln *listener) close() {
 	ln.once.Do(
 		func() {
 			if ln.f != nil {
-				sniffErrorAndLog(ln.f.Close())
+				sniffErrorAndLog(ln.logger, ln.f.Close())
 			}
 			if ln.ln != nil {
-				sniffErrorAndLog(ln.ln.Close())
+				sniffErrorAndLog(ln.logger, ln.ln.Close())
 			}
 			if ln.pconn != nil {
-				sniffErrorAndLog(ln.pconn.Close())
+				sniffErrorAndLog(ln.logger, ln.pconn.Close())
 			}
-			if ln.network == "unix" {
-				sniffErrorAndLog(os.RemoveAll(ln.addr))
+			if ln.hasSocketFile() {
+				sniffErrorAndLog(ln.logger, os.RemoveAll(ln.addr))
 			}
 		})
 }
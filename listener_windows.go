@@ -19,22 +19,23 @@ type listener struct {
 	pconn         net.PacketConn
 	lnaddr        net.Addr
 	addr, network string
+	logger        LeveledLogger // logger for the errors of closing the listener
 }
 
-func (ln *listener) system() error {
+func (ln *listener) system(opts *Options) error {
 	return nil
 }
 
 func (ln *listener) close() {
 	ln.once.Do(func() {
 		if ln.ln != nil {
-			sniffErrorAndLog(ln.ln.Close())
+			sniffErrorAndLog(ln.logger, ln.ln.Close())
 		}
 		if ln.pconn != nil {
-			sniffErrorAndLog(ln.pconn.Close())
+			sniffErrorAndLog(ln.logger, ln.pconn.Close())
 		}
-		if ln.network == "unix" {
-			sniffErrorAndLog(os.RemoveAll(ln.addr))
+		if ln.hasSocketFile() {
+			sniffErrorAndLog(ln.logger, os.RemoveAll(ln.addr))
 		}
 	})
 }
@@ -4,6 +4,11 @@
 
 package gnet
 
+import (
+	"hash/crc32"
+	"net"
+)
+
 // LoadBalancing represents the the type of load-balancing algorithm.
 type LoadBalancing int
 
@@ -15,108 +20,142 @@ const (
 	// serving the least number of active connections at the current time.
 	LeastConnections
 
-	// SourceAddrHash assignes the next accepted connection to the event-loop by hashing socket fd.
+	// SourceAddrHash assignes the next accepted connection to the event-loop by hashing the remote address.
 	SourceAddrHash
 )
 
-// IEventLoopGroup represents a set of event-loops.
-type (
-	IEventLoopGroup interface {
-		register(*eventloop)
-		next(int) *eventloop
-		iterate(func(int, *eventloop) bool)
-		len() int
-	}
+// EventLoop is the view of an event-loop exposed to LoadBalancer.
+type EventLoop interface {
+	// Index returns the index of event-loop.
+	Index() int
+
+	// CountConnections counts the number of active connections in event-loop.
+	CountConnections() int
+}
+
+// LoadBalancer picks the event-loop for each newly accepted connection, it is invoked by a single goroutine,
+// so implementations don't need to be thread-safe.
+type LoadBalancer interface {
+	// Next returns one of the given event-loops for the connection from remoteAddr, the first event-loop will be
+	// used if the returned one isn't in the list.
+	Next(loops []EventLoop, remoteAddr net.Addr) EventLoop
+}
 
-	// roundRobinEventLoopGroup with RoundRobin algorithm.
-	roundRobinEventLoopGroup struct {
+type (
+	// roundRobinLoadBalancer with RoundRobin algorithm.
+	roundRobinLoadBalancer struct {
 		nextLoopIndex int
-		eventLoops    []*eventloop
-		size          int
 	}
 
-	// leastConnectionsEventLoopGroup with Least-Connections algorithm.
-	leastConnectionsEventLoopGroup []*eventloop
+	// leastConnectionsLoadBalancer with Least-Connections algorithm.
+	leastConnectionsLoadBalancer struct{}
 
-	// sourceAddrHashEventLoopGroup with Hash algorithm.
-	sourceAddrHashEventLoopGroup struct {
-		eventLoops []*eventloop
-		size       int
-	}
+	// sourceAddrHashLoadBalancer with Hash algorithm.
+	sourceAddrHashLoadBalancer struct{}
 )
 
-func (g *roundRobinEventLoopGroup) register(el *eventloop) {
-	g.eventLoops = append(g.eventLoops, el)
-	g.size++
+// newLoadBalancer returns the built-in implementation of the given load-balancing algorithm.
+func newLoadBalancer(lb LoadBalancing) LoadBalancer {
+	switch lb {
+	case LeastConnections:
+		return new(leastConnectionsLoadBalancer)
+	case SourceAddrHash:
+		return new(sourceAddrHashLoadBalancer)
+	default:
+		return new(roundRobinLoadBalancer)
+	}
 }
 
-// next returns the eligible event-loop based on Round-Robin algorithm.
-func (g *roundRobinEventLoopGroup) next(_ int) (el *eventloop) {
-	el = g.eventLoops[g.nextLoopIndex]
-	if g.nextLoopIndex++; g.nextLoopIndex >= g.size {
-		g.nextLoopIndex = 0
+// Next returns the eligible event-loop based on Round-Robin algorithm.
+func (lb *roundRobinLoadBalancer) Next(loops []EventLoop, _ net.Addr) (el EventLoop) {
+	if lb.nextLoopIndex >= len(loops) {
+		lb.nextLoopIndex = 0
 	}
+	el = loops[lb.nextLoopIndex]
+	lb.nextLoopIndex++
 	return
 }
 
-func (g *roundRobinEventLoopGroup) iterate(f func(int, *eventloop) bool) {
-	for i, el := range g.eventLoops {
-		if !f(i, el) {
-			break
+// Next returns the eligible event-loop based on least-connections algorithm.
+func (lb *leastConnectionsLoadBalancer) Next(loops []EventLoop, _ net.Addr) (el EventLoop) {
+	el = loops[0]
+	leastConnCount := el.CountConnections()
+	for _, curEventLoop := range loops[1:] {
+		if curConnCount := curEventLoop.CountConnections(); curConnCount < leastConnCount {
+			leastConnCount = curConnCount
+			el = curEventLoop
 		}
 	}
+	return
 }
 
-func (g *roundRobinEventLoopGroup) len() int {
-	return g.size
+// Next returns the eligible event-loop by taking the remainder of the hash code of remote address
+// as the index of event-loop list.
+func (lb *sourceAddrHashLoadBalancer) Next(loops []EventLoop, remoteAddr net.Addr) EventLoop {
+	if remoteAddr == nil {
+		return loops[0]
+	}
+	return loops[hashCode(remoteAddr.String())%len(loops)]
 }
 
-func (g *leastConnectionsEventLoopGroup) register(el *eventloop) {
-	*g = append(*g, el)
+// hashCode hashes a string to a unique hashcode.
+func hashCode(s string) int {
+	v := int(crc32.ChecksumIEEE([]byte(s)))
+	if v >= 0 {
+		return v
+	}
+	return -v
 }
 
-// next returns the eligible event-loop based on least-connections algorithm.
-func (g *leastConnectionsEventLoopGroup) next(_ int) (el *eventloop) {
-	eventLoops := *g
-	el = eventLoops[0]
-	leastConnCount := el.loadConnCount()
-	var (
-		curEventLoop *eventloop
-		curConnCount int32
-	)
-	for _, curEventLoop = range eventLoops[1:] {
-		if curConnCount = curEventLoop.loadConnCount(); curConnCount < leastConnCount {
-			leastConnCount = curConnCount
-			el = curEventLoop
-		}
-	}
-	return
+// Index returns the index of event-loop.
+func (el *eventloop) Index() int {
+	return el.idx
 }
 
-func (g *leastConnectionsEventLoopGroup) iterate(f func(int, *eventloop) bool) {
-	eventLoops := *g
-	for i, el := range eventLoops {
-		if !f(i, el) {
-			break
-		}
-	}
+// CountConnections counts the number of active connections in event-loop.
+func (el *eventloop) CountConnections() int {
+	return int(el.loadConnCount())
 }
 
-func (g *leastConnectionsEventLoopGroup) len() int {
-	return len(*g)
+// IEventLoopGroup represents a set of event-loops.
+type (
+	IEventLoopGroup interface {
+		register(*eventloop)
+		next(net.Addr) *eventloop
+		iterate(func(int, *eventloop) bool)
+		len() int
+	}
+
+	// eventLoopGroup assigns connections to event-loops with a LoadBalancer.
+	eventLoopGroup struct {
+		lb         LoadBalancer
+		eventLoops []*eventloop
+		views      []EventLoop
+	}
+)
+
+func newEventLoopGroup(lb LoadBalancer) *eventLoopGroup {
+	return &eventLoopGroup{lb: lb}
 }
 
-func (g *sourceAddrHashEventLoopGroup) register(el *eventloop) {
+func (g *eventLoopGroup) register(el *eventloop) {
 	g.eventLoops = append(g.eventLoops, el)
-	g.size++
+	g.views = append(g.views, el)
 }
 
-// next returns the eligible event-loop by taking the remainder of a given fd as the index of event-loop list.
-func (g *sourceAddrHashEventLoopGroup) next(hashCode int) *eventloop {
-	return g.eventLoops[hashCode%g.size]
+// next returns the event-loop picked by the LoadBalancer.
+func (g *eventLoopGroup) next(remoteAddr net.Addr) *eventloop {
+	if el, ok := g.lb.Next(g.views, remoteAddr).(*eventloop); ok {
+		for _, e := range g.eventLoops {
+			if e == el {
+				return el
+			}
+		}
+	}
+	return g.eventLoops[0]
 }
 
-func (g *sourceAddrHashEventLoopGroup) iterate(f func(int, *eventloop) bool) {
+func (g *eventLoopGroup) iterate(f func(int, *eventloop) bool) {
 	for i, el := range g.eventLoops {
 		if !f(i, el) {
 			break
@@ -124,6 +163,6 @@ func (g *sourceAddrHashEventLoopGroup) iterate(f func(int, *eventloop) bool) {
 	}
 }
 
-func (g *sourceAddrHashEventLoopGroup) len() int {
-	return g.size
+func (g *eventLoopGroup) len() int {
+	return len(g.eventLoops)
 }
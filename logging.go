@@ -0,0 +1,56 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// connSeq is the sequence for generating connection ids.
+var connSeq uint64
+
+// nextConnID returns a new unique connection id.
+func nextConnID() uint64 {
+	return atomic.AddUint64(&connSeq, 1)
+}
+
+// logLabel is a key-value pair attached to the log lines of a connection.
+type logLabel struct {
+	key, value string
+}
+
+// setLogLabel sets the value of the given key in labels, keeping the order in which keys are first set.
+func setLogLabel(labels []logLabel, key, value string) []logLabel {
+	for i := range labels {
+		if labels[i].key == key {
+			labels[i].value = value
+			return labels
+		}
+	}
+	return append(labels, logLabel{key, value})
+}
+
+// connLogPrefix formats the logging context of a connection, which looks like:
+// "conn[id=1 remote=127.0.0.1:9000 user=andy] ".
+func connLogPrefix(id uint64, remoteAddr net.Addr, labels []logLabel) string {
+	var sb strings.Builder
+	sb.WriteString("conn[id=")
+	sb.WriteString(strconv.FormatUint(id, 10))
+	if remoteAddr != nil {
+		sb.WriteString(" remote=")
+		sb.WriteString(remoteAddr.String())
+	}
+	for _, label := range labels {
+		sb.WriteByte(' ')
+		sb.WriteString(label.key)
+		sb.WriteByte('=')
+		sb.WriteString(label.value)
+	}
+	sb.WriteString("] ")
+	return sb.String()
+}
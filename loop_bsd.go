@@ -9,11 +9,11 @@ package gnet
 import "github.com/panjf2000/gnet/internal/netpoll"
 
 func (el *eventloop) handleEvent(fd int, filter int16) error {
-	if c, ok := el.connections[fd]; ok {
+	if c, ok := el.connections[fd]; ok && !c.hijacked {
 		if filter == netpoll.EVFilterSock {
 			return el.loopCloseConn(c, nil)
 		}
-		switch c.outboundBuffer.IsEmpty() {
+		switch c.outboundEmpty() {
 		// Don't change the ordering of processing EVFILT_WRITE | EVFILT_READ | EV_ERROR/EV_EOF unless you're 100%
 		// sure what you're doing!
 		// Re-ordering can easily introduce bugs and bad side-effects, as I found out painfully in the past.
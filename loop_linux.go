@@ -9,8 +9,8 @@ package gnet
 import "github.com/panjf2000/gnet/internal/netpoll"
 
 func (el *eventloop) handleEvent(fd int, ev uint32) error {
-	if c, ok := el.connections[fd]; ok {
-		switch c.outboundBuffer.IsEmpty() {
+	if c, ok := el.connections[fd]; ok && !c.hijacked {
+		switch c.outboundEmpty() {
 		// Don't change the ordering of processing EPOLLOUT | EPOLLRDHUP / EPOLLIN unless you're 100%
 		// sure what you're doing!
 		// Re-ordering can easily introduce bugs and bad side-effects, as I found out painfully in the past.
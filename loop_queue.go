@@ -0,0 +1,115 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import "sync"
+
+// LoopOverflowPolicy represents the behavior of the queue of an event-loop when it is full, see Options.LoopQueueCap.
+type LoopOverflowPolicy int
+
+const (
+	// Block blocks the caller until the event-loop takes the queued jobs, so that nothing is lost,
+	// at the cost of the caller being slowed down to the pace of the event-loop. It must not be used
+	// when the queue is fed by the event-loops themselves, e.g. by AsyncWrite in React, since an event-loop
+	// blocked on its own queue never drains it, which is a deadlock.
+	Block LoopOverflowPolicy = iota
+
+	// DropOldest discards the oldest job in the queue to make room for the new one, which keeps the callers
+	// and the event-loop running at any load, at the cost of silently losing data of AsyncWrite and Wake-ups.
+	// It suits the latest-value-wins traffic like market data or game state.
+	DropOldest
+
+	// CloseConn rejects the new job with ErrLoopQueueFull and closes the connection it is for, which keeps
+	// the queue bounded without losing data silently, at the cost of dropping the connections,
+	// mostly the busiest ones, which should reconnect and retry.
+	CloseConn
+)
+
+// loopJob is a job queued by the users of connections, e.g. AsyncWrite, to be run in the event-loop.
+type loopJob struct {
+	run  func() error
+	drop func() // invoked if the job is discarded by DropOldest, optional
+}
+
+// loopQueue is the bounded queue of the jobs for an event-loop from the users, the jobs are handed over to
+// the event-loop in batches. Internal jobs, e.g. closing connections, are sent to the event-loop directly.
+// The zero value is an empty queue.
+type loopQueue struct {
+	mu        sync.Mutex
+	notFull   *sync.Cond
+	jobs      []loopJob
+	scheduled bool
+	closed    bool
+}
+
+// push queues the job according to the policy once there are capacity jobs in the queue, zero capacity
+// means no limit. It schedules the draining of queue in the event-loop by schedule if the queue was empty.
+func (q *loopQueue) push(capacity int, policy LoopOverflowPolicy, job loopJob, schedule func(func() error) error) error {
+	q.mu.Lock()
+	for !q.closed && capacity > 0 && len(q.jobs) >= capacity {
+		switch policy {
+		case DropOldest:
+			if drop := q.jobs[0].drop; drop != nil {
+				drop()
+			}
+			q.jobs[0] = loopJob{}
+			q.jobs = q.jobs[1:]
+		case CloseConn:
+			q.mu.Unlock()
+			return ErrLoopQueueFull
+		default:
+			if q.notFull == nil {
+				q.notFull = sync.NewCond(&q.mu)
+			}
+			q.notFull.Wait()
+		}
+	}
+	if q.closed {
+		q.mu.Unlock()
+		return ErrServerShutdown
+	}
+	q.jobs = append(q.jobs, job)
+	needSchedule := !q.scheduled
+	q.scheduled = true
+	q.mu.Unlock()
+	if needSchedule {
+		return schedule(q.drain)
+	}
+	return nil
+}
+
+// drain runs all the queued jobs, it must be invoked in the event-loop.
+func (q *loopQueue) drain() error {
+	q.mu.Lock()
+	jobs := q.jobs
+	q.jobs, q.scheduled = nil, false
+	if q.notFull != nil {
+		q.notFull.Broadcast()
+	}
+	q.mu.Unlock()
+	for _, job := range jobs {
+		if err := job.run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// len returns the number of queued jobs.
+func (q *loopQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.jobs)
+}
+
+// close rejects the jobs pushed afterwards and wakes up the callers blocked by Block.
+func (q *loopQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	if q.notFull != nil {
+		q.notFull.Broadcast()
+	}
+	q.mu.Unlock()
+}
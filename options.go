@@ -4,7 +4,15 @@
 
 package gnet
 
-import "time"
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/panjf2000/gnet/ringbuffer"
+)
+
+// BufferGrowthPolicy is the alias of ringbuffer.GrowthPolicy.
+type BufferGrowthPolicy = ringbuffer.GrowthPolicy
 
 // Option is a function that will set up option.
 type Option func(opts *Options)
@@ -28,6 +36,10 @@ type Options struct {
 	// LB represents the load-balancing algorithm used when assigning new connections.
 	LB LoadBalancing
 
+	// LoadBalancer is the customized strategy of assigning new connections to event-loops,
+	// it takes precedence over LB if set.
+	LoadBalancer LoadBalancer
+
 	// NumEventLoop is set up to start the given number of event-loop goroutine.
 	// Note: Setting up NumEventLoop will override Multicore.
 	NumEventLoop int
@@ -35,18 +47,211 @@ type Options struct {
 	// ReusePort indicates whether to set up the SO_REUSEPORT socket option.
 	ReusePort bool
 
-	// Ticker indicates whether the ticker has been set up.
+	// ReuseAddr indicates whether to set up the SO_REUSEADDR socket option on the listeners, which allows
+	// the server to be restarted on an address with the connections of the previous one still in TIME_WAIT,
+	// without sharing the address among listeners like ReusePort. It's implied by ReusePort, and the standard
+	// library sets it up for TCP and Unix listeners as well, so it only changes UDP listeners unless the default
+	// of the standard library changes. It's ignored on Windows, where SO_REUSEADDR lets other sockets steal
+	// the address being listened on.
+	ReuseAddr bool
+
+	// IncomingCPUAffinity indicates whether to assign each accepted connection to the event-loop matching the CPU
+	// where its packets arrive, which is read by the SO_INCOMING_CPU socket option, instead of the load-balancing
+	// algorithm. The event-loop with index i serves the CPUs whose numbers modulo the number of event-loops equal i.
+	// It only works on Linux without SO_REUSEPORT, and it only makes sense when the NIC spreads packets across
+	// CPUs by RSS with each receive queue's interrupts bound to one CPU, ideally with as many event-loops as
+	// receive queues, see the documentation of your NIC driver for setting up RSS and IRQ affinity.
+	IncomingCPUAffinity bool
+
+	// CPUAffinity is the list of CPUs which the event-loops are bound to, the event-loop with index i locks itself
+	// to an OS thread and binds the thread to the CPU CPUAffinity[i%len(CPUAffinity)] by sched_setaffinity, e.g. to
+	// keep the event-loops on the cores of the NUMA node of the NIC. It only works on Linux, it's ignored with
+	// a warning logged on other platforms.
+	CPUAffinity []int
+
+	// AcceptBacklog is the backlog of the listening stream sockets, i.e. the maximum number of connections completing
+	// the handshake but not accepted yet, beyond which the SYNs of new connections are dropped by the kernel. It's
+	// clamped to the maximum of the system, net.core.somaxconn on Linux and kern.ipc.somaxconn or the like on BSD,
+	// which has to be raised by sysctl for a larger backlog. The sockets listen with the maximum by default.
+	// It's ignored on Windows, where the sockets always listen with the maximum.
+	AcceptBacklog int
+
+	// SocketOpt is invoked with the file descriptor of each listening socket once it's set up, before serving,
+	// to apply the socket options not covered by Options, e.g. SO_RCVBUF, SO_SNDBUF or TCP_FASTOPEN by setsockopt.
+	// The socket is already listening, so the options that only work before listen(2) don't take effect.
+	// The server fails to start with the error it returns. It's not invoked on Windows.
+	SocketOpt func(fd int) error
+
+	// ConnSocketOpt is invoked with the file descriptor of each accepted stream connection before it's opened,
+	// to apply the socket options not covered by Options by setsockopt. It's invoked on the event-loop or
+	// the main reactor accepting the connection, so it must not block. The connection is closed without firing
+	// any event with the error it returns. It's not invoked on Windows.
+	ConnSocketOpt func(fd int) error
+
+	// Ticker indicates whether the ticker has been set up, which fires EventHandler.Tick on a single event-loop,
+	// or ElapsedTicker.OnTick with the time elapsed since the last tick if the event handler implements it.
 	Ticker bool
 
-	// TCPKeepAlive (SO_KEEPALIVE) socket option.
+	// PerLoopTicker indicates whether each event-loop has its own ticker firing LoopTicker.OnLoopTick
+	// on the event-loop, including the event-loops added by scaling. It has no effect unless the event handler
+	// implements LoopTicker.
+	PerLoopTicker bool
+
+	// TCPKeepAlive (SO_KEEPALIVE) socket option, it's the idle time before keepalive probes are sent (TCP_KEEPIDLE).
 	TCPKeepAlive time.Duration
 
+	// TCPKeepAliveInterval is the interval between keepalive probes (TCP_KEEPINTVL), TCPKeepAlive is used if it's 0.
+	// Like TCPKeepAliveCount, it doesn't apply on Windows, where the interval is TCPKeepAlive.
+	TCPKeepAliveInterval time.Duration
+
+	// TCPKeepAliveCount is the number of unacknowledged keepalive probes before the connection is dropped
+	// (TCP_KEEPCNT), the system default is used if it's 0.
+	TCPKeepAliveCount int
+
+	// MaxConnections is the maximum number of open connections of the server, new connections beyond that
+	// will be closed right after being accepted and RejectionHandler.OnConnectionRejected will be fired.
+	// Zero means no limit.
+	MaxConnections int
+
+	// IdleTimeout is the maximum duration that a connection can be idle, which means nothing is read from or
+	// written to it, connections idle for longer than that will be closed with ErrIdleTimeout passed to OnClosed.
+	// Idle connections are swept every IdleTimeout/2, so they may be closed up to 1.5*IdleTimeout after
+	// the last activity. Zero means no timeout.
+	IdleTimeout time.Duration
+
+	// ReadTimeout is the interval in which a frame is expected from each TCP/Unix connection, otherwise
+	// ReadTimeoutHandler.OnReadTimeout fires on the event-loop, so the handler can do periodic work on idle
+	// connections, e.g. sending keepalives. It keeps firing every ReadTimeout while no frame is decoded.
+	// Zero means no timeout, and it is ignored unless the event handler implements ReadTimeoutHandler.
+	ReadTimeout time.Duration
+
+	// UDPConnected indicates whether each remote peer of UDP listeners gets a persistent connection, which is
+	// created on the first datagram from the peer with OpenHandler.OnOpened fired, and reaped after being idle for
+	// IdleTimeout, or one minute if IdleTimeout is not set. The connection keeps its context across datagrams
+	// and can be written by AsyncWrite, Wake and Close like a TCP one, writes are encoded by the codec
+	// and sent as individual datagrams, while the datagrams read are passed to React as they are.
+	UDPConnected bool
+
+	// UDPBatching indicates whether the datagrams sent by Conn.SendTo within EventHandler.React of UDP connections
+	// are queued and sent together along with the datagram returned by React when React returns, by one
+	// sendmmsg(2) on Linux, or one by one on other platforms, which saves syscalls when replying with multiple
+	// datagrams. It has no effect on Windows.
+	UDPBatching bool
+
+	// UDPBatch is the maximum number of datagrams read from a UDP listener by one recvmmsg(2) on Linux, each of
+	// the datagrams is still passed to EventHandler.React individually, and the datagrams replied to them are sent
+	// together by one sendmmsg(2) once the datagrams read at a time have been handled, unless UDPConnected is set,
+	// with which UDPBatching applies to replies as usual. It amortizes the cost of syscalls under heavy traffic
+	// of small datagrams, for which each event-loop allocates UDPBatch buffers of the size of ReadBufferCap or 64KB.
+	// Datagrams are read one by one on other platforms. Values less than 2 mean no batching.
+	UDPBatch int
+
+	// TLSConfig enables TLS on the accepted stream connections with the config, the handshake is performed
+	// before OpenHandler.OnOpened is fired, and a connection failed in handshake is closed with the error of
+	// handshake passed to EventHandler.OnClosed. The codec encodes/decodes the decrypted stream.
+	// TryWrite and Hijack are not supported on TLS connections.
+	TLSConfig *tls.Config
+
+	// ProxyProtocol indicates whether the accepted stream connections start with a PROXY protocol v1 or v2
+	// header, which is prepended by the load balancers in front of the server, e.g. HAProxy or AWS ELB.
+	// The header is consumed before OpenHandler.OnOpen is fired (and before the TLS handshake if TLSConfig
+	// is set), Conn.RemoteAddr returns the client address carried by it, and the rest of stream is passed
+	// to the codec. Connections with a malformed header are closed with ErrInvalidProxyHeader passed to
+	// EventHandler.OnClosed. Only enable it behind trusted proxies, since clients can forge the header.
+	ProxyProtocol bool
+
 	// ICodec encodes and decodes TCP stream.
 	Codec ICodec
 
+	// BufferGrowthPolicy controls how the ring-buffers of connections grow and shrink.
+	BufferGrowthPolicy BufferGrowthPolicy
+
+	// ReadBufferCap is the number of bytes read from a TCP connection at a time, 64KB by default, and the initial
+	// capacity of the inbound ring-buffer of each connection, which never shrinks below it, see
+	// BufferGrowthPolicy.MinSize. Setting it to the size of typical messages of large-payload workloads saves
+	// the reallocations of growing and shrinking the inbound ring-buffers.
+	// The inbound ring-buffers are still taken from and put back to the pool shared by all servers, a ring-buffer
+	// smaller than ReadBufferCap is grown on being taken, and the pool drops the ring-buffers much larger than
+	// most of the ones put back, so a large ReadBufferCap pays an allocation per connection unless it's common.
+	// Datagrams are always read with a buffer of at least 64KB, regardless of it.
+	ReadBufferCap int
+
+	// ZeroCopyDebug indicates whether to overwrite the frames decoded by ZeroCopyCodec with garbage once they are
+	// released, so that the frames used after EventHandler.React returns are noticeable rather than silently
+	// corrupted by the subsequent data. It's meant for debugging and tests, since it costs a pass over every frame.
+	ZeroCopyDebug bool
+
+	// WriteBufferCap is the maximum number of bytes pending to be written to a connection, including the data queued
+	// by AsyncWrite and the data in outbound buffer, AsyncWrite returns ErrWriteBufferFull rather than queueing more
+	// data once the pending bytes exceed it, see Conn.OutboundBuffered. Zero means no limit.
+	WriteBufferCap int
+
+	// WriteBufferLowWater is the number of bytes pending to be written to a connection that has exceeded
+	// WriteBufferCap, to which it has to drain before WritableHandler.OnWritable fires, half of WriteBufferCap
+	// by default.
+	WriteBufferLowWater int
+
+	// ConnRateLimit is the maximum number of bytes read from each TCP connection per second, which are allowed
+	// to be read at once up to ConnRateBurst bytes, a non-positive ConnRateBurst defaults to ConnRateLimit.
+	// Once a connection is over the limit, the event-loop stops polling it for readable events until the rate
+	// falls under the limit, so that the data of an abusive client is held back in the kernel by TCP flow control,
+	// see Conn.RateLimiter for adjusting the limit of a connection. Zero means no limit.
+	ConnRateLimit int
+
+	// ConnRateBurst is the burst of ConnRateLimit.
+	ConnRateBurst int
+
+	// LoopQueueCap is the maximum number of jobs queued for each event-loop by the users of connections,
+	// i.e. AsyncWrite, Flush and Wake, see Server.LoopQueueLengths. Once the queue is full, LoopOverflowPolicy
+	// decides what to do with the new jobs. Zero means no limit.
+	LoopQueueCap int
+
+	// LoopOverflowPolicy is the behavior of the queue of an event-loop when it is full, Block by default,
+	// see LoopOverflowPolicy for the trade-offs of the policies.
+	LoopOverflowPolicy LoopOverflowPolicy
+
+	// ReactPool is the number of goroutines in the worker pool which EventHandler.React of stream connections
+	// is offloaded to, so that heavy processing of frames doesn't hold up the other connections of event-loop.
+	// The frames of a connection are reacted to one by one in order, and the returned data and action are handled
+	// on the event-loop afterwards. React on the pool gets a copy of frame and must only call the methods of
+	// Conn which are safe for concurrent use, e.g. AsyncWrite. The event-loop waits for a free worker once
+	// all of them are busy. Zero means React is invoked on the event-loops.
+	ReactPool int
+
 	// Logger is the customized logger for logging info, if it is not set,
 	// default standard logger from log package is used.
 	Logger Logger
+
+	// LeveledLogger is the customized logger for logging messages by level, which takes precedence over Logger,
+	// so that gnet can be integrated with the logging of application, e.g. zap or logrus, and the noisy
+	// messages can be silenced by level. If it is not set, the messages of all levels are logged by Logger.
+	LeveledLogger LeveledLogger
+}
+
+// ConnOption is a function that sets up a connection in OpenHandler.OnOpen, e.g. a socket option.
+type ConnOption func(c Conn) error
+
+// WithConnNoDelay sets up TCP_NODELAY socket option of the connection.
+func WithConnNoDelay(noDelay bool) ConnOption {
+	return func(c Conn) error {
+		return c.SetNoDelay(noDelay)
+	}
+}
+
+// WithConnLogLabel attaches a key-value label to the logging context of the connection.
+func WithConnLogLabel(key, value string) ConnOption {
+	return func(c Conn) error {
+		c.SetLogLabel(key, value)
+		return nil
+	}
+}
+
+// WithConnFrameQuota sets up the frame quota of the connection, see Conn.SetFrameQuota.
+func WithConnFrameQuota(n int64) ConnOption {
+	return func(c Conn) error {
+		c.SetFrameQuota(n)
+		return nil
+	}
 }
 
 // WithOptions sets up all options.
@@ -70,6 +275,13 @@ func WithLoadBalancing(lb LoadBalancing) Option {
 	}
 }
 
+// WithLoadBalancer sets up the customized load-balancing strategy in gnet server.
+func WithLoadBalancer(lb LoadBalancer) Option {
+	return func(opts *Options) {
+		opts.LoadBalancer = lb
+	}
+}
+
 // WithNumEventLoop sets up NumEventLoop in gnet server.
 func WithNumEventLoop(numEventLoop int) Option {
 	return func(opts *Options) {
@@ -84,6 +296,104 @@ func WithReusePort(reusePort bool) Option {
 	}
 }
 
+// WithReuseAddr sets up SO_REUSEADDR socket option.
+func WithReuseAddr(reuseAddr bool) Option {
+	return func(opts *Options) {
+		opts.ReuseAddr = reuseAddr
+	}
+}
+
+// WithAcceptBacklog sets up the backlog of the listening stream sockets.
+func WithAcceptBacklog(n int) Option {
+	return func(opts *Options) {
+		opts.AcceptBacklog = n
+	}
+}
+
+// WithSocketOpt sets up the function applying socket options to the listening sockets.
+func WithSocketOpt(socketOpt func(fd int) error) Option {
+	return func(opts *Options) {
+		opts.SocketOpt = socketOpt
+	}
+}
+
+// WithConnSocketOpt sets up the function applying socket options to the accepted connections.
+func WithConnSocketOpt(connSocketOpt func(fd int) error) Option {
+	return func(opts *Options) {
+		opts.ConnSocketOpt = connSocketOpt
+	}
+}
+
+// WithCPUAffinity sets up CPUAffinity in gnet server.
+func WithCPUAffinity(cpus []int) Option {
+	return func(opts *Options) {
+		opts.CPUAffinity = cpus
+	}
+}
+
+// WithIncomingCPUAffinity sets up IncomingCPUAffinity in gnet server.
+func WithIncomingCPUAffinity(incomingCPUAffinity bool) Option {
+	return func(opts *Options) {
+		opts.IncomingCPUAffinity = incomingCPUAffinity
+	}
+}
+
+// WithMaxConnections sets up the maximum number of open connections.
+func WithMaxConnections(maxConnections int) Option {
+	return func(opts *Options) {
+		opts.MaxConnections = maxConnections
+	}
+}
+
+// WithReadTimeout sets up the interval of firing OnReadTimeout on connections without frames.
+func WithReadTimeout(readTimeout time.Duration) Option {
+	return func(opts *Options) {
+		opts.ReadTimeout = readTimeout
+	}
+}
+
+// WithTLSConfig sets up the TLS config of stream connections.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(opts *Options) {
+		opts.TLSConfig = config
+	}
+}
+
+// WithProxyProtocol sets up parsing the PROXY protocol header of stream connections.
+func WithProxyProtocol(proxyProtocol bool) Option {
+	return func(opts *Options) {
+		opts.ProxyProtocol = proxyProtocol
+	}
+}
+
+// WithUDPConnected indicates whether remote peers of UDP listeners get persistent connections.
+func WithUDPConnected(connected bool) Option {
+	return func(opts *Options) {
+		opts.UDPConnected = connected
+	}
+}
+
+// WithUDPBatch sets up the maximum number of datagrams read from a UDP listener at a time.
+func WithUDPBatch(n int) Option {
+	return func(opts *Options) {
+		opts.UDPBatch = n
+	}
+}
+
+// WithUDPBatching indicates whether the datagrams sent within React of UDP connections are sent together.
+func WithUDPBatching(batching bool) Option {
+	return func(opts *Options) {
+		opts.UDPBatching = batching
+	}
+}
+
+// WithIdleTimeout sets up the timeout of idle connections.
+func WithIdleTimeout(idleTimeout time.Duration) Option {
+	return func(opts *Options) {
+		opts.IdleTimeout = idleTimeout
+	}
+}
+
 // WithTCPKeepAlive sets up SO_KEEPALIVE socket option.
 func WithTCPKeepAlive(tcpKeepAlive time.Duration) Option {
 	return func(opts *Options) {
@@ -91,6 +401,15 @@ func WithTCPKeepAlive(tcpKeepAlive time.Duration) Option {
 	}
 }
 
+// WithTCPKeepAliveEx sets up SO_KEEPALIVE socket option with the idle time, the interval and the count of probes.
+func WithTCPKeepAliveEx(idle, interval time.Duration, count int) Option {
+	return func(opts *Options) {
+		opts.TCPKeepAlive = idle
+		opts.TCPKeepAliveInterval = interval
+		opts.TCPKeepAliveCount = count
+	}
+}
+
 // WithTicker indicates that a ticker is set.
 func WithTicker(ticker bool) Option {
 	return func(opts *Options) {
@@ -98,6 +417,13 @@ func WithTicker(ticker bool) Option {
 	}
 }
 
+// WithPerLoopTicker indicates that a ticker is set for each event-loop.
+func WithPerLoopTicker(perLoopTicker bool) Option {
+	return func(opts *Options) {
+		opts.PerLoopTicker = perLoopTicker
+	}
+}
+
 // WithCodec sets up a codec to handle TCP stream.
 func WithCodec(codec ICodec) Option {
 	return func(opts *Options) {
@@ -105,9 +431,81 @@ func WithCodec(codec ICodec) Option {
 	}
 }
 
+// WithZeroCopyDebug sets up ZeroCopyDebug in gnet server.
+func WithZeroCopyDebug(zeroCopyDebug bool) Option {
+	return func(opts *Options) {
+		opts.ZeroCopyDebug = zeroCopyDebug
+	}
+}
+
+// WithWriteBufferCap sets up the maximum number of bytes pending to be written to a connection.
+func WithWriteBufferCap(n int) Option {
+	return func(opts *Options) {
+		opts.WriteBufferCap = n
+	}
+}
+
+// WithWriteBufferLowWater sets up the number of pending bytes to which a full connection drains before OnWritable.
+func WithWriteBufferLowWater(n int) Option {
+	return func(opts *Options) {
+		opts.WriteBufferLowWater = n
+	}
+}
+
+// WithConnRateLimit sets up ConnRateLimit and ConnRateBurst in gnet server.
+func WithConnRateLimit(bytesPerSec, burst int) Option {
+	return func(opts *Options) {
+		opts.ConnRateLimit = bytesPerSec
+		opts.ConnRateBurst = burst
+	}
+}
+
+// WithLoopQueueCap sets up the maximum number of jobs queued for each event-loop.
+func WithLoopQueueCap(n int) Option {
+	return func(opts *Options) {
+		opts.LoopQueueCap = n
+	}
+}
+
+// WithLoopOverflowPolicy sets up the behavior of the queue of an event-loop when it is full.
+func WithLoopOverflowPolicy(policy LoopOverflowPolicy) Option {
+	return func(opts *Options) {
+		opts.LoopOverflowPolicy = policy
+	}
+}
+
+// WithReactPool sets up the number of goroutines which React is offloaded to.
+func WithReactPool(size int) Option {
+	return func(opts *Options) {
+		opts.ReactPool = size
+	}
+}
+
 // WithLogger sets up a customized logger.
 func WithLogger(logger Logger) Option {
 	return func(opts *Options) {
 		opts.Logger = logger
 	}
 }
+
+// WithLeveledLogger sets up a customized logger logging messages by level.
+func WithLeveledLogger(logger LeveledLogger) Option {
+	return func(opts *Options) {
+		opts.LeveledLogger = logger
+	}
+}
+
+// WithReadBufferCap sets up the number of bytes read from a connection at a time and the initial capacity of
+// inbound ring-buffers.
+func WithReadBufferCap(n int) Option {
+	return func(opts *Options) {
+		opts.ReadBufferCap = n
+	}
+}
+
+// WithBufferGrowthPolicy sets up the policy of resizing the ring-buffers of connections.
+func WithBufferGrowthPolicy(policy BufferGrowthPolicy) Option {
+	return func(opts *Options) {
+		opts.BufferGrowthPolicy = policy
+	}
+}
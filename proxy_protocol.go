@@ -0,0 +1,140 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+)
+
+const (
+	// proxyV1MaxLength is the maximum length of a PROXY protocol v1 header, including the CRLF.
+	proxyV1MaxLength = 107
+	// proxyV2HeaderLength is the length of the fixed part of a PROXY protocol v2 header.
+	proxyV2HeaderLength = 16
+)
+
+var (
+	proxyV1Prefix    = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// parseProxyHeader parses the PROXY protocol v1 or v2 header at the beginning of buf, it returns the client
+// address carried by the header and the length of header. The address is nil if the header doesn't carry one,
+// e.g. the v1 UNKNOWN or the v2 LOCAL command of health checks by the proxy itself. ErrIncompletePacket
+// is returned if buf is too short to have the whole header.
+func parseProxyHeader(buf []byte) (addr net.Addr, n int, err error) {
+	switch {
+	case hasPrefixOf(buf, proxyV2Signature):
+		return parseProxyV2Header(buf)
+	case hasPrefixOf(buf, proxyV1Prefix):
+		return parseProxyV1Header(buf)
+	}
+	return nil, 0, ErrInvalidProxyHeader
+}
+
+// hasPrefixOf reports whether buf begins with prefix, or is a prefix of it.
+func hasPrefixOf(buf, prefix []byte) bool {
+	if len(buf) < len(prefix) {
+		return bytes.HasPrefix(prefix, buf)
+	}
+	return bytes.HasPrefix(buf, prefix)
+}
+
+func parseProxyV1Header(buf []byte) (net.Addr, int, error) {
+	end := bytes.Index(buf, []byte("\r\n"))
+	if end < 0 {
+		if len(buf) >= proxyV1MaxLength {
+			return nil, 0, ErrInvalidProxyHeader
+		}
+		return nil, 0, ErrIncompletePacket
+	}
+	n := end + 2
+	if n > proxyV1MaxLength {
+		return nil, 0, ErrInvalidProxyHeader
+	}
+	fields := bytes.Split(buf[len(proxyV1Prefix):end], []byte(" "))
+	switch string(fields[0]) {
+	case "UNKNOWN":
+		return nil, n, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, 0, ErrInvalidProxyHeader
+	}
+	if len(fields) != 5 {
+		return nil, 0, ErrInvalidProxyHeader
+	}
+	ipv6 := string(fields[0]) == "TCP6"
+	for _, f := range fields[1:3] {
+		if net.ParseIP(string(f)) == nil || (bytes.IndexByte(f, ':') >= 0) != ipv6 {
+			return nil, 0, ErrInvalidProxyHeader
+		}
+	}
+	ip := net.ParseIP(string(fields[1]))
+	port, err := strconv.ParseUint(string(fields[3]), 10, 16)
+	if err != nil {
+		return nil, 0, ErrInvalidProxyHeader
+	}
+	if _, err = strconv.ParseUint(string(fields[4]), 10, 16); err != nil {
+		return nil, 0, ErrInvalidProxyHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, n, nil
+}
+
+func parseProxyV2Header(buf []byte) (net.Addr, int, error) {
+	if len(buf) < proxyV2HeaderLength {
+		return nil, 0, ErrIncompletePacket
+	}
+	verCmd, famProto := buf[12], buf[13]
+	if verCmd>>4 != 2 {
+		return nil, 0, ErrInvalidProxyHeader
+	}
+	n := proxyV2HeaderLength + int(binary.BigEndian.Uint16(buf[14:16]))
+	if len(buf) < n {
+		return nil, 0, ErrIncompletePacket
+	}
+	switch verCmd & 0xf {
+	case 0: // LOCAL
+		return nil, n, nil
+	case 1: // PROXY
+	default:
+		return nil, 0, ErrInvalidProxyHeader
+	}
+	addrs := buf[proxyV2HeaderLength:n]
+	udp := famProto&0xf == 2
+	switch famProto >> 4 {
+	case 1: // AF_INET
+		if len(addrs) < 12 {
+			return nil, 0, ErrInvalidProxyHeader
+		}
+		return proxyIPAddr(net.IP(addrs[:4]).To16(), binary.BigEndian.Uint16(addrs[8:10]), udp), n, nil
+	case 2: // AF_INET6
+		if len(addrs) < 36 {
+			return nil, 0, ErrInvalidProxyHeader
+		}
+		return proxyIPAddr(net.IP(addrs[:16]), binary.BigEndian.Uint16(addrs[32:34]), udp), n, nil
+	case 3: // AF_UNIX
+		if len(addrs) < 216 {
+			return nil, 0, ErrInvalidProxyHeader
+		}
+		name := addrs[:108]
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		return &net.UnixAddr{Name: string(name), Net: "unix"}, n, nil
+	}
+	// AF_UNSPEC, the address is unknown.
+	return nil, n, nil
+}
+
+func proxyIPAddr(ip net.IP, port uint16, udp bool) net.Addr {
+	ip = append(net.IP(nil), ip...)
+	if udp {
+		return &net.UDPAddr{IP: ip, Port: int(port)}
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}
+}
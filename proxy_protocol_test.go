@@ -0,0 +1,75 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func proxyV2Header(cmd, famProto byte, addrs []byte) []byte {
+	buf := append([]byte{}, proxyV2Signature...)
+	buf = append(buf, 0x20|cmd, famProto, 0, 0)
+	binary.BigEndian.PutUint16(buf[14:], uint16(len(addrs)))
+	return append(buf, addrs...)
+}
+
+func TestParseProxyHeader(t *testing.T) {
+	inet := append(net.IPv4(203, 0, 113, 7).To4(), 198, 51, 100, 1, 0xc8, 0x22, 0x01, 0xbb)
+	inet6 := make([]byte, 36)
+	copy(inet6, net.ParseIP("2001:db8::7"))
+	binary.BigEndian.PutUint16(inet6[32:], 51234)
+	unixAddrs := make([]byte, 216)
+	copy(unixAddrs, "/tmp/client.sock")
+	tests := []struct {
+		name   string
+		header []byte
+		addr   string
+		err    error
+	}{
+		{"v1 tcp4", []byte("PROXY TCP4 203.0.113.7 198.51.100.1 51234 443\r\n"), "203.0.113.7:51234", nil},
+		{"v1 tcp6", []byte("PROXY TCP6 2001:db8::7 2001:db8::1 51234 443\r\n"), "[2001:db8::7]:51234", nil},
+		{"v1 unknown", []byte("PROXY UNKNOWN ff ff\r\n"), "", nil},
+		{"v1 family mismatch", []byte("PROXY TCP4 2001:db8::7 2001:db8::1 51234 443\r\n"), "", ErrInvalidProxyHeader},
+		{"v1 bad port", []byte("PROXY TCP4 203.0.113.7 198.51.100.1 65536 443\r\n"), "", ErrInvalidProxyHeader},
+		{"v1 too long", append([]byte("PROXY UNKNOWN "), make([]byte, 100)...), "", ErrInvalidProxyHeader},
+		{"v2 inet", proxyV2Header(1, 0x11, inet), "203.0.113.7:51234", nil},
+		{"v2 inet6", proxyV2Header(1, 0x21, inet6), "[2001:db8::7]:51234", nil},
+		{"v2 unix", proxyV2Header(1, 0x31, unixAddrs), "/tmp/client.sock", nil},
+		{"v2 local", proxyV2Header(0, 0x00, nil), "", nil},
+		{"v2 truncated addresses", proxyV2Header(1, 0x11, inet[:8]), "", ErrInvalidProxyHeader},
+		{"v2 bad version", append(append([]byte{}, proxyV2Signature...), 0x11, 0x11, 0, 0), "", ErrInvalidProxyHeader},
+		{"no header", []byte("GET / HTTP/1.1\r\n"), "", ErrInvalidProxyHeader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append(append([]byte{}, tt.header...), "payload"...)
+			addr, n, err := parseProxyHeader(data)
+			if err != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if n != len(tt.header) {
+				t.Fatalf("expected header length %d, got %d", len(tt.header), n)
+			}
+			if got := ""; addr != nil {
+				if got = addr.String(); got != tt.addr {
+					t.Fatalf("expected address %q, got %q", tt.addr, got)
+				}
+			} else if tt.addr != "" {
+				t.Fatalf("expected address %q, got nil", tt.addr)
+			}
+			// Every prefix of the header is incomplete.
+			for i := 0; i < len(tt.header); i++ {
+				if _, _, err = parseProxyHeader(tt.header[:i]); err != ErrIncompletePacket {
+					t.Fatalf("expected %v with %d bytes of header, got %v", ErrIncompletePacket, i, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket limiting the rate of bytes read from a connection, see Options.ConnRateLimit.
+// Tokens are refilled at the rate of bytesPerSec up to burst, the bytes read take away the tokens and reading
+// is paused while the bucket is in debt. It's safe to adjust it from any goroutine.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens refilled per second
+	burst  float64 // capacity of the bucket
+	tokens float64 // tokens in the bucket, negative while the bucket is in debt
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSec, burst int) *RateLimiter {
+	l := &RateLimiter{last: time.Now()}
+	l.setLimit(bytesPerSec, burst)
+	l.tokens = l.burst
+	return l
+}
+
+// SetLimit changes the rate and the burst of the limiter, a non-positive burst defaults to bytesPerSec and
+// a non-positive bytesPerSec lifts the limit. A connection paused by the old limit checks the new one when
+// the pause computed by the old limit is over.
+func (l *RateLimiter) SetLimit(bytesPerSec, burst int) {
+	l.mu.Lock()
+	l.refill(time.Now())
+	l.setLimit(bytesPerSec, burst)
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.mu.Unlock()
+}
+
+// Limit returns the rate and the burst of the limiter.
+func (l *RateLimiter) Limit() (bytesPerSec, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.rate), int(l.burst)
+}
+
+func (l *RateLimiter) setLimit(bytesPerSec, burst int) {
+	if burst <= 0 {
+		burst = bytesPerSec
+	}
+	l.rate, l.burst = float64(bytesPerSec), float64(burst)
+}
+
+func (l *RateLimiter) refill(now time.Time) {
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens += elapsed.Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+}
+
+// take takes away n tokens for the bytes read, it returns how long reading must be paused for the bucket to get
+// out of debt, 0 means reading can go on.
+func (l *RateLimiter) take(n int, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return 0
+	}
+	l.refill(now)
+	l.tokens -= float64(n)
+	return l.delay()
+}
+
+// wait returns how long reading must be paused for the bucket to get out of debt, 0 means reading can resume.
+func (l *RateLimiter) wait(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return 0
+	}
+	l.refill(now)
+	return l.delay()
+}
+
+func (l *RateLimiter) delay() time.Duration {
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
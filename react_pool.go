@@ -0,0 +1,80 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import (
+	"github.com/panjf2000/ants/v2"
+	"github.com/panjf2000/gnet/pool/goroutine"
+)
+
+// newReactPool creates the worker pool of Options.ReactPool, whose submissions wait for a free worker
+// rather than failing when all the workers are busy.
+func newReactPool(size int) (*goroutine.Pool, error) {
+	return ants.NewPool(size, ants.WithExpiryDuration(goroutine.ExpiryDuration))
+}
+
+// pooledFrame is a frame queued to be reacted to on the react pool.
+type pooledFrame struct {
+	frame   []byte
+	wake    bool // passed to React even if the event handler is a FramesReactor, e.g. the frames of Wake
+	timeout bool // fires ReadTimeoutHandler.OnReadTimeout rather than React
+}
+
+// queueReact queues a copy of the frame to be reacted to on the react pool, for the frame is only valid
+// until the event-loop reads again.
+func queueReact(queue []pooledFrame, frame []byte) []pooledFrame {
+	return append(queue, pooledFrame{frame: append([]byte{}, frame...)})
+}
+
+// queueWake queues the frame of Wake or WakeWith as it is to be reacted to on the react pool,
+// behind the frames decoded before, so that it never reacts concurrently with them.
+func queueWake(queue []pooledFrame, frame []byte) []pooledFrame {
+	return append(queue, pooledFrame{frame: frame, wake: true})
+}
+
+// queueReadTimeout queues the read timeout to fire OnReadTimeout on the react pool, behind the frames decoded before.
+func queueReadTimeout(queue []pooledFrame) []pooledFrame {
+	return append(queue, pooledFrame{timeout: true})
+}
+
+// reactOnPool reacts to the frames in order on the react pool, by ReactFrames if the event handler is a FramesReactor
+// unless the frame is queued by queueWake,
+// the result of each frame is handed over to the event-loop by run, the frames after the one which React returns
+// an action other than None for are dropped. done is handed over to the event-loop at last.
+func (svr *server) reactOnPool(c Conn, frames []pooledFrame, run func(func() error), result func(out []byte, action Action) error, done func() error) error {
+	return svr.reactPool.Submit(func() {
+		for _, f := range frames {
+			var action Action
+			if f.timeout {
+				var out []byte
+				out, action = svr.timeoutHandler.OnReadTimeout(c)
+				run(func() error {
+					return result(out, action)
+				})
+			} else if svr.framesReactor != nil && !f.wake {
+				var outs [][]byte
+				outs, action = svr.framesReactor.ReactFrames(f.frame, c)
+				run(func() error {
+					for _, out := range outs {
+						if err := result(out, None); err != nil {
+							return err
+						}
+					}
+					return result(nil, action)
+				})
+			} else {
+				var out []byte
+				out, action = svr.eventHandler.React(f.frame, c)
+				run(func() error {
+					return result(out, action)
+				})
+			}
+			if action != None {
+				break
+			}
+		}
+		run(done)
+	})
+}
@@ -11,24 +11,31 @@ import "github.com/panjf2000/gnet/internal/netpoll"
 func (svr *server) activateMainReactor() {
 	defer svr.signalShutdown()
 
-	svr.logger.Printf("main reactor exits with error:%v\n", svr.mainLoop.poller.Polling(func(fd int, filter int16) error {
+	svr.logger.Infof("main reactor exits with error:%v\n", svr.mainLoop.poller.Polling(func(fd int, filter int16) error {
 		return svr.acceptNewConnection(fd)
 	}))
 }
 
 func (svr *server) activateSubReactor(el *eventloop) {
-	defer svr.signalShutdown()
+	var err error
+	defer func() {
+		svr.signalShutdown()
+	}()
 
+	el.pinCPU()
 	if el.idx == 0 && svr.opts.Ticker {
 		go el.loopTicker()
 	}
+	if svr.opts.PerLoopTicker && svr.loopTicker != nil {
+		go el.loopPerLoopTicker()
+	}
 
-	svr.logger.Printf("event-loop:%d exits with error:%v\n", el.idx, el.poller.Polling(func(fd int, filter int16) error {
-		if c, ack := el.connections[fd]; ack {
+	err = el.poller.Polling(func(fd int, filter int16) error {
+		if c, ack := el.connections[fd]; ack && !c.hijacked {
 			if filter == netpoll.EVFilterSock {
 				return el.loopCloseConn(c, nil)
 			}
-			switch c.outboundBuffer.IsEmpty() {
+			switch c.outboundEmpty() {
 			// Don't change the ordering of processing EVFILT_WRITE | EVFILT_READ | EV_ERROR/EV_EOF unless you're 100%
 			// sure what you're doing!
 			// Re-ordering can easily introduce bugs and bad side-effects, as I found out painfully in the past.
@@ -45,5 +52,6 @@ func (svr *server) activateSubReactor(el *eventloop) {
 			}
 		}
 		return nil
-	}))
+	})
+	svr.logger.Infof("event-loop:%d exits with error:%v\n", el.idx, err)
 }
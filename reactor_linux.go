@@ -11,12 +11,13 @@ import "github.com/panjf2000/gnet/internal/netpoll"
 func (svr *server) activateMainReactor() {
 	defer svr.signalShutdown()
 
-	svr.logger.Printf("main reactor exits with error:%v\n", svr.mainLoop.poller.Polling(func(fd int, ev uint32) error {
+	svr.logger.Infof("main reactor exits with error:%v\n", svr.mainLoop.poller.Polling(func(fd int, ev uint32) error {
 		return svr.acceptNewConnection(fd)
 	}))
 }
 
 func (svr *server) activateSubReactor(el *eventloop) {
+	var err error
 	defer func() {
 		if el.idx == 0 && svr.opts.Ticker {
 			close(svr.ticktock)
@@ -24,13 +25,17 @@ func (svr *server) activateSubReactor(el *eventloop) {
 		svr.signalShutdown()
 	}()
 
+	el.pinCPU()
 	if el.idx == 0 && svr.opts.Ticker {
 		go el.loopTicker()
 	}
+	if svr.opts.PerLoopTicker && svr.loopTicker != nil {
+		go el.loopPerLoopTicker()
+	}
 
-	svr.logger.Printf("event-loop:%d exits with error:%v\n", el.idx, el.poller.Polling(func(fd int, ev uint32) error {
-		if c, ack := el.connections[fd]; ack {
-			switch c.outboundBuffer.IsEmpty() {
+	err = el.poller.Polling(func(fd int, ev uint32) error {
+		if c, ack := el.connections[fd]; ack && !c.hijacked {
+			switch c.outboundEmpty() {
 			// Don't change the ordering of processing EPOLLOUT | EPOLLRDHUP / EPOLLIN unless you're 100%
 			// sure what you're doing!
 			// Re-ordering can easily introduce bugs and bad side-effects, as I found out painfully in the past.
@@ -47,5 +52,6 @@ func (svr *server) activateSubReactor(el *eventloop) {
 			}
 		}
 		return nil
-	}))
+	})
+	svr.logger.Infof("event-loop:%d exits with error:%v\n", el.idx, err)
 }
@@ -0,0 +1,17 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build darwin netbsd freebsd openbsd dragonfly
+
+package gnet
+
+import "net"
+
+// udpBatch is not used on these platforms, for recvmmsg(2) is not available.
+type udpBatch struct{}
+
+// loopReadUDPBatch reads one datagram from the UDP listener, for recvmmsg(2) is not available on these platforms.
+func (el *eventloop) loopReadUDPBatch(fd int, localAddr net.Addr) error {
+	return el.loopReadUDP(fd, localAddr)
+}
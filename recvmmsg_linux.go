@@ -0,0 +1,143 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package gnet
+
+import (
+	"net"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// udpBatch holds the buffers of the datagrams read by one recvmmsg(2), see Options.UDPBatch.
+type udpBatch struct {
+	bufs     [][]byte
+	iovs     []unix.Iovec
+	names    []unix.RawSockaddrAny
+	msgs     []mmsghdr
+	conns    []*conn         // connections of the datagrams handled, whose replies are sent once the batch is handled
+	out      [][]byte        // datagrams replied to the batch
+	outSA    []unix.Sockaddr // destinations of out
+	outConns []*conn         // connections sending out
+}
+
+func newUDPBatch(n, size int) *udpBatch {
+	b := &udpBatch{
+		bufs:  make([][]byte, n),
+		iovs:  make([]unix.Iovec, n),
+		names: make([]unix.RawSockaddrAny, n),
+		msgs:  make([]mmsghdr, n),
+	}
+	for i := range b.msgs {
+		b.bufs[i] = make([]byte, size)
+		b.iovs[i].Base = &b.bufs[i][0]
+		b.iovs[i].SetLen(size)
+		b.msgs[i].hdr.Name = (*byte)(unsafe.Pointer(&b.names[i]))
+		b.msgs[i].hdr.Iov = &b.iovs[i]
+		b.msgs[i].hdr.SetIovlen(1)
+	}
+	return b
+}
+
+// read reads the datagrams from fd by recvmmsg(2), it returns the number of datagrams read.
+func (b *udpBatch) read(fd int) (int, error) {
+	for i := range b.msgs {
+		b.msgs[i].hdr.Namelen = unix.SizeofSockaddrAny
+	}
+	n, _, errno := unix.Syscall6(unix.SYS_RECVMMSG, uintptr(fd),
+		uintptr(unsafe.Pointer(&b.msgs[0])), uintptr(len(b.msgs)), 0, 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(n), nil
+}
+
+// datagram returns the i-th datagram read and the address of its sender.
+func (b *udpBatch) datagram(i int) ([]byte, unix.Sockaddr) {
+	return b.bufs[i][:b.msgs[i].len], sockaddrFromRaw(&b.names[i])
+}
+
+// sockaddrFromRaw converts the raw IP socket address filled by recvmmsg(2) into the socket address.
+func sockaddrFromRaw(rsa *unix.RawSockaddrAny) unix.Sockaddr {
+	switch rsa.Addr.Family {
+	case unix.AF_INET:
+		raw := (*unix.RawSockaddrInet4)(unsafe.Pointer(rsa))
+		port := (*[2]byte)(unsafe.Pointer(&raw.Port))
+		return &unix.SockaddrInet4{Port: int(port[0])<<8 | int(port[1]), Addr: raw.Addr}
+	case unix.AF_INET6:
+		raw := (*unix.RawSockaddrInet6)(unsafe.Pointer(rsa))
+		port := (*[2]byte)(unsafe.Pointer(&raw.Port))
+		return &unix.SockaddrInet6{Port: int(port[0])<<8 | int(port[1]), ZoneId: raw.Scope_id, Addr: raw.Addr}
+	}
+	return nil
+}
+
+// loopReadUDPBatch reads the datagrams from the UDP listener by one recvmmsg(2) and passes them to React one by one,
+// the datagrams replied to them by the connections which are not persistent are sent by one sendmmsg(2) at last.
+func (el *eventloop) loopReadUDPBatch(fd int, localAddr net.Addr) error {
+	b := el.udpBatch
+	if b == nil {
+		b = newUDPBatch(el.svr.opts.UDPBatch, el.svr.packetSize())
+		el.udpBatch = b
+	}
+	n, err := b.read(fd)
+	if err != nil || n == 0 {
+		if err != nil && err != unix.EAGAIN {
+			el.svr.logger.Errorf("failed to read UDP packets from fd:%d, error:%v\n", fd, err)
+		}
+		return nil
+	}
+	for i := 0; i < n && err == nil; i++ {
+		packet, sa := b.datagram(i)
+		if el.svr.opts.UDPConnected {
+			err = el.loopReadConnectedUDP(fd, sa, localAddr, packet)
+			continue
+		}
+		c := newUDPConn(fd, el, sa, localAddr)
+		c.addBytesRead(len(packet))
+		c.cork()
+		out, action := el.eventHandler.React(packet, c)
+		if out != nil {
+			el.eventHandler.PreWrite()
+			_ = c.sendTo(out)
+		}
+		b.conns = append(b.conns, c)
+		if action == Shutdown {
+			err = ErrServerShutdown
+		}
+	}
+	el.flushUDPBatch(fd, b)
+	return err
+}
+
+// flushUDPBatch sends the datagrams replied to the batch by one sendmmsg(2) and releases the connections.
+func (el *eventloop) flushUDPBatch(fd int, b *udpBatch) {
+	for _, c := range b.conns {
+		for _, buf := range c.uncorked() {
+			b.out = append(b.out, buf)
+			b.outSA = append(b.outSA, c.sa)
+			b.outConns = append(b.outConns, c)
+		}
+	}
+	sent, err := sendDatagramsTo(fd, b.out, b.outSA)
+	if err != nil {
+		el.svr.logger.Errorf("failed to send %d UDP packets from fd:%d, error:%v\n", len(b.out)-sent, fd, err)
+	}
+	for i, buf := range b.out[:sent] {
+		b.outConns[i].addBytesWritten(len(buf))
+	}
+	for _, c := range b.conns {
+		c.releaseUDP()
+	}
+	for i := range b.out {
+		b.out[i], b.outSA[i], b.outConns[i] = nil, nil, nil
+	}
+	for i := range b.conns {
+		b.conns[i] = nil
+	}
+	b.out, b.outSA, b.outConns, b.conns = b.out[:0], b.outSA[:0], b.outConns[:0], b.conns[:0]
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package gnet
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestUDPBatchRead(t *testing.T) {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_NONBLOCK, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(fd)
+	if err = unix.Bind(fd, &unix.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	lsa, _ := unix.Getsockname(fd)
+	client, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: lsa.(*unix.SockaddrInet4).Port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for i := 0; i < 5; i++ {
+		if _, err = fmt.Fprintf(client, "datagram-%d", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := newUDPBatch(8, 64)
+	n, err := b.read(fd)
+	if err != nil || n != 5 {
+		t.Fatalf("read %d datagrams, error: %v", n, err)
+	}
+	caddr := client.LocalAddr().(*net.UDPAddr)
+	for i := 0; i < n; i++ {
+		packet, sa := b.datagram(i)
+		if want := fmt.Sprintf("datagram-%d", i); string(packet) != want {
+			t.Fatalf("datagram %d: got %q, want %q", i, packet, want)
+		}
+		if sa4, ok := sa.(*unix.SockaddrInet4); !ok || sa4.Port != caddr.Port {
+			t.Fatalf("datagram %d: got address %v, want port %d", i, sa, caddr.Port)
+		}
+	}
+}
+
+type testUDPBatchServer struct {
+	*EventServer
+	count   int
+	started bool
+	done    chan error
+	err     error
+}
+
+func (s *testUDPBatchServer) React(packet []byte, c Conn) (out []byte, action Action) {
+	return append([]byte{}, packet...), None
+}
+
+func (s *testUDPBatchServer) Tick() (time.Duration, Action) {
+	if s.started {
+		select {
+		case s.err = <-s.done:
+			return time.Hour, Shutdown
+		default:
+			return time.Second / 10, None
+		}
+	}
+	s.started = true
+	go func() {
+		s.done <- func() error {
+			conn, err := net.Dial("udp", "127.0.0.1:9991")
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			for i := 0; i < s.count; i++ {
+				if _, err = fmt.Fprintf(conn, "datagram-%d", i); err != nil {
+					return err
+				}
+			}
+			_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			seen := make(map[string]bool, s.count)
+			buf := make([]byte, 64)
+			for len(seen) < s.count {
+				n, err := conn.Read(buf)
+				if err != nil {
+					return fmt.Errorf("received %d of %d echoes: %v", len(seen), s.count, err)
+				}
+				seen[string(buf[:n])] = true
+			}
+			return nil
+		}()
+	}()
+	return time.Second / 10, None
+}
+
+func TestUDPBatch(t *testing.T) {
+	events := &testUDPBatchServer{EventServer: &EventServer{}, count: 100, done: make(chan error, 1)}
+	if err := Serve(events, "udp://127.0.0.1:9991", WithUDPBatch(16), WithTicker(true)); err != nil {
+		t.Fatal(err)
+	}
+	if err := events.err; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -17,14 +17,33 @@ import (
 // ErrIsEmpty will be returned when trying to read a empty ring-buffer.
 var ErrIsEmpty = errors.New("ring-buffer is empty")
 
+// GrowthPolicy controls how a ring-buffer is resized.
+type GrowthPolicy struct {
+	// GrowBy is the fixed number of bytes that a ring-buffer grows by every time it runs out of space,
+	// or a multiple of it if more space is needed at a time, the ring-buffer doubles its capacity if it is zero.
+	GrowBy int
+
+	// ShrinkAfterIdle is the number of consecutive times that a ring-buffer is drained without having used
+	// more than a quarter of its capacity, after which the ring-buffer will be shrunk to fit the largest amount
+	// of data it held in that period. Zero value means that a ring-buffer never shrinks.
+	ShrinkAfterIdle int
+
+	// MinSize is the capacity that a ring-buffer is grown to when the policy is set, and below which
+	// the ring-buffer never shrinks. Zero value means no minimum.
+	MinSize int
+}
+
 // RingBuffer is a circular buffer that implement io.ReaderWriter interface.
 type RingBuffer struct {
-	buf     []byte
-	size    int
-	mask    int
-	r       int // next position to read
-	w       int // next position to write
-	isEmpty bool
+	buf      []byte
+	size     int
+	r        int // next position to read
+	w        int // next position to write
+	isEmpty  bool
+	policy   GrowthPolicy
+	peak     int // the largest amount of data held since the last drain
+	idlePeak int // the largest amount of data held during the idle period
+	idle     int // number of consecutive idle drains
 }
 
 // New returns a new RingBuffer whose buffer has the given size.
@@ -36,7 +55,6 @@ func New(size int) *RingBuffer {
 	return &RingBuffer{
 		buf:     make([]byte, size),
 		size:    size,
-		mask:    size - 1,
 		isEmpty: true,
 	}
 }
@@ -103,9 +121,10 @@ func (r *RingBuffer) Shift(n int) {
 	}
 
 	if n < r.Length() {
-		r.r = (r.r + n) & r.mask
+		r.r = r.wrap(r.r + n)
 		if r.r == r.w {
 			r.isEmpty = true
+			r.drained()
 		}
 	} else {
 		r.Reset()
@@ -141,6 +160,7 @@ func (r *RingBuffer) Read(p []byte) (n int, err error) {
 		r.r = r.r + n
 		if r.r == r.w {
 			r.isEmpty = true
+			r.drained()
 		}
 		return
 	}
@@ -158,9 +178,10 @@ func (r *RingBuffer) Read(p []byte) (n int, err error) {
 		c2 := n - c1
 		copy(p[c1:], r.buf[:c2])
 	}
-	r.r = (r.r + n) & r.mask
+	r.r = r.wrap(r.r + n)
 	if r.r == r.w {
 		r.isEmpty = true
+		r.drained()
 	}
 
 	return n, err
@@ -178,6 +199,7 @@ func (r *RingBuffer) ReadByte() (b byte, err error) {
 	}
 	if r.r == r.w {
 		r.isEmpty = true
+		r.drained()
 	}
 
 	return b, err
@@ -221,6 +243,7 @@ func (r *RingBuffer) Write(p []byte) (n int, err error) {
 	}
 
 	r.isEmpty = false
+	r.updatePeak()
 
 	return n, err
 }
@@ -237,6 +260,7 @@ func (r *RingBuffer) WriteByte(c byte) error {
 		r.w = 0
 	}
 	r.isEmpty = false
+	r.updatePeak()
 
 	return nil
 }
@@ -362,16 +386,95 @@ func (r *RingBuffer) Reset() {
 	r.r = 0
 	r.w = 0
 	r.isEmpty = true
+	r.drained()
+}
+
+// SetGrowthPolicy sets up the policy of resizing this ring-buffer.
+func (r *RingBuffer) SetGrowthPolicy(policy GrowthPolicy) {
+	r.policy = policy
+	r.peak = r.Length()
+	r.idlePeak = 0
+	r.idle = 0
+	if policy.MinSize > r.size {
+		r.malloc(policy.MinSize - r.size)
+	}
+}
+
+func (r *RingBuffer) updatePeak() {
+	if r.policy.ShrinkAfterIdle > 0 {
+		if n := r.Length(); n > r.peak {
+			r.peak = n
+		}
+	}
+}
+
+// drained is invoked every time this ring-buffer becomes empty, it shrinks the ring-buffer if it has been idle
+// for enough times in a row.
+func (r *RingBuffer) drained() {
+	if r.policy.ShrinkAfterIdle <= 0 || r.size == 0 {
+		return
+	}
+	peak := r.peak
+	r.peak = 0
+	if peak > r.size/4 {
+		r.idle = 0
+		r.idlePeak = 0
+		return
+	}
+	if peak > r.idlePeak {
+		r.idlePeak = peak
+	}
+	if r.idle++; r.idle < r.policy.ShrinkAfterIdle {
+		return
+	}
+	newCap := 0
+	if r.idlePeak > 0 {
+		newCap = internal.CeilToPowerOfTwo(r.idlePeak)
+	}
+	if min := r.policy.MinSize; min > 0 && newCap < min {
+		newCap = internal.CeilToPowerOfTwo(min)
+	}
+	r.idle = 0
+	r.idlePeak = 0
+	if newCap >= r.size {
+		return
+	}
+	r.r = 0
+	r.w = 0
+	r.size = newCap
+	if newCap == 0 {
+		r.buf = nil
+		return
+	}
+	r.buf = make([]byte, newCap)
+}
+
+// wrap returns the position i in the buffer, which is less than twice the size, wrapped around the end of buffer.
+// The size of buffer is not necessarily a power of two, see GrowthPolicy.GrowBy.
+func (r *RingBuffer) wrap(i int) int {
+	if i >= r.size {
+		i -= r.size
+	}
+	return i
 }
 
 func (r *RingBuffer) malloc(cap int) {
-	newCap := internal.CeilToPowerOfTwo(r.size + cap)
+	var newCap int
+	if r.policy.GrowBy > 0 {
+		newCap = r.size + (cap+r.policy.GrowBy-1)/r.policy.GrowBy*r.policy.GrowBy
+	} else {
+		if cap < r.size {
+			cap = r.size
+		}
+		newCap = internal.CeilToPowerOfTwo(r.size + cap)
+	}
 	newBuf := make([]byte, newCap)
 	oldLen := r.Length()
-	_, _ = r.Read(newBuf)
+	head, tail := r.LazyReadAll()
+	copy(newBuf, head)
+	copy(newBuf[len(head):], tail)
 	r.r = 0
 	r.w = oldLen
 	r.size = newCap
-	r.mask = newCap - 1
 	r.buf = newBuf
 }
@@ -195,9 +195,8 @@ func TestZeroRingBuffer(t *testing.T) {
 	if !(rb.Len() == 64 && rb.Cap() == 64) {
 		t.Fatalf("expect rb.Len()=64 and rb.Cap=64, but got rb.Len()=%d and rb.Cap()=%d", rb.Len(), rb.Cap())
 	}
-	if !(rb.r == 0 && rb.w == 48 && rb.size == 64 && rb.mask == 63) {
-		t.Fatalf("expect rb.r=0, rb.w=48, rb.size=64, rb.mask=63, but got rb.r=%d, rb.w=%d, rb.size=%d, rb.mask=%d",
-			rb.r, rb.w, rb.size, rb.mask)
+	if !(rb.r == 0 && rb.w == 48 && rb.size == 64) {
+		t.Fatalf("expect rb.r=0, rb.w=48, rb.size=64, but got rb.r=%d, rb.w=%d, rb.size=%d", rb.r, rb.w, rb.size)
 	}
 	if !bytes.Equal(rb.ByteBuffer().Bytes(), buf) {
 		t.Fatal("expect it is equal")
@@ -457,3 +456,88 @@ func TestRingBuffer_ByteInterface(t *testing.T) {
 		t.Fatalf("expect IsFull is false but got true")
 	}
 }
+
+func TestRingBuffer_GrowthPolicy(t *testing.T) {
+	rb := New(64)
+	rb.SetGrowthPolicy(GrowthPolicy{GrowBy: 1024})
+	_, _ = rb.Write(make([]byte, 65))
+	if rb.Cap() != 64+1024 {
+		t.Fatalf("expect cap %d bytes after growing by fixed step but got %d", 64+1024, rb.Cap())
+	}
+	_, _ = rb.Write(make([]byte, 2048))
+	if rb.Cap() != 64+3*1024 {
+		t.Fatalf("expect cap %d bytes after growing by a multiple of fixed step but got %d", 64+3*1024, rb.Cap())
+	}
+	// data wraps around the end of the buffer whose size is not a power of two.
+	rb.Shift(2000)
+	data := []byte(strings.Repeat("0123456789", 200))
+	_, _ = rb.Write(data)
+	if rb.Cap() != 64+3*1024 {
+		t.Fatalf("expect cap %d bytes to be kept but got %d", 64+3*1024, rb.Cap())
+	}
+	rb.Shift(65 + 2048 - 2000)
+	out := make([]byte, len(data))
+	if n, _ := rb.Read(out[:1500]); n != 1500 || !bytes.Equal(out[:n], data[:n]) {
+		t.Fatalf("expect %d bytes read across the end of buffer but got %d", 1500, n)
+	}
+	rb.Shift(100)
+	if n, _ := rb.Read(out); n != len(data)-1600 || !bytes.Equal(out[:n], data[1600:]) {
+		t.Fatalf("expect the rest %d bytes but got %d", len(data)-1600, n)
+	}
+
+	rb = New(64)
+	rb.SetGrowthPolicy(GrowthPolicy{ShrinkAfterIdle: 8})
+	large := make([]byte, 1<<20)
+	_, _ = rb.Write(large)
+	if rb.Cap() != 1<<20 {
+		t.Fatalf("expect cap %d bytes after growing but got %d", 1<<20, rb.Cap())
+	}
+	rb.Shift(len(large))
+
+	small := []byte(strings.Repeat("abcd", 25))
+	buf := make([]byte, len(small))
+	for i := 0; i < 7; i++ {
+		_, _ = rb.Write(small)
+		_, _ = rb.Read(buf)
+	}
+	if rb.Cap() != 1<<20 {
+		t.Fatalf("expect cap %d bytes before being idle for enough times but got %d", 1<<20, rb.Cap())
+	}
+	_, _ = rb.Write(small)
+	_, _ = rb.Read(buf)
+	if rb.Cap() != 128 {
+		t.Fatalf("expect cap 128 bytes after shrinking but got %d", rb.Cap())
+	}
+	if !bytes.Equal(buf, small) {
+		t.Fatalf("expect %s but got %s", small, buf)
+	}
+
+	// data must survive the shrunk ring-buffer growing again.
+	_, _ = rb.Write(large[:1000])
+	if rb.Length() != 1000 || rb.Cap() < 1000 {
+		t.Fatalf("expect len 1000 bytes after growing but got %d with cap %d", rb.Length(), rb.Cap())
+	}
+}
+
+func TestRingBuffer_GrowthPolicyMinSize(t *testing.T) {
+	rb := New(64)
+	_, _ = rb.Write([]byte("hello"))
+	rb.SetGrowthPolicy(GrowthPolicy{ShrinkAfterIdle: 2, MinSize: 1000})
+	if rb.Cap() != 1024 {
+		t.Fatalf("expect cap 1024 bytes after setting the minimum size but got %d", rb.Cap())
+	}
+	buf := make([]byte, 5)
+	if _, _ = rb.Read(buf); string(buf) != "hello" {
+		t.Fatalf("expect data to survive growing to the minimum size but got %s", buf)
+	}
+
+	_, _ = rb.Write(make([]byte, 1<<16))
+	rb.Shift(1 << 16)
+	for i := 0; i < 2; i++ {
+		_, _ = rb.Write(buf)
+		_, _ = rb.Read(buf)
+	}
+	if rb.Cap() != 1024 {
+		t.Fatalf("expect cap 1024 bytes after shrinking to the minimum size but got %d", rb.Cap())
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build darwin netbsd freebsd openbsd dragonfly
+
+package gnet
+
+import "golang.org/x/sys/unix"
+
+// sendFile sends at most count bytes of the file infd from offset to the socket outfd by copying them through buf,
+// for the sendfile(2) of these platforms differs from the one of Linux, offset is advanced by the number of bytes sent.
+func sendFile(outfd, infd int, offset *int64, count int, buf []byte) (int, error) {
+	if count > len(buf) {
+		count = len(buf)
+	}
+	n, err := unix.Pread(infd, buf[:count], *offset)
+	if n <= 0 {
+		return 0, err
+	}
+	if n, err = unix.Write(outfd, buf[:n]); err != nil {
+		return 0, err
+	}
+	*offset += int64(n)
+	return n, nil
+}
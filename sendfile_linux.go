@@ -0,0 +1,22 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package gnet
+
+import "golang.org/x/sys/unix"
+
+// maxSendfileSize is the maximum number of bytes sent by one sendfile(2), which keeps an event-loop
+// from being stuck in sending a huge file to a fast peer.
+const maxSendfileSize = 4 << 20
+
+// sendFile sends at most count bytes of the file infd from offset to the socket outfd by sendfile(2),
+// offset is advanced by the number of bytes sent. The buffer isn't used on Linux.
+func sendFile(outfd, infd int, offset *int64, count int, _ []byte) (int, error) {
+	if count > maxSendfileSize {
+		count = maxSendfileSize
+	}
+	return unix.Sendfile(outfd, infd, offset, count)
+}
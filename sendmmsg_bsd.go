@@ -0,0 +1,14 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build darwin netbsd freebsd openbsd dragonfly
+
+package gnet
+
+import "golang.org/x/sys/unix"
+
+// sendDatagrams sends the datagrams to sa one by one, for sendmmsg(2) is not available on these platforms.
+func sendDatagrams(fd int, bufs [][]byte, sa unix.Sockaddr) (int, error) {
+	return sendDatagramsOneByOne(fd, bufs, sa)
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package gnet
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// mmsghdr is the struct mmsghdr of sendmmsg(2).
+type mmsghdr struct {
+	hdr unix.Msghdr
+	len uint32
+}
+
+// sendDatagrams sends the datagrams to sa by sendmmsg(2) and returns the number of datagrams sent.
+func sendDatagrams(fd int, bufs [][]byte, sa unix.Sockaddr) (n int, err error) {
+	name, namelen, ok := rawSockaddr(sa)
+	if !ok {
+		return sendDatagramsOneByOne(fd, bufs, sa)
+	}
+	iovs := make([]unix.Iovec, len(bufs))
+	msgs := make([]mmsghdr, len(bufs))
+	for i, buf := range bufs {
+		setDatagram(&msgs[i], &iovs[i], buf, name, namelen)
+	}
+	return sendmmsg(fd, msgs)
+}
+
+// sendDatagramsTo sends each of the datagrams to the address of the same index by sendmmsg(2) and returns
+// the number of datagrams sent.
+func sendDatagramsTo(fd int, bufs [][]byte, sas []unix.Sockaddr) (n int, err error) {
+	iovs := make([]unix.Iovec, len(bufs))
+	msgs := make([]mmsghdr, len(bufs))
+	for i, buf := range bufs {
+		name, namelen, ok := rawSockaddr(sas[i])
+		if !ok {
+			for ; n < len(bufs); n++ {
+				if err = unix.Sendto(fd, bufs[n], 0, sas[n]); err != nil {
+					return
+				}
+			}
+			return
+		}
+		setDatagram(&msgs[i], &iovs[i], buf, name, namelen)
+	}
+	return sendmmsg(fd, msgs)
+}
+
+// setDatagram sets up the message of sendmmsg(2) with the datagram and its raw destination address.
+func setDatagram(msg *mmsghdr, iov *unix.Iovec, buf []byte, name *byte, namelen uint32) {
+	if len(buf) > 0 {
+		iov.Base = &buf[0]
+	}
+	iov.SetLen(len(buf))
+	msg.hdr.Name = name
+	msg.hdr.Namelen = namelen
+	msg.hdr.Iov = iov
+	msg.hdr.SetIovlen(1)
+}
+
+// sendmmsg sends the messages by sendmmsg(2) until all of them are sent or an error occurs, it returns
+// the number of messages sent.
+func sendmmsg(fd int, msgs []mmsghdr) (n int, err error) {
+	for n < len(msgs) {
+		sent, _, errno := unix.Syscall6(unix.SYS_SENDMMSG, uintptr(fd),
+			uintptr(unsafe.Pointer(&msgs[n])), uintptr(len(msgs)-n), 0, 0, 0)
+		if errno != 0 {
+			return n, errno
+		}
+		n += int(sent)
+	}
+	return
+}
+
+// rawSockaddr converts the IP socket address into the raw one taken by sendmmsg(2).
+func rawSockaddr(sa unix.Sockaddr) (name *byte, namelen uint32, ok bool) {
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		raw := &unix.RawSockaddrInet4{Family: unix.AF_INET, Addr: sa.Addr}
+		port := (*[2]byte)(unsafe.Pointer(&raw.Port))
+		port[0], port[1] = byte(sa.Port>>8), byte(sa.Port)
+		return (*byte)(unsafe.Pointer(raw)), unix.SizeofSockaddrInet4, true
+	case *unix.SockaddrInet6:
+		raw := &unix.RawSockaddrInet6{Family: unix.AF_INET6, Addr: sa.Addr, Scope_id: sa.ZoneId}
+		port := (*[2]byte)(unsafe.Pointer(&raw.Port))
+		port[0], port[1] = byte(sa.Port>>8), byte(sa.Port)
+		return (*byte)(unsafe.Pointer(raw)), unix.SizeofSockaddrInet6, true
+	}
+	return nil, 0, false
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package gnet
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func BenchmarkSendDatagrams(b *testing.B) {
+	peer, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer peer.Close()
+	addr := peer.LocalAddr().(*net.UDPAddr)
+	sa := &unix.SockaddrInet4{Port: addr.Port}
+	copy(sa.Addr[:], addr.IP.To4())
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer unix.Close(fd)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			if _, _, err := peer.ReadFrom(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	// The datagrams replied to a peer in one callback.
+	bufs := make([][]byte, 8)
+	for i := range bufs {
+		bufs[i] = make([]byte, 32)
+	}
+	for _, bm := range []struct {
+		name     string
+		send     func(int, [][]byte, unix.Sockaddr) (int, error)
+		syscalls int
+	}{
+		{"sendto", sendDatagramsOneByOne, len(bufs)},
+		{"sendmmsg", sendDatagrams, 1},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if n, err := bm.send(fd, bufs, sa); err != nil || n != len(bufs) {
+					b.Fatalf("sent %d datagrams, error: %v", n, err)
+				}
+			}
+			b.ReportMetric(float64(bm.syscalls), "syscalls/op")
+		})
+	}
+}
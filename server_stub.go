@@ -19,12 +19,12 @@ func (ln *listener) close() {
 	if ln.pconn != nil {
 		ln.pconn.Close()
 	}
-	if ln.network == "unix" {
+	if ln.hasSocketFile() {
 		os.RemoveAll(ln.addr)
 	}
 }
 
-func (ln *listener) system() error {
+func (ln *listener) system(opts *Options) error {
 	return nil
 }
 
@@ -8,44 +8,99 @@
 package gnet
 
 import (
-	"runtime"
+	"context"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/panjf2000/gnet/internal/netpoll"
+	"github.com/panjf2000/gnet/pool/goroutine"
 )
 
 type server struct {
-	ln               *listener          // all the listeners
+	bytesRead        uint64             // number of bytes read since start, first to be 64-bit aligned for atomic operations
+	bytesWritten     uint64             // number of bytes written since start
+	ln               *listener          // the first listener
+	lns              []*listener        // all the listeners
+	lnsLock          sync.RWMutex       // protects lns from being appended concurrently
 	wg               sync.WaitGroup     // event-loop close WaitGroup
 	opts             *Options           // options with server
 	once             sync.Once          // make sure only signalShutdown once
 	cond             *sync.Cond         // shutdown signaler
+	signaled         bool               // shutdown has been signaled, protected by cond.L
 	codec            ICodec             // codec for TCP stream
-	logger           Logger             // customized logger for logging info
+	reactPool        *goroutine.Pool    // worker pool which React is offloaded to, see Options.ReactPool
+	logger           LeveledLogger      // customized logger for logging info
 	ticktock         chan time.Duration // ticker channel
 	mainLoop         *eventloop         // main loop for accepting connections
 	eventHandler     EventHandler       // user eventHandler
+	framesReactor    FramesReactor      // eventHandler as FramesReactor, nil if it isn't one
+	openHandler      OpenHandler        // eventHandler as OpenHandler, nil if it isn't one
+	rejectionHandler RejectionHandler   // eventHandler as RejectionHandler, nil if it isn't one
+	writableHandler  WritableHandler    // eventHandler as WritableHandler, nil if it isn't one
+	writeCompleter   WriteCompleter     // eventHandler as WriteCompleter, nil if it isn't one
+	elapsedTicker    ElapsedTicker      // eventHandler as ElapsedTicker, nil if it isn't one
+	loopTicker       LoopTicker         // eventHandler as LoopTicker, nil if it isn't one
+	timeoutHandler   ReadTimeoutHandler // eventHandler as ReadTimeoutHandler, nil if it isn't one
 	subLoopGroup     IEventLoopGroup    // loops for handling events
 	subLoopGroupSize int                // number of loops
+	loopsLock        sync.RWMutex       // protects loops from being scaled concurrently
+	nextLoopIdx      int                // index of the next loop to be created
+	stopped          bool               // server is stopped and loops can't be scaled any more
+	sweeperDone      chan struct{}      // closed when the server stops to end sweeping idle connections
+	ready            chan struct{}      // closed once all the event-loops are running, see Server.Ready
+	down             int32              // 1 once the server begins shutting down, see Server.Healthy
+	udpConns         sync.Map           // udpConnKey -> *conn, connected UDP connections of all event-loops
+	conns            sync.Map           // Conn -> struct{}, open connections of all event-loops, see Server.Range
+	connCount        int32              // number of open connections across all event-loops
 }
 
 // waitForShutdown waits for a signal to shutdown
 func (svr *server) waitForShutdown() {
 	svr.cond.L.Lock()
-	svr.cond.Wait()
+	for !svr.signaled {
+		svr.cond.Wait()
+	}
 	svr.cond.L.Unlock()
 }
 
 // signalShutdown signals a shutdown an begins server closing
 func (svr *server) signalShutdown() {
+	atomic.StoreInt32(&svr.down, 1)
 	svr.once.Do(func() {
 		svr.cond.L.Lock()
+		svr.signaled = true
 		svr.cond.Signal()
 		svr.cond.L.Unlock()
 	})
 }
 
+// listener returns the listener of the given fd, or nil if fd isn't a listener.
+func (svr *server) listener(fd int) *listener {
+	for _, ln := range svr.listeners() {
+		if ln.fd == fd {
+			return ln
+		}
+	}
+	return nil
+}
+
+// acquireConnSlot takes a slot for a newly accepted connection, it reports false if the server has reached
+// the limit of MaxConnections.
+func (svr *server) acquireConnSlot() bool {
+	if n := atomic.AddInt32(&svr.connCount, 1); svr.opts.MaxConnections > 0 && int(n) > svr.opts.MaxConnections {
+		atomic.AddInt32(&svr.connCount, -1)
+		return false
+	}
+	return true
+}
+
+// releaseConnSlot gives back the slot of a closed connection.
+func (svr *server) releaseConnSlot() {
+	atomic.AddInt32(&svr.connCount, -1)
+}
+
 func (svr *server) startLoops() {
 	svr.subLoopGroup.iterate(func(i int, el *eventloop) bool {
 		svr.wg.Add(1)
@@ -84,11 +139,14 @@ func (svr *server) activateLoops(numEventLoop int) error {
 				svr:          svr,
 				codec:        svr.codec,
 				poller:       p,
-				packet:       make([]byte, 0x10000),
+				packet:       make([]byte, svr.packetSize()),
 				connections:  make(map[int]*conn),
+				udpConns:     make(map[udpConnKey]*conn),
 				eventHandler: svr.eventHandler,
 			}
-			_ = el.poller.AddRead(svr.ln.fd)
+			for _, ln := range svr.listeners() {
+				_ = el.poller.AddRead(ln.fd)
+			}
 			svr.subLoopGroup.register(el)
 		} else {
 			return err
@@ -108,7 +166,7 @@ func (svr *server) activateReactors(numEventLoop int) error {
 				svr:          svr,
 				codec:        svr.codec,
 				poller:       p,
-				packet:       make([]byte, 0x10000),
+				packet:       make([]byte, svr.packetSize()),
 				connections:  make(map[int]*conn),
 				eventHandler: svr.eventHandler,
 			}
@@ -118,117 +176,421 @@ func (svr *server) activateReactors(numEventLoop int) error {
 		}
 	}
 	svr.subLoopGroupSize = svr.subLoopGroup.len()
-	// Start sub reactors.
-	svr.startReactors()
+	svr.nextLoopIdx = numEventLoop
 
+	// Set up the main reactor before starting sub reactors so that it is visible to event callbacks.
 	if p, err := netpoll.OpenPoller(); err == nil {
 		el := &eventloop{
 			idx:    -1,
 			poller: p,
 			svr:    svr,
 		}
-		_ = el.poller.AddRead(svr.ln.fd)
+		for _, ln := range svr.listeners() {
+			_ = el.poller.AddRead(ln.fd)
+		}
 		svr.mainLoop = el
-		// Start main reactor.
+	} else {
+		return err
+	}
+
+	// Start sub reactors.
+	svr.startReactors()
+	// Start main reactor.
+	svr.wg.Add(1)
+	go func() {
+		svr.activateMainReactor()
+		svr.wg.Done()
+	}()
+	return nil
+}
+
+func (svr *server) start(numEventLoop int) (err error) {
+	if svr.opts.ReusePort || svr.hasPacketListener() {
+		err = svr.activateLoops(numEventLoop)
+	} else {
+		err = svr.activateReactors(numEventLoop)
+	}
+	if err == nil && svr.sweepsIdleConns() {
+		go svr.sweepIdleConns()
+	}
+	if err == nil && svr.opts.ReadTimeout > 0 && svr.timeoutHandler != nil && svr.hasStreamListener() {
+		go svr.checkReadTimeouts()
+	}
+	return
+}
+
+// sweepIdleConns closes the connections that have been idle for longer than IdleTimeout periodically.
+func (svr *server) sweepIdleConns() {
+	ticker := time.NewTicker(idleSweepInterval(svr.idleTimeout()))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-svr.sweeperDone:
+			return
+		case <-ticker.C:
+			svr.iterateLoops(func(el *eventloop) {
+				_ = el.poller.Trigger(el.loopCloseIdleConns)
+			})
+		}
+	}
+}
+
+// checkReadTimeouts fires the read timeout of the connections without frames for ReadTimeout periodically.
+func (svr *server) checkReadTimeouts() {
+	ticker := time.NewTicker(readTimeoutCheckInterval(svr.opts.ReadTimeout))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-svr.sweeperDone:
+			return
+		case <-ticker.C:
+			svr.iterateLoops(func(el *eventloop) {
+				_ = el.poller.Trigger(el.loopReadTimeouts)
+			})
+		}
+	}
+}
+
+// addListener listens on the given address and registers the listener with the event-loops polling listeners.
+func (svr *server) addListener(addr string) error {
+	svr.loopsLock.RLock()
+	defer svr.loopsLock.RUnlock()
+	if svr.stopped {
+		return ErrServerShutdown
+	}
+	if svr.listening(parseAddr(addr)) {
+		return ErrAlreadyListening
+	}
+	ln, err := initListener(addr, svr.opts)
+	if err != nil {
+		return err
+	}
+	if ln.pconn != nil && svr.mainLoop != nil {
+		ln.close()
+		return ErrProtocolNotSupported
+	}
+	// Append the listener before polling it, so that it can be found by its fd once it's readable.
+	svr.appendListener(ln)
+	if svr.mainLoop != nil {
+		return svr.mainLoop.poller.AddRead(ln.fd)
+	}
+	svr.subLoopGroup.iterate(func(i int, el *eventloop) bool {
+		err = el.poller.AddRead(ln.fd)
+		return err == nil
+	})
+	return err
+}
+
+// scaleLoops adds or removes sub event-loops to reach the given number, removed event-loops no longer get new
+// connections and keep serving their current connections until all of them are closed.
+func (svr *server) scaleLoops(numEventLoop int) error {
+	if numEventLoop <= 0 {
+		return ErrInvalidNumEventLoop
+	}
+	if svr.opts.ReusePort || svr.hasPacketListener() {
+		return ErrScalingNotSupported
+	}
+
+	svr.loopsLock.Lock()
+	defer svr.loopsLock.Unlock()
+	if svr.stopped {
+		return ErrServerShutdown
+	}
+	if numEventLoop < svr.subLoopGroup.len() {
+		return ErrScaleDownNotSupported
+	}
+	for svr.subLoopGroup.len() < numEventLoop {
+		p, err := netpoll.OpenPoller()
+		if err != nil {
+			return err
+		}
+		el := &eventloop{
+			idx:          svr.nextLoopIdx,
+			svr:          svr,
+			codec:        svr.codec,
+			poller:       p,
+			packet:       make([]byte, svr.packetSize()),
+			connections:  make(map[int]*conn),
+			eventHandler: svr.eventHandler,
+		}
+		svr.nextLoopIdx++
+		svr.subLoopGroup.register(el)
 		svr.wg.Add(1)
 		go func() {
-			svr.activateMainReactor()
+			svr.activateSubReactor(el)
 			svr.wg.Done()
 		}()
-	} else {
-		return err
 	}
+	svr.subLoopGroupSize = svr.subLoopGroup.len()
 	return nil
 }
 
-func (svr *server) start(numEventLoop int) error {
-	if svr.opts.ReusePort || svr.ln.pconn != nil {
-		return svr.activateLoops(numEventLoop)
+// iterateLoops iterates all sub event-loops.
+func (svr *server) iterateLoops(f func(el *eventloop)) {
+	svr.loopsLock.RLock()
+	defer svr.loopsLock.RUnlock()
+	svr.subLoopGroup.iterate(func(i int, el *eventloop) bool {
+		f(el)
+		return true
+	})
+}
+
+// broadcastAll writes the data to all the connections of every sub event-loop.
+func (svr *server) broadcastAll(buf []byte) (err error) {
+	svr.iterateLoops(func(el *eventloop) {
+		e := el.poller.Trigger(func() error {
+			return el.loopBroadcast(buf)
+		})
+		if e != nil && err == nil {
+			err = e
+		}
+	})
+	return
+}
+
+func (svr *server) countConnections() (count int) {
+	svr.iterateLoops(func(el *eventloop) {
+		count += int(el.loadConnCount())
+	})
+	return
+}
+
+// loopConnections returns the number of active connections of each sub event-loop in the order of loop indices.
+func (svr *server) loopConnections() []int {
+	var loops []*eventloop
+	svr.iterateLoops(func(el *eventloop) {
+		loops = append(loops, el)
+	})
+	sort.Slice(loops, func(i, j int) bool { return loops[i].idx < loops[j].idx })
+	counts := make([]int, len(loops))
+	for i, el := range loops {
+		counts[i] = int(el.loadConnCount())
+	}
+	return counts
+}
+
+// loopQueueLengths returns the number of jobs queued for each sub event-loop in the order of loop indices.
+func (svr *server) loopQueueLengths() []int {
+	var loops []*eventloop
+	svr.iterateLoops(func(el *eventloop) {
+		loops = append(loops, el)
+	})
+	sort.Slice(loops, func(i, j int) bool { return loops[i].idx < loops[j].idx })
+	lengths := make([]int, len(loops))
+	for i, el := range loops {
+		lengths[i] = el.jobs.len()
+	}
+	return lengths
+}
+
+// signalReady closes ready once the main reactor and all the sub event-loops have run a job,
+// which means that they are polling the listeners and connections.
+func (svr *server) signalReady() {
+	var pollers []*netpoll.Poller
+	svr.iterateLoops(func(el *eventloop) {
+		pollers = append(pollers, el.poller)
+	})
+	if svr.mainLoop != nil {
+		pollers = append(pollers, svr.mainLoop.poller)
+	}
+	job := svr.readyJob(len(pollers))
+	for _, p := range pollers {
+		sniffErrorAndLog(svr.logger, p.Trigger(job))
+	}
+}
+
+func (svr *server) countLoops() int {
+	svr.loopsLock.RLock()
+	defer svr.loopsLock.RUnlock()
+	return svr.subLoopGroup.len()
+}
+
+// shutdown stops accepting new connections, waits for the active connections to be closed or the context to be done,
+// and then stops the server, closing the remaining connections.
+func (svr *server) shutdown(ctx context.Context) error {
+	svr.loopsLock.RLock()
+	if svr.stopped {
+		svr.loopsLock.RUnlock()
+		return ErrServerShutdown
+	}
+	atomic.StoreInt32(&svr.down, 1)
+	// Find out the event-loops that are polling the listeners.
+	var acceptors []*netpoll.Poller
+	if svr.hasStreamListener() {
+		if svr.mainLoop != nil {
+			acceptors = append(acceptors, svr.mainLoop.poller)
+		} else {
+			svr.subLoopGroup.iterate(func(i int, el *eventloop) bool {
+				acceptors = append(acceptors, el.poller)
+				return true
+			})
+		}
+	}
+	svr.loopsLock.RUnlock()
+
+	// The listeners are kept open until the server stops, lest their fds are reused by new connections
+	// while event-loops are still treating them as the listeners.
+	err := syncPollers(ctx, acceptors, func(p *netpoll.Poller) {
+		for _, ln := range svr.listeners() {
+			if ln.pconn == nil {
+				sniffErrorAndLog(svr.logger, p.Delete(ln.fd))
+			}
+		}
+	})
+	if err == nil && svr.mainLoop != nil {
+		// Make sure the connections accepted by the main reactor have been registered in sub event-loops.
+		var loops []*netpoll.Poller
+		svr.iterateLoops(func(el *eventloop) {
+			loops = append(loops, el.poller)
+		})
+		err = syncPollers(ctx, loops, func(*netpoll.Poller) {})
+	}
+	if err == nil {
+		err = waitForConnections(ctx, svr.countConnections)
+	}
+	svr.signalShutdown()
+	return err
+}
+
+// syncPollers runs the job in each of the event-loops of given pollers and waits for all of them to be done.
+func syncPollers(ctx context.Context, pollers []*netpoll.Poller, job func(p *netpoll.Poller)) error {
+	done := make(chan struct{}, len(pollers))
+	for _, p := range pollers {
+		p := p
+		if err := p.Trigger(func() error {
+			job(p)
+			done <- struct{}{}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	for range pollers {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
-	return svr.activateReactors(numEventLoop)
+	return nil
 }
 
 func (svr *server) stop() {
 	// Wait on a signal for shutdown
 	svr.waitForShutdown()
 
+	svr.loopsLock.Lock()
+	svr.stopped = true
+	svr.loopsLock.Unlock()
+	close(svr.sweeperDone)
+
 	// Notify all loops to close by closing all listeners
-	svr.subLoopGroup.iterate(func(i int, el *eventloop) bool {
-		sniffErrorAndLog(el.poller.Trigger(func() error {
+	svr.iterateLoops(func(el *eventloop) {
+		sniffErrorAndLog(svr.logger, el.poller.Trigger(func() error {
 			return ErrServerShutdown
 		}))
-		return true
 	})
 
 	if svr.mainLoop != nil {
-		svr.ln.close()
-		sniffErrorAndLog(svr.mainLoop.poller.Trigger(func() error {
+		for _, ln := range svr.listeners() {
+			ln.close()
+		}
+		sniffErrorAndLog(svr.logger, svr.mainLoop.poller.Trigger(func() error {
 			return ErrServerShutdown
 		}))
 	}
 
 	// Wait on all loops to complete reading events
 	svr.wg.Wait()
+	svr.iterateLoops(func(el *eventloop) {
+		el.jobs.close()
+	})
 
 	// Close loops and all outstanding connections
-	svr.subLoopGroup.iterate(func(i int, el *eventloop) bool {
+	svr.iterateLoops(func(el *eventloop) {
 		for _, c := range el.connections {
-			sniffErrorAndLog(el.loopCloseConn(c, nil))
+			sniffErrorAndLog(svr.logger, el.loopCloseConn(c, nil))
+		}
+		for _, c := range el.udpConns {
+			sniffErrorAndLog(svr.logger, el.loopCloseConn(c, nil))
 		}
-		return true
 	})
 	svr.closeLoops()
-
-	if svr.mainLoop != nil {
-		sniffErrorAndLog(svr.mainLoop.poller.Close())
+	for _, ln := range svr.listeners() {
+		ln.close()
 	}
-}
 
-func serve(eventHandler EventHandler, listener *listener, options *Options) error {
-	// Figure out the correct number of loops/goroutines to use.
-	numEventLoop := 1
-	if options.Multicore {
-		numEventLoop = runtime.NumCPU()
+	if svr.mainLoop != nil {
+		sniffErrorAndLog(svr.logger, svr.mainLoop.poller.Close())
 	}
-	if options.NumEventLoop > 0 {
-		numEventLoop = options.NumEventLoop
+	if svr.reactPool != nil {
+		svr.reactPool.Release()
 	}
+}
 
+// newServer creates the server serving the listeners, which may be none for the server of Client.
+func newServer(eventHandler EventHandler, listeners []*listener, options *Options) (*server, error) {
 	svr := new(server)
 	svr.opts = options
 	svr.eventHandler = eventHandler
-	svr.ln = listener
+	svr.framesReactor, _ = eventHandler.(FramesReactor)
+	svr.openHandler, _ = eventHandler.(OpenHandler)
+	svr.rejectionHandler, _ = eventHandler.(RejectionHandler)
+	svr.writableHandler, _ = eventHandler.(WritableHandler)
+	svr.writeCompleter, _ = eventHandler.(WriteCompleter)
+	svr.elapsedTicker, _ = eventHandler.(ElapsedTicker)
+	svr.loopTicker, _ = eventHandler.(LoopTicker)
+	svr.timeoutHandler, _ = eventHandler.(ReadTimeoutHandler)
+	if len(listeners) > 0 {
+		svr.ln = listeners[0]
+	}
+	svr.lns = listeners
 
-	switch options.LB {
-	case RoundRobin:
-		svr.subLoopGroup = new(roundRobinEventLoopGroup)
-	case LeastConnections:
-		svr.subLoopGroup = new(leastConnectionsEventLoopGroup)
-	case SourceAddrHash:
-		svr.subLoopGroup = new(sourceAddrHashEventLoopGroup)
+	if options.LoadBalancer != nil {
+		svr.subLoopGroup = newEventLoopGroup(options.LoadBalancer)
+	} else {
+		svr.subLoopGroup = newEventLoopGroup(newLoadBalancer(options.LB))
 	}
 
 	svr.cond = sync.NewCond(&sync.Mutex{})
+	svr.sweeperDone = make(chan struct{})
+	svr.ready = make(chan struct{})
 	svr.ticktock = make(chan time.Duration, 1)
-	svr.logger = func() Logger {
-		if options.Logger == nil {
-			return defaultLogger
-		}
-		return options.Logger
-	}()
+	svr.logger = newLogger(options)
+	if len(options.CPUAffinity) > 0 && !cpuAffinitySupported {
+		svr.logger.Infof("CPUAffinity is ignored, for it's only supported on Linux\n")
+	}
 	svr.codec = func() ICodec {
 		if options.Codec == nil {
 			return new(BuiltInFrameCodec)
 		}
 		return options.Codec
 	}()
+	if options.ReactPool > 0 {
+		reactPool, err := newReactPool(options.ReactPool)
+		if err != nil {
+			return nil, err
+		}
+		svr.reactPool = reactPool
+	}
+	return svr, nil
+}
+
+func serve(eventHandler EventHandler, listeners []*listener, options *Options) error {
+	numEventLoop := numEventLoops(options)
+	svr, err := newServer(eventHandler, listeners, options)
+	if err != nil {
+		return err
+	}
 
 	server := Server{
 		svr:          svr,
 		Multicore:    options.Multicore,
-		Addr:         listener.lnaddr,
+		Addr:         svr.ln.lnaddr,
+		Addrs:        svr.addrs(),
 		NumEventLoop: numEventLoop,
 		ReusePort:    options.ReusePort,
+		ReuseAddr:    options.ReuseAddr,
 		TCPKeepAlive: options.TCPKeepAlive,
 	}
 	switch svr.eventHandler.OnInitComplete(server) {
@@ -239,9 +601,10 @@ func serve(eventHandler EventHandler, listener *listener, options *Options) erro
 
 	if err := svr.start(numEventLoop); err != nil {
 		svr.closeLoops()
-		svr.logger.Printf("gnet server is stoping with error: %v\n", err)
+		svr.logger.Errorf("gnet server is stoping with error: %v\n", err)
 		return err
 	}
+	svr.signalReady()
 	defer svr.stop()
 
 	return nil
@@ -8,10 +8,13 @@
 package gnet
 
 import (
+	"context"
 	"errors"
-	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/panjf2000/gnet/pool/goroutine"
 )
 
 // commandBufferSize represents the buffer size of event-loop command channel on Windows.
@@ -25,25 +28,49 @@ var (
 )
 
 type server struct {
-	ln               *listener          // all the listeners
+	bytesRead        uint64             // number of bytes read since start, first to be 64-bit aligned for atomic operations
+	bytesWritten     uint64             // number of bytes written since start
+	ln               *listener          // the first listener
+	lns              []*listener        // all the listeners
+	lnsLock          sync.RWMutex       // protects lns from being appended concurrently
+	stopped          bool               // server is stopped and listeners can't be added any more, protected by lnsLock
 	cond             *sync.Cond         // shutdown signaler
 	opts             *Options           // options with server
 	serr             error              // signal error
+	signaled         bool               // shutdown has been signaled, protected by cond.L
 	once             sync.Once          // make sure only signalShutdown once
 	codec            ICodec             // codec for TCP stream
+	reactPool        *goroutine.Pool    // worker pool which React is offloaded to, see Options.ReactPool
 	loopWG           sync.WaitGroup     // loop close WaitGroup
-	logger           Logger             // customized logger for logging info
+	logger           LeveledLogger      // customized logger for logging info
 	ticktock         chan time.Duration // ticker channel
 	listenerWG       sync.WaitGroup     // listener close WaitGroup
 	eventHandler     EventHandler       // user eventHandler
+	framesReactor    FramesReactor      // eventHandler as FramesReactor, nil if it isn't one
+	openHandler      OpenHandler        // eventHandler as OpenHandler, nil if it isn't one
+	rejectionHandler RejectionHandler   // eventHandler as RejectionHandler, nil if it isn't one
+	writableHandler  WritableHandler    // eventHandler as WritableHandler, nil if it isn't one
+	writeCompleter   WriteCompleter     // eventHandler as WriteCompleter, nil if it isn't one
+	elapsedTicker    ElapsedTicker      // eventHandler as ElapsedTicker, nil if it isn't one
+	loopTicker       LoopTicker         // eventHandler as LoopTicker, nil if it isn't one
+	timeoutHandler   ReadTimeoutHandler // eventHandler as ReadTimeoutHandler, nil if it isn't one
 	subLoopGroup     IEventLoopGroup    // loops for handling events
 	subLoopGroupSize int                // number of loops
+	inShutdown       int32              // 1 while shutting down gracefully, the closed listener isn't an error then
+	sweeperDone      chan struct{}      // closed when the server stops to end sweeping idle connections
+	ready            chan struct{}      // closed once all the event-loops are running, see Server.Ready
+	down             int32              // 1 once the server begins shutting down, see Server.Healthy
+	udpConns         sync.Map           // udpConnKey -> *stdConn, connected UDP connections of all event-loops
+	conns            sync.Map           // Conn -> struct{}, open connections of all event-loops, see Server.Range
+	connCount        int32              // number of open connections across all event-loops
 }
 
 // waitForShutdown waits for a signal to shutdown.
 func (svr *server) waitForShutdown() error {
 	svr.cond.L.Lock()
-	svr.cond.Wait()
+	for !svr.signaled {
+		svr.cond.Wait()
+	}
 	err := svr.serr
 	svr.cond.L.Unlock()
 	return err
@@ -51,22 +78,73 @@ func (svr *server) waitForShutdown() error {
 
 // signalShutdown signals a shutdown an begins server closing.
 func (svr *server) signalShutdown(err error) {
+	atomic.StoreInt32(&svr.down, 1)
 	svr.once.Do(func() {
 		svr.cond.L.Lock()
 		svr.serr = err
+		svr.signaled = true
 		svr.cond.Signal()
 		svr.cond.L.Unlock()
 	})
 }
 
-func (svr *server) startListener() {
+func (svr *server) startListeners() {
+	for _, ln := range svr.listeners() {
+		svr.startListener(ln)
+	}
+}
+
+func (svr *server) startListener(ln *listener) {
 	svr.listenerWG.Add(1)
 	go func() {
-		svr.listenerRun()
+		svr.listenerRun(ln)
 		svr.listenerWG.Done()
 	}()
 }
 
+// addListener listens on the given address and starts accepting connections from it.
+func (svr *server) addListener(addr string) error {
+	svr.lnsLock.Lock()
+	defer svr.lnsLock.Unlock()
+	if svr.stopped {
+		return ErrServerShutdown
+	}
+	for _, ln := range svr.lns {
+		if network, address := parseAddr(addr); ln.network == network && ln.addr == address {
+			return ErrAlreadyListening
+		}
+	}
+	ln, err := initListener(addr, svr.opts)
+	if err != nil {
+		return err
+	}
+	svr.lns = append(svr.lns, ln)
+	svr.startListener(ln)
+	return nil
+}
+
+// closeListeners closes all the listeners.
+func (svr *server) closeListeners() {
+	for _, ln := range svr.listeners() {
+		ln.close()
+	}
+}
+
+// acquireConnSlot takes a slot for a newly accepted connection, it reports false if the server has reached
+// the limit of MaxConnections.
+func (svr *server) acquireConnSlot() bool {
+	if n := atomic.AddInt32(&svr.connCount, 1); svr.opts.MaxConnections > 0 && int(n) > svr.opts.MaxConnections {
+		atomic.AddInt32(&svr.connCount, -1)
+		return false
+	}
+	return true
+}
+
+// releaseConnSlot gives back the slot of a closed connection.
+func (svr *server) releaseConnSlot() {
+	atomic.AddInt32(&svr.connCount, -1)
+}
+
 func (svr *server) startLoops(numEventLoop int) {
 	for i := 0; i < numEventLoop; i++ {
 		el := &eventloop{
@@ -87,12 +165,122 @@ func (svr *server) startLoops(numEventLoop int) {
 	})
 }
 
+// sweepIdleConns closes the connections that have been idle for longer than IdleTimeout periodically.
+func (svr *server) sweepIdleConns() {
+	ticker := time.NewTicker(idleSweepInterval(svr.idleTimeout()))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-svr.sweeperDone:
+			return
+		case <-ticker.C:
+			svr.subLoopGroup.iterate(func(i int, el *eventloop) bool {
+				select {
+				case el.ch <- el.loopCloseIdleConns:
+				case <-svr.sweeperDone:
+				}
+				return true
+			})
+		}
+	}
+}
+
+// checkReadTimeouts fires the read timeout of the connections without frames for ReadTimeout periodically.
+func (svr *server) checkReadTimeouts() {
+	ticker := time.NewTicker(readTimeoutCheckInterval(svr.opts.ReadTimeout))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-svr.sweeperDone:
+			return
+		case <-ticker.C:
+			svr.subLoopGroup.iterate(func(i int, el *eventloop) bool {
+				select {
+				case el.ch <- el.loopReadTimeouts:
+				case <-svr.sweeperDone:
+				}
+				return true
+			})
+		}
+	}
+}
+
+func (svr *server) scaleLoops(numEventLoop int) error {
+	if numEventLoop <= 0 {
+		return ErrInvalidNumEventLoop
+	}
+	return ErrScalingNotSupported
+}
+
+// broadcastAll writes the data to all the connections of every event-loop.
+func (svr *server) broadcastAll(buf []byte) error {
+	svr.subLoopGroup.iterate(func(i int, el *eventloop) bool {
+		el.ch <- func() error {
+			return el.loopBroadcast(buf)
+		}
+		return true
+	})
+	return nil
+}
+
+func (svr *server) countConnections() (count int) {
+	svr.subLoopGroup.iterate(func(i int, el *eventloop) bool {
+		count += int(el.loadConnCount())
+		return true
+	})
+	return
+}
+
+// loopConnections returns the number of active connections of each event-loop in the order of loop indices.
+func (svr *server) loopConnections() (counts []int) {
+	svr.subLoopGroup.iterate(func(i int, el *eventloop) bool {
+		counts = append(counts, int(el.loadConnCount()))
+		return true
+	})
+	return
+}
+
+// loopQueueLengths returns the number of jobs queued for each event-loop in the order of loop indices.
+func (svr *server) loopQueueLengths() (lengths []int) {
+	svr.subLoopGroup.iterate(func(i int, el *eventloop) bool {
+		lengths = append(lengths, el.jobs.len())
+		return true
+	})
+	return
+}
+
+// signalReady closes ready once all the event-loops have run a job, which means that they are running.
+func (svr *server) signalReady() {
+	job := svr.readyJob(svr.subLoopGroup.len())
+	svr.subLoopGroup.iterate(func(i int, el *eventloop) bool {
+		el.ch <- job
+		return true
+	})
+}
+
+func (svr *server) countLoops() int {
+	return svr.subLoopGroup.len()
+}
+
+func (svr *server) shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&svr.inShutdown, 1)
+	atomic.StoreInt32(&svr.down, 1)
+	svr.closeListeners()
+	err := waitForConnections(ctx, svr.countConnections)
+	svr.signalShutdown(nil)
+	return err
+}
+
 func (svr *server) stop() {
 	// Wait on a signal for shutdown.
-	svr.logger.Printf("server is being shutdown with err: %v\n", svr.waitForShutdown())
+	svr.logger.Infof("server is being shutdown with err: %v\n", svr.waitForShutdown())
+	close(svr.sweeperDone)
 
-	// Close listener.
-	svr.ln.close()
+	// Close listeners.
+	svr.lnsLock.Lock()
+	svr.stopped = true
+	svr.lnsLock.Unlock()
+	svr.closeListeners()
 	svr.listenerWG.Wait()
 
 	// Notify all loops to close.
@@ -103,6 +291,10 @@ func (svr *server) stop() {
 
 	// Wait on all loops to close.
 	svr.loopWG.Wait()
+	svr.subLoopGroup.iterate(func(i int, el *eventloop) bool {
+		el.jobs.close()
+		return true
+	})
 
 	// Close all connections.
 	svr.loopWG.Add(svr.subLoopGroupSize)
@@ -111,53 +303,74 @@ func (svr *server) stop() {
 		return true
 	})
 	svr.loopWG.Wait()
-}
-
-func serve(eventHandler EventHandler, listener *listener, options *Options) (err error) {
-	// Figure out the correct number of loops/goroutines to use.
-	numEventLoop := 1
-	if options.Multicore {
-		numEventLoop = runtime.NumCPU()
-	}
-	if options.NumEventLoop > 0 {
-		numEventLoop = options.NumEventLoop
+	if svr.reactPool != nil {
+		svr.reactPool.Release()
 	}
+}
 
+// newServer creates the server serving the listeners, which may be none for the server of Client.
+func newServer(eventHandler EventHandler, listeners []*listener, options *Options) (*server, error) {
 	svr := new(server)
 	svr.opts = options
 	svr.eventHandler = eventHandler
-	svr.ln = listener
+	svr.framesReactor, _ = eventHandler.(FramesReactor)
+	svr.openHandler, _ = eventHandler.(OpenHandler)
+	svr.rejectionHandler, _ = eventHandler.(RejectionHandler)
+	svr.writableHandler, _ = eventHandler.(WritableHandler)
+	svr.writeCompleter, _ = eventHandler.(WriteCompleter)
+	svr.elapsedTicker, _ = eventHandler.(ElapsedTicker)
+	svr.loopTicker, _ = eventHandler.(LoopTicker)
+	svr.timeoutHandler, _ = eventHandler.(ReadTimeoutHandler)
+	if len(listeners) > 0 {
+		svr.ln = listeners[0]
+	}
+	svr.lns = listeners
 
-	switch options.LB {
-	case RoundRobin:
-		svr.subLoopGroup = new(roundRobinEventLoopGroup)
-	case LeastConnections:
-		svr.subLoopGroup = new(leastConnectionsEventLoopGroup)
-	case SourceAddrHash:
-		svr.subLoopGroup = new(sourceAddrHashEventLoopGroup)
+	if options.LoadBalancer != nil {
+		svr.subLoopGroup = newEventLoopGroup(options.LoadBalancer)
+	} else {
+		svr.subLoopGroup = newEventLoopGroup(newLoadBalancer(options.LB))
 	}
 
 	svr.ticktock = make(chan time.Duration, 1)
+	svr.sweeperDone = make(chan struct{})
+	svr.ready = make(chan struct{})
 	svr.cond = sync.NewCond(&sync.Mutex{})
-	svr.logger = func() Logger {
-		if options.Logger == nil {
-			return defaultLogger
-		}
-		return options.Logger
-	}()
+	svr.logger = newLogger(options)
+	if len(options.CPUAffinity) > 0 && !cpuAffinitySupported {
+		svr.logger.Infof("CPUAffinity is ignored, for it's only supported on Linux\n")
+	}
 	svr.codec = func() ICodec {
 		if options.Codec == nil {
 			return new(BuiltInFrameCodec)
 		}
 		return options.Codec
 	}()
+	if options.ReactPool > 0 {
+		reactPool, err := newReactPool(options.ReactPool)
+		if err != nil {
+			return nil, err
+		}
+		svr.reactPool = reactPool
+	}
+	return svr, nil
+}
+
+func serve(eventHandler EventHandler, listeners []*listener, options *Options) (err error) {
+	numEventLoop := numEventLoops(options)
+	svr, err := newServer(eventHandler, listeners, options)
+	if err != nil {
+		return
+	}
 
 	server := Server{
 		svr:          svr,
 		Multicore:    options.Multicore,
-		Addr:         listener.lnaddr,
+		Addr:         svr.ln.lnaddr,
+		Addrs:        svr.addrs(),
 		NumEventLoop: numEventLoop,
 		ReusePort:    options.ReusePort,
+		ReuseAddr:    options.ReuseAddr,
 		TCPKeepAlive: options.TCPKeepAlive,
 	}
 	switch svr.eventHandler.OnInitComplete(server) {
@@ -168,8 +381,15 @@ func serve(eventHandler EventHandler, listener *listener, options *Options) (err
 
 	// Start all loops.
 	svr.startLoops(numEventLoop)
-	// Start listener.
-	svr.startListener()
+	// Start listeners.
+	svr.startListeners()
+	svr.signalReady()
+	if svr.sweepsIdleConns() {
+		go svr.sweepIdleConns()
+	}
+	if svr.opts.ReadTimeout > 0 && svr.timeoutHandler != nil && svr.hasStreamListener() {
+		go svr.checkReadTimeouts()
+	}
 	defer svr.stop()
 
 	return
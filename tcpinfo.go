@@ -0,0 +1,25 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gnet
+
+import "time"
+
+// TCPInfo is the information about a TCP connection retrieved from the kernel, which is useful for
+// adapting the behavior of application to the network condition.
+type TCPInfo struct {
+	State             uint8         // state of connection, e.g. TCP_ESTABLISHED
+	CongestionControl string        // name of the congestion control algorithm, e.g. "cubic" or "bbr"
+	RTT               time.Duration // smoothed round trip time
+	RTTVar            time.Duration // variance of round trip time
+	RTO               time.Duration // retransmission timeout
+	SndMSS            uint32        // maximum segment size for sending
+	RcvMSS            uint32        // maximum segment size for receiving
+	SndCwnd           uint32        // congestion window in segments
+	SndSsthresh       uint32        // slow start threshold in segments
+	Unacked           uint32        // number of unacknowledged segments
+	Lost              uint32        // number of segments considered lost
+	Retransmits       uint32        // number of consecutive retransmission timeouts
+	TotalRetrans      uint32        // total number of retransmitted segments
+}
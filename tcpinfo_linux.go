@@ -0,0 +1,39 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package gnet
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func getTCPInfo(fd int) (*TCPInfo, error) {
+	info, err := unix.GetsockoptTCPInfo(fd, unix.IPPROTO_TCP, unix.TCP_INFO)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := unix.GetsockoptString(fd, unix.IPPROTO_TCP, unix.TCP_CONGESTION)
+	if err != nil {
+		return nil, err
+	}
+	return &TCPInfo{
+		State:             info.State,
+		CongestionControl: cc,
+		RTT:               time.Duration(info.Rtt) * time.Microsecond,
+		RTTVar:            time.Duration(info.Rttvar) * time.Microsecond,
+		RTO:               time.Duration(info.Rto) * time.Microsecond,
+		SndMSS:            info.Snd_mss,
+		RcvMSS:            info.Rcv_mss,
+		SndCwnd:           info.Snd_cwnd,
+		SndSsthresh:       info.Snd_ssthresh,
+		Unacked:           info.Unacked,
+		Lost:              info.Lost,
+		Retransmits:       uint32(info.Retransmits),
+		TotalRetrans:      info.Total_retrans,
+	}, nil
+}
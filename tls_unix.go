@@ -0,0 +1,173 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux darwin netbsd freebsd openbsd dragonfly
+
+package gnet
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/panjf2000/gnet/internal/netpoll"
+)
+
+// errTLSWouldBlock is returned by the reads of tlsTransport when there is no more ciphertext, it is a temporary
+// net.Error so that the TLS layer keeps the partial records and can be read again later.
+var errTLSWouldBlock net.Error = tlsWouldBlockError{}
+
+type tlsWouldBlockError struct{}
+
+func (tlsWouldBlockError) Error() string   { return "no more data to read by TLS" }
+func (tlsWouldBlockError) Timeout() bool   { return true }
+func (tlsWouldBlockError) Temporary() bool { return true }
+
+// tlsTransport is the in-memory transport under the TLS layer of a connection, which is fed with the ciphertext
+// read by the event-loop and writes the ciphertext produced by the TLS layer to the connection.
+// During the handshake, which runs in its own goroutine, reads block until there is data and writes are handed
+// over to the event-loop, after that both of them are invoked within the event-loop without blocking.
+type tlsTransport struct {
+	c           *conn
+	mu          sync.Mutex
+	cond        *sync.Cond
+	in          []byte
+	handshaking bool
+	closed      bool
+}
+
+func newTLSTransport(c *conn) *tlsTransport {
+	t := &tlsTransport{c: c, handshaking: true}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// feed appends the ciphertext read from the connection.
+func (t *tlsTransport) feed(data []byte) {
+	t.mu.Lock()
+	t.in = append(t.in, data...)
+	t.cond.Signal()
+	t.mu.Unlock()
+}
+
+// handshakeDone makes the reads and writes non-blocking.
+func (t *tlsTransport) handshakeDone() {
+	t.mu.Lock()
+	t.handshaking = false
+	t.mu.Unlock()
+}
+
+func (t *tlsTransport) Read(b []byte) (n int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for len(t.in) == 0 {
+		if t.closed {
+			return 0, io.EOF
+		}
+		if !t.handshaking {
+			return 0, errTLSWouldBlock
+		}
+		t.cond.Wait()
+	}
+	n = copy(b, t.in)
+	if t.in = t.in[n:]; len(t.in) == 0 {
+		t.in = nil
+	}
+	return
+}
+
+func (t *tlsTransport) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	handshaking := t.handshaking
+	t.mu.Unlock()
+	if !handshaking {
+		t.c.writeRaw(b)
+		return len(b), nil
+	}
+	c, buf := t.c, append([]byte{}, b...)
+	err := c.loop.poller.Trigger(func() error {
+		if c.loop.connections[c.fd] == c {
+			c.writeRaw(buf)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close unblocks the pending reads of the handshake.
+func (t *tlsTransport) Close() error {
+	t.mu.Lock()
+	t.closed = true
+	t.cond.Broadcast()
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *tlsTransport) LocalAddr() net.Addr                { return t.c.localAddr }
+func (t *tlsTransport) RemoteAddr() net.Addr               { return t.c.remoteAddr }
+func (t *tlsTransport) SetDeadline(_ time.Time) error      { return nil }
+func (t *tlsTransport) SetReadDeadline(_ time.Time) error  { return nil }
+func (t *tlsTransport) SetWriteDeadline(_ time.Time) error { return nil }
+
+// loopHandshake performs the TLS handshake of the connection in its own goroutine, the connection is opened
+// once the handshake completes, or closed with the error of handshake.
+func (el *eventloop) loopHandshake(c *conn) error {
+	if c.remoteAddr == nil {
+		c.remoteAddr = netpoll.SockaddrToTCPOrUnixAddr(c.sa)
+	}
+	c.lastActive = time.Now()
+	transport := newTLSTransport(c)
+	tlsConn := tls.Server(transport, el.svr.opts.TLSConfig)
+	c.tlsTransport, c.tlsConn = transport, tlsConn
+	go func() {
+		err := tlsConn.Handshake()
+		transport.handshakeDone()
+		sniffErrorAndLog(el.svr.logger, el.poller.Trigger(func() error {
+			if el.connections[c.fd] != c {
+				return nil // closed during the handshake
+			}
+			if err != nil {
+				return el.loopCloseConn(c, err)
+			}
+			if err := el.loopOpen(c); err != nil || !c.opened {
+				return err
+			}
+			// Decrypt the data that arrived along with the end of handshake.
+			return el.loopReadTLS(c)
+		}))
+	}()
+	return nil
+}
+
+// loopReadTLS decrypts the ciphertext fed to the transport and reacts to the frames decoded from the plaintext.
+func (el *eventloop) loopReadTLS(c *conn) error {
+	if !c.opened {
+		return nil // still in handshake
+	}
+	buf := el.plaintext[:0]
+	for {
+		if len(buf) == cap(buf) {
+			buf = append(buf, make([]byte, len(buf)+0x1000)...)[:len(buf)]
+		}
+		n, err := c.tlsConn.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == errTLSWouldBlock {
+			break
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return el.loopCloseConn(c, err)
+		}
+	}
+	el.plaintext = buf
+	c.buffer = buf
+	return el.loopReact(c)
+}
@@ -0,0 +1,18 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build darwin netbsd freebsd openbsd dragonfly
+
+package gnet
+
+import (
+	"bytes"
+
+	"golang.org/x/sys/unix"
+)
+
+// writev concatenates the buffers and writes them to fd, for writev(2) is not wrapped by x/sys on these platforms.
+func writev(fd int, bufs [][]byte) (int, error) {
+	return ignoringEINTRIO(unix.Write, fd, bytes.Join(bufs, nil))
+}
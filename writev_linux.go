@@ -0,0 +1,25 @@
+// Copyright 2019 Andy Pan. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package gnet
+
+import "golang.org/x/sys/unix"
+
+// iovMax is the maximum number of buffers written by one writev(2).
+const iovMax = 1024
+
+// writev writes the buffers to fd by one writev(2), only the first iovMax buffers are written if there are more.
+func writev(fd int, bufs [][]byte) (int, error) {
+	if len(bufs) > iovMax {
+		bufs = bufs[:iovMax]
+	}
+	for {
+		n, err := unix.Writev(fd, bufs)
+		if err != unix.EINTR {
+			return n, err
+		}
+	}
+}